@@ -0,0 +1,129 @@
+package authtest
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Client sends HTTP requests; *http.Client and the middleware clients
+// implement it.
+type Client interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Verifier checks the signature of a request. Check implements it, so HMAC
+// and SigV4 checks can be passed to AssertSignedWith.
+type Verifier interface {
+	Verify(req *http.Request) error
+}
+
+// Verify runs the check.
+func (c Check) Verify(req *http.Request) error {
+	return c(req)
+}
+
+// Recorder is a client that captures the requests sent through it, at the
+// end of a middleware chain, so their auth can be asserted. Captured bodies
+// can be read again.
+type Recorder struct {
+	// Next sends the requests on; nil answers every request with an empty
+	// 200 OK.
+	Next Client
+
+	mu       sync.Mutex
+	requests []*http.Request
+}
+
+// Do captures req and sends it on.
+func (r *Recorder) Do(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+	captured := req.Clone(req.Context())
+	if body != nil {
+		captured.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	r.mu.Lock()
+	r.requests = append(r.requests, captured)
+	r.mu.Unlock()
+
+	if r.Next != nil {
+		return r.Next.Do(req)
+	}
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Body:       http.NoBody,
+		Request:    req,
+	}, nil
+}
+
+// Requests returns the captured requests in the order they were sent.
+func (r *Recorder) Requests() []*http.Request {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*http.Request(nil), r.requests...)
+}
+
+// Last returns the last captured request, failing t if there is none.
+func (r *Recorder) Last(t testing.TB) *http.Request {
+	t.Helper()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.requests) == 0 {
+		t.Fatal("authtest: no request captured")
+	}
+	return r.requests[len(r.requests)-1]
+}
+
+// AssertBasicAuth fails t unless req carries Basic credentials for user and
+// pass.
+func AssertBasicAuth(t testing.TB, req *http.Request, user, pass string) bool {
+	t.Helper()
+	return assert(t, req, Basic(user, pass))
+}
+
+// AssertBearer fails t unless req carries the Bearer token.
+func AssertBearer(t testing.TB, req *http.Request, token string) bool {
+	t.Helper()
+	return assert(t, req, Bearer(token))
+}
+
+// AssertSignedWith fails t unless key verifies the signature of req, such as
+// HMAC(header, secret) or SigV4(creds).
+func AssertSignedWith(t testing.TB, req *http.Request, key Verifier) bool {
+	t.Helper()
+	return assert(t, req, key)
+}
+
+// AssertNoAuth fails t if req carries any credentials, such as after a
+// redirect to another host.
+func AssertNoAuth(t testing.TB, req *http.Request) bool {
+	t.Helper()
+	if auth := req.Header.Get("Authorization"); auth != "" {
+		scheme, _, _ := strings.Cut(auth, " ")
+		t.Errorf("authtest: %s %s: unexpected %s authorization", req.Method, req.URL, scheme)
+		return false
+	}
+	return true
+}
+
+// assert fails t if v rejects req.
+func assert(t testing.TB, req *http.Request, v Verifier) bool {
+	t.Helper()
+	if err := v.Verify(req); err != nil {
+		t.Errorf("authtest: %s %s: %v", req.Method, req.URL, err)
+		return false
+	}
+	return true
+}
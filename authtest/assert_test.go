@@ -0,0 +1,121 @@
+package authtest_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/authtest"
+	"github.com/Vkanhan/go-auth-middleware-http-client/client"
+	"github.com/Vkanhan/go-auth-middleware-http-client/middleware"
+)
+
+// creds are the SigV4 credentials of the tests.
+var creds = authtest.SigV4Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret", Region: "eu-west-1", Service: "execute-api"}
+
+// sendThrough sends a POST with body through m to a new Recorder and returns
+// the captured request.
+func sendThrough(t *testing.T, m client.Middleware, url, body string) *http.Request {
+	t.Helper()
+	rec := &authtest.Recorder{}
+	req, _ := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	resp, err := m(rec).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return rec.Last(t)
+}
+
+func TestRecorder(t *testing.T) {
+	srv := authtest.NewServer(t, authtest.Basic("user", "pass"), authtest.Response{Status: http.StatusAccepted})
+	rec := &authtest.Recorder{Next: srv.Client()}
+	c := middleware.BasicAuthMiddleware("user", "pass")(rec)
+	for _, body := range []string{"one", "two"} {
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/items", strings.NewReader(body))
+		resp, err := c.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusAccepted {
+			t.Errorf("status = %d, want the server's 202", resp.StatusCode)
+		}
+	}
+
+	// The captured bodies are readable although the server read them too.
+	var bodies []string
+	for _, req := range rec.Requests() {
+		body, _ := io.ReadAll(req.Body)
+		bodies = append(bodies, string(body))
+	}
+	if got := fmt.Sprint(bodies); got != "[one two]" {
+		t.Errorf("bodies = %s, want [one two]", got)
+	}
+	authtest.AssertBasicAuth(t, rec.Last(t), "user", "pass")
+
+	rt := &recordingT{TB: t}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		(&authtest.Recorder{}).Last(rt)
+	}()
+	<-done
+	if got := fmt.Sprint(rt.Failures()); got != "[authtest: no request captured]" {
+		t.Errorf("failures = %s", got)
+	}
+}
+
+func TestAssertions(t *testing.T) {
+	clock := client.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	sigV4 := middleware.SigningMiddleware(&middleware.SigV4Signer{
+		AccessKeyID: creds.AccessKeyID, SecretAccessKey: creds.SecretAccessKey,
+		Region: creds.Region, Service: creds.Service, Clock: clock,
+	})
+	const url = "https://api.example.com/v1/items?b=2&a=1"
+	signed := sendThrough(t, sigV4, url, `{"id":1}`)
+	basic := sendThrough(t, middleware.BasicAuthMiddleware("user", "pass"), url, "")
+	bearer := sendThrough(t, middleware.APIKeyAuthMiddleware("token"), url, "")
+	none := sendThrough(t, func(next client.HTTPClient) client.HTTPClient { return next }, url, "")
+
+	tampered := signed.Clone(signed.Context())
+	tampered.URL.RawQuery = "b=2&a=2"
+	otherCreds := creds
+	otherCreds.SecretAccessKey = "other"
+	otherRegion := creds
+	otherRegion.Region = "us-east-1"
+
+	tests := []struct {
+		name    string
+		assert  func(t testing.TB) bool
+		failure string
+	}{
+		{"basic", func(t testing.TB) bool { return authtest.AssertBasicAuth(t, basic, "user", "pass") }, ""},
+		{"basic wrong", func(t testing.TB) bool { return authtest.AssertBasicAuth(t, basic, "user", "other") }, `authtest: POST ` + url + `: wrong basic credentials for user "user"`},
+		{"bearer", func(t testing.TB) bool { return authtest.AssertBearer(t, bearer, "token") }, ""},
+		{"bearer missing", func(t testing.TB) bool { return authtest.AssertBearer(t, basic, "token") }, "authtest: POST " + url + ": no bearer token"},
+		{"no auth", func(t testing.TB) bool { return authtest.AssertNoAuth(t, none) }, ""},
+		{"unexpected auth", func(t testing.TB) bool { return authtest.AssertNoAuth(t, bearer) }, "authtest: POST " + url + ": unexpected Bearer authorization"},
+		{"sigv4", func(t testing.TB) bool { return authtest.AssertSignedWith(t, signed, authtest.SigV4(creds)) }, ""},
+		{"sigv4 other secret", func(t testing.TB) bool { return authtest.AssertSignedWith(t, signed, authtest.SigV4(otherCreds)) }, "authtest: POST " + url + ": wrong SigV4 signature"},
+		{"sigv4 other region", func(t testing.TB) bool { return authtest.AssertSignedWith(t, signed, authtest.SigV4(otherRegion)) }, `authtest: POST ` + url + `: wrong credential scope "AKID/20240101/eu-west-1/execute-api/aws4_request"`},
+		{"sigv4 tampered", func(t testing.TB) bool { return authtest.AssertSignedWith(t, tampered, authtest.SigV4(creds)) }, "authtest: POST https://api.example.com/v1/items?b=2&a=2: wrong SigV4 signature"},
+		{"sigv4 unsigned", func(t testing.TB) bool { return authtest.AssertSignedWith(t, basic, authtest.SigV4(creds)) }, "authtest: POST " + url + ": no AWS4-HMAC-SHA256 authorization"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rt := &recordingT{TB: t}
+			ok := tt.assert(rt)
+			failures := rt.Failures()
+			if ok != (tt.failure == "") {
+				t.Errorf("assertion returned %v with failures %q", ok, failures)
+			}
+			if got := strings.Join(failures, "\n"); got != tt.failure {
+				t.Errorf("failures = %q, want %q", got, tt.failure)
+			}
+		})
+	}
+}
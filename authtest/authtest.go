@@ -0,0 +1,252 @@
+// Package authtest helps test authentication middleware end to end: httptest
+// servers that check the auth of every request they receive and answer with
+// scripted responses, and assertions on captured outgoing requests.
+package authtest
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/internal/signing"
+)
+
+// DefaultHMACHeader is the header HMAC checks read the signature from.
+const DefaultHMACHeader = "X-Signature"
+
+// Headers TimestampedHMAC reads, the defaults of middleware.HMACSigner.
+const (
+	DefaultTimestampHeader = "X-Timestamp"
+	DefaultBodyHashHeader  = "X-Content-SHA256"
+)
+
+// Check verifies the authentication of a request.
+type Check func(*http.Request) error
+
+// Basic requires Basic credentials for user and pass.
+func Basic(user, pass string) Check {
+	return func(req *http.Request) error {
+		gotUser, gotPass, ok := req.BasicAuth()
+		if !ok {
+			return errors.New("no basic credentials")
+		}
+		if !equal(gotUser, user) || !equal(gotPass, pass) {
+			return fmt.Errorf("wrong basic credentials for user %q", gotUser)
+		}
+		return nil
+	}
+}
+
+// Bearer requires the Bearer token.
+func Bearer(token string) Check {
+	return func(req *http.Request) error {
+		got, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			return errors.New("no bearer token")
+		}
+		if !equal(got, token) {
+			return errors.New("wrong bearer token")
+		}
+		return nil
+	}
+}
+
+// HMAC requires header, or DefaultHMACHeader if empty, to hold the
+// signature HMACSignature computes for the request with key. Requests
+// signed by middleware.HMACSigner are checked with TimestampedHMAC.
+func HMAC(header string, key []byte) Check {
+	if header == "" {
+		header = DefaultHMACHeader
+	}
+	return func(req *http.Request) error {
+		got := req.Header.Get(header)
+		if got == "" {
+			return fmt.Errorf("no %s header", header)
+		}
+
+		body, err := readBody(req)
+		if err != nil {
+			return err
+		}
+
+		want := HMACSignature(key, req.Method, req.URL.RequestURI(), body)
+		if !equal(got, want) {
+			return fmt.Errorf("wrong %s signature", header)
+		}
+		return nil
+	}
+}
+
+// readBody reads the body of req and puts it back for later readers.
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read body: %w", err)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// HMACSignature returns the hex HMAC-SHA256 with key of the method, the
+// request URI and the body, each separated by a newline.
+func HMACSignature(key []byte, method, requestURI string, body []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(method + "\n" + requestURI + "\n"))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// TimestampedHMAC requires the signature middleware.HMACSigner makes with
+// key in its default headers: DefaultHMACHeader holds the hex HMAC-SHA256
+// of the method, the request URI, the DefaultTimestampHeader value and the
+// DefaultBodyHashHeader value, which must be the hex SHA-256 of the body.
+func TimestampedHMAC(key []byte) Check {
+	return func(req *http.Request) error {
+		got := req.Header.Get(DefaultHMACHeader)
+		if got == "" {
+			return fmt.Errorf("no %s header", DefaultHMACHeader)
+		}
+		timestamp := req.Header.Get(DefaultTimestampHeader)
+		if timestamp == "" {
+			return fmt.Errorf("no %s header", DefaultTimestampHeader)
+		}
+
+		body, err := readBody(req)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(body)
+		payloadHash := hex.EncodeToString(sum[:])
+		if req.Header.Get(DefaultBodyHashHeader) != payloadHash {
+			return fmt.Errorf("%s does not match the body", DefaultBodyHashHeader)
+		}
+
+		want := signing.HMAC(key, req.Method, req.URL.RequestURI(), timestamp, payloadHash)
+		if !equal(got, want) {
+			return fmt.Errorf("wrong %s signature", DefaultHMACHeader)
+		}
+		return nil
+	}
+}
+
+// All requires every check to pass.
+func All(checks ...Check) Check {
+	return func(req *http.Request) error {
+		for _, check := range checks {
+			if err := check(req); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// equal compares secrets in constant time.
+func equal(got, want string) bool {
+	return subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
+
+// Response is a scripted response.
+type Response struct {
+	Status int
+	Header http.Header
+	Body   string
+}
+
+// Server is an httptest server that checks the authentication of every
+// request. Requests that fail the check fail the test and are answered with
+// 401 Unauthorized; the others get the scripted responses in order, the last
+// one repeating, or an empty 200 OK without a script.
+type Server struct {
+	*httptest.Server
+
+	t         testing.TB
+	check     Check
+	responses []Response
+
+	mu       sync.Mutex
+	requests int
+	rejected int
+}
+
+// NewServer starts a Server checking requests with check; a nil check
+// accepts any request. The server is closed when the test ends.
+func NewServer(t testing.TB, check Check, responses ...Response) *Server {
+	t.Helper()
+	s := &Server{t: t, check: check, responses: responses}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// NewTLSServer is like NewServer but serves HTTPS. Use its Client method to
+// trust the certificate.
+func NewTLSServer(t testing.TB, check Check, responses ...Response) *Server {
+	t.Helper()
+	s := &Server{t: t, check: check, responses: responses}
+	s.Server = httptest.NewTLSServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Requests returns the number of requests received.
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// Rejected returns the number of requests that failed the check.
+func (s *Server) Rejected() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rejected
+}
+
+// serve checks the request and writes the next scripted response.
+func (s *Server) serve(w http.ResponseWriter, req *http.Request) {
+	if s.check != nil {
+		if err := s.check(req); err != nil {
+			s.mu.Lock()
+			s.requests++
+			s.rejected++
+			s.mu.Unlock()
+			s.t.Errorf("authtest: %s %s: %v", req.Method, req.URL, err)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+	}
+
+	s.mu.Lock()
+	n := s.requests - s.rejected
+	s.requests++
+	s.mu.Unlock()
+
+	resp := Response{Status: http.StatusOK}
+	if len(s.responses) > 0 {
+		resp = s.responses[min(n, len(s.responses)-1)]
+	}
+	for name, values := range resp.Header {
+		w.Header()[name] = values
+	}
+	status := resp.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	io.WriteString(w, resp.Body)
+}
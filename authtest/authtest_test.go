@@ -0,0 +1,118 @@
+package authtest_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/authtest"
+	"github.com/Vkanhan/go-auth-middleware-http-client/middleware"
+)
+
+// signHMAC signs req as middleware.HMACSigner does, failing t on error.
+func signHMAC(t *testing.T, key []byte, req *http.Request, body string) {
+	t.Helper()
+	sum := sha256.Sum256([]byte(body))
+	if err := (&middleware.HMACSigner{Key: key}).Sign(req, hex.EncodeToString(sum[:])); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestChecks(t *testing.T) {
+	key := []byte("secret")
+	const body = `{"name":"gopher"}`
+	tests := []struct {
+		name    string
+		check   authtest.Check
+		prepare func(t *testing.T, req *http.Request)
+		err     string
+	}{
+		{"basic", authtest.Basic("user", "pass"), func(t *testing.T, req *http.Request) { req.SetBasicAuth("user", "pass") }, ""},
+		{"basic wrong password", authtest.Basic("user", "pass"), func(t *testing.T, req *http.Request) { req.SetBasicAuth("user", "nope") }, `wrong basic credentials for user "user"`},
+		{"basic missing", authtest.Basic("user", "pass"), func(t *testing.T, req *http.Request) {}, "no basic credentials"},
+		{"bearer", authtest.Bearer("token"), func(t *testing.T, req *http.Request) { req.Header.Set("Authorization", "Bearer token") }, ""},
+		{"bearer wrong", authtest.Bearer("token"), func(t *testing.T, req *http.Request) { req.Header.Set("Authorization", "Bearer other") }, "wrong bearer token"},
+		{"bearer other scheme", authtest.Bearer("token"), func(t *testing.T, req *http.Request) { req.SetBasicAuth("token", "") }, "no bearer token"},
+		{"hmac", authtest.HMAC("", key), func(t *testing.T, req *http.Request) {
+			req.Header.Set(authtest.DefaultHMACHeader, authtest.HMACSignature(key, http.MethodPost, "/v1/users?dry_run=1", []byte(body)))
+		}, ""},
+		{"hmac header", authtest.HMAC("X-Sig", key), func(t *testing.T, req *http.Request) {
+			req.Header.Set("X-Sig", authtest.HMACSignature(key, http.MethodPost, "/v1/users?dry_run=1", []byte(body)))
+		}, ""},
+		{"hmac other body", authtest.HMAC("", key), func(t *testing.T, req *http.Request) {
+			req.Header.Set(authtest.DefaultHMACHeader, authtest.HMACSignature(key, http.MethodPost, "/v1/users?dry_run=1", []byte("{}")))
+		}, "wrong X-Signature signature"},
+		{"hmac missing", authtest.HMAC("", key), func(t *testing.T, req *http.Request) {}, "no X-Signature header"},
+		{"timestamped hmac", authtest.TimestampedHMAC(key), func(t *testing.T, req *http.Request) { signHMAC(t, key, req, body) }, ""},
+		{"timestamped hmac other key", authtest.TimestampedHMAC(key), func(t *testing.T, req *http.Request) { signHMAC(t, []byte("other"), req, body) }, "wrong X-Signature signature"},
+		{"timestamped hmac other body", authtest.TimestampedHMAC(key), func(t *testing.T, req *http.Request) { signHMAC(t, key, req, "{}") }, "X-Content-SHA256 does not match the body"},
+		{"timestamped hmac changed timestamp", authtest.TimestampedHMAC(key), func(t *testing.T, req *http.Request) {
+			signHMAC(t, key, req, body)
+			req.Header.Set(authtest.DefaultTimestampHeader, "0")
+		}, "wrong X-Signature signature"},
+		{"timestamped hmac missing timestamp", authtest.TimestampedHMAC(key), func(t *testing.T, req *http.Request) {
+			signHMAC(t, key, req, body)
+			req.Header.Del(authtest.DefaultTimestampHeader)
+		}, "no X-Timestamp header"},
+		{"all", authtest.All(authtest.Bearer("token"), authtest.HMAC("", key)), func(t *testing.T, req *http.Request) { req.Header.Set("Authorization", "Bearer token") }, "no X-Signature header"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, "https://api.example.com/v1/users?dry_run=1", strings.NewReader(body))
+			tt.prepare(t, req)
+			err := tt.check(req)
+			if got := fmt.Sprint(err); tt.err == "" && err != nil || tt.err != "" && got != tt.err {
+				t.Errorf("err = %v, want %q", err, tt.err)
+			}
+			// The check leaves the body for the handler.
+			if got, _ := io.ReadAll(req.Body); string(got) != body {
+				t.Errorf("body after the check = %q, want %q", got, body)
+			}
+		})
+	}
+}
+
+func TestServer(t *testing.T) {
+	rt := &recordingT{TB: t}
+	srv := authtest.NewServer(rt, authtest.Bearer("token"),
+		authtest.Response{Status: http.StatusCreated, Body: "first"},
+		authtest.Response{Header: http.Header{"X-Step": {"2"}}, Body: "second"},
+	)
+	var outcomes []string
+	for _, token := range []string{"token", "wrong", "token", "token"} {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/users", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		outcomes = append(outcomes, fmt.Sprintf("%d %s %s", resp.StatusCode, resp.Header.Get("X-Step"), strings.TrimSpace(string(body))))
+	}
+	if got, want := fmt.Sprint(outcomes), "[201  first 401  wrong bearer token 200 2 second 200 2 second]"; got != want {
+		t.Errorf("outcomes = %s, want %s", got, want)
+	}
+	if srv.Requests() != 4 || srv.Rejected() != 1 {
+		t.Errorf("requests = %d, rejected = %d; want 4 and 1", srv.Requests(), srv.Rejected())
+	}
+	if got, want := fmt.Sprint(rt.Failures()), "[authtest: GET /users: wrong bearer token]"; got != want {
+		t.Errorf("failures = %s, want %s", got, want)
+	}
+}
+
+func TestTLSServer(t *testing.T) {
+	srv := authtest.NewTLSServer(t, nil)
+	resp, err := srv.Client().Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || srv.Requests() != 1 {
+		t.Errorf("status = %d, requests = %d; want 200 and 1", resp.StatusCode, srv.Requests())
+	}
+}
@@ -0,0 +1,134 @@
+package authtest
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Palettes the request generator picks from, biased toward inputs that trip
+// up canonicalization.
+var (
+	fuzzMethods  = []string{"GET", "POST", "PUT", "DELETE", "PATCH", "HEAD", "OPTIONS"}
+	fuzzSegments = []string{"", "a", "users", "ü", "雪", "a b", "a+b", "%2F", "~x", "..", ".", "*", "a=b", "😀", "%"}
+	fuzzKeys     = []string{"a", "A", "x-y", "ü", "k k", "", "a", "list[]"}
+	fuzzValues   = []string{"", "1", "a b", "a+b", "=", "&", "ü", "  spaced  ", "😀", "%zz"}
+	fuzzHeaders  = []string{"X-Custom", "x-custom", "Content-Type", "X-Amz-Meta-Ü", "X-Empty", "Accept"}
+	fuzzBodies   = []string{"", "{}", "a", "\x00\xff", "ü😀", strings.Repeat("x", 4096)}
+)
+
+// fuzzReader turns fuzz input into choices, returning zeros once exhausted.
+type fuzzReader struct {
+	data []byte
+}
+
+// next returns a number in [0, n).
+func (r *fuzzReader) next(n int) int {
+	if len(r.data) == 0 {
+		return 0
+	}
+	b := r.data[0]
+	r.data = r.data[1:]
+	return int(b) % n
+}
+
+// pick returns one of choices.
+func (r *fuzzReader) pick(choices []string) string {
+	return choices[r.next(len(choices))]
+}
+
+// GenerateRequest deterministically builds a request from fuzz input: its
+// method, a path of unusual segments, repeated query parameters, repeated
+// and oddly spaced headers, and an empty, missing or binary body.
+func GenerateRequest(data []byte) *http.Request {
+	r := &fuzzReader{data: data}
+	method := r.pick(fuzzMethods)
+
+	segments := make([]string, r.next(4))
+	for i := range segments {
+		segments[i] = r.pick(fuzzSegments)
+	}
+	u := &url.URL{Scheme: "https", Host: "example.com", Path: "/" + strings.Join(segments, "/")}
+
+	query := make([]string, r.next(5))
+	for i := range query {
+		query[i] = url.QueryEscape(r.pick(fuzzKeys)) + "=" + url.QueryEscape(r.pick(fuzzValues))
+	}
+	u.RawQuery = strings.Join(query, "&")
+
+	var body io.Reader
+	hasBody := r.next(3)
+	content := r.pick(fuzzBodies)
+	if hasBody > 0 {
+		body = strings.NewReader(content)
+	}
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		// The URL was built escaped, so it always parses back.
+		panic(err)
+	}
+
+	for range r.next(5) {
+		req.Header.Add(r.pick(fuzzHeaders), r.pick(fuzzValues))
+	}
+	return req
+}
+
+// AddFuzzSeeds adds to f a seed corpus spanning the generator palettes.
+func AddFuzzSeeds(f *testing.F) {
+	f.Add([]byte{})
+	for i := range 16 {
+		f.Add(bytes.Repeat([]byte{byte(i)}, 24))
+	}
+	f.Add([]byte{1, 3, 3, 4, 5, 4, 1, 2, 2, 7, 1, 5, 4, 0, 4, 0, 5, 1, 5, 2, 8})
+}
+
+// SigningTarget returns a fuzz function checking that the signer wrapping
+// next produces requests v verifies, for all generated requests:
+//
+//	f.Fuzz(authtest.SigningTarget(func(next authtest.Client) authtest.Client {
+//		return signer(next)
+//	}, authtest.TimestampedHMAC(key)))
+//
+// Signers may refuse a request with an error; panics and signatures that do
+// not verify fail the test.
+func SigningTarget(wrap func(next Client) Client, v Verifier) func(*testing.T, []byte) {
+	return func(t *testing.T, data []byte) {
+		req := GenerateRequest(data)
+		rec := &Recorder{}
+		resp, err := wrap(rec).Do(req)
+		if err != nil {
+			return
+		}
+		resp.Body.Close()
+
+		for _, sent := range rec.Requests() {
+			if err := v.Verify(sent); err != nil {
+				t.Errorf("%s %s with headers %v: %v", sent.Method, sent.URL, sent.Header, err)
+			}
+		}
+	}
+}
+
+// CanonicalTarget returns a fuzz function checking that canonical, such as
+// a wrapper of SigV4CanonicalRequest, is deterministic and leaves the
+// request untouched.
+func CanonicalTarget(canonical func(*http.Request) string) func(*testing.T, []byte) {
+	return func(t *testing.T, data []byte) {
+		req := GenerateRequest(data)
+		header := req.Header.Clone()
+		rawURL := req.URL.String()
+
+		first := canonical(req)
+		if second := canonical(req); first != second {
+			t.Errorf("%s %s: canonical form changed between calls:\n%s\n---\n%s", req.Method, rawURL, first, second)
+		}
+		if !reflect.DeepEqual(req.Header, header) || req.URL.String() != rawURL {
+			t.Errorf("%s %s: canonicalization modified the request", req.Method, rawURL)
+		}
+	}
+}
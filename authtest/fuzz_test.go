@@ -0,0 +1,161 @@
+package authtest_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/authtest"
+)
+
+// readAll returns the body of req, or "<nil>" when it has none.
+func readAll(t *testing.T, req *http.Request) string {
+	t.Helper()
+	if req.Body == nil {
+		return "<nil>"
+	}
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestGenerateRequest(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   []byte
+		method string
+		url    string
+		header http.Header
+		body   string
+	}{
+		{"empty input", nil, "GET", "https://example.com/", http.Header{}, "<nil>"},
+		{"choices wrap", []byte{8}, "POST", "https://example.com/", http.Header{}, "<nil>"},
+		{"unicode path", []byte{0, 2, 13, 3}, "GET", "https://example.com/%F0%9F%98%80/%C3%BC", http.Header{}, "<nil>"},
+		{"percent segment", []byte{0, 1, 14}, "GET", "https://example.com/%25", http.Header{}, "<nil>"},
+		{
+			"query and headers",
+			[]byte{1, 1, 2, 2, 0, 1, 0, 2, 1, 0, 4, 0, 1, 1, 2, 0, 7, 2, 1},
+			"POST", "https://example.com/users?a=1&a=a+b",
+			http.Header{"X-Custom": {"1", "a b", "  spaced  "}, "Content-Type": {"1"}},
+			"",
+		},
+		{"binary body", []byte{1, 0, 0, 2, 3, 0}, "POST", "https://example.com/", http.Header{}, "\x00\xff"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := authtest.GenerateRequest(tt.data)
+			if req.Method != tt.method || req.URL.String() != tt.url {
+				t.Errorf("request = %s %s, want %s %s", req.Method, req.URL, tt.method, tt.url)
+			}
+			if !reflect.DeepEqual(req.Header, tt.header) {
+				t.Errorf("header = %v, want %v", req.Header, tt.header)
+			}
+			if body := readAll(t, req); body != tt.body {
+				t.Errorf("body = %q, want %q", body, tt.body)
+			}
+		})
+	}
+}
+
+func FuzzGenerateRequest(f *testing.F) {
+	authtest.AddFuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		first, second := authtest.GenerateRequest(data), authtest.GenerateRequest(data)
+		if first.Method != second.Method || first.URL.String() != second.URL.String() {
+			t.Errorf("requests differ: %s %s and %s %s", first.Method, first.URL, second.Method, second.URL)
+		}
+		if !reflect.DeepEqual(first.Header, second.Header) {
+			t.Errorf("headers differ: %v and %v", first.Header, second.Header)
+		}
+		if a, b := readAll(t, first), readAll(t, second); a != b {
+			t.Errorf("bodies differ: %q and %q", a, b)
+		}
+	})
+}
+
+// clientFunc is an authtest.Client backed by a function.
+type clientFunc func(req *http.Request) (*http.Response, error)
+
+// Do calls fn.
+func (fn clientFunc) Do(req *http.Request) (*http.Response, error) {
+	return fn(req)
+}
+
+func TestSigningTarget(t *testing.T) {
+	data := []byte{1, 1, 2, 2, 0, 1, 0, 2, 1, 0, 4, 0, 1, 1, 2, 0, 7, 2, 1}
+	tests := []struct {
+		name     string
+		wrap     func(next authtest.Client) authtest.Client
+		verified int
+	}{
+		{
+			"signed once",
+			func(next authtest.Client) authtest.Client {
+				return clientFunc(func(req *http.Request) (*http.Response, error) {
+					req.Header.Set("X-Signature", "signed")
+					return next.Do(req)
+				})
+			},
+			1,
+		},
+		{
+			"every attempt verified",
+			func(next authtest.Client) authtest.Client {
+				return clientFunc(func(req *http.Request) (*http.Response, error) {
+					req.Header.Set("X-Signature", "signed")
+					resp, err := next.Do(req)
+					if err != nil {
+						return nil, err
+					}
+					resp.Body.Close()
+					return next.Do(req)
+				})
+			},
+			2,
+		},
+		{
+			"refused",
+			func(next authtest.Client) authtest.Client {
+				return clientFunc(func(req *http.Request) (*http.Response, error) {
+					return nil, errors.New("unsupported request")
+				})
+			},
+			0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var verified int
+			check := authtest.Check(func(req *http.Request) error {
+				verified++
+				if req.Header.Get("X-Signature") != "signed" {
+					t.Errorf("verified an unsigned request: %v", req.Header)
+				}
+				return nil
+			})
+			authtest.SigningTarget(tt.wrap, check)(t, data)
+			if verified != tt.verified {
+				t.Errorf("verified %d requests, want %d", verified, tt.verified)
+			}
+		})
+	}
+}
+
+func TestCanonicalTarget(t *testing.T) {
+	var seen []*http.Request
+	canonical := func(req *http.Request) string {
+		seen = append(seen, req)
+		return req.Method + " " + req.URL.String()
+	}
+	authtest.CanonicalTarget(canonical)(t, []byte{1, 2, 13, 3, 2, 0, 1, 0, 2})
+	if len(seen) != 2 || seen[0] != seen[1] {
+		t.Fatalf("canonical called with %v, want the same request twice", seen)
+	}
+	if got := seen[0].Method + " " + seen[0].URL.String(); got != "POST https://example.com/%F0%9F%98%80/%C3%BC?a=1&a=a+b" {
+		t.Errorf("canonicalized %s", got)
+	}
+}
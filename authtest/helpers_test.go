@@ -0,0 +1,46 @@
+package authtest_test
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+// recordingT is a testing.TB that records failures instead of reporting
+// them, to test the helpers that fail tests. Other calls, such as Cleanup,
+// go to the embedded test.
+type recordingT struct {
+	testing.TB
+	mu       sync.Mutex
+	failures []string
+}
+
+// Helper does nothing.
+func (r *recordingT) Helper() {}
+
+// Errorf records a failure.
+func (r *recordingT) Errorf(format string, args ...any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
+
+// Fatal records a failure and stops the calling goroutine.
+func (r *recordingT) Fatal(args ...any) {
+	r.Errorf("%s", fmt.Sprint(args...))
+	runtime.Goexit()
+}
+
+// Fatalf records a failure and stops the calling goroutine.
+func (r *recordingT) Fatalf(format string, args ...any) {
+	r.Errorf(format, args...)
+	runtime.Goexit()
+}
+
+// Failures returns the failures recorded so far.
+func (r *recordingT) Failures() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.failures...)
+}
@@ -0,0 +1,351 @@
+package authtest
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Grant types understood by TokenServer.
+const (
+	GrantClientCredentials = "client_credentials"
+	GrantRefreshToken      = "refresh_token"
+	GrantDeviceCode        = "urn:ietf:params:oauth:grant-type:device_code"
+)
+
+// TokenFailure is a scripted OAuth2 error response.
+type TokenFailure struct {
+	// Status defaults to 400 Bad Request.
+	Status int
+	// Error is the OAuth2 error code, such as "invalid_client" or
+	// "slow_down"; it defaults to "server_error".
+	Error       string
+	Description string
+}
+
+// TokenServer is a stub OAuth2 authorization server serving the client
+// credentials, refresh token and device authorization grants. Its fields
+// must be set before the first request.
+type TokenServer struct {
+	*httptest.Server
+
+	// ClientID and ClientSecret are the accepted client credentials, sent
+	// either with Basic auth or in the form. An empty ClientSecret accepts
+	// public clients.
+	ClientID, ClientSecret string
+	// ExpiresIn is the lifetime of access tokens; zero means one hour.
+	ExpiresIn time.Duration
+	// DeviceCodeExpiresIn is the lifetime of device codes; zero means ten
+	// minutes.
+	DeviceCodeExpiresIn time.Duration
+	// PollInterval is the device flow polling interval sent to clients,
+	// rounded up to whole seconds; zero means one second.
+	PollInterval time.Duration
+	// Now returns the time tokens expire by; nil uses time.Now. A fake
+	// clock's Now method makes expiry deterministic.
+	Now func() time.Time
+
+	mu       sync.Mutex
+	access   map[string]time.Time
+	refresh  map[string]bool
+	devices  map[string]*deviceAuth
+	failures []TokenFailure
+	issued   map[string]int
+}
+
+// deviceAuth is a pending device authorization.
+type deviceAuth struct {
+	userCode string
+	expires  time.Time
+	approved bool
+	denied   bool
+}
+
+// NewTokenServer starts a TokenServer accepting clientID and clientSecret.
+// The server is closed when the test ends.
+func NewTokenServer(t testing.TB, clientID, clientSecret string) *TokenServer {
+	t.Helper()
+	s := &TokenServer{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		access:       make(map[string]time.Time),
+		refresh:      make(map[string]bool),
+		devices:      make(map[string]*deviceAuth),
+		issued:       make(map[string]int),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", s.serveToken)
+	mux.HandleFunc("/device", s.serveDevice)
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+// TokenURL returns the URL of the token endpoint.
+func (s *TokenServer) TokenURL() string {
+	return s.URL + "/token"
+}
+
+// DeviceAuthURL returns the URL of the device authorization endpoint.
+func (s *TokenServer) DeviceAuthURL() string {
+	return s.URL + "/device"
+}
+
+// FailNext makes the next token requests fail, one failure per request.
+func (s *TokenServer) FailNext(failures ...TokenFailure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, failures...)
+}
+
+// Approve approves the device authorization with userCode, so the next poll
+// gets a token.
+func (s *TokenServer) Approve(userCode string) bool {
+	return s.decide(userCode, true)
+}
+
+// Deny denies the device authorization with userCode, so the next poll
+// fails with access_denied.
+func (s *TokenServer) Deny(userCode string) bool {
+	return s.decide(userCode, false)
+}
+
+// decide approves or denies a device authorization.
+func (s *TokenServer) decide(userCode string, approve bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, d := range s.devices {
+		if d.userCode == userCode {
+			d.approved, d.denied = approve, !approve
+			return true
+		}
+	}
+	return false
+}
+
+// Revoke invalidates an access or refresh token.
+func (s *TokenServer) Revoke(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.access, token)
+	delete(s.refresh, token)
+}
+
+// ExpireAll makes every access token issued so far expire now; refresh
+// tokens stay valid.
+func (s *TokenServer) ExpireAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	for token := range s.access {
+		s.access[token] = now
+	}
+}
+
+// Issued returns the number of access tokens issued for grantType, or for
+// every grant type if empty.
+func (s *TokenServer) Issued(grantType string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if grantType != "" {
+		return s.issued[grantType]
+	}
+	total := 0
+	for _, n := range s.issued {
+		total += n
+	}
+	return total
+}
+
+// Check returns a Check accepting the unexpired, unrevoked access tokens the
+// server issued, to protect an authtest Server with.
+func (s *TokenServer) Check() Check {
+	return func(req *http.Request) error {
+		token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			return errors.New("no bearer token")
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		expires, ok := s.access[token]
+		if !ok {
+			return errors.New("unknown bearer token")
+		}
+		if !s.now().Before(expires) {
+			return errors.New("expired bearer token")
+		}
+		return nil
+	}
+}
+
+// now returns the current time of the server.
+func (s *TokenServer) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
+
+// serveToken serves the token endpoint.
+func (s *TokenServer) serveToken(w http.ResponseWriter, req *http.Request) {
+	if !s.authenticate(w, req) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.failures) > 0 {
+		f := s.failures[0]
+		s.failures = s.failures[1:]
+		if f.Status == 0 {
+			f.Status = http.StatusBadRequest
+		}
+		if f.Error == "" {
+			f.Error = "server_error"
+		}
+		writeOAuthError(w, f)
+		return
+	}
+
+	grantType := req.PostFormValue("grant_type")
+	switch grantType {
+	case GrantClientCredentials:
+	case GrantRefreshToken:
+		token := req.PostFormValue("refresh_token")
+		if !s.refresh[token] {
+			writeOAuthError(w, TokenFailure{Error: "invalid_grant", Description: "unknown refresh token"})
+			return
+		}
+		// Refresh tokens are rotated on use.
+		delete(s.refresh, token)
+	case GrantDeviceCode:
+		d, ok := s.devices[req.PostFormValue("device_code")]
+		switch {
+		case !ok:
+			writeOAuthError(w, TokenFailure{Error: "invalid_grant", Description: "unknown device code"})
+			return
+		case !s.now().Before(d.expires):
+			writeOAuthError(w, TokenFailure{Error: "expired_token"})
+			return
+		case d.denied:
+			writeOAuthError(w, TokenFailure{Error: "access_denied"})
+			return
+		case !d.approved:
+			writeOAuthError(w, TokenFailure{Error: "authorization_pending"})
+			return
+		}
+		delete(s.devices, req.PostFormValue("device_code"))
+	default:
+		writeOAuthError(w, TokenFailure{Error: "unsupported_grant_type"})
+		return
+	}
+
+	expiresIn := s.ExpiresIn
+	if expiresIn <= 0 {
+		expiresIn = time.Hour
+	}
+	access, refresh := rand.Text(), rand.Text()
+	s.access[access] = s.now().Add(expiresIn)
+	s.refresh[refresh] = true
+	s.issued[grantType]++
+
+	body := map[string]any{
+		"access_token":  access,
+		"token_type":    "Bearer",
+		"expires_in":    int(expiresIn.Seconds()),
+		"refresh_token": refresh,
+	}
+	if scope := req.PostFormValue("scope"); scope != "" {
+		body["scope"] = scope
+	}
+	writeJSON(w, http.StatusOK, body)
+}
+
+// serveDevice serves the device authorization endpoint.
+func (s *TokenServer) serveDevice(w http.ResponseWriter, req *http.Request) {
+	if !s.authenticate(w, req) {
+		return
+	}
+
+	expiresIn := s.DeviceCodeExpiresIn
+	if expiresIn <= 0 {
+		expiresIn = 10 * time.Minute
+	}
+	interval := s.PollInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	s.mu.Lock()
+	deviceCode := rand.Text()
+	userCode := rand.Text()[:8]
+	s.devices[deviceCode] = &deviceAuth{userCode: userCode, expires: s.now().Add(expiresIn)}
+	s.mu.Unlock()
+
+	verification := s.URL + "/activate"
+	writeJSON(w, http.StatusOK, map[string]any{
+		"device_code":               deviceCode,
+		"user_code":                 userCode,
+		"verification_uri":          verification,
+		"verification_uri_complete": verification + "?user_code=" + userCode,
+		"expires_in":                int(expiresIn.Seconds()),
+		"interval":                  int((interval + time.Second - 1) / time.Second),
+	})
+}
+
+// authenticate checks that req is a POST with valid client credentials,
+// answering with an error otherwise.
+func (s *TokenServer) authenticate(w http.ResponseWriter, req *http.Request) bool {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+
+	id, secret, ok := req.BasicAuth()
+	if ok {
+		// RFC 6749 section 2.3.1 form-encodes the credentials first.
+		if unescaped, err := url.QueryUnescape(id); err == nil {
+			id = unescaped
+		}
+		if unescaped, err := url.QueryUnescape(secret); err == nil {
+			secret = unescaped
+		}
+	} else {
+		id, secret = req.PostFormValue("client_id"), req.PostFormValue("client_secret")
+	}
+	if equal(id, s.ClientID) && (s.ClientSecret == "" || equal(secret, s.ClientSecret)) {
+		return true
+	}
+	writeOAuthError(w, TokenFailure{Status: http.StatusUnauthorized, Error: "invalid_client"})
+	return false
+}
+
+// writeOAuthError writes an RFC 6749 error response.
+func writeOAuthError(w http.ResponseWriter, f TokenFailure) {
+	status := f.Status
+	if status == 0 {
+		status = http.StatusBadRequest
+	}
+	body := map[string]string{"error": f.Error}
+	if f.Description != "" {
+		body["error_description"] = f.Description
+	}
+	writeJSON(w, status, body)
+}
+
+// writeJSON writes body as a JSON response.
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,226 @@
+package authtest_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/authtest"
+)
+
+// postForm posts form to u, with the client credentials in Basic auth when
+// basic is set, and returns the status and decoded JSON body.
+func postForm(t *testing.T, u string, form url.Values, basic bool) (int, map[string]any) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, u, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if basic {
+		req.SetBasicAuth("client", "s3cret")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var body map[string]any
+	json.NewDecoder(resp.Body).Decode(&body)
+	return resp.StatusCode, body
+}
+
+// clientForm returns a form with the client credentials and values as
+// name, value pairs.
+func clientForm(values ...string) url.Values {
+	form := url.Values{"client_id": {"client"}, "client_secret": {"s3cret"}}
+	for i := 0; i < len(values); i += 2 {
+		form.Set(values[i], values[i+1])
+	}
+	return form
+}
+
+// oauthError describes an error response as "<status> <error>".
+func oauthError(status int, body map[string]any) string {
+	return fmt.Sprintf("%d %v", status, body["error"])
+}
+
+func TestTokenServerClientCredentials(t *testing.T) {
+	s := authtest.NewTokenServer(t, "client", "s3cret")
+
+	status, body := postForm(t, s.TokenURL(), clientForm("grant_type", authtest.GrantClientCredentials, "scope", "read"), false)
+	if status != 200 || body["token_type"] != "Bearer" || body["expires_in"] != 3600.0 || body["scope"] != "read" {
+		t.Errorf("form credentials: %d %v", status, body)
+	}
+	if status, body := postForm(t, s.TokenURL(), url.Values{"grant_type": {authtest.GrantClientCredentials}}, true); status != 200 || body["access_token"] == nil {
+		t.Errorf("basic credentials: %d %v", status, body)
+	}
+
+	tests := []struct {
+		name string
+		form url.Values
+		want string
+	}{
+		{"wrong secret", url.Values{"grant_type": {authtest.GrantClientCredentials}, "client_id": {"client"}, "client_secret": {"nope"}}, "401 invalid_client"},
+		{"no credentials", url.Values{"grant_type": {authtest.GrantClientCredentials}}, "401 invalid_client"},
+		{"unknown grant", clientForm("grant_type", "password"), "400 unsupported_grant_type"},
+		{"unknown refresh token", clientForm("grant_type", authtest.GrantRefreshToken, "refresh_token", "nope"), "400 invalid_grant"},
+	}
+	for _, tt := range tests {
+		if got := oauthError(postForm(t, s.TokenURL(), tt.form, false)); got != tt.want {
+			t.Errorf("%s: %s, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	resp, err := http.Get(s.TokenURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET: status = %d, want 405", resp.StatusCode)
+	}
+	if s.Issued(authtest.GrantClientCredentials) != 2 || s.Issued("") != 2 {
+		t.Errorf("issued = %d, want 2", s.Issued(""))
+	}
+}
+
+func TestTokenServerPublicClient(t *testing.T) {
+	s := authtest.NewTokenServer(t, "public", "")
+	form := url.Values{"grant_type": {authtest.GrantClientCredentials}, "client_id": {"public"}}
+	if status, body := postForm(t, s.TokenURL(), form, false); status != 200 {
+		t.Errorf("public client: %d %v", status, body)
+	}
+}
+
+func TestTokenServerRefresh(t *testing.T) {
+	s := authtest.NewTokenServer(t, "client", "s3cret")
+	_, body := postForm(t, s.TokenURL(), clientForm("grant_type", authtest.GrantClientCredentials), false)
+	refresh := body["refresh_token"].(string)
+
+	status, body := postForm(t, s.TokenURL(), clientForm("grant_type", authtest.GrantRefreshToken, "refresh_token", refresh), false)
+	if status != 200 || body["refresh_token"] == refresh {
+		t.Errorf("refresh: %d %v, want a new refresh token", status, body)
+	}
+	// Refresh tokens are rotated, so the old one no longer works.
+	if got := oauthError(postForm(t, s.TokenURL(), clientForm("grant_type", authtest.GrantRefreshToken, "refresh_token", refresh), false)); got != "400 invalid_grant" {
+		t.Errorf("reused refresh token: %s, want 400 invalid_grant", got)
+	}
+
+	rotated := body["refresh_token"].(string)
+	s.Revoke(rotated)
+	if got := oauthError(postForm(t, s.TokenURL(), clientForm("grant_type", authtest.GrantRefreshToken, "refresh_token", rotated), false)); got != "400 invalid_grant" {
+		t.Errorf("revoked refresh token: %s, want 400 invalid_grant", got)
+	}
+	if s.Issued(authtest.GrantRefreshToken) != 1 {
+		t.Errorf("refresh grants issued = %d, want 1", s.Issued(authtest.GrantRefreshToken))
+	}
+}
+
+func TestTokenServerFailNext(t *testing.T) {
+	s := authtest.NewTokenServer(t, "client", "s3cret")
+	s.FailNext(authtest.TokenFailure{}, authtest.TokenFailure{Status: http.StatusTooManyRequests, Error: "slow_down", Description: "wait"})
+	form := clientForm("grant_type", authtest.GrantClientCredentials)
+
+	var got []string
+	for range 3 {
+		got = append(got, oauthError(postForm(t, s.TokenURL(), form, false)))
+	}
+	if fmt.Sprint(got) != "[400 server_error 429 slow_down 200 <nil>]" {
+		t.Errorf("responses = %v", got)
+	}
+}
+
+func TestTokenServerDeviceFlow(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := authtest.NewTokenServer(t, "client", "s3cret")
+	s.Now = func() time.Time { return now }
+	s.PollInterval = 1500 * time.Millisecond
+
+	authorize := func() (deviceCode, userCode string) {
+		t.Helper()
+		status, body := postForm(t, s.DeviceAuthURL(), clientForm("scope", "read"), false)
+		if status != 200 || body["interval"] != 2.0 || body["expires_in"] != 600.0 {
+			t.Fatalf("device authorization: %d %v", status, body)
+		}
+		userCode = body["user_code"].(string)
+		if body["verification_uri_complete"] != s.URL+"/activate?user_code="+userCode {
+			t.Errorf("verification_uri_complete = %v", body["verification_uri_complete"])
+		}
+		return body["device_code"].(string), userCode
+	}
+	poll := func(deviceCode string) string {
+		t.Helper()
+		return oauthError(postForm(t, s.TokenURL(), clientForm("grant_type", authtest.GrantDeviceCode, "device_code", deviceCode), false))
+	}
+
+	approved, userCode := authorize()
+	if got := poll(approved); got != "400 authorization_pending" {
+		t.Errorf("before approval: %s", got)
+	}
+	if !s.Approve(userCode) || s.Approve("unknown") {
+		t.Error("Approve did not find the user code, or found an unknown one")
+	}
+	if got := poll(approved); got != "200 <nil>" {
+		t.Errorf("after approval: %s", got)
+	}
+	if got := poll(approved); got != "400 invalid_grant" {
+		t.Errorf("used device code: %s", got)
+	}
+
+	denied, userCode := authorize()
+	s.Deny(userCode)
+	if got := poll(denied); got != "400 access_denied" {
+		t.Errorf("denied: %s", got)
+	}
+
+	expired, userCode := authorize()
+	s.Approve(userCode)
+	now = now.Add(10 * time.Minute)
+	if got := poll(expired); got != "400 expired_token" {
+		t.Errorf("expired: %s", got)
+	}
+	if s.Issued(authtest.GrantDeviceCode) != 1 {
+		t.Errorf("device grants issued = %d, want 1", s.Issued(authtest.GrantDeviceCode))
+	}
+}
+
+func TestTokenServerCheck(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := authtest.NewTokenServer(t, "client", "s3cret")
+	s.Now = func() time.Time { return now }
+	s.ExpiresIn = time.Minute
+	token := func() string {
+		_, body := postForm(t, s.TokenURL(), clientForm("grant_type", authtest.GrantClientCredentials), false)
+		return body["access_token"].(string)
+	}
+	check := func(token string) string {
+		req, _ := http.NewRequest(http.MethodGet, "https://api.example.com/", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		return fmt.Sprint(s.Check()(req))
+	}
+
+	first, second := token(), token()
+	if got := check(first); got != "<nil>" {
+		t.Errorf("issued token: %s", got)
+	}
+	s.Revoke(second)
+	if got := check(second); got != "unknown bearer token" {
+		t.Errorf("revoked token: %s", got)
+	}
+	now = now.Add(time.Minute)
+	if got := check(first); got != "expired bearer token" {
+		t.Errorf("after ExpiresIn: %s", got)
+	}
+	third := token()
+	s.ExpireAll()
+	if got := check(third); got != "expired bearer token" {
+		t.Errorf("after ExpireAll: %s", got)
+	}
+	if got := check(""); got != "no bearer token" {
+		t.Errorf("no token: %s", got)
+	}
+}
@@ -0,0 +1,168 @@
+package authtest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// maskedValue replaces masked header values in snapshots.
+const maskedValue = "[MASKED]"
+
+// Snapshots compares outgoing requests with snapshot files, to make changes
+// in what the middleware sends obvious in review.
+type Snapshots struct {
+	// Dir is the directory holding the snapshots, usually testdata.
+	Dir string
+	// Update rewrites the snapshots with the current requests instead of
+	// comparing them. Tests typically set it from an -update flag.
+	Update bool
+	// Mask lists headers whose values change on every run, such as Date or
+	// X-Amz-Date, so only their presence is recorded.
+	Mask []string
+}
+
+// Match fails t with a diff unless req serializes to the snapshot stored
+// under name. A missing snapshot fails too, unless updating.
+func (s Snapshots) Match(t testing.TB, name string, req *http.Request) {
+	t.Helper()
+	got, err := SnapshotRequest(req, s.Mask...)
+	if err != nil {
+		t.Fatalf("authtest: snapshot %s: %v", name, err)
+	}
+	path := filepath.Join(s.Dir, name+".snap")
+
+	if s.Update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("authtest: failed to create snapshot directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatalf("authtest: failed to write snapshot: %v", err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		t.Errorf("authtest: snapshot %s does not exist; run with updates on to create it", path)
+		return
+	}
+	if err != nil {
+		t.Fatalf("authtest: failed to read snapshot: %v", err)
+	}
+	if string(want) != got {
+		t.Errorf("authtest: request does not match snapshot %s (-want +got):\n%s", path, diffLines(string(want), got))
+	}
+}
+
+// SnapshotRequest serializes req to a stable text form: the method and URL
+// with sorted query parameters, the headers sorted by name, a blank line
+// and the body, with JSON indented and its keys sorted. The values of the
+// masked headers are replaced. The body stays readable.
+func SnapshotRequest(req *http.Request, mask ...string) (string, error) {
+	var b strings.Builder
+
+	u := *req.URL
+	u.RawQuery = u.Query().Encode()
+	fmt.Fprintf(&b, "%s %s\n", req.Method, u.String())
+
+	header := req.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	if req.Host != "" && req.Host != req.URL.Host {
+		header.Set("Host", req.Host)
+	}
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		masked := slices.ContainsFunc(mask, func(m string) bool { return strings.EqualFold(m, name) })
+		for _, value := range header[name] {
+			if masked {
+				value = maskedValue
+			}
+			fmt.Fprintf(&b, "%s: %s\n", name, value)
+		}
+	}
+
+	body, err := readBody(req)
+	if err != nil {
+		return "", err
+	}
+	if len(body) > 0 {
+		b.WriteString("\n")
+		b.WriteString(normalizeBody(body))
+		b.WriteString("\n")
+	}
+	return b.String(), nil
+}
+
+// normalizeBody formats JSON bodies canonically and encodes binary ones.
+func normalizeBody(body []byte) string {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var value any
+	if err := dec.Decode(&value); err == nil && !dec.More() {
+		// Marshaling a decoded value sorts object keys.
+		if formatted, err := json.MarshalIndent(value, "", "  "); err == nil {
+			return string(formatted)
+		}
+	}
+	if !utf8.Valid(body) {
+		return "base64:" + base64.StdEncoding.EncodeToString(body)
+	}
+	return strings.TrimSuffix(string(body), "\n")
+}
+
+// diffLines returns a line diff of want and got, marking lines only in want
+// with "- ", lines only in got with "+ " and common lines with two spaces.
+func diffLines(want, got string) string {
+	a := strings.Split(strings.TrimSuffix(want, "\n"), "\n")
+	b := strings.Split(strings.TrimSuffix(got, "\n"), "\n")
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:]
+	// and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var out strings.Builder
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			out.WriteString("  " + a[i] + "\n")
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			out.WriteString("- " + a[i] + "\n")
+			i++
+		default:
+			out.WriteString("+ " + b[j] + "\n")
+			j++
+		}
+	}
+	return out.String()
+}
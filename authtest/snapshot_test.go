@@ -0,0 +1,222 @@
+package authtest_test
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/authtest"
+)
+
+// snapshotRequest returns a POST of body to the items endpoint, with a
+// timestamp header.
+func snapshotRequest(body string) *http.Request {
+	req, _ := http.NewRequest(http.MethodPost, "https://api.example.com/v1/items?b=2&a=1&a=0", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Amz-Date", "20261014T120000Z")
+	return req
+}
+
+func TestSnapshotRequest(t *testing.T) {
+	tests := []struct {
+		name string
+		req  func() *http.Request
+		mask []string
+		want string
+	}{
+		{
+			name: "sorted query, headers and JSON",
+			req: func() *http.Request {
+				req := snapshotRequest(`{"b":1,"a":{"d":[1,2.50],"c":null}}`)
+				req.Header.Add("X-Zeta", "2")
+				req.Header.Add("X-Zeta", "1")
+				return req
+			},
+			mask: []string{"x-amz-date"},
+			want: `POST https://api.example.com/v1/items?a=1&a=0&b=2
+Content-Type: application/json
+X-Amz-Date: [MASKED]
+X-Zeta: 2
+X-Zeta: 1
+
+{
+  "a": {
+    "c": null,
+    "d": [
+      1,
+      2.50
+    ]
+  },
+  "b": 1
+}
+`,
+		},
+		{
+			name: "unmasked",
+			req:  func() *http.Request { return snapshotRequest("") },
+			want: `POST https://api.example.com/v1/items?a=1&a=0&b=2
+Content-Type: application/json
+X-Amz-Date: 20261014T120000Z
+`,
+		},
+		{
+			name: "no body",
+			req: func() *http.Request {
+				req, _ := http.NewRequest(http.MethodGet, "https://api.example.com/", nil)
+				return req
+			},
+			want: "GET https://api.example.com/\n",
+		},
+		{
+			name: "host override",
+			req: func() *http.Request {
+				req, _ := http.NewRequest(http.MethodGet, "https://10.0.0.1/", nil)
+				req.Host = "api.example.com"
+				return req
+			},
+			want: "GET https://10.0.0.1/\nHost: api.example.com\n",
+		},
+		{
+			name: "text body",
+			req: func() *http.Request {
+				req, _ := http.NewRequest(http.MethodPut, "https://api.example.com/notes/1", strings.NewReader("line one\nline two\n"))
+				return req
+			},
+			want: "PUT https://api.example.com/notes/1\n\nline one\nline two\n",
+		},
+		{
+			name: "binary body",
+			req: func() *http.Request {
+				req, _ := http.NewRequest(http.MethodPut, "https://api.example.com/blobs/1", strings.NewReader("\x00\xff"))
+				return req
+			},
+			want: "PUT https://api.example.com/blobs/1\n\nbase64:AP8=\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := tt.req()
+			got, err := authtest.SnapshotRequest(req, tt.mask...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("snapshot =\n%s\nwant\n%s", got, tt.want)
+			}
+			again, _ := authtest.SnapshotRequest(req, tt.mask...)
+			if again != got {
+				t.Errorf("second snapshot differs, so the body was not put back:\n%s", again)
+			}
+		})
+	}
+}
+
+// mismatch returns the failure of a request not matching the snapshot at
+// path, with diff lines.
+func mismatch(path string, diff ...string) string {
+	return "authtest: request does not match snapshot " + path + " (-want +got):\n" + strings.Join(diff, "\n") + "\n"
+}
+
+func TestSnapshotsMatch(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "testdata")
+	path := filepath.Join(dir, "items", "create.snap")
+	created := `{"name":"gopher","tags":["a","b"]}`
+
+	// Updating writes the snapshot, creating its directory.
+	update := &recordingT{TB: t}
+	authtest.Snapshots{Dir: dir, Update: true, Mask: []string{"X-Amz-Date"}}.Match(update, "items/create", snapshotRequest(created))
+	if failures := update.Failures(); len(failures) != 0 {
+		t.Fatalf("updating failed: %q", failures)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshots := authtest.Snapshots{Dir: dir, Mask: []string{"X-Amz-Date"}}
+	tests := []struct {
+		name     string
+		snapshot string
+		req      *http.Request
+		failure  string
+	}{
+		{
+			name:     "same request",
+			snapshot: "items/create",
+			req:      snapshotRequest(created),
+		},
+		{
+			name:     "other timestamp and key order",
+			snapshot: "items/create",
+			req: func() *http.Request {
+				req := snapshotRequest(`{"tags":["a","b"],"name":"gopher"}`)
+				req.Header.Set("X-Amz-Date", "20261015T000000Z")
+				return req
+			}(),
+		},
+		{
+			name:     "changed body",
+			snapshot: "items/create",
+			req:      snapshotRequest(`{"name":"gopher","tags":["a","c"],"owner":"me"}`),
+			failure: mismatch(path,
+				"  POST https://api.example.com/v1/items?a=1&a=0&b=2",
+				"  Content-Type: application/json",
+				"  X-Amz-Date: [MASKED]",
+				"  ",
+				"  {",
+				"    \"name\": \"gopher\",",
+				"+   \"owner\": \"me\",",
+				"    \"tags\": [",
+				"      \"a\",",
+				"-     \"b\"",
+				"+     \"c\"",
+				"    ]",
+				"  }",
+			),
+		},
+		{
+			name:     "added header",
+			snapshot: "items/create",
+			req: func() *http.Request {
+				req := snapshotRequest(created)
+				req.Header.Set("Authorization", "Bearer token")
+				return req
+			}(),
+			failure: mismatch(path,
+				"  POST https://api.example.com/v1/items?a=1&a=0&b=2",
+				"+ Authorization: Bearer token",
+				"  Content-Type: application/json",
+				"  X-Amz-Date: [MASKED]",
+				"  ",
+				"  {",
+				"    \"name\": \"gopher\",",
+				"    \"tags\": [",
+				"      \"a\",",
+				"      \"b\"",
+				"    ]",
+				"  }",
+			),
+		},
+		{
+			name:     "missing snapshot",
+			snapshot: "items/delete",
+			req:      snapshotRequest(created),
+			failure:  "authtest: snapshot " + filepath.Join(dir, "items", "delete.snap") + " does not exist; run with updates on to create it",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := &recordingT{TB: t}
+			snapshots.Match(rec, tt.snapshot, tt.req)
+			var want []string
+			if tt.failure != "" {
+				want = []string{tt.failure}
+			}
+			if got := rec.Failures(); !slices.Equal(got, want) {
+				t.Errorf("failures = %q, want %q", got, want)
+			}
+		})
+	}
+}
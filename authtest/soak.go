@@ -0,0 +1,243 @@
+package authtest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// SoakConfig configures Soak.
+type SoakConfig struct {
+	// Workers is the number of goroutines sending requests; zero means 16.
+	Workers int
+	// Duration is how long the load runs; zero means two seconds.
+	Duration time.Duration
+	// Handler serves the requests; nil answers 200 OK with a short body.
+	Handler http.Handler
+	// NewClient builds the client under test, typically a middleware chain,
+	// on top of base, which talks to the local server. Nil tests base.
+	NewClient func(base *http.Client) Client
+	// NewRequest builds a request to the server at url; nil sends GET url.
+	NewRequest func(ctx context.Context, url string) (*http.Request, error)
+	// Chaos functions run in turn, one every ChaosInterval, while the load
+	// runs: rotating credentials, tripping breakers and the like.
+	Chaos []func()
+	// ChaosInterval defaults to 50ms.
+	ChaosInterval time.Duration
+	// CancelRate is the fraction of requests whose context is cancelled
+	// shortly after they are sent.
+	CancelRate float64
+}
+
+// SoakResult counts what happened during a soak.
+type SoakResult struct {
+	Requests  int64
+	Errors    int64
+	Cancelled int64
+}
+
+// Soak hammers a client with concurrent requests against a local server
+// while running chaos functions and cancelling contexts, then fails t if
+// goroutines or file descriptors leaked, or if response bodies were closed
+// twice or never. Run it under the race detector to also catch data races.
+func Soak(t testing.TB, cfg SoakConfig) SoakResult {
+	t.Helper()
+	if cfg.Workers <= 0 {
+		cfg.Workers = 16
+	}
+	if cfg.Duration <= 0 {
+		cfg.Duration = 2 * time.Second
+	}
+	if cfg.ChaosInterval <= 0 {
+		cfg.ChaosInterval = 50 * time.Millisecond
+	}
+	handler := cfg.Handler
+	if handler == nil {
+		handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			io.WriteString(w, "ok")
+		})
+	}
+	newRequest := cfg.NewRequest
+	if newRequest == nil {
+		newRequest = func(ctx context.Context, url string) (*http.Request, error) {
+			return http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		}
+	}
+
+	goroutines := runtime.NumGoroutine()
+	fds := openFDs()
+
+	srv := httptest.NewServer(handler)
+	bodies := &bodyTracker{}
+	transport := &http.Transport{}
+	base := &http.Client{Transport: &trackingTransport{next: transport, bodies: bodies}}
+	var client Client = base
+	if cfg.NewClient != nil {
+		client = cfg.NewClient(base)
+	}
+
+	var result SoakResult
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+
+	for range cfg.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				soakRequest(t, client, srv.URL, newRequest, cfg.CancelRate, &result)
+			}
+		}()
+	}
+
+	if len(cfg.Chaos) > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ticker := time.NewTicker(cfg.ChaosInterval)
+			defer ticker.Stop()
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				case <-ticker.C:
+					cfg.Chaos[i%len(cfg.Chaos)]()
+				}
+			}
+		}()
+	}
+
+	time.Sleep(cfg.Duration)
+	close(stop)
+	wg.Wait()
+
+	srv.Close()
+	transport.CloseIdleConnections()
+	if closer, ok := client.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+
+	if n := bodies.doubleClosed.Load(); n > 0 {
+		t.Errorf("authtest: %d response bodies closed more than once", n)
+	}
+	if n := bodies.open.Load(); n > 0 {
+		t.Errorf("authtest: %d response bodies never closed", n)
+	}
+	if leaked := settle(func() int { return runtime.NumGoroutine() - goroutines }); leaked > 0 {
+		t.Errorf("authtest: %d goroutines leaked", leaked)
+	}
+	if fds >= 0 {
+		if leaked := settle(func() int { return openFDs() - fds }); leaked > 0 {
+			t.Errorf("authtest: %d file descriptors leaked", leaked)
+		}
+	}
+	return result
+}
+
+// soakRequest sends one request, cancelling it at random, and drains and
+// closes the response.
+func soakRequest(t testing.TB, client Client, url string, newRequest func(context.Context, string) (*http.Request, error), cancelRate float64, result *SoakResult) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if rand.Float64() < cancelRate {
+		timer := time.AfterFunc(time.Duration(rand.Int64N(int64(2*time.Millisecond))), cancel)
+		defer timer.Stop()
+	}
+
+	req, err := newRequest(ctx, url)
+	if err != nil {
+		t.Errorf("authtest: failed to create soak request: %v", err)
+		return
+	}
+	atomic.AddInt64(&result.Requests, 1)
+	resp, err := client.Do(req)
+	if err == nil {
+		_, err = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	switch {
+	case err == nil:
+	case errors.Is(err, context.Canceled):
+		atomic.AddInt64(&result.Cancelled, 1)
+	default:
+		atomic.AddInt64(&result.Errors, 1)
+	}
+}
+
+// settle polls leaked until it drops to zero or a few seconds pass, since
+// connections and their goroutines wind down asynchronously, and returns
+// the last value.
+func settle(leaked func() int) int {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		n := leaked()
+		if n <= 0 || time.Now().After(deadline) {
+			return n
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// openFDs returns the number of open file descriptors, or -1 where it
+// cannot be counted.
+func openFDs() int {
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return -1
+	}
+	return len(entries)
+}
+
+// bodyTracker counts response bodies that are open or were closed twice.
+type bodyTracker struct {
+	open         atomic.Int64
+	doubleClosed atomic.Int64
+}
+
+// trackingTransport wraps response bodies to track how they are closed.
+type trackingTransport struct {
+	next   http.RoundTripper
+	bodies *bodyTracker
+}
+
+// RoundTrip sends the request and tracks the response body.
+func (t *trackingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	t.bodies.open.Add(1)
+	resp.Body = &trackedBody{ReadCloser: resp.Body, bodies: t.bodies}
+	return resp, nil
+}
+
+// trackedBody reports its closes to a bodyTracker.
+type trackedBody struct {
+	io.ReadCloser
+	bodies *bodyTracker
+	closed atomic.Bool
+}
+
+// Close closes the body, counting a second close as a bug.
+func (b *trackedBody) Close() error {
+	if b.closed.Swap(true) {
+		b.bodies.doubleClosed.Add(1)
+		return nil
+	}
+	b.bodies.open.Add(-1)
+	return b.ReadCloser.Close()
+}
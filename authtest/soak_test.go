@@ -0,0 +1,128 @@
+package authtest_test
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/authtest"
+)
+
+// soakClient sends a soak request through the base client.
+type soakClient func(base *http.Client, req *http.Request) (*http.Response, error)
+
+// newClient returns a SoakConfig.NewClient building c.
+func (c soakClient) newClient(base *http.Client) authtest.Client {
+	return clientFunc(func(req *http.Request) (*http.Response, error) {
+		return c(base, req)
+	})
+}
+
+func TestSoak(t *testing.T) {
+	var chaos atomic.Int64
+	srv := func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+		io.WriteString(w, "ok")
+	}
+	result := authtest.Soak(t, authtest.SoakConfig{
+		Workers:       4,
+		Duration:      100 * time.Millisecond,
+		Handler:       http.HandlerFunc(srv),
+		ChaosInterval: 10 * time.Millisecond,
+		Chaos:         []func(){func() { chaos.Add(1) }},
+		NewClient: soakClient(func(base *http.Client, req *http.Request) (*http.Response, error) {
+			req.Header.Set("Authorization", "Bearer token")
+			return base.Do(req)
+		}).newClient,
+	})
+	if result.Requests == 0 || result.Errors != 0 || result.Cancelled != 0 {
+		t.Errorf("result = %+v, want only successful requests", result)
+	}
+	if chaos.Load() == 0 {
+		t.Error("chaos functions did not run")
+	}
+}
+
+func TestSoakCancel(t *testing.T) {
+	result := authtest.Soak(t, authtest.SoakConfig{
+		Workers:  4,
+		Duration: 100 * time.Millisecond,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			select {
+			case <-req.Context().Done():
+			case <-time.After(time.Second):
+			}
+		}),
+		CancelRate: 1,
+	})
+	if result.Requests == 0 || result.Cancelled != result.Requests || result.Errors != 0 {
+		t.Errorf("result = %+v, want every request cancelled", result)
+	}
+}
+
+func TestSoakFailures(t *testing.T) {
+	var mu sync.Mutex
+	var unclosed []io.Closer
+	t.Cleanup(func() {
+		for _, body := range unclosed {
+			body.Close()
+		}
+	})
+
+	tests := []struct {
+		name    string
+		client  soakClient
+		failure string
+	}{
+		{
+			"closed twice",
+			func(base *http.Client, req *http.Request) (*http.Response, error) {
+				resp, err := base.Do(req)
+				if err != nil {
+					return nil, err
+				}
+				resp.Body.Close()
+				resp.Body.Close()
+				return &http.Response{StatusCode: resp.StatusCode, Body: io.NopCloser(strings.NewReader("ok"))}, nil
+			},
+			" response bodies closed more than once",
+		},
+		{
+			"never closed",
+			func(base *http.Client, req *http.Request) (*http.Response, error) {
+				resp, err := base.Do(req)
+				if err != nil {
+					return nil, err
+				}
+				mu.Lock()
+				unclosed = append(unclosed, resp.Body)
+				mu.Unlock()
+				return &http.Response{StatusCode: resp.StatusCode, Body: io.NopCloser(strings.NewReader("ok"))}, nil
+			},
+			" response bodies never closed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := &recordingT{TB: t}
+			authtest.Soak(rec, authtest.SoakConfig{
+				Workers:   2,
+				Duration:  20 * time.Millisecond,
+				NewClient: tt.client.newClient,
+			})
+			var found bool
+			for _, failure := range rec.Failures() {
+				found = found || strings.HasPrefix(failure, "authtest: ") && strings.HasSuffix(failure, tt.failure)
+			}
+			if !found {
+				t.Errorf("failures = %q, want one ending in %q", rec.Failures(), tt.failure)
+			}
+		})
+	}
+}
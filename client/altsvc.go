@@ -0,0 +1,89 @@
+package client
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultAltSvcMaxAge is how long an Alt-Svc advertisement lasts without an
+// ma parameter, per RFC 7838.
+const defaultAltSvcMaxAge = 24 * time.Hour
+
+// rememberAltSvc records whether the Alt-Svc header of resp, a response from
+// the origin of u, advertises HTTP/3 on the same host and port, which is
+// where the HTTP/3 round tripper connects.
+func (t *Transport) rememberAltSvc(u *url.URL, resp *http.Response) {
+	values := resp.Header.Values("Alt-Svc")
+	if len(values) == 0 {
+		return
+	}
+	maxAge, ok := parseAltSvcH3(strings.Join(values, ","), u.Hostname(), canonicalPort(u))
+	switch {
+	case ok:
+		t.h3Alt.Store(u.Host, t.clock.Now().Add(maxAge))
+	case maxAge < 0:
+		t.h3Alt.Delete(u.Host)
+	}
+}
+
+// h3Advertised reports whether the origin of u advertised HTTP/3 in an
+// Alt-Svc header that has not expired.
+func (t *Transport) h3Advertised(u *url.URL) bool {
+	expires, ok := t.h3Alt.Load(u.Host)
+	if !ok {
+		return false
+	}
+	if t.clock.Now().Before(expires.(time.Time)) {
+		return true
+	}
+	t.h3Alt.Delete(u.Host)
+	return false
+}
+
+// parseAltSvcH3 looks for an h3 alternative on host and port in an Alt-Svc
+// header value and returns how long it lasts. A value of "clear" returns a
+// negative duration and false.
+func parseAltSvcH3(value, host, port string) (time.Duration, bool) {
+	if strings.TrimSpace(value) == "clear" {
+		return -1, false
+	}
+	for _, alt := range strings.Split(value, ",") {
+		params := strings.Split(alt, ";")
+		protocol, authority, ok := strings.Cut(strings.TrimSpace(params[0]), "=")
+		if !ok || protocol != "h3" {
+			continue
+		}
+		authority = strings.Trim(authority, `"`)
+		i := strings.LastIndex(authority, ":")
+		if i < 0 || authority[i+1:] != port {
+			continue
+		}
+		if altHost := strings.Trim(authority[:i], "[]"); altHost != "" && !strings.EqualFold(altHost, host) {
+			continue
+		}
+
+		maxAge := defaultAltSvcMaxAge
+		for _, param := range params[1:] {
+			name, v, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if seconds, err := strconv.Atoi(strings.Trim(v, `"`)); strings.EqualFold(name, "ma") && err == nil && seconds >= 0 {
+				maxAge = time.Duration(seconds) * time.Second
+			}
+		}
+		return maxAge, maxAge > 0
+	}
+	return 0, false
+}
+
+// canonicalPort returns the port the transport dials for u.
+func canonicalPort(u *url.URL) string {
+	if port := u.Port(); port != "" {
+		return port
+	}
+	if u.Scheme == "https" {
+		return "443"
+	}
+	return "80"
+}
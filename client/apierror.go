@@ -0,0 +1,46 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// maxAPIErrorBody caps how much of an error response APIError keeps.
+const maxAPIErrorBody = 64 << 10
+
+// APIError is returned by the request helpers of CustomClient when the
+// server answers with a status outside 2xx.
+type APIError struct {
+	StatusCode int
+	Status     string
+	Method     string
+	URL        string
+	Header     http.Header
+	// Body holds up to 64KB of the response body.
+	Body []byte
+}
+
+// Error implements the error interface.
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s %s: unexpected status: %s", e.Method, e.URL, e.Status)
+}
+
+// newAPIError builds the APIError for resp, reading the start of its body.
+// The caller closes the body.
+func newAPIError(req *http.Request, resp *http.Response) *APIError {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxAPIErrorBody))
+	return &APIError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Method:     req.Method,
+		URL:        req.URL.Redacted(),
+		Header:     resp.Header,
+		Body:       body,
+	}
+}
+
+// successful reports whether resp has a 2xx status.
+func successful(resp *http.Response) bool {
+	return resp.StatusCode >= 200 && resp.StatusCode <= 299
+}
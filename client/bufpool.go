@@ -0,0 +1,52 @@
+package client
+
+import (
+	"io"
+	"sync"
+)
+
+// Sizes of the pooled body buffers. Larger buffers are left to the garbage
+// collector so one huge body does not stay pinned in the pool.
+const (
+	bodyBufferSize    = 4 << 10
+	maxPooledBodySize = 1 << 20
+)
+
+// bodyPool recycles the buffers bodies are read into.
+var bodyPool = sync.Pool{
+	New: func() any {
+		b := make([]byte, 0, bodyBufferSize)
+		return &b
+	},
+}
+
+// readBodyPooled reads r to the end, like io.ReadAll, into a buffer from
+// the pool. The buffer may be handed back with ReleaseBody.
+func readBodyPooled(r io.Reader) ([]byte, error) {
+	b := (*bodyPool.Get().(*[]byte))[:0]
+	for {
+		n, err := r.Read(b[len(b):cap(b)])
+		b = b[:len(b)+n]
+		if err == io.EOF {
+			return b, nil
+		}
+		if err != nil {
+			return b, err
+		}
+		if len(b) == cap(b) {
+			// Let append pick the growth.
+			b = append(b, 0)[:len(b)]
+		}
+	}
+}
+
+// ReleaseBody returns a body read by CustomClient.Get to the buffer pool,
+// cutting allocations in clients sending many requests. Calling it is
+// optional, but b must not be used afterwards.
+func ReleaseBody(b []byte) {
+	if cap(b) == 0 || cap(b) > maxPooledBodySize {
+		return
+	}
+	b = b[:0]
+	bodyPool.Put(&b)
+}
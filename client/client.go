@@ -0,0 +1,239 @@
+// Package client provides an HTTP client built from composable middleware,
+// and a managed transport with tunable connection handling.
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// HTTPClient is an interface for sending HTTP requests.
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// HTTPClientFunc is a function type that implements the HTTPClient interface.
+type HTTPClientFunc func(req *http.Request) (*http.Response, error)
+
+// Do sends an HTTP request and returns an HTTP response.
+func (fn HTTPClientFunc) Do(req *http.Request) (*http.Response, error) {
+	return fn(req)
+}
+
+// Middleware is a type for functions that modify HTTPClient behavior.
+// Middleware runs once per call; redirects are followed afterwards by the base
+// client, so only the base client's redirect policy applies to them, and
+// headers middleware added are carried over as the policy allows.
+type Middleware func(HTTPClient) HTTPClient
+
+// CustomClient is a custom HTTP client with middleware support.
+type CustomClient struct {
+	httpClient  HTTPClient
+	base        HTTPClient
+	middlewares []Middleware
+	baseURL     *url.URL
+}
+
+// NewCustomClient creates a new CustomClient with optional middleware. An
+// *http.Client base without a CheckRedirect of its own, such as
+// http.DefaultClient, follows up to 10 redirects and strips credentials
+// from those that leave the origin of the original request, as
+// NewHTTPClient does; SetRedirectPolicy changes that.
+func NewCustomClient(baseClient HTTPClient, middlewares ...Middleware) CustomClient {
+	c := CustomClient{base: secureRedirects(baseClient), middlewares: middlewares}
+	c.compose()
+	return c
+}
+
+// Use appends middlewares to the chain, as if they had been passed last to
+// NewCustomClient. The chain is composed again here rather than per
+// request, so Use must not run concurrently with requests; Clone the client
+// to vary the chain of one in use.
+func (c *CustomClient) Use(middlewares ...Middleware) {
+	c.middlewares = append(c.middlewares[:len(c.middlewares):len(c.middlewares)], middlewares...)
+	c.compose()
+}
+
+// Clone returns a copy of the client with the same base client and chain,
+// to which Use can add middleware without affecting the original. State a
+// middleware set up when it was created, such as a cache, is shared.
+func (c *CustomClient) Clone() CustomClient {
+	clone := CustomClient{base: c.base, middlewares: c.middlewares[:len(c.middlewares):len(c.middlewares)], baseURL: c.baseURL}
+	clone.compose()
+	return clone
+}
+
+// compose applies the middlewares to the base client once, so requests
+// only pay for the calls through the chain.
+func (c *CustomClient) compose() {
+	httpClient := c.base
+	for _, middleware := range c.middlewares {
+		httpClient = middleware(httpClient)
+	}
+	c.httpClient = httpClient
+}
+
+// CloseIdleConnections closes the idle connections of the base client, if
+// it keeps any.
+func (c *CustomClient) CloseIdleConnections() {
+	if closer, ok := c.base.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+// Stats returns the connection pool statistics of the base client. It
+// returns zero values unless the base client uses a managed transport.
+func (c *CustomClient) Stats() TransportStats {
+	if t := c.transport(); t != nil {
+		return t.Stats()
+	}
+	if provider, ok := c.base.(interface{ Stats() TransportStats }); ok {
+		return provider.Stats()
+	}
+	return TransportStats{}
+}
+
+// transport returns the managed transport of the base client, or nil.
+func (c *CustomClient) transport() *Transport {
+	if hc, ok := c.base.(*http.Client); ok {
+		if t, ok := hc.Transport.(*Transport); ok {
+			return t
+		}
+	}
+	return nil
+}
+
+// SetBaseURL sets the URL that relative request URLs are resolved
+// against. Its path is treated as a directory, so with a base of
+// https://api.example.com/v1, "users/1" refers to
+// https://api.example.com/v1/users/1, while "/users/1" replaces the path.
+// An empty rawURL clears the base URL. A managed transport created with
+// WithPreconnect starts warming up connections to the new base URL.
+func (c *CustomClient) SetBaseURL(rawURL string) error {
+	if rawURL == "" {
+		c.baseURL = nil
+		return nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("failed to parse base URL: %w", err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("base URL %q is not absolute", rawURL)
+	}
+	if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+		if u.RawPath != "" {
+			u.RawPath += "/"
+		}
+	}
+	c.baseURL = u
+	if t := c.transport(); t != nil {
+		t.warmUpBaseURL(u)
+	}
+	return nil
+}
+
+// BaseURL returns the base URL set with SetBaseURL, or an empty string.
+func (c *CustomClient) BaseURL() string {
+	if c.baseURL == nil {
+		return ""
+	}
+	return c.baseURL.String()
+}
+
+// newRequest creates a request for rawURL, resolved against the base URL.
+func (c *CustomClient) newRequest(ctx context.Context, method, rawURL string, body io.Reader) (*http.Request, error) {
+	if c.baseURL != nil {
+		ref, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		rawURL = c.baseURL.ResolveReference(ref).String()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	return req, nil
+}
+
+// Get sends a GET request and returns the response body. The body is read
+// into a pooled buffer, which may be recycled with ReleaseBody. Responses
+// with a status outside 2xx fail with an *APIError. The options adjust this
+// call only.
+func (c *CustomClient) Get(ctx context.Context, url string, opts ...RequestOption) ([]byte, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.send(req, opts)
+}
+
+// Post sends a POST request with the given body and content type and
+// returns the response body, like Get.
+func (c *CustomClient) Post(ctx context.Context, url, contentType string, body io.Reader, opts ...RequestOption) ([]byte, error) {
+	return c.sendBody(ctx, http.MethodPost, url, contentType, body, opts)
+}
+
+// Put sends a PUT request with the given body and content type and returns
+// the response body, like Get.
+func (c *CustomClient) Put(ctx context.Context, url, contentType string, body io.Reader, opts ...RequestOption) ([]byte, error) {
+	return c.sendBody(ctx, http.MethodPut, url, contentType, body, opts)
+}
+
+// Patch sends a PATCH request with the given body and content type and
+// returns the response body, like Get.
+func (c *CustomClient) Patch(ctx context.Context, url, contentType string, body io.Reader, opts ...RequestOption) ([]byte, error) {
+	return c.sendBody(ctx, http.MethodPatch, url, contentType, body, opts)
+}
+
+// Delete sends a DELETE request and returns the response body, like Get.
+func (c *CustomClient) Delete(ctx context.Context, url string, opts ...RequestOption) ([]byte, error) {
+	req, err := c.newRequest(ctx, http.MethodDelete, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.send(req, opts)
+}
+
+// sendBody sends a request with a body. Bodies of the types
+// http.NewRequest knows, such as *bytes.Reader, can be replayed by
+// middleware that retries.
+func (c *CustomClient) sendBody(ctx context.Context, method, url, contentType string, body io.Reader, opts []RequestOption) ([]byte, error) {
+	req, err := c.newRequest(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return c.send(req, opts)
+}
+
+// send sends req through the middleware chain with opts and reads the
+// response body into a pooled buffer.
+func (c *CustomClient) send(req *http.Request, opts []RequestOption) ([]byte, error) {
+	resp, cancel, err := c.do(req, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	defer resp.Body.Close()
+
+	if !successful(resp) {
+		return nil, newAPIError(req, resp)
+	}
+
+	body, err := readBodyPooled(resp.Body)
+	if err != nil {
+		ReleaseBody(body)
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	return body, nil
+}
@@ -0,0 +1,83 @@
+package client_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/client"
+)
+
+// headerMiddleware sets a header, like the auth middleware does.
+func headerMiddleware(name string) client.Middleware {
+	return func(next client.HTTPClient) client.HTTPClient {
+		return client.HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+			req.Header.Set(name, "1")
+			return next.Do(req)
+		})
+	}
+}
+
+// chain returns n header middlewares.
+func chain(n int) []client.Middleware {
+	middlewares := make([]client.Middleware, n)
+	for i := range middlewares {
+		middlewares[i] = headerMiddleware(fmt.Sprintf("X-Middleware-%d", i))
+	}
+	return middlewares
+}
+
+// okClient answers every request with the same empty response.
+var okClient = client.HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+})
+
+// BenchmarkChainComposed sends requests through a chain composed once by
+// NewCustomClient.
+func BenchmarkChainComposed(b *testing.B) {
+	for _, n := range []int{1, 5, 20} {
+		b.Run(fmt.Sprintf("depth=%d", n), func(b *testing.B) {
+			c := client.NewCustomClient(okClient, chain(n)...)
+			req, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := c.Do(req); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkChainPerRequest composes the chain for every request, as the
+// client did before chains were composed up front.
+func BenchmarkChainPerRequest(b *testing.B) {
+	for _, n := range []int{1, 5, 20} {
+		b.Run(fmt.Sprintf("depth=%d", n), func(b *testing.B) {
+			middlewares := chain(n)
+			req, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+			b.ReportAllocs()
+			for b.Loop() {
+				var httpClient client.HTTPClient = okClient
+				for _, m := range middlewares {
+					httpClient = m(httpClient)
+				}
+				if _, err := httpClient.Do(req); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkChainUse measures recomposing the chain after Use, which is paid
+// once per change rather than per request.
+func BenchmarkChainUse(b *testing.B) {
+	base := client.NewCustomClient(okClient, chain(5)...)
+	extra := headerMiddleware("X-Extra")
+	b.ReportAllocs()
+	for b.Loop() {
+		c := base.Clone()
+		c.Use(extra)
+	}
+}
@@ -0,0 +1,155 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Sleeper waits for a duration.
+type Sleeper interface {
+	// Sleep blocks for d, or until ctx is done, in which case it returns
+	// ctx.Err().
+	Sleep(ctx context.Context, d time.Duration) error
+}
+
+// Clock tells the time and sleeps. Everything in the package that expires,
+// waits or backs off goes through a Clock, so tests can substitute a
+// FakeClock. Network I/O timeouts always run on real time.
+type Clock interface {
+	Now() time.Time
+	Sleeper
+}
+
+// SystemClock is the Clock backed by the time package.
+var SystemClock Clock = systemClock{}
+
+// systemClock implements Clock with real time.
+type systemClock struct{}
+
+// Now returns the current time.
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// Sleep waits for d on a real timer.
+func (systemClock) Sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// clockOrSystem returns c, or SystemClock if c is nil.
+func clockOrSystem(c Clock) Clock {
+	if c == nil {
+		return SystemClock
+	}
+	return c
+}
+
+// WithClock makes the managed transport read time from clock, for DNS cache
+// expiry and protocol fallback windows.
+func WithClock(clock Clock) Option {
+	return func(c *config) {
+		c.clock = clock
+	}
+}
+
+// FakeClock is a Clock for tests whose time only moves when told to.
+// Sleepers wake up once Advance moves the time past their deadline.
+type FakeClock struct {
+	mu       sync.Mutex
+	now      time.Time
+	sleepers []*fakeSleeper
+}
+
+// fakeSleeper is a goroutine blocked in FakeClock.Sleep.
+type fakeSleeper struct {
+	until time.Time
+	done  chan struct{}
+}
+
+// NewFakeClock creates a FakeClock set to now.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now returns the fake time.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Sleep blocks until the fake time has advanced by d or ctx is done.
+func (c *FakeClock) Sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	c.mu.Lock()
+	s := &fakeSleeper{until: c.now.Add(d), done: make(chan struct{})}
+	c.sleepers = append(c.sleepers, s)
+	c.mu.Unlock()
+
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		c.mu.Lock()
+		c.removeSleeper(s)
+		c.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// Advance moves the fake time forward by d and wakes the sleepers whose
+// deadline has passed.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+	pending := c.sleepers[:0]
+	for _, s := range c.sleepers {
+		if s.until.After(c.now) {
+			pending = append(pending, s)
+		} else {
+			close(s.done)
+		}
+	}
+	c.sleepers = pending
+}
+
+// Sleepers returns the number of goroutines blocked in Sleep.
+func (c *FakeClock) Sleepers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.sleepers)
+}
+
+// WaitForSleepers blocks until at least n goroutines are blocked in Sleep,
+// so a test can advance the time knowing the code under test is waiting.
+func (c *FakeClock) WaitForSleepers(n int) {
+	for c.Sleepers() < n {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// removeSleeper drops s from the sleepers. Callers must hold c.mu.
+func (c *FakeClock) removeSleeper(s *fakeSleeper) {
+	for i, other := range c.sleepers {
+		if other == s {
+			c.sleepers = append(c.sleepers[:i], c.sleepers[i+1:]...)
+			return
+		}
+	}
+}
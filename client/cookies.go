@@ -0,0 +1,258 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CookieJar is an http.CookieJar that isolates cookies per host: a cookie is
+// only ever sent back to the exact host that set it, whatever its Domain
+// attribute says. It lives in memory unless created with a file to persist to.
+type CookieJar struct {
+	// Clock, if set before first use, replaces the system clock for expiry.
+	Clock Clock
+
+	mu    sync.Mutex
+	hosts map[string][]storedCookie
+	path  string
+}
+
+// storedCookie is the part of a cookie the jar needs to replay it.
+type storedCookie struct {
+	Name     string    `json:"name"`
+	Value    string    `json:"value"`
+	Path     string    `json:"path"`
+	Expires  time.Time `json:"expires,omitzero"`
+	Secure   bool      `json:"secure,omitempty"`
+	HttpOnly bool      `json:"http_only,omitempty"`
+}
+
+// NewCookieJar creates an in-memory cookie jar.
+func NewCookieJar() *CookieJar {
+	return &CookieJar{hosts: make(map[string][]storedCookie)}
+}
+
+// NewPersistentCookieJar creates a cookie jar saved to path on every change.
+// Cookies already stored at path are loaded; a missing file starts empty.
+func NewPersistentCookieJar(path string) (*CookieJar, error) {
+	jar := NewCookieJar()
+	jar.path = path
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return jar, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cookie jar: %w", err)
+	}
+	if err := json.Unmarshal(data, &jar.hosts); err != nil {
+		return nil, fmt.Errorf("failed to decode cookie jar: %w", err)
+	}
+	return jar, nil
+}
+
+// WithCookieJar makes the client store and send cookies using jar.
+func WithCookieJar(jar http.CookieJar) Option {
+	return func(c *config) {
+		c.cookieJar = jar
+	}
+}
+
+// SetCookies stores the cookies received in a response from u.
+func (j *CookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	host := cookieHost(u)
+	now := clockOrSystem(j.Clock).Now()
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	stored := j.hosts[host]
+	for _, cookie := range cookies {
+		sc := storedCookie{
+			Name:     cookie.Name,
+			Value:    cookie.Value,
+			Path:     cookie.Path,
+			Secure:   cookie.Secure,
+			HttpOnly: cookie.HttpOnly,
+		}
+		if sc.Path == "" || sc.Path[0] != '/' {
+			sc.Path = defaultCookiePath(u.Path)
+		}
+		switch {
+		case cookie.MaxAge < 0:
+			sc.Expires = now
+		case cookie.MaxAge > 0:
+			sc.Expires = now.Add(time.Duration(cookie.MaxAge) * time.Second)
+		case !cookie.Expires.IsZero():
+			sc.Expires = cookie.Expires
+		}
+
+		// Replace a cookie with the same name and path, then drop it again
+		// if it has already expired.
+		stored = removeCookie(stored, sc.Name, sc.Path)
+		if sc.Expires.IsZero() || sc.Expires.After(now) {
+			stored = append(stored, sc)
+		}
+	}
+
+	if len(stored) == 0 {
+		delete(j.hosts, host)
+	} else {
+		j.hosts[host] = stored
+	}
+	j.save()
+}
+
+// Cookies returns the cookies to send in a request to u.
+func (j *CookieJar) Cookies(u *url.URL) []*http.Cookie {
+	host := cookieHost(u)
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+	now := clockOrSystem(j.Clock).Now()
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var cookies []*http.Cookie
+	for _, sc := range j.hosts[host] {
+		if !sc.Expires.IsZero() && !sc.Expires.After(now) {
+			continue
+		}
+		if sc.Secure && u.Scheme != "https" {
+			continue
+		}
+		if !pathMatch(path, sc.Path) {
+			continue
+		}
+		cookies = append(cookies, &http.Cookie{Name: sc.Name, Value: sc.Value})
+	}
+	return cookies
+}
+
+// HostCookies returns the unexpired cookies stored for host.
+func (j *CookieJar) HostCookies(host string) []*http.Cookie {
+	now := clockOrSystem(j.Clock).Now()
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var cookies []*http.Cookie
+	for _, sc := range j.hosts[strings.ToLower(host)] {
+		if !sc.Expires.IsZero() && !sc.Expires.After(now) {
+			continue
+		}
+		cookies = append(cookies, &http.Cookie{
+			Name:     sc.Name,
+			Value:    sc.Value,
+			Path:     sc.Path,
+			Expires:  sc.Expires,
+			Secure:   sc.Secure,
+			HttpOnly: sc.HttpOnly,
+		})
+	}
+	return cookies
+}
+
+// Hosts returns the hosts that have cookies in the jar.
+func (j *CookieJar) Hosts() []string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	hosts := make([]string, 0, len(j.hosts))
+	for host := range j.hosts {
+		hosts = append(hosts, host)
+	}
+	return hosts
+}
+
+// Clear removes the cookies of the given hosts, or of every host when called
+// without arguments.
+func (j *CookieJar) Clear(hosts ...string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if len(hosts) == 0 {
+		clear(j.hosts)
+	}
+	for _, host := range hosts {
+		delete(j.hosts, strings.ToLower(host))
+	}
+	j.save()
+}
+
+// save writes the jar to its file, if it has one. Callers must hold j.mu.
+// The jar keeps working from memory when the file cannot be written.
+func (j *CookieJar) save() {
+	if j.path == "" {
+		return
+	}
+
+	data, err := json.Marshal(j.hosts)
+	if err != nil {
+		return
+	}
+
+	// Write to a temporary file first so a crash never leaves a torn jar.
+	tmp, err := os.CreateTemp(filepath.Dir(j.path), ".cookies-*")
+	if err != nil {
+		return
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return
+	}
+	if err := tmp.Close(); err != nil {
+		return
+	}
+	os.Rename(tmp.Name(), j.path)
+}
+
+// cookieHost returns the key cookies of u are stored under.
+func cookieHost(u *url.URL) string {
+	return strings.ToLower(u.Hostname())
+}
+
+// defaultCookiePath returns the default cookie path for a request path, as
+// described in RFC 6265 section 5.1.4.
+func defaultCookiePath(path string) string {
+	if path == "" || path[0] != '/' {
+		return "/"
+	}
+	i := strings.LastIndex(path, "/")
+	if i == 0 {
+		return "/"
+	}
+	return path[:i]
+}
+
+// pathMatch reports whether a request path matches a cookie path.
+func pathMatch(path, cookiePath string) bool {
+	if !strings.HasPrefix(path, cookiePath) {
+		return false
+	}
+	return len(path) == len(cookiePath) ||
+		strings.HasSuffix(cookiePath, "/") ||
+		path[len(cookiePath)] == '/'
+}
+
+// removeCookie returns cookies without the one with the given name and path.
+func removeCookie(cookies []storedCookie, name, path string) []storedCookie {
+	kept := cookies[:0]
+	for _, sc := range cookies {
+		if sc.Name != name || sc.Path != path {
+			kept = append(kept, sc)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,358 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"time"
+)
+
+// defaultFallbackDelay is how long the dialer waits on the preferred address
+// family before racing the other one, matching the net package.
+const defaultFallbackDelay = 300 * time.Millisecond
+
+// AddressPreference selects which address family the dialer tries first.
+type AddressPreference int
+
+const (
+	// PreferResolverOrder dials addresses in the order the resolver returned.
+	PreferResolverOrder AddressPreference = iota
+	// PreferIPv6 dials IPv6 addresses first and races IPv4 as the fallback.
+	PreferIPv6
+	// PreferIPv4 dials IPv4 addresses first and races IPv6 as the fallback.
+	PreferIPv4
+	// IPv4Only resolves and dials IPv4 addresses only.
+	IPv4Only
+	// IPv6Only resolves and dials IPv6 addresses only.
+	IPv6Only
+)
+
+// dialer resolves hosts with a Resolver and dials the resulting addresses,
+// racing address families in the style of Happy Eyeballs (RFC 6555).
+type dialer struct {
+	net.Dialer
+	resolver      Resolver
+	fallbackDelay time.Duration
+	preference    AddressPreference
+
+	// localAddrs and iface pick the local address outbound connections
+	// are bound to.
+	localAddrs []netip.Addr
+	iface      string
+
+	// ssrf vets the addresses of QUIC connections, which do not go through
+	// the ControlContext hook.
+	ssrf *ssrfGuard
+}
+
+// newDialer builds the managed dialer described by the config.
+func (c *config) newDialer() *dialer {
+	resolver := c.resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	if c.dnsCacheTTL > 0 {
+		cache := NewDNSCache(resolver, c.dnsCacheTTL, c.dnsNegativeTTL)
+		cache.Clock = c.clock
+		resolver = cache
+	}
+
+	d := &dialer{
+		Dialer: net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		},
+		resolver:      resolver,
+		fallbackDelay: defaultFallbackDelay,
+		preference:    c.addressPreference,
+		localAddrs:    c.localAddrs,
+		iface:         c.iface,
+		ssrf:          c.ssrf,
+	}
+	if c.fallbackDelay != 0 {
+		d.fallbackDelay = c.fallbackDelay
+	}
+	if c.tcpKeepAlive != nil {
+		d.KeepAliveConfig = *c.tcpKeepAlive
+	}
+	if c.ssrf != nil {
+		d.ControlContext = c.ssrf.control
+	}
+	return d
+}
+
+// DialContext connects to addr, resolving its host through the resolver.
+func (d *dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	network = d.restrictNetwork(network)
+	addrs, port, err := d.resolve(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	// A negative fallback delay turns off racing: every address is tried
+	// in turn.
+	if d.fallbackDelay < 0 {
+		return d.dialSerial(ctx, network, addrs, port)
+	}
+	primaries, fallbacks := partitionAddrs(addrs)
+	return d.dialParallel(ctx, network, primaries, fallbacks, port)
+}
+
+// resolve returns the addresses of the host in addr that can be used with
+// network, in the order they should be dialed, along with the port.
+func (d *dialer) resolve(ctx context.Context, network, addr string) ([]net.IPAddr, string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// IP literals need no resolution.
+	var addrs []net.IPAddr
+	if ip := net.ParseIP(host); ip != nil {
+		addrs = []net.IPAddr{{IP: ip}}
+	} else {
+		addrs, err = lookupFamily(ctx, d.resolver, lookupNetwork(network), host)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	addrs = filterNetwork(network, addrs)
+	if len(addrs) == 0 {
+		return nil, "", &net.DNSError{Err: "no suitable address found", Name: host, IsNotFound: true}
+	}
+	return sortAddrs(addrs, d.preference), port, nil
+}
+
+// dialParallel dials the primary addresses and, after the fallback delay or
+// as soon as the primaries fail, the fallback addresses. The first connection
+// to succeed wins.
+func (d *dialer) dialParallel(ctx context.Context, network string, primaries, fallbacks []net.IPAddr, port string) (net.Conn, error) {
+	if len(fallbacks) == 0 {
+		return d.dialSerial(ctx, network, primaries, port)
+	}
+
+	type result struct {
+		conn    net.Conn
+		err     error
+		primary bool
+	}
+
+	returned := make(chan struct{})
+	defer close(returned)
+
+	results := make(chan result)
+	race := func(ctx context.Context, primary bool, addrs []net.IPAddr) {
+		conn, err := d.dialSerial(ctx, network, addrs, port)
+		select {
+		case results <- result{conn: conn, err: err, primary: primary}:
+		case <-returned:
+			if conn != nil {
+				conn.Close()
+			}
+		}
+	}
+
+	primaryCtx, primaryCancel := context.WithCancel(ctx)
+	defer primaryCancel()
+	go race(primaryCtx, true, primaries)
+
+	fallbackCtx, fallbackCancel := context.WithCancel(ctx)
+	defer fallbackCancel()
+	fallbackTimer := time.NewTimer(d.fallbackDelay)
+	defer fallbackTimer.Stop()
+
+	var primaryErr error
+	pending := 2
+	for {
+		select {
+		case <-fallbackTimer.C:
+			go race(fallbackCtx, false, fallbacks)
+
+		case res := <-results:
+			if res.err == nil {
+				return res.conn, nil
+			}
+			if res.primary {
+				primaryErr = res.err
+			}
+			if pending--; pending == 0 {
+				if primaryErr != nil {
+					return nil, primaryErr
+				}
+				return nil, res.err
+			}
+
+			// Start the fallback right away once the primaries have failed.
+			if res.primary && fallbackTimer.Stop() {
+				fallbackTimer.Reset(0)
+			}
+		}
+	}
+}
+
+// dialSerial dials the addresses in order and returns the first connection
+// that succeeds, or the first error if none does.
+func (d *dialer) dialSerial(ctx context.Context, network string, addrs []net.IPAddr, port string) (net.Conn, error) {
+	var firstErr error
+	for _, addr := range addrs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		conn, err := d.dialAddr(ctx, network, addr, port)
+		if err == nil {
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr == nil {
+		firstErr = fmt.Errorf("no addresses to dial")
+	}
+	return nil, firstErr
+}
+
+// dialAddr connects to a single address from the configured local address.
+func (d *dialer) dialAddr(ctx context.Context, network string, addr net.IPAddr, port string) (net.Conn, error) {
+	local, err := d.localAddr(addr.IP)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := d.Dialer
+	if local.IsValid() {
+		dialer.LocalAddr = &net.TCPAddr{IP: local.AsSlice(), Zone: local.Zone()}
+	}
+	return dialer.DialContext(ctx, network, net.JoinHostPort(addr.String(), port))
+}
+
+// localAddr returns the local address to bind to when connecting to ip, or
+// the zero address to let the system choose.
+func (d *dialer) localAddr(ip net.IP) (netip.Addr, error) {
+	if len(d.localAddrs) == 0 && d.iface == "" {
+		return netip.Addr{}, nil
+	}
+
+	candidates := d.localAddrs
+	if d.iface != "" {
+		var err error
+		if candidates, err = interfaceAddrs(d.iface); err != nil {
+			return netip.Addr{}, err
+		}
+	}
+
+	// Bind to a local address of the same family as the destination.
+	isIPv4 := ip.To4() != nil
+	for _, local := range candidates {
+		if local.Unmap().Is4() == isIPv4 {
+			return local, nil
+		}
+	}
+	return netip.Addr{}, fmt.Errorf("no local address of the same family to reach %s", ip)
+}
+
+// interfaceAddrs returns the addresses of the named interface, except
+// link-local ones, which cannot be bound without a zone. They are
+// looked up on each call so that address changes are picked up.
+func interfaceAddrs(name string) ([]netip.Addr, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find interface: %w", err)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list interface addresses: %w", err)
+	}
+
+	var ips []netip.Addr
+	for _, addr := range addrs {
+		prefix, err := netip.ParsePrefix(addr.String())
+		if err != nil || prefix.Addr().IsLinkLocalUnicast() {
+			continue
+		}
+		ips = append(ips, prefix.Addr())
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("interface %s has no usable address", name)
+	}
+	return ips, nil
+}
+
+// restrictNetwork narrows a "tcp" or "udp" dial to a single family in the
+// IPv4Only and IPv6Only modes.
+func (d *dialer) restrictNetwork(network string) string {
+	if network != "tcp" && network != "udp" {
+		return network
+	}
+	switch d.preference {
+	case IPv4Only:
+		return network + "4"
+	case IPv6Only:
+		return network + "6"
+	}
+	return network
+}
+
+// lookupNetwork returns the resolver network matching a dial network.
+func lookupNetwork(network string) string {
+	switch network {
+	case "tcp4", "udp4":
+		return "ip4"
+	case "tcp6", "udp6":
+		return "ip6"
+	}
+	return "ip"
+}
+
+// filterNetwork drops the addresses that cannot be used with network.
+func filterNetwork(network string, addrs []net.IPAddr) []net.IPAddr {
+	filtered := make([]net.IPAddr, 0, len(addrs))
+	for _, addr := range addrs {
+		isIPv4 := addr.IP.To4() != nil
+		switch {
+		case (network == "tcp4" || network == "udp4") && !isIPv4:
+		case (network == "tcp6" || network == "udp6") && isIPv4:
+		default:
+			filtered = append(filtered, addr)
+		}
+	}
+	return filtered
+}
+
+// sortAddrs orders addrs by the preferred family, keeping the resolver order
+// within each family. The input slice is not modified.
+func sortAddrs(addrs []net.IPAddr, preference AddressPreference) []net.IPAddr {
+	if preference != PreferIPv4 && preference != PreferIPv6 {
+		return addrs
+	}
+
+	wantIPv4 := preference == PreferIPv4
+	sorted := make([]net.IPAddr, 0, len(addrs))
+	for _, addr := range addrs {
+		if (addr.IP.To4() != nil) == wantIPv4 {
+			sorted = append(sorted, addr)
+		}
+	}
+	for _, addr := range addrs {
+		if (addr.IP.To4() != nil) != wantIPv4 {
+			sorted = append(sorted, addr)
+		}
+	}
+	return sorted
+}
+
+// partitionAddrs splits addrs into those of the same family as the first
+// address and the rest.
+func partitionAddrs(addrs []net.IPAddr) (primaries, fallbacks []net.IPAddr) {
+	primaryIPv4 := addrs[0].IP.To4() != nil
+	for _, addr := range addrs {
+		if (addr.IP.To4() != nil) == primaryIPv4 {
+			primaries = append(primaries, addr)
+		} else {
+			fallbacks = append(fallbacks, addr)
+		}
+	}
+	return primaries, fallbacks
+}
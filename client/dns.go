@@ -0,0 +1,208 @@
+package client
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// Resolver looks up the IP addresses of a host. *net.Resolver implements it.
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// familyResolver is implemented by resolvers that can look up a single
+// address family, such as *net.Resolver. network is "ip", "ip4" or "ip6".
+type familyResolver interface {
+	LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error)
+}
+
+// lookupFamily resolves host, querying only the family of network when the
+// resolver supports it. Other resolvers return every family and the caller
+// is expected to filter.
+func lookupFamily(ctx context.Context, r Resolver, network, host string) ([]net.IPAddr, error) {
+	fr, ok := r.(familyResolver)
+	if !ok || network == "ip" {
+		return r.LookupIPAddr(ctx, host)
+	}
+
+	ips, err := fr.LookupNetIP(ctx, network, host)
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]net.IPAddr, len(ips))
+	for i, ip := range ips {
+		addrs[i] = net.IPAddr{IP: ip.AsSlice(), Zone: ip.Zone()}
+	}
+	return addrs, nil
+}
+
+// defaultMaxDNSEntries bounds the answers a DNSCache keeps by default.
+const defaultMaxDNSEntries = 1024
+
+// DNSCache is a Resolver that caches the answers of another Resolver.
+type DNSCache struct {
+	// Clock, if set before first use, replaces the system clock for expiry.
+	Clock Clock
+	// MaxEntries bounds the cached answers; zero means 1024. Once it is
+	// reached, expired answers are dropped, then the one closest to expiry.
+	MaxEntries int
+
+	resolver    Resolver
+	ttl         time.Duration
+	negativeTTL time.Duration
+
+	mu       sync.Mutex
+	entries  map[dnsKey]dnsEntry
+	inflight map[dnsKey]*dnsLookup
+}
+
+// dnsKey identifies a cached lookup.
+type dnsKey struct {
+	network, host string
+}
+
+// dnsEntry is a cached answer, either addresses or a not-found error.
+type dnsEntry struct {
+	addrs   []net.IPAddr
+	err     error
+	expires time.Time
+}
+
+// dnsLookup is a lookup in progress that concurrent callers wait on.
+type dnsLookup struct {
+	done  chan struct{}
+	addrs []net.IPAddr
+	err   error
+}
+
+// NewDNSCache creates a DNSCache in front of resolver. Answers are kept for
+// ttl regardless of the record TTL, and not-found answers for negativeTTL. A
+// zero negativeTTL disables negative caching.
+func NewDNSCache(resolver Resolver, ttl, negativeTTL time.Duration) *DNSCache {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	return &DNSCache{
+		resolver:    resolver,
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		entries:     make(map[dnsKey]dnsEntry),
+		inflight:    make(map[dnsKey]*dnsLookup),
+	}
+}
+
+// LookupIPAddr returns the cached addresses of host, resolving it on a miss.
+// Concurrent misses for the same host share a single lookup.
+func (c *DNSCache) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	return c.lookup(ctx, dnsKey{network: "ip", host: host})
+}
+
+// LookupNetIP is like LookupIPAddr but limited to the family of network,
+// which is "ip", "ip4" or "ip6". Each family is cached separately.
+func (c *DNSCache) LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error) {
+	addrs, err := c.lookup(ctx, dnsKey{network: network, host: host})
+	if err != nil {
+		return nil, err
+	}
+	ips := make([]netip.Addr, 0, len(addrs))
+	for _, addr := range addrs {
+		if ip, ok := netip.AddrFromSlice(addr.IP); ok {
+			ips = append(ips, ip.Unmap().WithZone(addr.Zone))
+		}
+	}
+	return ips, nil
+}
+
+// lookup returns the cached answer for key, resolving it on a miss.
+func (c *DNSCache) lookup(ctx context.Context, key dnsKey) ([]net.IPAddr, error) {
+	c.mu.Lock()
+	if entry, ok := c.entries[key]; ok {
+		if clockOrSystem(c.Clock).Now().Before(entry.expires) {
+			c.mu.Unlock()
+			return entry.addrs, entry.err
+		}
+		delete(c.entries, key)
+	}
+
+	// Join a lookup that is already running for the host, or start one.
+	lookup, ok := c.inflight[key]
+	if !ok {
+		lookup = &dnsLookup{done: make(chan struct{})}
+		c.inflight[key] = lookup
+		go c.resolve(context.WithoutCancel(ctx), key, lookup)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-lookup.done:
+		return lookup.addrs, lookup.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// resolve runs a lookup on behalf of every caller waiting for host. It does
+// not inherit caller cancellation, so one caller giving up does not fail the
+// others.
+func (c *DNSCache) resolve(ctx context.Context, key dnsKey, lookup *dnsLookup) {
+	lookup.addrs, lookup.err = lookupFamily(ctx, c.resolver, key.network, key.host)
+
+	c.mu.Lock()
+	delete(c.inflight, key)
+	c.store(key, lookup.addrs, lookup.err)
+	c.mu.Unlock()
+	close(lookup.done)
+}
+
+// store caches the result of a lookup. Callers must hold c.mu.
+func (c *DNSCache) store(key dnsKey, addrs []net.IPAddr, err error) {
+	now := clockOrSystem(c.Clock).Now()
+	switch {
+	case err == nil:
+		c.makeRoom(now)
+		c.entries[key] = dnsEntry{addrs: addrs, expires: now.Add(c.ttl)}
+	case c.negativeTTL > 0 && isNotFound(err):
+		c.makeRoom(now)
+		c.entries[key] = dnsEntry{err: err, expires: now.Add(c.negativeTTL)}
+	}
+}
+
+// makeRoom drops answers once the cache is full: every expired one, or the
+// one closest to expiry when none has. Callers must hold c.mu.
+func (c *DNSCache) makeRoom(now time.Time) {
+	limit := cmp.Or(c.MaxEntries, defaultMaxDNSEntries)
+	if len(c.entries) < limit {
+		return
+	}
+	var oldest dnsKey
+	var oldestExpires time.Time
+	for key, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, key)
+		} else if oldestExpires.IsZero() || entry.expires.Before(oldestExpires) {
+			oldest, oldestExpires = key, entry.expires
+		}
+	}
+	if len(c.entries) >= limit {
+		delete(c.entries, oldest)
+	}
+}
+
+// Flush drops all cached answers.
+func (c *DNSCache) Flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.entries)
+}
+
+// isNotFound reports whether err is an authoritative "no such host" answer,
+// as opposed to a transient failure that must not be cached.
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
@@ -0,0 +1,81 @@
+package client_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/client"
+)
+
+// countingResolver answers every lookup with 192.0.2.1 and records the
+// hosts it was asked for.
+type countingResolver struct {
+	mu    sync.Mutex
+	hosts []string
+}
+
+// LookupIPAddr records host.
+func (r *countingResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hosts = append(r.hosts, host)
+	return []net.IPAddr{{IP: net.IPv4(192, 0, 2, 1)}}, nil
+}
+
+func TestDNSCacheMaxEntries(t *testing.T) {
+	tests := []struct {
+		name    string
+		hosts   []string // Looked up a second apart.
+		lookups string
+	}{
+		{"within the cap", []string{"a", "b", "a", "b"}, "[a b]"},
+		{"closest to expiry dropped", []string{"a", "b", "c", "b", "a", "c"}, "[a b c a]"},
+		{"expired dropped", []string{"a", "b", "wait", "c", "b", "c"}, "[a b c b]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver := &countingResolver{}
+			clock := client.NewFakeClock(time.Now())
+			cache := client.NewDNSCache(resolver, time.Minute, 0)
+			cache.Clock = clock
+			cache.MaxEntries = 2
+			for _, host := range tt.hosts {
+				clock.Advance(time.Second)
+				if host == "wait" {
+					clock.Advance(time.Minute)
+					continue
+				}
+				if _, err := cache.LookupIPAddr(context.Background(), host); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := fmt.Sprint(resolver.hosts); got != tt.lookups {
+				t.Errorf("lookups = %s, want %s", got, tt.lookups)
+			}
+		})
+	}
+}
+
+func TestDNSCacheDefaultMaxEntries(t *testing.T) {
+	resolver := &countingResolver{}
+	clock := client.NewFakeClock(time.Now())
+	cache := client.NewDNSCache(resolver, time.Hour, 0)
+	cache.Clock = clock
+	for i := range 1025 {
+		clock.Advance(time.Millisecond)
+		cache.LookupIPAddr(context.Background(), strconv.Itoa(i))
+	}
+	cache.LookupIPAddr(context.Background(), "1")
+	cache.LookupIPAddr(context.Background(), "0")
+	if got, want := len(resolver.hosts), 1026; got != want {
+		t.Errorf("lookups = %d, want %d", got, want)
+	}
+	if last := resolver.hosts[len(resolver.hosts)-1]; last != "0" {
+		t.Errorf("last lookup = %s, want the oldest host 0", last)
+	}
+}
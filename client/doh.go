@@ -0,0 +1,252 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// Well-known DNS-over-HTTPS endpoints.
+const (
+	DoHCloudflare = "https://cloudflare-dns.com/dns-query"
+	DoHGoogle     = "https://dns.google/dns-query"
+	DoHQuad9      = "https://dns.quad9.net/dns-query"
+)
+
+// DNS wire format constants used by the DoH resolver.
+const (
+	dnsTypeA       = 1
+	dnsTypeAAAA    = 28
+	dnsClassINET   = 1
+	dnsRcodeNXName = 3
+	dnsHeaderLen   = 12
+	dnsMessageType = "application/dns-message"
+	dnsMaxMessage  = 65535
+)
+
+var (
+	// errMalformedDNS is returned when a DoH answer cannot be parsed.
+	errMalformedDNS = errors.New("malformed DNS message")
+	// errNXDomain is returned by parseAnswer for NXDOMAIN responses.
+	errNXDomain = errors.New("no such host")
+)
+
+// DoHResolver is a Resolver that queries a DNS-over-HTTPS (RFC 8484)
+// endpoint.
+type DoHResolver struct {
+	endpoint string
+	client   HTTPClient
+}
+
+// NewDoHResolver creates a resolver that sends queries to endpoint using
+// client. A nil client uses a dedicated *http.Client whose own lookups, for
+// the endpoint host only, go through the system resolver. The client must
+// not itself resolve through this resolver.
+func NewDoHResolver(endpoint string, client HTTPClient) *DoHResolver {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &DoHResolver{endpoint: endpoint, client: client}
+}
+
+// WithDNSOverHTTPS makes the dialer resolve hosts through the given DoH
+// endpoint, such as DoHCloudflare.
+func WithDNSOverHTTPS(endpoint string) Option {
+	return WithResolver(NewDoHResolver(endpoint, nil))
+}
+
+// LookupIPAddr resolves the A and AAAA records of host in parallel. IPv4
+// addresses are returned first.
+func (r *DoHResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	type answer struct {
+		addrs []net.IPAddr
+		err   error
+	}
+
+	answers := make(chan answer, 1)
+	go func() {
+		addrs, err := r.query(ctx, host, dnsTypeAAAA)
+		answers <- answer{addrs, err}
+	}()
+	ipv4, err4 := r.query(ctx, host, dnsTypeA)
+	ipv6 := <-answers
+
+	addrs := append(ipv4, ipv6.addrs...)
+	if len(addrs) > 0 {
+		return addrs, nil
+	}
+	for _, err := range []error{err4, ipv6.err} {
+		if err != nil && !isNotFound(err) {
+			return nil, err
+		}
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+// LookupNetIP resolves only the records of the family of network, which is
+// "ip", "ip4" or "ip6".
+func (r *DoHResolver) LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error) {
+	var addrs []net.IPAddr
+	var err error
+	switch network {
+	case "ip4":
+		addrs, err = r.query(ctx, host, dnsTypeA)
+	case "ip6":
+		addrs, err = r.query(ctx, host, dnsTypeAAAA)
+	default:
+		addrs, err = r.LookupIPAddr(ctx, host)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+
+	ips := make([]netip.Addr, 0, len(addrs))
+	for _, addr := range addrs {
+		if ip, ok := netip.AddrFromSlice(addr.IP); ok {
+			ips = append(ips, ip.Unmap())
+		}
+	}
+	return ips, nil
+}
+
+// query sends a single question to the endpoint and returns the addresses
+// in the answer.
+func (r *DoHResolver) query(ctx context.Context, host string, qtype uint16) ([]net.IPAddr, error) {
+	msg, err := packQuestion(host, qtype)
+	if err != nil {
+		return nil, &net.DNSError{Err: err.Error(), Name: host}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.endpoint, bytes.NewReader(msg))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DoH request: %w", err)
+	}
+	req.Header.Set("Content-Type", dnsMessageType)
+	req.Header.Set("Accept", dnsMessageType)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, &net.DNSError{Err: err.Error(), Name: host, IsTemporary: true}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &net.DNSError{Err: "DoH server returned " + resp.Status, Name: host, IsTemporary: true}
+	}
+	body, err := readBodyPooled(io.LimitReader(resp.Body, dnsMaxMessage))
+	defer ReleaseBody(body)
+	if err != nil {
+		return nil, &net.DNSError{Err: err.Error(), Name: host, IsTemporary: true}
+	}
+
+	addrs, err := parseAnswer(body, qtype)
+	if err != nil {
+		return nil, &net.DNSError{Err: err.Error(), Name: host, IsNotFound: errors.Is(err, errNXDomain)}
+	}
+	return addrs, nil
+}
+
+// packQuestion builds a recursive DNS query for host. The ID is zero, as
+// RFC 8484 recommends for cache friendliness.
+func packQuestion(host string, qtype uint16) ([]byte, error) {
+	msg := make([]byte, dnsHeaderLen, dnsHeaderLen+len(host)+6)
+	binary.BigEndian.PutUint16(msg[2:], 0x0100) // recursion desired
+	binary.BigEndian.PutUint16(msg[4:], 1)      // one question
+
+	for _, label := range strings.Split(strings.TrimSuffix(host, "."), ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return nil, fmt.Errorf("invalid host name %q", host)
+		}
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	msg = append(msg, 0)
+	msg = binary.BigEndian.AppendUint16(msg, qtype)
+	msg = binary.BigEndian.AppendUint16(msg, dnsClassINET)
+	return msg, nil
+}
+
+// parseAnswer extracts the records of type qtype from a DNS response.
+func parseAnswer(msg []byte, qtype uint16) ([]net.IPAddr, error) {
+	if len(msg) < dnsHeaderLen {
+		return nil, errMalformedDNS
+	}
+	switch rcode := binary.BigEndian.Uint16(msg[2:]) & 0x000f; rcode {
+	case 0:
+	case dnsRcodeNXName:
+		return nil, errNXDomain
+	default:
+		return nil, fmt.Errorf("DNS server returned rcode %d", rcode)
+	}
+	questions := int(binary.BigEndian.Uint16(msg[4:]))
+	answers := int(binary.BigEndian.Uint16(msg[6:]))
+
+	off := dnsHeaderLen
+	for range questions {
+		var err error
+		if off, err = skipName(msg, off); err != nil {
+			return nil, err
+		}
+		off += 4 // type and class
+	}
+
+	var addrs []net.IPAddr
+	for range answers {
+		var err error
+		if off, err = skipName(msg, off); err != nil {
+			return nil, err
+		}
+		if off+10 > len(msg) {
+			return nil, errMalformedDNS
+		}
+		rtype := binary.BigEndian.Uint16(msg[off:])
+		rclass := binary.BigEndian.Uint16(msg[off+2:])
+		rdlen := int(binary.BigEndian.Uint16(msg[off+8:]))
+		off += 10
+		if off+rdlen > len(msg) {
+			return nil, errMalformedDNS
+		}
+		rdata := msg[off : off+rdlen]
+		off += rdlen
+
+		// Skip CNAMEs and anything else that is not the requested address.
+		if rtype != qtype || rclass != dnsClassINET {
+			continue
+		}
+		if (qtype == dnsTypeA && rdlen != net.IPv4len) || (qtype == dnsTypeAAAA && rdlen != net.IPv6len) {
+			return nil, errMalformedDNS
+		}
+		addrs = append(addrs, net.IPAddr{IP: net.IP(bytes.Clone(rdata))})
+	}
+	return addrs, nil
+}
+
+// skipName returns the offset just past the domain name starting at off.
+func skipName(msg []byte, off int) (int, error) {
+	for {
+		if off >= len(msg) {
+			return 0, errMalformedDNS
+		}
+		n := int(msg[off])
+		switch {
+		case n == 0:
+			return off + 1, nil
+		case n&0xc0 == 0xc0:
+			// A compression pointer ends the name.
+			return off + 2, nil
+		default:
+			off += 1 + n
+		}
+	}
+}
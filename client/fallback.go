@@ -0,0 +1,108 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/internal/httpx"
+)
+
+// http1FallbackFor is how long a host is sent over HTTP/1.1 after an HTTP/2
+// failure under FallbackHTTP1.
+const http1FallbackFor = 5 * time.Minute
+
+// ErrHTTP2 wraps errors caused by the HTTP/2 connection rather than by the
+// request, such as GOAWAY frames, stream resets and lost connections.
+var ErrHTTP2 = errors.New("http2 connection failure")
+
+// http2FailureMarkers identify HTTP/2 connection failures, whose error types
+// are not exported by net/http.
+var http2FailureMarkers = []string{
+	"http2: server sent GOAWAY",
+	"http2: Transport received Server's graceful shutdown GOAWAY",
+	"http2: client connection lost",
+	"http2: client conn is closed",
+	"http2: client conn not usable",
+	"stream error: stream ID",
+	"connection error: ",
+}
+
+// ProtocolFallback decides what the transport does when an HTTP/2 request
+// fails before a response arrives.
+type ProtocolFallback int
+
+const (
+	// FallbackNone returns the error to the caller.
+	FallbackNone ProtocolFallback = iota
+	// FallbackRetry retries the request once, which uses a new connection
+	// since the transport drops broken HTTP/2 connections.
+	FallbackRetry
+	// FallbackHTTP1 retries the request once over HTTP/1.1 and keeps using
+	// HTTP/1.1 for that host for a while.
+	FallbackHTTP1
+)
+
+// WithProtocolFallback sets how HTTP/2 connection failures are handled.
+// Requests are only retried when their method is idempotent and their body
+// can be replayed. Whatever the policy, such failures are reported wrapped
+// in ErrHTTP2.
+func WithProtocolFallback(p ProtocolFallback) Option {
+	return func(c *config) {
+		c.protocolFallback = p
+	}
+}
+
+// roundTripHTTP2 sends the request over the HTTP/2-capable transport,
+// applying the protocol fallback policy to HTTP/2 failures.
+func (t *Transport) roundTripHTTP2(req *http.Request) (*http.Response, error) {
+	if t.h1 != nil && t.useHTTP1(req.URL.Host) {
+		return t.roundTripTracked(t.h1, req)
+	}
+
+	resp, err := t.roundTripTracked(t.rt, req)
+	if err == nil || !isHTTP2Failure(err) {
+		return resp, err
+	}
+	err = fmt.Errorf("%w: %w", ErrHTTP2, err)
+
+	if t.fallback == FallbackNone || !httpx.IsIdempotent(req.Method) || req.Context().Err() != nil {
+		return nil, err
+	}
+	retry, rewindErr := httpx.RewindBody(req)
+	if rewindErr != nil {
+		return nil, err
+	}
+
+	if t.fallback == FallbackHTTP1 && t.h1 != nil {
+		t.h1Hosts.Store(req.URL.Host, t.clock.Now())
+		return t.roundTripTracked(t.h1, retry)
+	}
+	return t.roundTripTracked(t.rt, retry)
+}
+
+// useHTTP1 reports whether host recently failed over HTTP/2.
+func (t *Transport) useHTTP1(host string) bool {
+	failedAt, ok := t.h1Hosts.Load(host)
+	if !ok {
+		return false
+	}
+	if t.clock.Now().Sub(failedAt.(time.Time)) < http1FallbackFor {
+		return true
+	}
+	t.h1Hosts.Delete(host)
+	return false
+}
+
+// isHTTP2Failure reports whether err comes from a broken HTTP/2 connection.
+func isHTTP2Failure(err error) bool {
+	msg := err.Error()
+	for _, marker := range http2FailureMarkers {
+		if strings.Contains(msg, marker) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/internal/httpx"
+)
+
+// PolicyError is returned when the host policy refuses to send a request.
+type PolicyError struct {
+	Host   string
+	Reason string
+}
+
+// Error implements the error interface.
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("host %q is not allowed: %s", e.Host, e.Reason)
+}
+
+// hostPolicy restricts the hosts requests may be sent to. Patterns are
+// exact host names, globs such as "api-*.example.com", or suffixes starting
+// with a dot, like ".example.com", which match the domain and its
+// subdomains.
+type hostPolicy struct {
+	allow []string
+	deny  []string
+}
+
+// WithAllowedHosts only lets requests through to hosts matching one of the
+// patterns. It is checked before any connection is made, including for
+// redirects.
+func WithAllowedHosts(patterns ...string) Option {
+	return func(c *config) {
+		c.hostPolicy.allow = append(c.hostPolicy.allow, lowerAll(patterns)...)
+	}
+}
+
+// WithDeniedHosts refuses requests to hosts matching one of the patterns.
+// Denied patterns win over allowed ones.
+func WithDeniedHosts(patterns ...string) Option {
+	return func(c *config) {
+		c.hostPolicy.deny = append(c.hostPolicy.deny, lowerAll(patterns)...)
+	}
+}
+
+// check returns a *PolicyError if requests to host are not allowed.
+func (p *hostPolicy) check(host string) error {
+	if len(p.allow) == 0 && len(p.deny) == 0 {
+		return nil
+	}
+
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if pattern, ok := httpx.MatchHost(p.deny, host); ok {
+		return &PolicyError{Host: host, Reason: "matches denied pattern " + pattern}
+	}
+	if len(p.allow) > 0 {
+		if _, ok := httpx.MatchHost(p.allow, host); !ok {
+			return &PolicyError{Host: host, Reason: "matches no allowed pattern"}
+		}
+	}
+	return nil
+}
+
+// lowerAll returns the strings in lower case.
+func lowerAll(values []string) []string {
+	lowered := make([]string, len(values))
+	for i, v := range values {
+		lowered[i] = strings.ToLower(v)
+	}
+	return lowered
+}
@@ -0,0 +1,83 @@
+//go:build http3
+
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// newHTTP3RoundTripper creates a quic-go based HTTP/3 round tripper dialing
+// through d, so QUIC connections get the same resolution, address family,
+// local address and SSRF rules as TCP ones.
+func newHTTP3RoundTripper(tlsConfig *tls.Config, d *dialer) http.RoundTripper {
+	return &http3.Transport{TLSClientConfig: tlsConfig, Dial: d.dialQUIC}
+}
+
+// dialQUIC connects to addr over QUIC, trying its addresses in turn. Errors
+// are wrapped in errHTTP3Dial, since no request was sent.
+func (d *dialer) dialQUIC(ctx context.Context, addr string, tlsConfig *tls.Config, quicConfig *quic.Config) (*quic.Conn, error) {
+	network := d.restrictNetwork("udp")
+	addrs, port, err := d.resolve(ctx, network, addr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errHTTP3Dial, err)
+	}
+	portNum, err := net.LookupPort(network, port)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errHTTP3Dial, err)
+	}
+
+	var firstErr error
+	for _, ip := range addrs {
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("%w: %w", errHTTP3Dial, err)
+		}
+		conn, err := d.dialQUICAddr(ctx, network, &net.UDPAddr{IP: ip.IP, Port: portNum, Zone: ip.Zone}, tlsConfig, quicConfig)
+		if err == nil {
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return nil, fmt.Errorf("%w: %w", errHTTP3Dial, firstErr)
+}
+
+// dialQUICAddr connects to a single address from the configured local
+// address, completing the handshake before returning.
+func (d *dialer) dialQUICAddr(ctx context.Context, network string, addr *net.UDPAddr, tlsConfig *tls.Config, quicConfig *quic.Config) (*quic.Conn, error) {
+	if d.ssrf != nil {
+		ip, _ := netip.AddrFromSlice(addr.IP)
+		if err := d.ssrf.check(ip); err != nil {
+			return nil, err
+		}
+	}
+	local, err := d.localAddr(addr.IP)
+	if err != nil {
+		return nil, err
+	}
+	var laddr *net.UDPAddr
+	if local.IsValid() {
+		laddr = &net.UDPAddr{IP: local.AsSlice(), Zone: local.Zone()}
+	}
+
+	udpConn, err := net.ListenUDP(network, laddr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := quic.Dial(ctx, udpConn, addr, tlsConfig, quicConfig)
+	if err != nil {
+		udpConn.Close()
+		return nil, err
+	}
+	// quic-go leaves sockets it did not create open.
+	context.AfterFunc(conn.Context(), func() { udpConn.Close() })
+	return conn, nil
+}
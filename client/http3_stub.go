@@ -0,0 +1,14 @@
+//go:build !http3
+
+package client
+
+import (
+	"crypto/tls"
+	"net/http"
+)
+
+// newHTTP3RoundTripper returns nil when HTTP/3 support is not compiled in,
+// which makes the managed transport fall back to HTTP/2.
+func newHTTP3RoundTripper(tlsConfig *tls.Config, d *dialer) http.RoundTripper {
+	return nil
+}
@@ -0,0 +1,87 @@
+//go:build http3
+
+package client_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/client"
+)
+
+// altSvcStep is a request of a TestHTTP3AltSvc case.
+type altSvcStep struct {
+	advance time.Duration
+	altSvc  string // Answered in Alt-Svc, with %d standing for the port.
+	proto   string // Protocol the request should use.
+}
+
+func TestHTTP3AltSvc(t *testing.T) {
+	// The same handler answers over TCP and over QUIC on the same port.
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if alt := r.URL.Query().Get("alt"); alt != "" {
+			w.Header().Set("Alt-Svc", alt)
+		}
+	})
+	srv := httptest.NewUnstartedServer(handler)
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	udp, err := net.ListenPacket("udp", "127.0.0.1:"+port)
+	if err != nil {
+		t.Skipf("UDP port %s is taken: %v", port, err)
+	}
+	h3 := &http3.Server{Handler: handler, TLSConfig: http3.ConfigureTLSConfig(&tls.Config{Certificates: srv.TLS.Certificates})}
+	go h3.Serve(udp)
+	defer h3.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+
+	const h2, h3Proto = "HTTP/2.0", "HTTP/3.0"
+	tests := []struct {
+		name  string
+		steps []altSvcStep
+	}{
+		{"not advertised", []altSvcStep{{proto: h2}, {proto: h2}}},
+		{"advertised", []altSvcStep{{altSvc: `h3=":%d"`, proto: h2}, {proto: h3Proto}, {proto: h3Proto}}},
+		{"advertised among others", []altSvcStep{{altSvc: `h2="alt.example.com:443", h3=":%d"; ma=60; persist=1`, proto: h2}, {proto: h3Proto}}},
+		{"other port", []altSvcStep{{altSvc: `h3=":1"`, proto: h2}, {proto: h2}}},
+		{"other host", []altSvcStep{{altSvc: `h3="alt.example.com:%d"`, proto: h2}, {proto: h2}}},
+		{"draft version", []altSvcStep{{altSvc: `h3-29=":%d"`, proto: h2}, {proto: h2}}},
+		{"zero max age", []altSvcStep{{altSvc: `h3=":%d"; ma=0`, proto: h2}, {proto: h2}}},
+		{"expired", []altSvcStep{{altSvc: `h3=":%d"; ma=60`, proto: h2}, {advance: 59 * time.Second, proto: h3Proto}, {advance: time.Second, proto: h2}}},
+		{"cleared", []altSvcStep{{altSvc: `h3=":%d"`, proto: h2}, {altSvc: "clear", proto: h3Proto}, {proto: h2}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := client.NewFakeClock(time.Now())
+			httpClient := client.NewHTTPClient(client.WithHTTP3(), client.WithTLSConfig(&tls.Config{RootCAs: roots}), client.WithClock(clock))
+			defer httpClient.CloseIdleConnections()
+			for i, step := range tt.steps {
+				clock.Advance(step.advance)
+				u := srv.URL + "/"
+				if step.altSvc != "" {
+					u += "?alt=" + url.QueryEscape(strings.ReplaceAll(step.altSvc, "%d", port))
+				}
+				resp, err := httpClient.Get(u)
+				if err != nil {
+					t.Fatalf("step %d: %v", i, err)
+				}
+				resp.Body.Close()
+				if resp.Proto != step.proto {
+					t.Errorf("step %d: proto = %s, want %s", i, resp.Proto, step.proto)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/internal/httpx"
+)
+
+// DefaultMaxJSONSize caps the size of the JSON bodies the JSON helpers
+// decode.
+const DefaultMaxJSONSize = 32 << 20
+
+// ErrBodyTooLarge is returned when a body exceeds its size cap.
+var ErrBodyTooLarge = httpx.ErrBodyTooLarge
+
+// GetJSON sends a GET request and decodes the JSON response into v. The
+// body is decoded as it streams in rather than buffered first, and bodies
+// larger than DefaultMaxJSONSize fail with ErrBodyTooLarge.
+func (c *CustomClient) GetJSON(ctx context.Context, url string, v any, opts ...RequestOption) error {
+	return c.DoJSON(ctx, http.MethodGet, url, nil, v, opts...)
+}
+
+// PostJSON sends in as a JSON POST body and decodes the JSON response into
+// out, like GetJSON.
+func (c *CustomClient) PostJSON(ctx context.Context, url string, in, out any, opts ...RequestOption) error {
+	return c.DoJSON(ctx, http.MethodPost, url, in, out, opts...)
+}
+
+// DoJSON sends a request with in, unless nil, marshaled as its JSON body,
+// and decodes the JSON response into out, unless nil. Responses with a
+// status outside 2xx fail with an *APIError; a 204 leaves out untouched.
+func (c *CustomClient) DoJSON(ctx context.Context, method, url string, in, out any, opts ...RequestOption) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("failed to encode request body: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := c.newRequest(ctx, method, url, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if out != nil {
+		req.Header.Set("Accept", "application/json")
+	}
+
+	resp, cancel, err := c.do(req, opts)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	defer resp.Body.Close()
+
+	if !successful(resp) {
+		return newAPIError(req, resp)
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, DefaultMaxJSONSize))
+		return nil
+	}
+	return httpx.DecodeJSON(resp.Body, out, DefaultMaxJSONSize)
+}
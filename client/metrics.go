@@ -0,0 +1,13 @@
+package client
+
+// Metrics receives the measurements of the client, to export them to a
+// monitoring system. Labels are given as name, value pairs. Methods are
+// called concurrently and should not block.
+type Metrics interface {
+	// AddCounter increases the counter name by delta.
+	AddCounter(name string, delta float64, labels ...string)
+	// SetGauge sets the gauge name to value.
+	SetGauge(name string, value float64, labels ...string)
+	// Observe records value in the histogram name.
+	Observe(name string, value float64, labels ...string)
+}
@@ -0,0 +1,314 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// preconnectTimeout bounds the warm-up WithPreconnect starts.
+const preconnectTimeout = 30 * time.Second
+
+// WithPreconnect makes the transport open n connections to the base URL of
+// the client and to each target URL, including the TLS handshake, so the
+// first requests after startup skip the connection setup. The base URL is
+// warmed up when it is set with SetBaseURL; list failover endpoints as
+// targets. The warm-up runs in the background; failures only leave the pool
+// cold. Use Transport.Preconnect to warm up on demand.
+func WithPreconnect(n int, targets ...string) Option {
+	return func(c *config) {
+		c.preconnect = n
+		c.preconnectTargets = append(c.preconnectTargets, targets...)
+	}
+}
+
+// Preconnect opens up to n connections to each target URL and holds them
+// until the transport needs new connections to that host. The connections
+// are dialed and, for https targets, TLS-handshaked as the transport would,
+// but no request is sent. HTTP/2 servers get a single connection, since it
+// carries concurrent requests anyway, and at most MaxIdleConnsPerHost are
+// opened. Connections still unused after IdleConnTimeout are dropped. The
+// errors of the targets that could not be reached are joined.
+func (t *Transport) Preconnect(ctx context.Context, n int, targets ...string) error {
+	var (
+		mu   sync.Mutex
+		errs []error
+		wg   sync.WaitGroup
+	)
+	for _, target := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := t.preconnect(ctx, n, target); err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("failed to preconnect to %s: %w", target, err))
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// preconnect opens up to n connections to target, stopping after the first
+// when the server speaks HTTP/2. It returns the first error.
+func (t *Transport) preconnect(ctx context.Context, n int, target string) error {
+	u, err := url.Parse(target)
+	if err != nil {
+		return fmt.Errorf("failed to parse URL: %w", err)
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	if err := t.hostPolicy.check(u.Hostname()); err != nil {
+		return err
+	}
+	if host := t.hostTransport(u); host != nil {
+		return host.preconnect(ctx, n, target)
+	}
+	if t.rt.Proxy != nil {
+		// Connections to the target would not be used through a proxy.
+		if proxy, _ := t.rt.Proxy(&http.Request{URL: u}); proxy != nil {
+			return fmt.Errorf("requests to %s go through a proxy", u.Host)
+		}
+	}
+	if limit := t.rt.MaxIdleConnsPerHost; limit > 0 {
+		n = min(n, limit)
+	}
+	if n <= 0 {
+		return nil
+	}
+
+	addr := canonicalAddr(u)
+	h2, err := t.warm.open(ctx, u.Scheme, addr)
+	if err != nil || h2 {
+		return err
+	}
+	errs := make([]error, n-1)
+	var wg sync.WaitGroup
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = t.warm.open(ctx, u.Scheme, addr)
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// warmUp preconnects to targets in the background.
+func (t *Transport) warmUp(n int, targets ...string) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), preconnectTimeout)
+		defer cancel()
+		t.Preconnect(ctx, n, targets...)
+	}()
+}
+
+// warmUpBaseURL preconnects to the origin of a client's base URL, unless
+// WithPreconnect is off or already lists that origin.
+func (t *Transport) warmUpBaseURL(u *url.URL) {
+	if t.preconnectN <= 0 {
+		return
+	}
+	origin := canonicalAddr(u)
+	for _, target := range t.preconnectTargets {
+		if tu, err := url.Parse(target); err == nil && tu.Scheme == u.Scheme && canonicalAddr(tu) == origin {
+			return
+		}
+	}
+	t.warmUp(t.preconnectN, u.String())
+}
+
+// startPreconnect runs the warm-up WithPreconnect asked for.
+func (c *config) startPreconnect(t *Transport) {
+	t.preconnectN, t.preconnectTargets = c.preconnect, c.preconnectTargets
+	if c.preconnect <= 0 || len(c.preconnectTargets) == 0 {
+		return
+	}
+	t.warmUp(c.preconnect, c.preconnectTargets...)
+}
+
+// canonicalAddr returns the host:port the transport dials for u.
+func canonicalAddr(u *url.URL) string {
+	return net.JoinHostPort(u.Hostname(), canonicalPort(u))
+}
+
+// warmPool holds the connections Preconnect opened until the transport
+// dials their address, which hands them to the transport's pool. It
+// installs itself as the DialContext and DialTLSContext of the transport.
+type warmPool struct {
+	rt    *http.Transport
+	dial  dialFunc
+	stats *transportStats
+	clock Clock
+
+	mu    sync.Mutex
+	conns map[string][]warmConn
+}
+
+// warmConn is a connection waiting in a warmPool.
+type warmConn struct {
+	conn   net.Conn
+	opened time.Time
+}
+
+// newWarmPool creates the warm pool of rt, reporting handshakes to stats.
+func newWarmPool(rt *http.Transport, stats *transportStats, clock Clock) *warmPool {
+	p := &warmPool{rt: rt, dial: rt.DialContext, stats: stats, clock: clock}
+	rt.DialContext = p.dialContext
+	rt.DialTLSContext = p.dialTLSContext
+
+	// Set up HTTP/2 now rather than on the first request, since it edits
+	// the TLSClientConfig handshakes read.
+	rt.CloseIdleConnections()
+	return p
+}
+
+// dialContext returns a preconnected plain connection to addr, or dials one.
+func (p *warmPool) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if conn := p.take("http", addr); conn != nil {
+		return conn, nil
+	}
+	return p.dial(ctx, network, addr)
+}
+
+// dialTLSContext returns a preconnected TLS connection to addr, or dials
+// one and completes its handshake.
+func (p *warmPool) dialTLSContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	// The transport reports a handshake for the returned connection, which
+	// was already counted when it was done.
+	if conn := p.take("https", addr); conn != nil {
+		skipHandshakeTrace(ctx)
+		return conn, nil
+	}
+	conn, err := p.handshake(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	skipHandshakeTrace(ctx)
+	return conn, nil
+}
+
+// handshake dials addr and completes the TLS handshake the way the
+// transport does, within its TLSHandshakeTimeout.
+func (p *warmPool) handshake(ctx context.Context, network, addr string) (*tls.Conn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := p.dial(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	config := p.rt.TLSClientConfig.Clone()
+	if config == nil {
+		config = &tls.Config{}
+	}
+	if config.ServerName == "" {
+		config.ServerName = host
+	}
+	tlsConn := tls.Client(conn, config)
+	if timeout := p.rt.TLSHandshakeTimeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	start := time.Now()
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	p.stats.handshakes.Add(1)
+	p.stats.tlsTime.Add(int64(time.Since(start)))
+	return tlsConn, nil
+}
+
+// open dials a connection to addr for scheme and adds it to the pool. It
+// reports whether the server negotiated HTTP/2.
+func (p *warmPool) open(ctx context.Context, scheme, addr string) (bool, error) {
+	if scheme == "http" {
+		conn, err := p.dial(ctx, "tcp", addr)
+		if err != nil {
+			return false, err
+		}
+		p.put(scheme, addr, conn)
+		return false, nil
+	}
+	conn, err := p.handshake(ctx, "tcp", addr)
+	if err != nil {
+		return false, err
+	}
+	p.put(scheme, addr, conn)
+	return conn.ConnectionState().NegotiatedProtocol == "h2", nil
+}
+
+// put adds conn to the connections waiting for addr.
+func (p *warmPool) put(scheme, addr string, conn net.Conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conns == nil {
+		p.conns = make(map[string][]warmConn)
+	}
+	key := scheme + "://" + addr
+	p.conns[key] = append(p.conns[key], warmConn{conn: conn, opened: p.clock.Now()})
+}
+
+// take removes a connection to addr from the pool, closing those that
+// waited longer than IdleConnTimeout. It returns nil if none is left.
+func (p *warmPool) take(scheme, addr string) net.Conn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	key := scheme + "://" + addr
+	conns := p.conns[key]
+	now := p.clock.Now()
+	for len(conns) > 0 {
+		wc := conns[len(conns)-1]
+		conns = conns[:len(conns)-1]
+		if idle := p.rt.IdleConnTimeout; idle > 0 && now.Sub(wc.opened) >= idle {
+			wc.conn.Close()
+			continue
+		}
+		p.conns[key] = conns
+		return wc.conn
+	}
+	delete(p.conns, key)
+	return nil
+}
+
+// close closes the connections waiting in the pool.
+func (p *warmPool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, conns := range p.conns {
+		for _, wc := range conns {
+			wc.conn.Close()
+		}
+	}
+	p.conns = nil
+}
+
+// skipHandshakeKey is the context key of the flag telling the stats trace
+// of a request to ignore the TLS handshake the transport reports.
+type skipHandshakeKey struct{}
+
+// skipHandshakeTrace sets the flag of skipHandshakeKey in ctx, if any.
+func skipHandshakeTrace(ctx context.Context) {
+	if skip, ok := ctx.Value(skipHandshakeKey{}).(*atomic.Bool); ok {
+		skip.Store(true)
+	}
+}
@@ -0,0 +1,165 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/internal/httpx"
+)
+
+// Defaults of PrefetchConfig.
+const (
+	DefaultPrefetchConcurrency = 4
+	DefaultPrefetchAttempts    = 3
+	defaultPrefetchBackoff     = time.Second
+)
+
+// PrefetchConfig configures PrefetchWith.
+type PrefetchConfig struct {
+	// Concurrency bounds the requests in flight; zero means
+	// DefaultPrefetchConcurrency.
+	Concurrency int
+	// Attempts bounds the tries per URL answered with 429 Too Many Requests
+	// or 503 Service Unavailable; zero means DefaultPrefetchAttempts.
+	Attempts int
+	// Clock paces the pauses; nil uses SystemClock.
+	Clock Clock
+}
+
+// Prefetch sends GET requests for urls through the middleware chain so a
+// cache in it stores fresh responses, warming it up before traffic spikes.
+// It returns once every URL was fetched; run it in a goroutine to warm up
+// in the background.
+func (c *CustomClient) Prefetch(ctx context.Context, urls ...string) error {
+	return c.PrefetchWith(ctx, PrefetchConfig{}, urls...)
+}
+
+// PrefetchWith is Prefetch with explicit settings. The requests carry
+// Cache-Control: no-cache, so stored entries are revalidated rather than
+// served. When the origin answers 429 or 503, all workers pause for its
+// Retry-After before retrying. URLs answered with a status other than 2xx
+// or 304 Not Modified fail with an *APIError. The errors of the URLs that
+// could not be fetched are joined.
+func (c *CustomClient) PrefetchWith(ctx context.Context, cfg PrefetchConfig, urls ...string) error {
+	concurrency := cfg.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultPrefetchConcurrency
+	}
+	p := &prefetcher{client: c.httpClient, newRequest: c.newRequest, clock: clockOrSystem(cfg.Clock), attempts: cfg.Attempts}
+	if p.attempts <= 0 {
+		p.attempts = DefaultPrefetchAttempts
+	}
+
+	queue := make(chan string)
+	var wg sync.WaitGroup
+	for range min(concurrency, len(urls)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for u := range queue {
+				if err := p.fetch(ctx, u); err != nil {
+					p.fail(fmt.Errorf("failed to prefetch %s: %w", u, err))
+				}
+			}
+		}()
+	}
+	for _, u := range urls {
+		select {
+		case queue <- u:
+		case <-ctx.Done():
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		p.fail(err)
+	}
+	return errors.Join(p.errs...)
+}
+
+// prefetcher holds the state shared by the prefetch workers.
+type prefetcher struct {
+	client     HTTPClient
+	newRequest func(ctx context.Context, method, url string, body io.Reader) (*http.Request, error)
+	clock      Clock
+	attempts   int
+
+	mu          sync.Mutex
+	pausedUntil time.Time
+	errs        []error
+}
+
+// fetch sends a GET of u, retrying while the origin pushes back.
+func (p *prefetcher) fetch(ctx context.Context, u string) error {
+	for attempt := 1; ; attempt++ {
+		if err := p.wait(ctx); err != nil {
+			return err
+		}
+		req, err := p.newRequest(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Cache-Control", "no-cache")
+
+		resp, err := p.client.Do(req)
+		if err != nil {
+			return err
+		}
+		if successful(resp) || resp.StatusCode == http.StatusNotModified {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			return nil
+		}
+		pushedBack := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable
+		if !pushedBack || attempt >= p.attempts {
+			err := newAPIError(req, resp)
+			resp.Body.Close()
+			return err
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		wait, ok := httpx.ParseRetryAfter(resp.Header, p.clock.Now())
+		if !ok {
+			wait = defaultPrefetchBackoff
+		}
+		p.pause(wait)
+	}
+}
+
+// wait blocks while the workers are paused.
+func (p *prefetcher) wait(ctx context.Context) error {
+	for {
+		p.mu.Lock()
+		d := p.pausedUntil.Sub(p.clock.Now())
+		p.mu.Unlock()
+		if d <= 0 {
+			return ctx.Err()
+		}
+		if err := p.clock.Sleep(ctx, d); err != nil {
+			return err
+		}
+	}
+}
+
+// pause stops the workers for d.
+func (p *prefetcher) pause(d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if until := p.clock.Now().Add(d); until.After(p.pausedUntil) {
+		p.pausedUntil = until
+	}
+}
+
+// fail records the error of a URL.
+func (p *prefetcher) fail(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.errs = append(p.errs, err)
+}
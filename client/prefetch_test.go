@@ -0,0 +1,68 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/client"
+)
+
+func TestPrefetch(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int // Answered to each request of a URL in turn.
+		sent     int
+		status   int // Of the *APIError returned, or zero for none.
+	}{
+		{"ok", []int{200}, 1, 0},
+		{"not modified", []int{304}, 1, 0},
+		{"not found", []int{404}, 1, 404},
+		{"unauthorized", []int{401}, 1, 401},
+		{"server error", []int{500}, 1, 500},
+		{"redirect not followed", []int{302}, 1, 302},
+		{"retried after 429", []int{429, 200}, 2, 0},
+		{"retried after 503", []int{503, 503, 200}, 3, 0},
+		{"retries exhausted", []int{503}, 3, 503},
+		{"error after a retry", []int{429, 500}, 2, 500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			sent := make(map[string]int)
+			base := client.HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				n := sent[req.URL.Path]
+				sent[req.URL.Path]++
+				status := tt.statuses[min(n, len(tt.statuses)-1)]
+				header := http.Header{"Retry-After": {"0"}}
+				return &http.Response{StatusCode: status, Status: http.StatusText(status), Header: header, Body: http.NoBody, Request: req}, nil
+			})
+			c := client.NewCustomClient(base)
+			err := c.Prefetch(context.Background(), "https://example.com/a", "https://example.com/b")
+
+			for _, path := range []string{"/a", "/b"} {
+				if sent[path] != tt.sent {
+					t.Errorf("%s sent %d times, want %d", path, sent[path], tt.sent)
+				}
+			}
+			if tt.status == 0 {
+				if err != nil {
+					t.Fatalf("err = %v", err)
+				}
+				return
+			}
+			var apiErr *client.APIError
+			if !errors.As(err, &apiErr) || apiErr.StatusCode != tt.status {
+				t.Fatalf("err = %v, want an *APIError with status %d", err, tt.status)
+			}
+			if n := strings.Count(err.Error(), "failed to prefetch"); n != 2 {
+				t.Errorf("err = %v, want both URLs reported", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// defaultMaxRedirects is how many redirects a request follows by default.
+// net/http stops one earlier: its limit of 10 counts requests, the first
+// one included, so it follows 9 redirects.
+const defaultMaxRedirects = 10
+
+// defaultSensitiveHeaders are removed from redirects that leave the origin
+// of the original request.
+var defaultSensitiveHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"X-Api-Key",
+	"X-Amz-Security-Token",
+}
+
+var (
+	// ErrTooManyRedirects is returned when a request exceeds the redirect limit.
+	ErrTooManyRedirects = errors.New("too many redirects")
+	// ErrCrossHostRedirect is returned when a same-host-only client is
+	// redirected to another host.
+	ErrCrossHostRedirect = errors.New("redirect to a different host")
+	// ErrRedirectDowngrade is returned when an https request is redirected to
+	// a plain http URL.
+	ErrRedirectDowngrade = errors.New("redirect downgrades https to http")
+)
+
+// RedirectHook is called before each redirect is followed, with the next
+// request and the requests made so far, oldest first. It may modify the next
+// request. Returning an error stops the redirect chain; returning
+// http.ErrUseLastResponse hands the redirect response to the caller.
+type RedirectHook func(req *http.Request, via []*http.Request) error
+
+// redirectPolicy decides which redirects the client follows.
+type redirectPolicy struct {
+	max         int
+	sameHost    bool
+	noDowngrade bool
+	hooks       []RedirectHook
+
+	// sensitiveHeaders are stripped on cross-origin redirects unless the
+	// target host is in trustedHosts.
+	sensitiveHeaders []string
+	trustedHosts     map[string]bool
+}
+
+// WithMaxRedirects sets how many redirects a request may follow. Zero makes
+// the client return redirect responses instead of following them.
+func WithMaxRedirects(n int) Option {
+	return func(c *config) {
+		c.redirect.max = n
+	}
+}
+
+// WithSameHostRedirects only follows redirects that stay on the host of the
+// original request.
+func WithSameHostRedirects() Option {
+	return func(c *config) {
+		c.redirect.sameHost = true
+	}
+}
+
+// WithoutRedirectDowngrade refuses redirects from https to plain http.
+func WithoutRedirectDowngrade() Option {
+	return func(c *config) {
+		c.redirect.noDowngrade = true
+	}
+}
+
+// WithRedirectHook registers a hook that runs before each redirect, after
+// the built-in checks passed. Hooks run in the order they were added.
+func WithRedirectHook(hook RedirectHook) Option {
+	return func(c *config) {
+		c.redirect.hooks = append(c.redirect.hooks, hook)
+	}
+}
+
+// WithRedirectSensitiveHeaders adds headers to strip when a redirect leaves
+// the origin of the original request. Authorization, Proxy-Authorization,
+// Cookie, X-Api-Key and X-Amz-Security-Token are always stripped.
+func WithRedirectSensitiveHeaders(headers ...string) Option {
+	return func(c *config) {
+		c.redirect.sensitiveHeaders = append(c.redirect.sensitiveHeaders, headers...)
+	}
+}
+
+// WithTrustedRedirectHosts lists hosts that keep receiving the credentials of
+// the original request when a redirect points to them from another origin.
+func WithTrustedRedirectHosts(hosts ...string) Option {
+	return func(c *config) {
+		if c.redirect.trustedHosts == nil {
+			c.redirect.trustedHosts = make(map[string]bool)
+		}
+		for _, host := range hosts {
+			c.redirect.trustedHosts[strings.ToLower(host)] = true
+		}
+	}
+}
+
+// SetRedirectPolicy makes the client follow redirects according to the
+// redirect options, such as WithMaxRedirects and WithTrustedRedirectHosts;
+// other options are ignored. It fails unless the base client is an
+// *http.Client, which is copied rather than modified. Like Use, it must not
+// run concurrently with requests.
+func (c *CustomClient) SetRedirectPolicy(opts ...Option) error {
+	base, ok := c.base.(*http.Client)
+	if !ok {
+		return fmt.Errorf("failed to set redirect policy: base client %T does not follow redirects", c.base)
+	}
+	policy := newConfig(opts).redirect
+	c.base = withRedirectPolicy(base, &policy)
+	c.compose()
+	return nil
+}
+
+// secureRedirects gives an *http.Client base that has no redirect policy of
+// its own the default one, so the credentials added by middleware are
+// stripped from redirects to other origins. net/http only strips some of
+// them, and keeps them for subdomains.
+func secureRedirects(base HTTPClient) HTTPClient {
+	httpClient, ok := base.(*http.Client)
+	if !ok || httpClient.CheckRedirect != nil {
+		return base
+	}
+	policy := newConfig(nil).redirect
+	return withRedirectPolicy(httpClient, &policy)
+}
+
+// withRedirectPolicy returns a copy of base following redirects according
+// to policy.
+func withRedirectPolicy(base *http.Client, policy *redirectPolicy) *http.Client {
+	httpClient := *base
+	httpClient.CheckRedirect = policy.checkRedirect
+	return &httpClient
+}
+
+// checkRedirect implements http.Client.CheckRedirect.
+func (p *redirectPolicy) checkRedirect(req *http.Request, via []*http.Request) error {
+	if p.max == 0 {
+		return http.ErrUseLastResponse
+	}
+	if len(via) > p.max {
+		return fmt.Errorf("%w: stopped after %d", ErrTooManyRedirects, p.max)
+	}
+
+	prev := via[len(via)-1]
+	if p.noDowngrade && prev.URL.Scheme == "https" && req.URL.Scheme == "http" {
+		return fmt.Errorf("%w: %s", ErrRedirectDowngrade, req.URL.Redacted())
+	}
+	if p.sameHost && req.URL.Host != via[0].URL.Host {
+		return fmt.Errorf("%w: %s", ErrCrossHostRedirect, req.URL.Host)
+	}
+
+	// Keep credentials from leaking to other origins. net/http drops some of
+	// them on its own, so restore them for trusted hosts.
+	if !sameOrigin(req, via[0]) {
+		trusted := p.trustedHosts[strings.ToLower(req.URL.Hostname())]
+		for _, header := range p.sensitiveHeaders {
+			if values := via[0].Header.Values(header); trusted && len(values) > 0 {
+				req.Header[http.CanonicalHeaderKey(header)] = values
+			} else {
+				req.Header.Del(header)
+			}
+		}
+	}
+
+	for _, hook := range p.hooks {
+		if err := hook(req, via); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sameOrigin reports whether both requests target the same scheme, host and
+// port.
+func sameOrigin(a, b *http.Request) bool {
+	return a.URL.Scheme == b.URL.Scheme && strings.EqualFold(a.URL.Host, b.URL.Host)
+}
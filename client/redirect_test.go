@@ -0,0 +1,334 @@
+package client_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/client"
+)
+
+// redirectServer starts a server redirecting /n to /n-1 down to /0, which
+// answers 200, and /to?url=u to u.
+func redirectServer(t *testing.T, newServer func(http.Handler) *httptest.Server) *httptest.Server {
+	t.Helper()
+	srv := newServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/to" {
+			http.Redirect(w, r, r.URL.Query().Get("url"), http.StatusFound)
+			return
+		}
+		n, _ := strconv.Atoi(r.URL.Path[1:])
+		if n > 0 {
+			http.Redirect(w, r, fmt.Sprintf("/%d", n-1), http.StatusFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRedirectPolicy(t *testing.T) {
+	srv := redirectServer(t, httptest.NewServer)
+	other := redirectServer(t, httptest.NewServer)
+	tlsSrv := redirectServer(t, httptest.NewTLSServer)
+	roots := x509.NewCertPool()
+	roots.AddCert(tlsSrv.Certificate())
+	trustTLS := client.WithTLSConfig(&tls.Config{RootCAs: roots})
+
+	tests := []struct {
+		name   string
+		opts   []client.Option
+		url    string
+		status int
+		err    error
+	}{
+		{"followed", nil, srv.URL + "/3", 200, nil},
+		{"default limit", nil, srv.URL + "/10", 200, nil},
+		{"over the default limit", nil, srv.URL + "/11", 0, client.ErrTooManyRedirects},
+		{"max redirects", []client.Option{client.WithMaxRedirects(2)}, srv.URL + "/3", 0, client.ErrTooManyRedirects},
+		{"within max redirects", []client.Option{client.WithMaxRedirects(2)}, srv.URL + "/2", 200, nil},
+		{"not followed", []client.Option{client.WithMaxRedirects(0)}, srv.URL + "/1", 302, nil},
+		{"other host", nil, srv.URL + "/to?url=" + other.URL + "/0", 200, nil},
+		{"same host only", []client.Option{client.WithSameHostRedirects()}, srv.URL + "/to?url=" + other.URL + "/0", 0, client.ErrCrossHostRedirect},
+		{"same host only stays", []client.Option{client.WithSameHostRedirects()}, srv.URL + "/2", 200, nil},
+		{"downgrade", []client.Option{trustTLS}, tlsSrv.URL + "/to?url=" + srv.URL + "/0", 200, nil},
+		{"downgrade refused", []client.Option{trustTLS, client.WithoutRedirectDowngrade()}, tlsSrv.URL + "/to?url=" + srv.URL + "/0", 0, client.ErrRedirectDowngrade},
+		{"upgrade", []client.Option{trustTLS, client.WithoutRedirectDowngrade()}, srv.URL + "/to?url=" + tlsSrv.URL + "/0", 200, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := client.NewHTTPClient(tt.opts...).Get(tt.url)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("err = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+		})
+	}
+}
+
+func TestRedirectLimit(t *testing.T) {
+	var requests int
+	srv := redirectServer(t, func(h http.Handler) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			h.ServeHTTP(w, r)
+		}))
+	})
+	tests := []struct {
+		name      string
+		opts      []client.Option
+		redirects int // Redirects the server answers with.
+		requests  int
+		err       string
+	}{
+		{"default", nil, 10, 11, ""},
+		{"over the default", nil, 11, 11, "too many redirects: stopped after 10"},
+		{"max", []client.Option{client.WithMaxRedirects(3)}, 3, 4, ""},
+		{"over the max", []client.Option{client.WithMaxRedirects(3)}, 5, 4, "too many redirects: stopped after 3"},
+		{"one", []client.Option{client.WithMaxRedirects(1)}, 1, 2, ""},
+		{"none", []client.Option{client.WithMaxRedirects(0)}, 5, 1, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests = 0
+			resp, err := client.NewHTTPClient(tt.opts...).Get(fmt.Sprintf("%s/%d", srv.URL, tt.redirects))
+			if err == nil {
+				resp.Body.Close()
+			}
+			if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.HasSuffix(err.Error(), tt.err)) {
+				t.Errorf("err = %v, want %q", err, tt.err)
+			}
+			if requests != tt.requests {
+				t.Errorf("requests = %d, want %d", requests, tt.requests)
+			}
+		})
+	}
+}
+
+func TestRedirectHook(t *testing.T) {
+	srv := redirectServer(t, httptest.NewServer)
+	stop := errors.New("stop")
+	tests := []struct {
+		name    string
+		results []error // Returned by the hooks, named a, b, ... in order.
+		status  int
+		err     error
+		calls   string
+	}{
+		{"runs in order", []error{nil, nil}, 200, nil, "[a:/1:1 b:/1:1 a:/0:2 b:/0:2]"},
+		{"stops the chain", []error{stop, nil}, 0, stop, "[a:/1:1]"},
+		{"uses the last response", []error{http.ErrUseLastResponse}, 302, nil, "[a:/1:1]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls []string
+			var opts []client.Option
+			for i, result := range tt.results {
+				name := string(rune('a' + i))
+				opts = append(opts, client.WithRedirectHook(func(req *http.Request, via []*http.Request) error {
+					calls = append(calls, fmt.Sprintf("%s:%s:%d", name, req.URL.Path, len(via)))
+					return result
+				}))
+			}
+			resp, err := client.NewHTTPClient(opts...).Get(srv.URL + "/2")
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if err == nil {
+				resp.Body.Close()
+				if resp.StatusCode != tt.status {
+					t.Errorf("status = %d, want %d", resp.StatusCode, tt.status)
+				}
+			}
+			if got := fmt.Sprint(calls); got != tt.calls {
+				t.Errorf("calls = %s, want %s", got, tt.calls)
+			}
+		})
+	}
+}
+
+func TestRedirectHookModifiesRequest(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/start" {
+			http.Redirect(w, r, "/next", http.StatusFound)
+			return
+		}
+		w.Header().Set("X-Seen", r.Header.Get("X-Hop"))
+	}))
+	defer srv.Close()
+	httpClient := client.NewHTTPClient(client.WithRedirectHook(func(req *http.Request, via []*http.Request) error {
+		req.Header.Set("X-Hop", strconv.Itoa(len(via)))
+		return nil
+	}))
+	resp, err := httpClient.Get(srv.URL + "/start")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got := resp.Header.Get("X-Seen"); got != "1" {
+		t.Errorf("X-Hop = %q, want 1", got)
+	}
+}
+
+// credentialHeaders are the headers the default redirect policy strips.
+var credentialHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "X-Api-Key", "X-Amz-Security-Token"}
+
+// keptAll expects checkReceived to find every header.
+var keptAll = map[string]bool{"Authorization": true, "Proxy-Authorization": true, "Cookie": true, "X-Api-Key": true, "X-Amz-Security-Token": true, "X-Custom": true}
+
+// headerServer starts a server answering with the credential headers and
+// X-Custom it received, as X-Got-<name>.
+func headerServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/to" {
+			http.Redirect(w, r, r.URL.Query().Get("url"), http.StatusFound)
+			return
+		}
+		for _, name := range append(credentialHeaders, "X-Custom") {
+			w.Header().Set("X-Got-"+name, r.Header.Get(name))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// credentials sets every credential header and X-Custom on requests, like
+// auth middleware does.
+func credentials(next client.HTTPClient) client.HTTPClient {
+	return client.HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+		for _, name := range append(credentialHeaders, "X-Custom") {
+			req.Header.Set(name, "secret")
+		}
+		return next.Do(req)
+	})
+}
+
+// checkReceived checks that exactly the headers in kept reached the server
+// that answered resp.
+func checkReceived(t *testing.T, resp *http.Response, kept map[string]bool) {
+	t.Helper()
+	for _, name := range append(credentialHeaders, "X-Custom") {
+		got := resp.Header.Get("X-Got-" + name)
+		if want := kept[name]; (got != "") != want {
+			t.Errorf("%s received = %q, want kept %v", name, got, want)
+		}
+	}
+}
+
+func TestRedirectCredentials(t *testing.T) {
+	srv := headerServer(t)
+	other := headerServer(t)
+	// The same servers under another host name, which net/http treats as a
+	// different domain.
+	otherName := strings.Replace(other.URL, "127.0.0.1", "localhost", 1)
+	custom := map[string]bool{"X-Custom": true}
+
+	tests := []struct {
+		name string
+		opts []client.Option
+		to   string
+		kept map[string]bool
+	}{
+		{"same origin", nil, srv.URL + "/", keptAll},
+		{"other port", nil, other.URL + "/", custom},
+		{"other host", nil, otherName + "/", custom},
+		{"extra sensitive header", []client.Option{client.WithRedirectSensitiveHeaders("X-Custom")}, other.URL + "/", nil},
+		{"trusted host", []client.Option{client.WithTrustedRedirectHosts("LOCALHOST")}, otherName + "/", keptAll},
+		{"trusted host with extra header", []client.Option{client.WithTrustedRedirectHosts("localhost"), client.WithRedirectSensitiveHeaders("X-Custom")}, otherName + "/", keptAll},
+		{"other host not trusted", []client.Option{client.WithTrustedRedirectHosts("example.com")}, otherName + "/", custom},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := client.NewCustomClient(client.NewHTTPClient(tt.opts...), credentials)
+			resp, err := c.Do(newGet(t, srv.URL+"/to?url="+url.QueryEscape(tt.to)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			checkReceived(t, resp, tt.kept)
+		})
+	}
+}
+
+func TestRedirectCredentialsDefaultClient(t *testing.T) {
+	srv := headerServer(t)
+	other := headerServer(t)
+	start := srv.URL + "/to?url=" + url.QueryEscape(other.URL+"/")
+
+	// net/http keeps headers for another port of the same host; the
+	// default policy of NewCustomClient does not.
+	c := client.NewCustomClient(&http.Client{}, credentials)
+	resp, err := c.Do(newGet(t, start))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	checkReceived(t, resp, map[string]bool{"X-Custom": true})
+
+	// A CheckRedirect of the caller's own is left alone.
+	c = client.NewCustomClient(&http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return nil }}, credentials)
+	resp, err = c.Do(newGet(t, start))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.Header.Get("X-Got-X-Api-Key") == "" {
+		t.Error("X-Api-Key stripped despite the caller's CheckRedirect")
+	}
+}
+
+func TestSetRedirectPolicy(t *testing.T) {
+	srv := headerServer(t)
+	other := headerServer(t)
+	base := &http.Client{}
+	c := client.NewCustomClient(base, credentials)
+	if err := c.SetRedirectPolicy(client.WithTrustedRedirectHosts("127.0.0.1"), client.WithMaxRedirects(1)); err != nil {
+		t.Fatal(err)
+	}
+	if base.CheckRedirect != nil {
+		t.Error("SetRedirectPolicy modified the base client")
+	}
+
+	resp, err := c.Do(newGet(t, srv.URL+"/to?url="+url.QueryEscape(other.URL+"/")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	checkReceived(t, resp, keptAll)
+
+	twice := srv.URL + "/to?url=" + url.QueryEscape(srv.URL+"/to?url="+url.QueryEscape(other.URL+"/"))
+	if _, err := c.Do(newGet(t, twice)); !errors.Is(err, client.ErrTooManyRedirects) {
+		t.Errorf("err = %v, want %v", err, client.ErrTooManyRedirects)
+	}
+
+	c = client.NewCustomClient(okClient)
+	if err := c.SetRedirectPolicy(); err == nil {
+		t.Error("SetRedirectPolicy succeeded on a base client that is not an *http.Client")
+	}
+}
+
+// newGet returns a GET request for url.
+func newGet(t *testing.T, url string) *http.Request {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
@@ -0,0 +1,98 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// RequestOption adjusts a single call of the request helpers of
+// CustomClient, such as Get or PostJSON.
+type RequestOption func(*requestConfig)
+
+// requestConfig collects the RequestOptions of a call.
+type requestConfig struct {
+	header      http.Header
+	query       url.Values
+	timeout     time.Duration
+	middlewares []Middleware
+}
+
+// WithHeader sets the header key to value on the request, replacing the
+// values the helper sets itself, such as Accept. Several WithHeader options
+// for the same key add up.
+func WithHeader(key, value string) RequestOption {
+	return func(cfg *requestConfig) {
+		if cfg.header == nil {
+			cfg.header = make(http.Header)
+		}
+		cfg.header.Add(key, value)
+	}
+}
+
+// WithQuery adds the query parameter key with value to the request URL.
+func WithQuery(key, value string) RequestOption {
+	return func(cfg *requestConfig) {
+		if cfg.query == nil {
+			cfg.query = make(url.Values)
+		}
+		cfg.query.Add(key, value)
+	}
+}
+
+// WithTimeout bounds the call, reading the response body included, to d.
+// It can only shorten the deadline of the context passed in.
+func WithTimeout(d time.Duration) RequestOption {
+	return func(cfg *requestConfig) {
+		cfg.timeout = d
+	}
+}
+
+// WithMiddleware wraps the middleware chain of the client in m for this
+// call only, as if m had been passed last to NewCustomClient. Several
+// WithMiddleware options apply in order.
+func WithMiddleware(m ...Middleware) RequestOption {
+	return func(cfg *requestConfig) {
+		cfg.middlewares = append(cfg.middlewares, m...)
+	}
+}
+
+// do applies opts to req and sends it through the middleware chain. The
+// returned cancel function releases the timeout of the call and must be
+// called once the response body is consumed.
+func (c *CustomClient) do(req *http.Request, opts []RequestOption) (*http.Response, context.CancelFunc, error) {
+	var cfg requestConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	cancel := context.CancelFunc(func() {})
+	if cfg.timeout > 0 {
+		var ctx context.Context
+		ctx, cancel = context.WithTimeout(req.Context(), cfg.timeout)
+		req = req.WithContext(ctx)
+	}
+	if len(cfg.query) > 0 {
+		query := req.URL.Query()
+		for key, values := range cfg.query {
+			query[key] = append(query[key], values...)
+		}
+		req.URL.RawQuery = query.Encode()
+	}
+	for key, values := range cfg.header {
+		req.Header[key] = values
+	}
+
+	httpClient := c.httpClient
+	for _, middleware := range cfg.middlewares {
+		httpClient = middleware(httpClient)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		cancel()
+		return nil, nil, fmt.Errorf("request failed: %w", err)
+	}
+	return resp, cancel, nil
+}
@@ -0,0 +1,92 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"syscall"
+)
+
+// ErrForbiddenAddress is returned when SSRF protection refuses to connect to
+// an internal address.
+var ErrForbiddenAddress = errors.New("destination address is forbidden")
+
+// internalPrefixes are ranges that are not covered by the netip.Addr
+// predicates but must not be reachable from user-supplied URLs either. The
+// IPv6 ranges embed an IPv4 address that translators or relays reach, so
+// they would otherwise tunnel to internal IPv4 hosts.
+var internalPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "this" network
+	netip.MustParsePrefix("100.64.0.0/10"),   // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // documentation (TEST-NET-1)
+	netip.MustParsePrefix("198.18.0.0/15"),   // benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // documentation (TEST-NET-2)
+	netip.MustParsePrefix("203.0.113.0/24"),  // documentation (TEST-NET-3)
+	netip.MustParsePrefix("240.0.0.0/4"),     // reserved, including broadcast
+	netip.MustParsePrefix("::/96"),           // IPv4-compatible (deprecated)
+	netip.MustParsePrefix("64:ff9b::/96"),    // NAT64
+	netip.MustParsePrefix("64:ff9b:1::/48"),  // local-use NAT64
+	netip.MustParsePrefix("2001:db8::/32"),   // documentation
+	netip.MustParsePrefix("2002::/16"),       // 6to4
+	netip.MustParsePrefix("3fff::/20"),       // documentation
+}
+
+// ssrfGuard rejects connections to internal addresses unless allowlisted.
+type ssrfGuard struct {
+	allow []netip.Prefix
+}
+
+// WithSSRFProtection refuses to connect to private, loopback, link-local,
+// reserved and documentation addresses, and to IPv6 ranges that embed an
+// IPv4 address such as NAT64 and 6to4, except those inside the allow
+// prefixes. The check
+// runs on the resolved address right before connecting, so DNS rebinding
+// cannot bypass it. Proxies from the environment are ignored while it is on,
+// since the proxy rather than the destination would be checked.
+func WithSSRFProtection(allow ...netip.Prefix) Option {
+	return func(c *config) {
+		c.ssrf = &ssrfGuard{allow: allow}
+	}
+}
+
+// control is a net.Dialer ControlContext hook that vets each address the
+// dialer is about to connect to.
+func (g *ssrfGuard) control(ctx context.Context, network, address string, conn syscall.RawConn) error {
+	ap, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, address)
+	}
+	return g.check(ap.Addr())
+}
+
+// check refuses ip unless it is public or allowlisted.
+func (g *ssrfGuard) check(ip netip.Addr) error {
+	ip = ip.Unmap()
+	for _, prefix := range g.allow {
+		if prefix.Contains(ip) {
+			return nil
+		}
+	}
+	if isInternal(ip) {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, ip)
+	}
+	return nil
+}
+
+// isInternal reports whether ip belongs to a range that is not publicly
+// routable.
+func isInternal(ip netip.Addr) bool {
+	if ip.IsPrivate() || ip.IsLoopback() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return true
+	}
+	for _, prefix := range internalPrefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,157 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/client"
+)
+
+// resolverFunc is a client.Resolver backed by a function.
+type resolverFunc func(ctx context.Context, host string) ([]net.IPAddr, error)
+
+// LookupIPAddr calls fn.
+func (fn resolverFunc) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	return fn(ctx, host)
+}
+
+// resolveTo returns a resolver answering every lookup with ips.
+func resolveTo(ips ...string) client.Resolver {
+	return resolverFunc(func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		addrs := make([]net.IPAddr, len(ips))
+		for i, ip := range ips {
+			addrs[i] = net.IPAddr{IP: net.ParseIP(ip)}
+		}
+		return addrs, nil
+	})
+}
+
+func TestSSRFProtectionAddresses(t *testing.T) {
+	tests := []struct {
+		ip        string
+		forbidden bool
+	}{
+		{"127.0.0.1", true},
+		{"::1", true},
+		{"::ffff:127.0.0.1", true},
+		{"10.1.2.3", true},
+		{"172.16.0.1", true},
+		{"192.168.1.1", true},
+		{"fc00::1", true},
+		{"169.254.169.254", true},
+		{"fe80::1", true},
+		{"0.0.0.0", true},
+		{"0.1.2.3", true},
+		{"100.64.0.1", true},
+		{"224.0.0.1", true},
+		{"ff02::1", true},
+		{"192.0.0.8", true},
+		{"192.0.2.1", true},
+		{"198.18.0.1", true},
+		{"198.19.255.255", true},
+		{"198.51.100.1", true},
+		{"203.0.113.1", true},
+		{"240.0.0.1", true},
+		{"255.255.255.255", true},
+		{"::7f00:1", true},
+		{"64:ff9b::7f00:1", true},
+		{"64:ff9b::a00:1", true},
+		{"64:ff9b:1::a00:1", true},
+		{"2002:7f00:1::", true},
+		{"2002:5db8:d822::1", true},
+		{"2001:db8::1", true},
+		{"3fff::1", true},
+		{"198.20.0.1", false},
+		{"93.184.216.34", false},
+		{"2606:2800:220:1::1", false},
+	}
+	httpClient := client.NewHTTPClient(client.WithSSRFProtection())
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			// Public addresses may not be reachable from here, so the
+			// request only has to get past the guard.
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			u := url.URL{Scheme: "http", Host: net.JoinHostPort(tt.ip, "80"), Path: "/"}
+			req, _ := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+			resp, err := httpClient.Do(req)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if forbidden := errors.Is(err, client.ErrForbiddenAddress); forbidden != tt.forbidden {
+				t.Errorf("err = %v, want forbidden %v", err, tt.forbidden)
+			}
+		})
+	}
+}
+
+func TestSSRFProtection(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	byName := "http://api.example.com:" + port + "/"
+	loopback := netip.MustParsePrefix("127.0.0.0/8")
+
+	tests := []struct {
+		name      string
+		opts      []client.Option
+		url       string
+		forbidden bool
+	}{
+		{"loopback", []client.Option{client.WithSSRFProtection()}, srv.URL, true},
+		{"allowed", []client.Option{client.WithSSRFProtection(loopback)}, srv.URL, false},
+		{"other prefix allowed", []client.Option{client.WithSSRFProtection(netip.MustParsePrefix("10.0.0.0/8"))}, srv.URL, true},
+		{"resolved name", []client.Option{client.WithSSRFProtection(), client.WithResolver(resolveTo("127.0.0.1"))}, byName, true},
+		{"resolved name allowed", []client.Option{client.WithSSRFProtection(loopback), client.WithResolver(resolveTo("127.0.0.1"))}, byName, false},
+		{"forbidden address skipped", []client.Option{client.WithSSRFProtection(loopback), client.WithResolver(resolveTo("10.0.0.1", "127.0.0.1"))}, byName, false},
+		{"off", []client.Option{client.WithResolver(resolveTo("127.0.0.1"))}, byName, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := client.NewHTTPClient(tt.opts...).Get(tt.url)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if tt.forbidden {
+				if !errors.Is(err, client.ErrForbiddenAddress) {
+					t.Errorf("err = %v, want %v", err, client.ErrForbiddenAddress)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestSSRFProtectionIgnoresProxy(t *testing.T) {
+	var proxied bool
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = true
+	}))
+	defer proxy.Close()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	proxyURL, _ := url.Parse(proxy.URL)
+	httpClient := client.NewHTTPClient(
+		client.WithProxy(http.ProxyURL(proxyURL)),
+		client.WithSSRFProtection(netip.MustParsePrefix("127.0.0.0/8")),
+	)
+	resp, err := httpClient.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if proxied {
+		t.Error("request went through the proxy")
+	}
+}
@@ -0,0 +1,294 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// connRateWindow is the window the new-connection rate is averaged over.
+const connRateWindow = 60
+
+// TransportStats is a snapshot of the connection pool of a managed transport.
+type TransportStats struct {
+	// OpenConns is the number of connections currently open.
+	OpenConns int64
+	// IdleConns is the number of open connections with no request in flight.
+	IdleConns int64
+	// NewConns is the number of connections established so far.
+	NewConns uint64
+	// NewConnsPerSecond is the rate of new connections over the last minute.
+	NewConnsPerSecond float64
+	// DialErrors is the number of connection attempts that failed.
+	DialErrors uint64
+	// ReusedConns is the number of requests sent on a pooled connection.
+	ReusedConns uint64
+	// ConnectTime is the total time spent establishing TCP connections.
+	ConnectTime time.Duration
+	// TLSHandshakes is the number of completed TLS handshakes.
+	TLSHandshakes uint64
+	// TLSHandshakeTime is the total time spent in TLS handshakes.
+	TLSHandshakeTime time.Duration
+}
+
+// AvgTLSHandshake returns the mean TLS handshake duration.
+func (s TransportStats) AvgTLSHandshake() time.Duration {
+	if s.TLSHandshakes == 0 {
+		return 0
+	}
+	return s.TLSHandshakeTime / time.Duration(s.TLSHandshakes)
+}
+
+// transportStats collects the counters behind TransportStats.
+type transportStats struct {
+	openConns   atomic.Int64
+	busyConns   atomic.Int64
+	newConns    atomic.Uint64
+	dialErrors  atomic.Uint64
+	reusedConns atomic.Uint64
+	connectTime atomic.Int64
+	handshakes  atomic.Uint64
+	tlsTime     atomic.Int64
+
+	// rate counts new connections per second in a ring of buckets.
+	rateMu      sync.Mutex
+	rateBuckets [connRateWindow]uint64
+	rateSecond  int64
+}
+
+// snapshot returns the current statistics.
+func (s *transportStats) snapshot() TransportStats {
+	open := s.openConns.Load()
+	return TransportStats{
+		OpenConns:         open,
+		IdleConns:         max(open-s.busyConns.Load(), 0),
+		NewConns:          s.newConns.Load(),
+		NewConnsPerSecond: s.newConnRate(),
+		DialErrors:        s.dialErrors.Load(),
+		ReusedConns:       s.reusedConns.Load(),
+		ConnectTime:       time.Duration(s.connectTime.Load()),
+		TLSHandshakes:     s.handshakes.Load(),
+		TLSHandshakeTime:  time.Duration(s.tlsTime.Load()),
+	}
+}
+
+// dialFunc is the signature of http.Transport.DialContext.
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// wrapDial counts the connections made by dial and tracks when they close.
+func (s *transportStats) wrapDial(dial dialFunc) dialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		start := time.Now()
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			s.dialErrors.Add(1)
+			return nil, err
+		}
+
+		s.connectTime.Add(int64(time.Since(start)))
+		s.newConns.Add(1)
+		s.openConns.Add(1)
+		s.recordNewConn()
+		return &trackedConn{Conn: conn, stats: s}, nil
+	}
+}
+
+// recordNewConn adds a new connection to the rate window.
+func (s *transportStats) recordNewConn() {
+	s.rateMu.Lock()
+	defer s.rateMu.Unlock()
+	s.advance(time.Now().Unix())
+	s.rateBuckets[s.rateSecond%connRateWindow]++
+}
+
+// newConnRate returns the average of new connections per second.
+func (s *transportStats) newConnRate() float64 {
+	s.rateMu.Lock()
+	defer s.rateMu.Unlock()
+	s.advance(time.Now().Unix())
+
+	var total uint64
+	for _, n := range s.rateBuckets {
+		total += n
+	}
+	return float64(total) / connRateWindow
+}
+
+// advance moves the rate window to now, clearing the buckets of the seconds
+// that passed. Callers must hold s.rateMu.
+func (s *transportStats) advance(now int64) {
+	elapsed := now - s.rateSecond
+	if elapsed <= 0 {
+		return
+	}
+	if elapsed >= connRateWindow {
+		clear(s.rateBuckets[:])
+	} else {
+		for i := s.rateSecond + 1; i <= now; i++ {
+			s.rateBuckets[i%connRateWindow] = 0
+		}
+	}
+	s.rateSecond = now
+}
+
+// trace returns a context that reports connection reuse and TLS handshakes
+// of a request to the stats, and the connUse that tracks the connection the
+// request is sent on.
+func (s *transportStats) trace(ctx context.Context) (context.Context, *connUse) {
+	use := &connUse{}
+	var (
+		mu        sync.Mutex
+		handshake time.Time
+		skip      atomic.Bool
+	)
+
+	ctx = context.WithValue(ctx, skipHandshakeKey{}, &skip)
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				s.reusedConns.Add(1)
+			}
+			use.acquire(info.Conn)
+		},
+		TLSHandshakeStart: func() {
+			mu.Lock()
+			defer mu.Unlock()
+			handshake = time.Now()
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if err == nil && !handshake.IsZero() && !skip.Load() {
+				s.handshakes.Add(1)
+				s.tlsTime.Add(int64(time.Since(handshake)))
+			}
+		},
+	})
+	return ctx, use
+}
+
+// connUse marks the connection of one request as busy until released.
+type connUse struct {
+	mu       sync.Mutex
+	conn     *trackedConn
+	released bool
+}
+
+// acquire marks conn as busy, unless the request already finished.
+func (u *connUse) acquire(conn net.Conn) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.conn != nil || u.released {
+		return
+	}
+	if u.conn = unwrapTrackedConn(conn); u.conn != nil {
+		u.conn.acquire()
+	}
+}
+
+// release marks the connection as no longer used by the request. It is safe
+// to call more than once.
+func (u *connUse) release() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.conn != nil && !u.released {
+		u.conn.release()
+	}
+	u.released = true
+}
+
+// trackedConn is a connection counted by transportStats.
+type trackedConn struct {
+	net.Conn
+	stats *transportStats
+
+	closeOnce sync.Once
+	mu        sync.Mutex
+	inFlight  int
+}
+
+// acquire marks a request as in flight on the connection.
+func (c *trackedConn) acquire() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.inFlight++; c.inFlight == 1 {
+		c.stats.busyConns.Add(1)
+	}
+}
+
+// release marks a request on the connection as finished.
+func (c *trackedConn) release() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.inFlight--; c.inFlight == 0 {
+		c.stats.busyConns.Add(-1)
+	}
+}
+
+// Close closes the connection and removes it from the open count.
+func (c *trackedConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.stats.openConns.Add(-1)
+	})
+	return c.Conn.Close()
+}
+
+// unwrapTrackedConn finds the trackedConn beneath a TLS connection.
+func unwrapTrackedConn(conn net.Conn) *trackedConn {
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn = tlsConn.NetConn()
+	}
+	tracked, _ := conn.(*trackedConn)
+	return tracked
+}
+
+// releaseBody calls release once the response body is closed or fully read.
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+}
+
+// Read reads from the body and releases the connection at EOF.
+func (b *releaseBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.release()
+	}
+	return n, err
+}
+
+// Close closes the body and releases the connection.
+func (b *releaseBody) Close() error {
+	b.release()
+	return b.ReadCloser.Close()
+}
+
+// Stats returns a snapshot of the connection pool statistics.
+func (t *Transport) Stats() TransportStats {
+	return t.stats.snapshot()
+}
+
+// roundTripTracked sends the request with rt while keeping the connection
+// statistics up to date.
+func (t *Transport) roundTripTracked(rt http.RoundTripper, req *http.Request) (*http.Response, error) {
+	ctx, use := t.stats.trace(req.Context())
+	resp, err := rt.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		use.release()
+		return nil, err
+	}
+
+	// Upgraded connections are no longer managed by the pool.
+	if _, ok := resp.Body.(io.Writer); ok {
+		use.release()
+		return resp, nil
+	}
+	resp.Body = &releaseBody{ReadCloser: resp.Body, release: use.release}
+	return resp, nil
+}
@@ -0,0 +1,245 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// downloadBufferSize is the size of the chunks Download copies.
+const downloadBufferSize = 32 << 10
+
+// Do sends req through the middleware chain as it is, without resolving
+// its URL against the base URL or checking the status, and returns the
+// response for the caller to read and close. It makes the client usable as
+// the base client of another.
+func (c *CustomClient) Do(req *http.Request) (*http.Response, error) {
+	return c.httpClient.Do(req)
+}
+
+// GetStream sends a GET request and returns the response body unread, for
+// bodies too large to hold in memory, along with the response for its
+// headers. The caller must close the body. Responses with a status outside
+// 2xx fail with an *APIError.
+func (c *CustomClient) GetStream(ctx context.Context, url string, opts ...RequestOption) (io.ReadCloser, *http.Response, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, cancel, err := c.do(req, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !successful(resp) {
+		err := newAPIError(req, resp)
+		resp.Body.Close()
+		cancel()
+		return nil, nil, err
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp.Body, resp, nil
+}
+
+// cancelBody releases the context of a call when its body is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close closes the body and releases the context.
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// DownloadConfig configures DownloadWith.
+type DownloadConfig struct {
+	// Offset is the number of bytes of the resource already in the writer,
+	// from an earlier download; the rest is requested with a Range header.
+	// When the server ignores the range, the bytes before Offset are
+	// skipped.
+	Offset int64
+	// Attempts bounds the requests made when the transfer breaks off, each
+	// resuming where the previous one stopped; zero means one. Resumed
+	// requests carry If-Range, and the download fails rather than mix two
+	// versions when the resource changed meanwhile.
+	Attempts int
+	// Progress, if set, is called after each chunk with the bytes of the
+	// resource written so far, Offset included, and its total size, or -1
+	// if unknown.
+	Progress func(done, total int64)
+}
+
+// Download sends a GET request and copies the response body to w as it
+// arrives, returning the number of bytes written.
+func (c *CustomClient) Download(ctx context.Context, url string, w io.Writer, opts ...RequestOption) (int64, error) {
+	return c.DownloadWith(ctx, DownloadConfig{}, url, w, opts...)
+}
+
+// DownloadWith is Download with explicit settings. Responses with a status
+// outside 2xx fail with an *APIError. Errors writing to w are not retried.
+func (c *CustomClient) DownloadWith(ctx context.Context, cfg DownloadConfig, url string, w io.Writer, opts ...RequestOption) (int64, error) {
+	d := &download{client: c, cfg: cfg, url: url, w: w, opts: opts, offset: cfg.Offset, total: -1}
+	attempts := max(cfg.Attempts, 1)
+	for attempt := 1; ; attempt++ {
+		err := d.attempt(ctx)
+		if err == nil {
+			return d.written, nil
+		}
+		var retry *resumableError
+		if !errors.As(err, &retry) || attempt >= attempts || ctx.Err() != nil {
+			if retry != nil {
+				err = retry.err
+			}
+			return d.written, err
+		}
+	}
+}
+
+// download holds the state of a download across attempts.
+type download struct {
+	client *CustomClient
+	cfg    DownloadConfig
+	url    string
+	w      io.Writer
+	opts   []RequestOption
+
+	// offset is the position in the resource reached so far.
+	offset  int64
+	written int64
+	total   int64
+	// validator is the strong ETag or the Last-Modified date of the
+	// resource, for If-Range.
+	validator string
+}
+
+// resumableError marks a failure the download can resume after.
+type resumableError struct {
+	err error
+}
+
+// Error implements the error interface.
+func (e *resumableError) Error() string {
+	return e.err.Error()
+}
+
+// attempt requests the resource from the current offset and copies it to
+// the writer.
+func (d *download) attempt(ctx context.Context) error {
+	req, err := d.client.newRequest(ctx, http.MethodGet, d.url, nil)
+	if err != nil {
+		return err
+	}
+	if d.offset > 0 {
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(d.offset, 10)+"-")
+		if d.validator != "" {
+			req.Header.Set("If-Range", d.validator)
+		}
+	}
+	resp, cancel, err := d.client.do(req, d.opts)
+	if err != nil {
+		return &resumableError{err: err}
+	}
+	defer cancel()
+	defer resp.Body.Close()
+
+	skip := int64(0)
+	switch {
+	case resp.StatusCode == http.StatusPartialContent:
+		start, size, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if !ok || start != d.offset {
+			return fmt.Errorf("unexpected Content-Range %q", resp.Header.Get("Content-Range"))
+		}
+		d.total = size
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && d.offset > 0:
+		// The range starts at the end: the resource is complete.
+		if _, size, ok := parseContentRange(resp.Header.Get("Content-Range")); ok && size == d.offset {
+			d.total = size
+			return nil
+		}
+		return newAPIError(req, resp)
+	case successful(resp):
+		if d.offset > 0 && d.validator != "" {
+			return errors.New("resource changed during download")
+		}
+		skip = d.offset
+		d.total = resp.ContentLength
+	default:
+		return newAPIError(req, resp)
+	}
+	if d.validator == "" {
+		if etag := resp.Header.Get("Etag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			d.validator = etag
+		} else {
+			d.validator = resp.Header.Get("Last-Modified")
+		}
+	}
+
+	if skip > 0 {
+		if _, err := io.CopyN(io.Discard, resp.Body, skip); err != nil {
+			return &resumableError{err: fmt.Errorf("failed to read response body: %w", err)}
+		}
+	}
+	buf := make([]byte, downloadBufferSize)
+	for {
+		n, readErr := resp.Body.Read(buf)
+		if n > 0 {
+			if _, err := d.w.Write(buf[:n]); err != nil {
+				return fmt.Errorf("failed to write download: %w", err)
+			}
+			d.offset += int64(n)
+			d.written += int64(n)
+			if d.cfg.Progress != nil {
+				d.cfg.Progress(d.offset, d.total)
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return &resumableError{err: fmt.Errorf("failed to read response body: %w", readErr)}
+		}
+	}
+	if d.total >= 0 && d.offset < d.total {
+		return &resumableError{err: fmt.Errorf("failed to read response body: %w", io.ErrUnexpectedEOF)}
+	}
+	return nil
+}
+
+// parseContentRange parses a Content-Range header of the form
+// "bytes start-end/size" or "bytes */size", returning a size of -1 when it
+// is unknown.
+func parseContentRange(value string) (start, size int64, ok bool) {
+	rest, ok := strings.CutPrefix(value, "bytes ")
+	if !ok {
+		return 0, 0, false
+	}
+	span, sizeText, ok := strings.Cut(rest, "/")
+	if !ok {
+		return 0, 0, false
+	}
+	size = -1
+	if sizeText != "*" {
+		var err error
+		if size, err = strconv.ParseInt(sizeText, 10, 64); err != nil {
+			return 0, 0, false
+		}
+	}
+	if span == "*" {
+		return 0, size, true
+	}
+	startText, _, ok := strings.Cut(span, "-")
+	if !ok {
+		return 0, 0, false
+	}
+	start, err := strconv.ParseInt(startText, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return start, size, true
+}
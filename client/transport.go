@@ -0,0 +1,498 @@
+package client
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/internal/httpx"
+)
+
+// http3BrokenFor is how long a host is sent over HTTP/2 after an HTTP/3
+// attempt to it failed.
+const http3BrokenFor = 5 * time.Minute
+
+// errHTTP3Dial marks HTTP/3 failures to connect, after which the request is
+// known not to have been sent.
+var errHTTP3Dial = errors.New("http3 dial failed")
+
+// Connection pool defaults of the managed transport. They favour throughput
+// to a few busy hosts over the net/http defaults, which keep only two idle
+// connections per host.
+const (
+	// DefaultMaxIdleConns caps idle connections across all hosts.
+	DefaultMaxIdleConns = 512
+	// DefaultMaxIdleConnsPerHost caps idle connections kept for one host.
+	DefaultMaxIdleConnsPerHost = 64
+	// DefaultMaxConnsPerHost caps connections to one host; zero is unlimited.
+	DefaultMaxConnsPerHost = 0
+	// DefaultIdleConnTimeout is how long an idle connection is kept.
+	DefaultIdleConnTimeout = 90 * time.Second
+)
+
+// Transport is a managed http.RoundTripper with tunable connection handling.
+type Transport struct {
+	rt *http.Transport
+
+	// h3 is the HTTP/3 round tripper, nil unless WithHTTP3 is set.
+	h3 http.RoundTripper
+	// h3Alt maps hosts to the time their Alt-Svc advertisement of HTTP/3
+	// expires, and h3Broken to the time their HTTP/3 attempt failed.
+	h3Alt    sync.Map
+	h3Broken sync.Map
+
+	stats *transportStats
+
+	// hosts holds the transports of hosts with overridden settings.
+	hosts map[string]*Transport
+
+	// h1 speaks HTTP/1.1 only, for hosts that fell back from HTTP/2.
+	fallback ProtocolFallback
+	h1       *http.Transport
+	h1Hosts  sync.Map
+
+	hostPolicy hostPolicy
+	clock      Clock
+
+	// warm holds the connections Preconnect opened; preconnectN and
+	// preconnectTargets are the WithPreconnect settings.
+	warm              *warmPool
+	preconnectN       int
+	preconnectTargets []string
+}
+
+// Option configures the managed transport and the client built around it.
+type Option func(*config)
+
+// config holds the settings collected from Options.
+type config struct {
+	forceHTTP2 bool
+	h2c        bool
+	http2      http.HTTP2Config
+	http3      bool
+
+	resolver       Resolver
+	dnsCacheTTL    time.Duration
+	dnsNegativeTTL time.Duration
+	ssrf           *ssrfGuard
+
+	maxIdleConns        int
+	maxIdleConnsPerHost int
+	maxConnsPerHost     int
+	idleConnTimeout     time.Duration
+	disableKeepAlives   bool
+	tcpKeepAlive        *net.KeepAliveConfig
+
+	fallbackDelay     time.Duration
+	addressPreference AddressPreference
+	localAddrs        []netip.Addr
+	iface             string
+
+	redirect  redirectPolicy
+	cookieJar http.CookieJar
+
+	tlsConfig     *tls.Config
+	proxy         func(*http.Request) (*url.URL, error)
+	hostOverrides map[string][]Option
+
+	protocolFallback ProtocolFallback
+	hostPolicy       hostPolicy
+	clock            Clock
+
+	preconnect        int
+	preconnectTargets []string
+}
+
+// newConfig applies the options on top of the defaults.
+func newConfig(opts []Option) *config {
+	cfg := &config{
+		maxIdleConns:        DefaultMaxIdleConns,
+		maxIdleConnsPerHost: DefaultMaxIdleConnsPerHost,
+		maxConnsPerHost:     DefaultMaxConnsPerHost,
+		idleConnTimeout:     DefaultIdleConnTimeout,
+		redirect: redirectPolicy{
+			max:              defaultMaxRedirects,
+			sensitiveHeaders: append([]string(nil), defaultSensitiveHeaders...),
+		},
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// WithForceHTTP2 makes the transport speak HTTP/2 only, failing requests to
+// servers that do not negotiate it.
+func WithForceHTTP2() Option {
+	return func(c *config) {
+		c.forceHTTP2 = true
+	}
+}
+
+// WithH2C enables HTTP/2 with prior knowledge over plaintext connections, for
+// internal services that serve h2c. HTTP/1.x is disabled when it is set.
+func WithH2C() Option {
+	return func(c *config) {
+		c.h2c = true
+	}
+}
+
+// WithHTTP2KeepAlive sends a ping on HTTP/2 connections that have been silent
+// for sendPingAfter and closes them if no reply arrives within pingTimeout.
+func WithHTTP2KeepAlive(sendPingAfter, pingTimeout time.Duration) Option {
+	return func(c *config) {
+		c.http2.SendPingTimeout = sendPingAfter
+		c.http2.PingTimeout = pingTimeout
+	}
+}
+
+// WithHTTP2Config replaces the HTTP/2 settings of the transport wholesale.
+func WithHTTP2Config(h2 http.HTTP2Config) Option {
+	return func(c *config) {
+		c.http2 = h2
+	}
+}
+
+// WithHTTP3 sends https requests over HTTP/3 to origins that advertised it
+// on the same port with an Alt-Svc header, so the first request to an
+// origin always goes over TCP. It falls back to HTTP/2 when the attempt
+// fails; requests are only sent again over HTTP/2 when the QUIC connection
+// could not be set up or their method is idempotent. QUIC connections use
+// the resolver, address family, local address and SSRF settings of TCP
+// ones. HTTP/3 needs the binary to be built with the http3 tag; without it
+// the option has no effect.
+func WithHTTP3() Option {
+	return func(c *config) {
+		c.http3 = true
+	}
+}
+
+// WithResolver makes the dialer resolve hosts with r instead of the system
+// resolver.
+func WithResolver(r Resolver) Option {
+	return func(c *config) {
+		c.resolver = r
+	}
+}
+
+// WithDNSCache caches DNS answers in process for ttl, overriding the record
+// TTL, and "no such host" answers for negativeTTL.
+func WithDNSCache(ttl, negativeTTL time.Duration) Option {
+	return func(c *config) {
+		c.dnsCacheTTL = ttl
+		c.dnsNegativeTTL = negativeTTL
+	}
+}
+
+// WithMaxIdleConns caps the number of idle connections across all hosts.
+// Zero means no limit.
+func WithMaxIdleConns(n int) Option {
+	return func(c *config) {
+		c.maxIdleConns = n
+	}
+}
+
+// WithMaxIdleConnsPerHost caps the number of idle connections kept per host.
+func WithMaxIdleConnsPerHost(n int) Option {
+	return func(c *config) {
+		c.maxIdleConnsPerHost = n
+	}
+}
+
+// WithMaxConnsPerHost caps the number of connections per host, including
+// those in use. Zero means no limit.
+func WithMaxConnsPerHost(n int) Option {
+	return func(c *config) {
+		c.maxConnsPerHost = n
+	}
+}
+
+// WithIdleConnTimeout sets how long an idle connection stays in the pool.
+// Zero means no limit.
+func WithIdleConnTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.idleConnTimeout = d
+	}
+}
+
+// WithTCPKeepAlive sets the TCP keep-alive probes of new connections: the
+// first probe is sent after idle, then every interval, and the connection is
+// dropped after count unanswered probes.
+func WithTCPKeepAlive(idle, interval time.Duration, count int) Option {
+	return func(c *config) {
+		c.tcpKeepAlive = &net.KeepAliveConfig{
+			Enable:   true,
+			Idle:     idle,
+			Interval: interval,
+			Count:    count,
+		}
+	}
+}
+
+// WithoutKeepAlives disables HTTP keep-alives so every request uses a fresh
+// connection, for proxies that mishandle persistent connections.
+func WithoutKeepAlives() Option {
+	return func(c *config) {
+		c.disableKeepAlives = true
+	}
+}
+
+// WithFallbackDelay sets how long the dialer waits on the preferred address
+// family before racing the other one. A negative delay disables racing and
+// tries the addresses one after another, as on a single-stack host.
+func WithFallbackDelay(d time.Duration) Option {
+	return func(c *config) {
+		c.fallbackDelay = d
+	}
+}
+
+// WithAddressPreference sets which address family the dialer tries first.
+func WithAddressPreference(p AddressPreference) Option {
+	return func(c *config) {
+		c.addressPreference = p
+	}
+}
+
+// WithLocalAddr binds outbound connections to the given local addresses,
+// for example to egress from an allowlisted IP on a multi-homed host. Give at
+// most one address per family; connections use the one matching the
+// destination.
+func WithLocalAddr(addrs ...netip.Addr) Option {
+	return func(c *config) {
+		c.localAddrs = addrs
+	}
+}
+
+// WithInterface binds outbound connections to an address of the named
+// network interface.
+func WithInterface(name string) Option {
+	return func(c *config) {
+		c.iface = name
+	}
+}
+
+// WithTLSConfig sets the TLS configuration used for https connections.
+func WithTLSConfig(tlsConfig *tls.Config) Option {
+	return func(c *config) {
+		c.tlsConfig = tlsConfig
+	}
+}
+
+// WithProxy sets the function that picks the proxy for each request, as in
+// http.Transport.Proxy. By default proxies come from the environment.
+func WithProxy(proxy func(*http.Request) (*url.URL, error)) Option {
+	return func(c *config) {
+		c.proxy = proxy
+	}
+}
+
+// WithHostOverride applies extra options to requests for host, which is
+// matched against the request host with and without its port. Only
+// connection-level options take effect, such as TLS, proxy, HTTP version and
+// pool settings; redirect and cookie options are client-wide. Overrides for
+// the same host accumulate.
+func WithHostOverride(host string, opts ...Option) Option {
+	return func(c *config) {
+		if c.hostOverrides == nil {
+			c.hostOverrides = make(map[string][]Option)
+		}
+		host = strings.ToLower(host)
+		c.hostOverrides[host] = append(c.hostOverrides[host], opts...)
+	}
+}
+
+// NewTransport creates a managed transport from the given options.
+func NewTransport(opts ...Option) *Transport {
+	cfg := newConfig(opts)
+	t := cfg.newTransport()
+	cfg.startPreconnect(t)
+	return t
+}
+
+// NewHTTPClient creates an *http.Client backed by a managed transport that
+// follows redirects according to the redirect options. The result can be
+// passed to NewCustomClient as the base client.
+func NewHTTPClient(opts ...Option) *http.Client {
+	cfg := newConfig(opts)
+	t := cfg.newTransport()
+	cfg.startPreconnect(t)
+	return &http.Client{
+		Transport:     t,
+		CheckRedirect: cfg.redirect.checkRedirect,
+		Jar:           cfg.cookieJar,
+	}
+}
+
+// newTransport builds the managed transport described by the config.
+func (c *config) newTransport() *Transport {
+	return c.buildTransport(&transportStats{})
+}
+
+// buildTransport builds a managed transport reporting to stats, along with
+// the transports of its host overrides.
+func (c *config) buildTransport(stats *transportStats) *Transport {
+	t := &Transport{
+		rt:         c.newHTTPTransport(stats),
+		stats:      stats,
+		fallback:   c.protocolFallback,
+		hostPolicy: c.hostPolicy,
+		clock:      clockOrSystem(c.clock),
+	}
+	t.warm = newWarmPool(t.rt, stats, t.clock)
+	if c.http3 {
+		t.h3 = newHTTP3RoundTripper(t.rt.TLSClientConfig, c.newDialer())
+	}
+	if c.protocolFallback == FallbackHTTP1 {
+		t.h1 = c.newHTTPTransport(stats)
+		var protocols http.Protocols
+		protocols.SetHTTP1(true)
+		t.h1.Protocols = &protocols
+	}
+
+	// Each overridden host gets its own transport, starting from this
+	// config and sharing its statistics.
+	for host, opts := range c.hostOverrides {
+		hc := *c
+		hc.hostOverrides = nil
+		for _, opt := range opts {
+			opt(&hc)
+		}
+		if t.hosts == nil {
+			t.hosts = make(map[string]*Transport)
+		}
+		t.hosts[host] = hc.buildTransport(stats)
+	}
+	return t
+}
+
+// newHTTPTransport builds the underlying *http.Transport, reporting its
+// connections to stats.
+func (c *config) newHTTPTransport(stats *transportStats) *http.Transport {
+	rt := http.DefaultTransport.(*http.Transport).Clone()
+	rt.DialContext = stats.wrapDial(c.newDialer().DialContext)
+	if c.tlsConfig != nil {
+		rt.TLSClientConfig = c.tlsConfig.Clone()
+	}
+	if c.proxy != nil {
+		rt.Proxy = c.proxy
+	}
+	if c.ssrf != nil {
+		rt.Proxy = nil
+	}
+
+	// Size the connection pool.
+	rt.MaxIdleConns = c.maxIdleConns
+	rt.MaxIdleConnsPerHost = c.maxIdleConnsPerHost
+	rt.MaxConnsPerHost = c.maxConnsPerHost
+	rt.IdleConnTimeout = c.idleConnTimeout
+	rt.DisableKeepAlives = c.disableKeepAlives
+
+	// Copy the HTTP/2 settings so the transport never aliases the config.
+	h2 := c.http2
+	rt.HTTP2 = &h2
+
+	// Pick the protocols the transport is allowed to speak.
+	var protocols http.Protocols
+	switch {
+	case c.h2c:
+		protocols.SetHTTP2(true)
+		protocols.SetUnencryptedHTTP2(true)
+	case c.forceHTTP2:
+		protocols.SetHTTP2(true)
+	default:
+		protocols.SetHTTP1(true)
+		protocols.SetHTTP2(true)
+	}
+	rt.Protocols = &protocols
+
+	return rt
+}
+
+// RoundTrip sends the request over the managed transport.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.hostPolicy.check(req.URL.Hostname()); err != nil {
+		httpx.CloseBody(req)
+		return nil, err
+	}
+	if host := t.hostTransport(req.URL); host != nil {
+		return host.RoundTrip(req)
+	}
+
+	if t.useHTTP3(req) {
+		resp, err := t.h3.RoundTrip(req)
+		if err == nil {
+			t.rememberAltSvc(req.URL, resp)
+			return resp, nil
+		}
+		if req.Context().Err() != nil {
+			return nil, err
+		}
+
+		// Remember the failure and retry the request over HTTP/2, unless
+		// it may have been sent and is not safe to send twice.
+		t.h3Broken.Store(req.URL.Host, t.clock.Now())
+		if !errors.Is(err, errHTTP3Dial) && !httpx.IsIdempotent(req.Method) {
+			return nil, err
+		}
+		if req, err = httpx.RewindBody(req); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := t.roundTripHTTP2(req)
+	if err == nil && t.h3 != nil && req.URL.Scheme == "https" {
+		t.rememberAltSvc(req.URL, resp)
+	}
+	return resp, err
+}
+
+// hostTransport returns the override transport for the URL's host, if any.
+func (t *Transport) hostTransport(u *url.URL) *Transport {
+	if len(t.hosts) == 0 {
+		return nil
+	}
+	if host, ok := t.hosts[strings.ToLower(u.Host)]; ok {
+		return host
+	}
+	return t.hosts[strings.ToLower(u.Hostname())]
+}
+
+// CloseIdleConnections closes the connections in the pool that are not in use.
+func (t *Transport) CloseIdleConnections() {
+	t.rt.CloseIdleConnections()
+	t.warm.close()
+	if t.h1 != nil {
+		t.h1.CloseIdleConnections()
+	}
+	if closer, ok := t.h3.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+	for _, host := range t.hosts {
+		host.CloseIdleConnections()
+	}
+}
+
+// useHTTP3 reports whether the request should be attempted over HTTP/3.
+func (t *Transport) useHTTP3(req *http.Request) bool {
+	if t.h3 == nil || req.URL.Scheme != "https" || !t.h3Advertised(req.URL) {
+		return false
+	}
+
+	// Only try HTTP/3 when the body can be replayed for the fallback.
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+
+	if failedAt, ok := t.h3Broken.Load(req.URL.Host); ok {
+		if t.clock.Now().Sub(failedAt.(time.Time)) < http3BrokenFor {
+			return false
+		}
+		t.h3Broken.Delete(req.URL.Host)
+	}
+	return true
+}
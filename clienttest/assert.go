@@ -0,0 +1,118 @@
+package clienttest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// snapshot returns a copy of req whose body can be read any number of
+// times, and puts the body of req back for later readers.
+func snapshot(req *http.Request) (*http.Request, error) {
+	captured := req.Clone(req.Context())
+	if req.Body == nil || req.Body == http.NoBody {
+		return captured, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("clienttest: failed to read request body: %w", err)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	captured.Body = io.NopCloser(bytes.NewReader(body))
+	captured.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	return captured, nil
+}
+
+// body returns the body of a request returned by Requests, or reads req.
+func body(req *http.Request) ([]byte, error) {
+	if req.GetBody != nil {
+		r, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	}
+	if req.Body == nil {
+		return nil, nil
+	}
+	return io.ReadAll(req.Body)
+}
+
+// AssertMethod fails t unless req uses method.
+func AssertMethod(t testing.TB, req *http.Request, method string) bool {
+	t.Helper()
+	if req.Method != method {
+		t.Errorf("clienttest: %s %s: method is not %s", req.Method, req.URL, method)
+		return false
+	}
+	return true
+}
+
+// AssertHeader fails t unless the header name of req is want.
+func AssertHeader(t testing.TB, req *http.Request, name, want string) bool {
+	t.Helper()
+	if got := req.Header.Get(name); got != want {
+		t.Errorf("clienttest: %s %s: header %s is %q, want %q", req.Method, req.URL, name, got, want)
+		return false
+	}
+	return true
+}
+
+// AssertQuery fails t unless the query parameter key of req is want.
+func AssertQuery(t testing.TB, req *http.Request, key, want string) bool {
+	t.Helper()
+	if got := req.URL.Query().Get(key); got != want {
+		t.Errorf("clienttest: %s %s: query parameter %s is %q, want %q", req.Method, req.URL, key, got, want)
+		return false
+	}
+	return true
+}
+
+// AssertBody fails t unless the body of req is want.
+func AssertBody(t testing.TB, req *http.Request, want string) bool {
+	t.Helper()
+	got, err := body(req)
+	if err != nil {
+		t.Errorf("clienttest: %s %s: failed to read body: %v", req.Method, req.URL, err)
+		return false
+	}
+	if string(got) != want {
+		t.Errorf("clienttest: %s %s: body is %q, want %q", req.Method, req.URL, got, want)
+		return false
+	}
+	return true
+}
+
+// AssertJSON fails t unless the body of req is JSON equal to want once
+// marshaled, regardless of formatting and key order.
+func AssertJSON(t testing.TB, req *http.Request, want any) bool {
+	t.Helper()
+	got, err := body(req)
+	if err != nil {
+		t.Errorf("clienttest: %s %s: failed to read body: %v", req.Method, req.URL, err)
+		return false
+	}
+	wantJSON, err := json.Marshal(want)
+	if err != nil {
+		t.Fatalf("clienttest: failed to marshal expected body: %v", err)
+	}
+	var gotValue, wantValue any
+	if err := json.Unmarshal(got, &gotValue); err != nil {
+		t.Errorf("clienttest: %s %s: body is not JSON: %v", req.Method, req.URL, err)
+		return false
+	}
+	json.Unmarshal(wantJSON, &wantValue)
+	if !reflect.DeepEqual(gotValue, wantValue) {
+		t.Errorf("clienttest: %s %s: body is %s, want %s", req.Method, req.URL, got, wantJSON)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,97 @@
+package clienttest_test
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/clienttest"
+)
+
+// sent sends a POST of body through a mock and returns the request it
+// captured.
+func sent(t *testing.T, body string) *http.Request {
+	t.Helper()
+	m := clienttest.NewMockClient()
+	m.Expect(http.MethodPost, clienttest.Any()).Respond(http.StatusOK, "")
+	req, _ := http.NewRequest(http.MethodPost, "https://api.example.com/items?page=2&tag=a&tag=b", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := m.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return m.Last(t)
+}
+
+func TestAssertions(t *testing.T) {
+	const prefix = "clienttest: POST https://api.example.com/items?page=2&tag=a&tag=b: "
+	const body = `{"name": "gopher", "tags": ["a", "b"], "size": 2}`
+	tests := []struct {
+		name     string
+		body     string
+		assert   func(t testing.TB, req *http.Request) bool
+		failures []string
+	}{
+		{"method", body, func(t testing.TB, req *http.Request) bool {
+			return clienttest.AssertMethod(t, req, http.MethodPost)
+		}, nil},
+		{"other method", body, func(t testing.TB, req *http.Request) bool {
+			return clienttest.AssertMethod(t, req, http.MethodPut)
+		}, []string{prefix + "method is not PUT"}},
+		{"header", body, func(t testing.TB, req *http.Request) bool {
+			return clienttest.AssertHeader(t, req, "content-type", "application/json")
+		}, nil},
+		{"missing header", body, func(t testing.TB, req *http.Request) bool {
+			return clienttest.AssertHeader(t, req, "Authorization", "Bearer token")
+		}, []string{prefix + `header Authorization is "", want "Bearer token"`}},
+		{"query", body, func(t testing.TB, req *http.Request) bool {
+			return clienttest.AssertQuery(t, req, "page", "2")
+		}, nil},
+		{"first of repeated query", body, func(t testing.TB, req *http.Request) bool {
+			return clienttest.AssertQuery(t, req, "tag", "b")
+		}, []string{prefix + `query parameter tag is "a", want "b"`}},
+		{"body", body, func(t testing.TB, req *http.Request) bool {
+			return clienttest.AssertBody(t, req, body)
+		}, nil},
+		{"other body", "name=gopher", func(t testing.TB, req *http.Request) bool {
+			return clienttest.AssertBody(t, req, body)
+		}, []string{prefix + `body is "name=gopher", want "{\"name\": \"gopher\", \"tags\": [\"a\", \"b\"], \"size\": 2}"`}},
+		{"body read twice", body, func(t testing.TB, req *http.Request) bool {
+			return clienttest.AssertBody(t, req, body) && clienttest.AssertBody(t, req, body)
+		}, nil},
+		{"JSON", body, func(t testing.TB, req *http.Request) bool {
+			return clienttest.AssertJSON(t, req, map[string]any{"size": 2, "tags": []string{"a", "b"}, "name": "gopher"})
+		}, nil},
+		{"JSON struct", body, func(t testing.TB, req *http.Request) bool {
+			return clienttest.AssertJSON(t, req, struct {
+				Name string   `json:"name"`
+				Tags []string `json:"tags"`
+				Size int      `json:"size"`
+			}{"gopher", []string{"a", "b"}, 2})
+		}, nil},
+		{"other JSON", body, func(t testing.TB, req *http.Request) bool {
+			return clienttest.AssertJSON(t, req, map[string]any{"name": "gopher", "tags": []string{"b", "a"}, "size": 2})
+		}, []string{prefix + `body is ` + body + `, want {"name":"gopher","size":2,"tags":["b","a"]}`}},
+		{"not JSON", "name=gopher", func(t testing.TB, req *http.Request) bool {
+			return clienttest.AssertJSON(t, req, map[string]any{"name": "gopher"})
+		}, []string{prefix + "body is not JSON: invalid character 'a' in literal null (expecting 'u')"}},
+		{"unmarshalable expectation", body, func(t testing.TB, req *http.Request) bool {
+			return clienttest.AssertJSON(t, req, make(chan int))
+		}, []string{"clienttest: failed to marshal expected body: json: unsupported type: chan int"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := sent(t, tt.body)
+			var ok bool
+			got := failures(func(rt testing.TB) { ok = tt.assert(rt, req) })
+			if !slices.Equal(got, tt.failures) {
+				t.Errorf("failures = %q, want %q", got, tt.failures)
+			}
+			if want := len(tt.failures) == 0; ok != want {
+				t.Errorf("assertion returned %v, want %v", ok, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package clienttest_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/client"
+	"github.com/Vkanhan/go-auth-middleware-http-client/clienttest"
+	"github.com/Vkanhan/go-auth-middleware-http-client/middleware"
+)
+
+func TestEnvRecordMode(t *testing.T) {
+	tests := []struct {
+		record, ci string
+		mode       middleware.RecordMode
+		failure    string
+	}{
+		{"", "", middleware.RecordOnce, ""},
+		{"", "true", middleware.RecordNone, ""},
+		{"once", "true", middleware.RecordOnce, ""},
+		{"new", "", middleware.RecordNewEpisodes, ""},
+		{"all", "", middleware.RecordAll, ""},
+		{"none", "", middleware.RecordNone, ""},
+		{"sometimes", "", 0, `clienttest: unknown CLIENTTEST_RECORD value "sometimes"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.record+"/"+tt.ci, func(t *testing.T) {
+			t.Setenv(clienttest.RecordEnv, tt.record)
+			t.Setenv("CI", tt.ci)
+			var mode middleware.RecordMode
+			got := failures(func(rt testing.TB) { mode = clienttest.EnvRecordMode(rt) })
+			var want []string
+			if tt.failure != "" {
+				want = []string{tt.failure}
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("failures = %q, want %q", got, want)
+			}
+			if mode != tt.mode {
+				t.Errorf("mode = %v, want %v", mode, tt.mode)
+			}
+		})
+	}
+}
+
+func TestCassette(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv(clienttest.RecordEnv, "")
+	t.Setenv("CI", "")
+
+	var sent int
+	api := client.HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+		sent++
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{},
+			Body:       io.NopCloser(strings.NewReader(`{"id":1}`)),
+			Request:    req,
+		}, nil
+	})
+	offline := client.HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, errors.New("offline")
+	})
+	get := func(c client.HTTPClient) string {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, "https://api.example.com/users/1", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := c.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	// The first run records into testdata, with the secrets redacted.
+	if body := get(clienttest.Cassette(t, "users/get")(api)); body != `{"id":1}` {
+		t.Errorf("recorded body = %s", body)
+	}
+	data, err := os.ReadFile(filepath.Join("testdata", "cassettes", "users", "get.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "secret") {
+		t.Errorf("cassette holds the token:\n%s", data)
+	}
+
+	// Later runs, including ones under CI, replay it.
+	t.Setenv("CI", "true")
+	if body := get(clienttest.Cassette(t, "users/get")(offline)); body != `{"id":1}` {
+		t.Errorf("replayed body = %s", body)
+	}
+	if sent != 1 {
+		t.Errorf("sent %d requests, want 1", sent)
+	}
+
+	// Under CI, a missing cassette fails instead of recording.
+	got := failures(func(rt testing.TB) { clienttest.Cassette(rt, "users/list") })
+	if len(got) != 1 || !strings.HasPrefix(got[0], "clienttest: failed to read cassette:") {
+		t.Errorf("failures = %q, want a missing cassette", got)
+	}
+}
+
+func TestCassetteWith(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scrubbed.json")
+	api := client.HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"X-Session": {"session-secret"}},
+			Body:       http.NoBody,
+			Request:    req,
+		}, nil
+	})
+	m := clienttest.CassetteWith(t, middleware.VCRConfig{Path: path, ScrubHeaders: []string{"X-Session"}})
+	req, _ := http.NewRequest(http.MethodGet, "https://api.example.com/", nil)
+	resp, err := m(api).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "session-secret") {
+		t.Errorf("cassette holds the session:\n%s", data)
+	}
+}
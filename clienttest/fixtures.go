@@ -0,0 +1,176 @@
+package clienttest
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Client sends HTTP requests; *http.Client and the middleware clients
+// implement it.
+type Client interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Fixtures is a client that answers requests from golden files. Each file
+// holds one response in HTTP/1.1 form: a status line such as "HTTP/1.1 200
+// OK", header lines, a blank line and the body.
+type Fixtures struct {
+	// Dir is the directory holding the files, usually testdata.
+	Dir string
+	// Name returns the file name for a request; nil uses FixtureName.
+	Name func(*http.Request) string
+	// Update sends requests to Live and rewrites their files with the
+	// responses instead of reading them. Tests typically set it from an
+	// -update flag.
+	Update bool
+	// Live is the client used in update mode; nil uses http.DefaultClient.
+	Live Client
+}
+
+// NewFixtures creates Fixtures reading from dir.
+func NewFixtures(dir string) *Fixtures {
+	return &Fixtures{Dir: dir}
+}
+
+// FixtureName names the file of a request after its method, host, path and
+// query, such as "GET_api.example.com_users_q_1.golden".
+func FixtureName(req *http.Request) string {
+	name := req.Method + "_" + req.URL.Host + req.URL.Path
+	if req.URL.RawQuery != "" {
+		name += "_" + req.URL.RawQuery
+	}
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-':
+			return r
+		}
+		return '_'
+	}, strings.TrimRight(name, "/"))
+	return name + ".golden"
+}
+
+// Do answers the request from its file, or records the live response to it
+// in update mode.
+func (f *Fixtures) Do(req *http.Request) (*http.Response, error) {
+	name := FixtureName
+	if f.Name != nil {
+		name = f.Name
+	}
+	path := filepath.Join(f.Dir, name(req))
+
+	if f.Update {
+		return f.record(req, path)
+	}
+
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s %s has no fixture %s", ErrUnexpectedRequest, req.Method, req.URL, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixture: %w", err)
+	}
+	return parseFixture(data, req, path)
+}
+
+// record sends req to the live client and saves the response to path.
+func (f *Fixtures) record(req *http.Request, path string) (*http.Response, error) {
+	live := f.Live
+	if live == nil {
+		live = http.DefaultClient
+	}
+	resp, err := live.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read live response: %w", err)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "HTTP/1.1 %s\n", resp.Status)
+	names := make([]string, 0, len(resp.Header))
+	for name := range resp.Header {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		// The length is recomputed from the body on load.
+		if name == "Content-Length" {
+			continue
+		}
+		for _, value := range resp.Header[name] {
+			fmt.Fprintf(&buf, "%s: %s\n", name, value)
+		}
+	}
+	buf.WriteString("\n")
+	buf.Write(body)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create fixture directory: %w", err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		return nil, fmt.Errorf("failed to write fixture: %w", err)
+	}
+	return parseFixture(buf.Bytes(), req, path)
+}
+
+// parseFixture builds the response to req stored in data.
+func parseFixture(data []byte, req *http.Request, path string) (*http.Response, error) {
+	br := bufio.NewReader(bytes.NewReader(data))
+	tp := textproto.NewReader(br)
+
+	line, err := tp.ReadLine()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse fixture %s: %w", path, err)
+	}
+	proto, status, _ := strings.Cut(line, " ")
+	code, _, _ := strings.Cut(status, " ")
+	statusCode, err := strconv.Atoi(code)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse fixture %s: bad status line %q", path, line)
+	}
+	major, minor, ok := http.ParseHTTPVersion(proto)
+	if !ok {
+		return nil, fmt.Errorf("failed to parse fixture %s: bad status line %q", path, line)
+	}
+
+	header, err := tp.ReadMIMEHeader()
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse fixture %s: %w", path, err)
+	}
+	// The body is whatever follows the head, so the file needs neither a
+	// Content-Length nor chunking.
+	body, _ := io.ReadAll(br)
+	h := make(http.Header, len(header))
+	for name, values := range header {
+		h[name] = values
+	}
+	h.Del("Content-Length")
+
+	return &http.Response{
+		Status:        status,
+		StatusCode:    statusCode,
+		Proto:         proto,
+		ProtoMajor:    major,
+		ProtoMinor:    minor,
+		Header:        h,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
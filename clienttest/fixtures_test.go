@@ -0,0 +1,113 @@
+package clienttest_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/clienttest"
+)
+
+func TestFixtureName(t *testing.T) {
+	tests := []struct {
+		method, url, name string
+	}{
+		{http.MethodGet, "https://api.example.com/users", "GET_api.example.com_users.golden"},
+		{http.MethodGet, "https://api.example.com/users/", "GET_api.example.com_users.golden"},
+		{http.MethodPost, "https://api.example.com/v1/users/1?q=1&sort=name", "POST_api.example.com_v1_users_1_q_1_sort_name.golden"},
+		{http.MethodGet, "http://localhost:8080/", "GET_localhost_8080.golden"},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, tt.url, nil)
+		if got := clienttest.FixtureName(req); got != tt.name {
+			t.Errorf("FixtureName(%s %s) = %s, want %s", tt.method, tt.url, got, tt.name)
+		}
+	}
+}
+
+func TestFixtures(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"GET_api.example.com_users.golden":  "HTTP/1.1 200 OK\nContent-Type: application/json\nContent-Length: 999\n\n[{\"id\":1}]\n",
+		"GET_api.example.com_empty.golden":  "HTTP/1.1 204 No Content\n",
+		"GET_api.example.com_broken.golden": "200 OK\n\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f := clienttest.NewFixtures(dir)
+
+	req, _ := http.NewRequest(http.MethodGet, "https://api.example.com/users", nil)
+	resp, err := f.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != 200 || resp.Status != "200 OK" || string(body) != "[{\"id\":1}]\n" {
+		t.Errorf("response = %q %q", resp.Status, body)
+	}
+	if resp.Header.Get("Content-Type") != "application/json" || resp.ContentLength != int64(len(body)) {
+		t.Errorf("header = %v, length = %d; want the JSON type and the length of the body", resp.Header, resp.ContentLength)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, "https://api.example.com/empty", nil)
+	if resp, err := f.Do(req); err != nil || resp.StatusCode != 204 {
+		t.Errorf("head only: %v, %v; want 204", resp, err)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, "https://api.example.com/broken", nil)
+	if _, err := f.Do(req); err == nil || !strings.Contains(err.Error(), "bad status line") {
+		t.Errorf("broken fixture: err = %v, want a bad status line", err)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, "https://api.example.com/missing", nil)
+	if _, err := f.Do(req); !errors.Is(err, clienttest.ErrUnexpectedRequest) {
+		t.Errorf("missing fixture: err = %v, want %v", err, clienttest.ErrUnexpectedRequest)
+	}
+}
+
+func TestFixturesUpdate(t *testing.T) {
+	dir := t.TempDir()
+	live := clienttest.NewMockClient()
+	live.Expect(http.MethodGet, clienttest.Any()).
+		Respond(http.StatusNotFound, `{"error":"no such user"}`).
+		RespondHeader("X-Request-Id", "1").
+		RespondHeader("Content-Type", "application/json").
+		RespondHeader("Content-Length", "24")
+	name := func(req *http.Request) string { return "user.golden" }
+
+	f := &clienttest.Fixtures{Dir: dir, Name: name, Update: true, Live: live}
+	req, _ := http.NewRequest(http.MethodGet, "https://api.example.com/users/7", nil)
+	resp, err := f.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	live.AssertExpectations(t)
+
+	data, err := os.ReadFile(filepath.Join(dir, "user.golden"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "HTTP/1.1 404 Not Found\nContent-Type: application/json\nX-Request-Id: 1\n\n{\"error\":\"no such user\"}"
+	if string(data) != want {
+		t.Errorf("fixture =\n%s\nwant\n%s", data, want)
+	}
+
+	// Read back without the live client.
+	f = &clienttest.Fixtures{Dir: dir, Name: name}
+	resp, err = f.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != 404 || string(body) != `{"error":"no such user"}` || resp.Header.Get("X-Request-Id") != "1" {
+		t.Errorf("replayed %d %s %v", resp.StatusCode, body, resp.Header)
+	}
+}
@@ -0,0 +1,58 @@
+package clienttest_test
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+// recordingT is a testing.TB that records failures instead of reporting
+// them, to test the helpers that fail tests.
+type recordingT struct {
+	testing.TB
+	mu       sync.Mutex
+	failures []string
+}
+
+// Helper does nothing.
+func (r *recordingT) Helper() {}
+
+// Errorf records a failure.
+func (r *recordingT) Errorf(format string, args ...any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
+
+// Fatal records a failure and stops the calling goroutine.
+func (r *recordingT) Fatal(args ...any) {
+	r.Errorf("%s", fmt.Sprint(args...))
+	runtime.Goexit()
+}
+
+// Fatalf records a failure and stops the calling goroutine.
+func (r *recordingT) Fatalf(format string, args ...any) {
+	r.Errorf(format, args...)
+	runtime.Goexit()
+}
+
+// Failures returns the failures recorded so far.
+func (r *recordingT) Failures() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.failures...)
+}
+
+// failures runs fn with a recordingT in its own goroutine, so that Fatal
+// can stop it, and returns the failures it recorded.
+func failures(fn func(t testing.TB)) []string {
+	r := &recordingT{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn(r)
+	}()
+	<-done
+	return r.Failures()
+}
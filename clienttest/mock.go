@@ -0,0 +1,308 @@
+// Package clienttest helps test code built on the client package: a
+// MockClient that stands in for an HTTPClient, matching outgoing requests
+// against expectations and answering them with canned responses, assertions
+// on the requests it received, golden file fixtures, and cassettes that
+// record real exchanges once and replay them in CI.
+package clienttest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// ErrUnexpectedRequest is returned by Do for requests no expectation matches.
+var ErrUnexpectedRequest = errors.New("clienttest: unexpected request")
+
+// Matcher reports whether a string, such as a URL or header value, matches.
+type Matcher func(string) bool
+
+// Exactly matches the string s.
+func Exactly(s string) Matcher {
+	return func(v string) bool { return v == s }
+}
+
+// Prefix matches strings starting with prefix.
+func Prefix(prefix string) Matcher {
+	return func(v string) bool { return strings.HasPrefix(v, prefix) }
+}
+
+// Contains matches strings containing substr.
+func Contains(substr string) Matcher {
+	return func(v string) bool { return strings.Contains(v, substr) }
+}
+
+// Regexp matches strings matching the regular expression expr. It panics if
+// expr does not compile.
+func Regexp(expr string) Matcher {
+	re := regexp.MustCompile(expr)
+	return re.MatchString
+}
+
+// Any matches every string.
+func Any() Matcher {
+	return func(string) bool { return true }
+}
+
+// MockClient is an HTTPClient that answers requests from expectations. It is
+// safe for concurrent use.
+type MockClient struct {
+	mu           sync.Mutex
+	ordered      bool
+	next         int
+	expectations []*Expectation
+	unexpected   []string
+	requests     []*http.Request
+}
+
+// NewMockClient creates a MockClient whose expectations may be met in any
+// order.
+func NewMockClient() *MockClient {
+	return &MockClient{}
+}
+
+// InOrder makes the expectations match only in the order they were added.
+func (m *MockClient) InOrder() *MockClient {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ordered = true
+	return m
+}
+
+// Expect adds an expectation for a request with the given method, or any
+// method if empty, and a URL accepted by url. By default it must be met
+// exactly once and answers with an empty 200 OK.
+func (m *MockClient) Expect(method string, url Matcher) *Expectation {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e := &Expectation{
+		method: method,
+		url:    url,
+		times:  1,
+		status: http.StatusOK,
+		header: make(http.Header),
+	}
+	m.expectations = append(m.expectations, e)
+	return e
+}
+
+// Do answers the request from the first expectation that matches it.
+func (m *MockClient) Do(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		defer req.Body.Close()
+	}
+	received, err := snapshot(req)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	m.requests = append(m.requests, received)
+	e := m.match(req)
+	if e == nil {
+		desc := req.Method + " " + req.URL.String()
+		m.unexpected = append(m.unexpected, desc)
+		m.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s", ErrUnexpectedRequest, desc)
+	}
+	e.calls++
+	m.mu.Unlock()
+
+	return e.respond(req)
+}
+
+// Requests returns the requests received so far, in order, with their
+// bodies readable.
+func (m *MockClient) Requests() []*http.Request {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.requests)
+}
+
+// Last returns the last request received, failing t if there was none.
+func (m *MockClient) Last(t testing.TB) *http.Request {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.requests) == 0 {
+		t.Fatal("clienttest: no request received")
+	}
+	return m.requests[len(m.requests)-1]
+}
+
+// match finds the expectation for req. Callers must hold m.mu.
+func (m *MockClient) match(req *http.Request) *Expectation {
+	if !m.ordered {
+		for _, e := range m.expectations {
+			if !e.exhausted() && e.matches(req) {
+				return e
+			}
+		}
+		return nil
+	}
+
+	// In order, skip past expectations that are already satisfied but
+	// never past one that still needs calls.
+	for ; m.next < len(m.expectations); m.next++ {
+		e := m.expectations[m.next]
+		if !e.exhausted() && e.matches(req) {
+			return e
+		}
+		if !e.satisfied() {
+			return nil
+		}
+	}
+	return nil
+}
+
+// AssertExpectations fails t for every expectation that was not met and for
+// every request that matched none.
+func (m *MockClient) AssertExpectations(t testing.TB) {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, e := range m.expectations {
+		if !e.satisfied() {
+			t.Errorf("clienttest: expected %s, got %d calls", e, e.calls)
+		}
+	}
+	for _, desc := range m.unexpected {
+		t.Errorf("clienttest: unexpected request %s", desc)
+	}
+}
+
+// Expectation describes an expected request and the response to it.
+type Expectation struct {
+	method  string
+	url     Matcher
+	headers []headerMatcher
+
+	times    int
+	anyTimes bool
+	calls    int
+
+	status  int
+	header  http.Header
+	body    string
+	err     error
+	handler func(*http.Request) (*http.Response, error)
+}
+
+// headerMatcher matches one request header.
+type headerMatcher struct {
+	name  string
+	match Matcher
+}
+
+// WithHeader requires the request header name to match.
+func (e *Expectation) WithHeader(name string, match Matcher) *Expectation {
+	e.headers = append(e.headers, headerMatcher{name: name, match: match})
+	return e
+}
+
+// Times requires the expectation to be met exactly n times.
+func (e *Expectation) Times(n int) *Expectation {
+	e.times = n
+	e.anyTimes = false
+	return e
+}
+
+// AnyTimes lets the expectation be met any number of times, including none.
+func (e *Expectation) AnyTimes() *Expectation {
+	e.anyTimes = true
+	return e
+}
+
+// Respond answers with the given status and body.
+func (e *Expectation) Respond(status int, body string) *Expectation {
+	e.status = status
+	e.body = body
+	return e
+}
+
+// RespondHeader adds a header to the response.
+func (e *Expectation) RespondHeader(name, value string) *Expectation {
+	e.header.Add(name, value)
+	return e
+}
+
+// ReturnError makes Do fail with err instead of responding.
+func (e *Expectation) ReturnError(err error) *Expectation {
+	e.err = err
+	return e
+}
+
+// RespondFunc answers with the result of fn, for responses that depend on
+// the request.
+func (e *Expectation) RespondFunc(fn func(*http.Request) (*http.Response, error)) *Expectation {
+	e.handler = fn
+	return e
+}
+
+// String describes the expectation.
+func (e *Expectation) String() string {
+	method := e.method
+	if method == "" {
+		method = "any method"
+	}
+	if e.anyTimes {
+		return method + " request (any times)"
+	}
+	return fmt.Sprintf("%s request (%d times)", method, e.times)
+}
+
+// matches reports whether req meets the expectation.
+func (e *Expectation) matches(req *http.Request) bool {
+	if e.method != "" && e.method != req.Method {
+		return false
+	}
+	if e.url != nil && !e.url(req.URL.String()) {
+		return false
+	}
+	for _, h := range e.headers {
+		if !h.match(req.Header.Get(h.name)) {
+			return false
+		}
+	}
+	return true
+}
+
+// exhausted reports whether the expectation accepts no more calls.
+func (e *Expectation) exhausted() bool {
+	return !e.anyTimes && e.calls >= e.times
+}
+
+// satisfied reports whether the expectation got enough calls.
+func (e *Expectation) satisfied() bool {
+	return e.anyTimes || e.calls == e.times
+}
+
+// respond builds the response to req.
+func (e *Expectation) respond(req *http.Request) (*http.Response, error) {
+	if e.handler != nil {
+		return e.handler(req)
+	}
+	if e.err != nil {
+		return nil, e.err
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.status, http.StatusText(e.status)),
+		StatusCode:    e.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.header.Clone(),
+		Body:          io.NopCloser(strings.NewReader(e.body)),
+		ContentLength: int64(len(e.body)),
+		Request:       req,
+	}, nil
+}
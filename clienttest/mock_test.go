@@ -0,0 +1,210 @@
+package clienttest_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/clienttest"
+)
+
+// do sends "METHOD path" through m and describes the outcome as the status
+// or "unexpected".
+func do(t *testing.T, m *clienttest.MockClient, request string) string {
+	t.Helper()
+	method, path, _ := strings.Cut(request, " ")
+	req, err := http.NewRequest(method, "https://api.example.com"+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := m.Do(req)
+	if errors.Is(err, clienttest.ErrUnexpectedRequest) {
+		return "unexpected"
+	}
+	if err != nil {
+		return err.Error()
+	}
+	resp.Body.Close()
+	return fmt.Sprint(resp.StatusCode)
+}
+
+func TestMockClientExpectations(t *testing.T) {
+	host := "https://api.example.com"
+	tests := []struct {
+		name     string
+		ordered  bool
+		expect   func(m *clienttest.MockClient)
+		requests []string
+		outcomes string
+		failures string
+	}{
+		{
+			name: "any order",
+			expect: func(m *clienttest.MockClient) {
+				m.Expect(http.MethodGet, clienttest.Exactly(host+"/a"))
+				m.Expect(http.MethodPost, clienttest.Exactly(host+"/b")).Respond(201, "")
+			},
+			requests: []string{"POST /b", "GET /a"},
+			outcomes: "[201 200]",
+			failures: "[]",
+		},
+		{
+			name:    "in order",
+			ordered: true,
+			expect: func(m *clienttest.MockClient) {
+				m.Expect(http.MethodGet, clienttest.Exactly(host+"/a"))
+				m.Expect(http.MethodPost, clienttest.Exactly(host+"/b")).Respond(201, "")
+			},
+			requests: []string{"GET /a", "POST /b"},
+			outcomes: "[200 201]",
+			failures: "[]",
+		},
+		{
+			name:    "out of order",
+			ordered: true,
+			expect: func(m *clienttest.MockClient) {
+				m.Expect(http.MethodGet, clienttest.Exactly(host+"/a"))
+				m.Expect(http.MethodPost, clienttest.Exactly(host+"/b"))
+			},
+			requests: []string{"POST /b", "GET /a"},
+			outcomes: "[unexpected 200]",
+			failures: "[clienttest: expected POST request (1 times), got 0 calls clienttest: unexpected request POST https://api.example.com/b]",
+		},
+		{
+			name:    "in order with times",
+			ordered: true,
+			expect: func(m *clienttest.MockClient) {
+				m.Expect(http.MethodGet, clienttest.Exactly(host+"/a")).Times(2)
+				m.Expect(http.MethodGet, clienttest.Exactly(host+"/b"))
+			},
+			requests: []string{"GET /a", "GET /b", "GET /a", "GET /b"},
+			outcomes: "[200 unexpected 200 200]",
+			failures: "[clienttest: unexpected request GET https://api.example.com/b]",
+		},
+		{
+			name:    "in order past any times",
+			ordered: true,
+			expect: func(m *clienttest.MockClient) {
+				m.Expect(http.MethodGet, clienttest.Exactly(host+"/a")).AnyTimes()
+				m.Expect(http.MethodGet, clienttest.Exactly(host+"/b"))
+			},
+			requests: []string{"GET /b", "GET /a"},
+			outcomes: "[200 unexpected]",
+			failures: "[clienttest: unexpected request GET https://api.example.com/a]",
+		},
+		{
+			name: "times exhausted",
+			expect: func(m *clienttest.MockClient) {
+				m.Expect(http.MethodGet, clienttest.Any()).Times(2)
+			},
+			requests: []string{"GET /a", "GET /a", "GET /a"},
+			outcomes: "[200 200 unexpected]",
+			failures: "[clienttest: unexpected request GET https://api.example.com/a]",
+		},
+		{
+			name: "too few calls",
+			expect: func(m *clienttest.MockClient) {
+				m.Expect(http.MethodGet, clienttest.Any()).Times(2)
+			},
+			requests: []string{"GET /a"},
+			outcomes: "[200]",
+			failures: "[clienttest: expected GET request (2 times), got 1 calls]",
+		},
+		{
+			name: "times zero",
+			expect: func(m *clienttest.MockClient) {
+				m.Expect(http.MethodDelete, clienttest.Any()).Times(0)
+			},
+			requests: []string{"DELETE /a"},
+			outcomes: "[unexpected]",
+			failures: "[clienttest: unexpected request DELETE https://api.example.com/a]",
+		},
+		{
+			name: "any times unused",
+			expect: func(m *clienttest.MockClient) {
+				m.Expect("", clienttest.Any()).AnyTimes()
+			},
+			outcomes: "[]",
+			failures: "[]",
+		},
+		{
+			name: "first match wins",
+			expect: func(m *clienttest.MockClient) {
+				m.Expect("", clienttest.Prefix(host+"/users")).Respond(404, "")
+				m.Expect("", clienttest.Any()).AnyTimes()
+			},
+			requests: []string{"GET /users/1", "GET /users/2", "GET /orders"},
+			outcomes: "[404 200 200]",
+			failures: "[]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := clienttest.NewMockClient()
+			if tt.ordered {
+				m.InOrder()
+			}
+			tt.expect(m)
+			var outcomes []string
+			for _, request := range tt.requests {
+				outcomes = append(outcomes, do(t, m, request))
+			}
+			if got := fmt.Sprint(outcomes); got != tt.outcomes {
+				t.Errorf("outcomes = %s, want %s", got, tt.outcomes)
+			}
+			if got := fmt.Sprint(failures(m.AssertExpectations)); got != tt.failures {
+				t.Errorf("failures = %s, want %s", got, tt.failures)
+			}
+			if got := len(m.Requests()); got != len(tt.requests) {
+				t.Errorf("requests = %d, want %d", got, len(tt.requests))
+			}
+		})
+	}
+}
+
+func TestMockClientResponses(t *testing.T) {
+	errDown := errors.New("down")
+	m := clienttest.NewMockClient()
+	m.Expect(http.MethodGet, clienttest.Exactly("https://api.example.com/user")).
+		WithHeader("Authorization", clienttest.Prefix("Bearer ")).
+		Respond(200, `{"id":1}`).
+		RespondHeader("Content-Type", "application/json")
+	m.Expect(http.MethodGet, clienttest.Contains("/fail")).ReturnError(errDown)
+	m.Expect(http.MethodPost, clienttest.Regexp(`/echo$`)).RespondFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: 202, Header: http.Header{}, Body: req.Body, Request: req}, nil
+	})
+
+	req, _ := http.NewRequest(http.MethodGet, "https://api.example.com/user", nil)
+	if _, err := m.Do(req); !errors.Is(err, clienttest.ErrUnexpectedRequest) {
+		t.Errorf("without Authorization: err = %v, want %v", err, clienttest.ErrUnexpectedRequest)
+	}
+	req.Header.Set("Authorization", "Bearer token")
+	resp, err := m.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != 200 || string(body) != `{"id":1}` || resp.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("response = %d %s %v", resp.StatusCode, body, resp.Header)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, "https://api.example.com/fail", nil)
+	if _, err := m.Do(req); !errors.Is(err, errDown) {
+		t.Errorf("err = %v, want %v", err, errDown)
+	}
+
+	req, _ = http.NewRequest(http.MethodPost, "https://api.example.com/echo", strings.NewReader("ping"))
+	resp, err = m.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	if resp.StatusCode != 202 || string(body) != "ping" {
+		t.Errorf("response = %d %s, want 202 ping", resp.StatusCode, body)
+	}
+	// The recorded request keeps its body readable.
+	clienttest.AssertBody(t, m.Last(t), "ping")
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/client"
+	"github.com/Vkanhan/go-auth-middleware-http-client/middleware"
+)
+
+func main() {
+	// Define your API key and endpoint.
+	apiKey := "your-api-key-here"
+	apiEndpoint := "https://your-api-endpoint.com"
+
+	// Create a new custom client with API key authentication middleware.
+	apiClient := client.NewCustomClient(http.DefaultClient, middleware.APIKeyAuthMiddleware(apiKey))
+
+	// Send a GET request and print the response body.
+	responseBody, err := apiClient.Get(context.Background(), apiEndpoint)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	fmt.Println(string(responseBody))
+}
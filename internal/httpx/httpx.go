@@ -0,0 +1,134 @@
+// Package httpx holds the request and body helpers shared by the client and
+// middleware packages.
+package httpx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrBodyTooLarge is returned when a body exceeds its size cap.
+var ErrBodyTooLarge = errors.New("body too large")
+
+// CloseBody closes the request body, as a RoundTripper must even when it
+// fails.
+func CloseBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
+
+// RewindBody returns a copy of the request with a fresh body so it can be
+// sent again. Requests without a body are returned as they are.
+func RewindBody(req *http.Request) (*http.Request, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req, nil
+	}
+	if req.GetBody == nil {
+		return nil, errors.New("failed to rewind request body: GetBody is not set")
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, fmt.Errorf("failed to rewind request body: %w", err)
+	}
+	req = req.Clone(req.Context())
+	req.Body = body
+	return req, nil
+}
+
+// IsIdempotent reports whether requests with method may be sent twice.
+func IsIdempotent(method string) bool {
+	switch method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace,
+		http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// ParseRetryAfter returns the wait a Retry-After header asks for, in
+// seconds or as a date.
+func ParseRetryAfter(h http.Header, now time.Time) (time.Duration, bool) {
+	value := h.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(t.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// DecodeJSON decodes the single JSON value r holds into v, reading at most
+// limit bytes.
+func DecodeJSON(r io.Reader, v any, limit int64) error {
+	dec := json.NewDecoder(&cappedReader{r: r, remaining: limit})
+	if err := dec.Decode(v); err != nil {
+		if errors.Is(err, ErrBodyTooLarge) {
+			return fmt.Errorf("failed to decode response body: %w", ErrBodyTooLarge)
+		}
+		return fmt.Errorf("failed to decode response body: %w", err)
+	}
+	// Only whitespace may follow the value.
+	if _, err := dec.Token(); err != io.EOF {
+		if err == nil || !errors.Is(err, ErrBodyTooLarge) {
+			err = errors.New("unexpected data after JSON value")
+		}
+		return fmt.Errorf("failed to decode response body: %w", err)
+	}
+	return nil
+}
+
+// cappedReader reads from r, failing with ErrBodyTooLarge once more than
+// remaining bytes are read.
+type cappedReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+// Read reads up to one byte past the cap, to tell a body of exactly the
+// cap from a larger one.
+func (c *cappedReader) Read(p []byte) (int, error) {
+	if c.remaining < 0 {
+		return 0, ErrBodyTooLarge
+	}
+	if int64(len(p)) > c.remaining+1 {
+		p = p[:c.remaining+1]
+	}
+	n, err := c.r.Read(p)
+	c.remaining -= int64(n)
+	if c.remaining < 0 {
+		return n + int(c.remaining), ErrBodyTooLarge
+	}
+	return n, err
+}
+
+// MatchHost returns the first pattern that matches host. Patterns are exact
+// host names, globs such as "api-*.example.com", or suffixes starting with a
+// dot, like ".example.com", which match the domain and its subdomains. Both
+// are expected in lower case.
+func MatchHost(patterns []string, host string) (string, bool) {
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, ".") {
+			if host == pattern[1:] || strings.HasSuffix(host, pattern) {
+				return pattern, true
+			}
+			continue
+		}
+		if ok, _ := path.Match(pattern, host); ok {
+			return pattern, true
+		}
+	}
+	return "", false
+}
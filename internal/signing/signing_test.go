@@ -0,0 +1,27 @@
+package signing_test
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/authtest"
+	"github.com/Vkanhan/go-auth-middleware-http-client/internal/signing"
+)
+
+func FuzzSigV4CanonicalRequest(f *testing.F) {
+	authtest.AddFuzzSeeds(f)
+	// GET /ü/雪/😀
+	f.Add([]byte{0, 3, 3, 4, 13, 0, 0, 0, 0})
+	// POST /users?a=1&a=a+b with X-Custom set three times.
+	f.Add([]byte{1, 1, 2, 2, 0, 1, 0, 2, 1, 0, 4, 0, 1, 1, 2, 0, 7, 2, 1})
+	f.Fuzz(authtest.CanonicalTarget(func(req *http.Request) string {
+		signed := []string{"host"}
+		for name := range req.Header {
+			signed = append(signed, strings.ToLower(name))
+		}
+		slices.Sort(signed)
+		return signing.SigV4CanonicalRequest(req, slices.Compact(signed), "UNSIGNED-PAYLOAD")
+	}))
+}
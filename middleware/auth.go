@@ -0,0 +1,88 @@
+// Package middleware provides middleware for the client package: request
+// authentication, caching, retries, and tools for testing failure modes.
+//
+// ContractMiddleware checks traffic against OpenAPI 3 documents in JSON
+// form only; convert YAML documents to JSON before loading them.
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/client"
+	"github.com/Vkanhan/go-auth-middleware-http-client/internal/httpx"
+)
+
+// BasicAuthMiddleware adds Basic Auth to the request.
+func BasicAuthMiddleware(username, password string) client.Middleware {
+	return BasicAuthProviderMiddleware(StaticCredentials(username, password))
+}
+
+// BasicAuthProviderMiddleware adds Basic Auth to the request with the
+// credentials provider supplies at that time. Requests fail without being
+// sent when the provider fails.
+func BasicAuthProviderMiddleware(provider CredentialProvider) client.Middleware {
+	return func(next client.HTTPClient) client.HTTPClient {
+		return client.HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+			creds, err := provider.Credentials(req.Context())
+			if err == nil && creds.Username == "" && creds.Password == "" {
+				err = errNoCredentials
+			}
+			if err != nil {
+				httpx.CloseBody(req)
+				return nil, fmt.Errorf("failed to get credentials: %w", err)
+			}
+			req.SetBasicAuth(creds.Username, creds.Password)
+			return next.Do(req)
+		})
+	}
+}
+
+// APIKeyAuthMiddleware adds API key-based authentication to the request.
+func APIKeyAuthMiddleware(apiKey string) client.Middleware {
+	return APIKeyAuthSourceMiddleware(StaticToken(apiKey))
+}
+
+// APIKeyAuthSourceMiddleware adds API key-based authentication to the
+// request with the key source supplies at that time. Requests fail without
+// being sent when the source fails.
+func APIKeyAuthSourceMiddleware(source TokenSource) client.Middleware {
+	return func(next client.HTTPClient) client.HTTPClient {
+		return client.HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+			apiKey, err := source.Token(req.Context())
+			if err == nil && apiKey == "" {
+				err = errNoCredentials
+			}
+			if err != nil {
+				httpx.CloseBody(req)
+				return nil, fmt.Errorf("failed to get API key: %w", err)
+			}
+			req.Header.Set("Authorization", "Bearer "+apiKey)
+			return next.Do(req)
+		})
+	}
+}
+
+// CredentialHostsMiddleware fails requests to hosts matching none of the
+// patterns with a *client.PolicyError before any credentials are fetched or
+// sent. Patterns are matched like client.WithAllowedHosts does. Pass it
+// after the auth middleware, so it checks requests before they reach it.
+// Redirects are left to the redirect policy of the client, which strips
+// credentials from those leaving the origin of the original request.
+func CredentialHostsMiddleware(patterns ...string) client.Middleware {
+	allowed := make([]string, len(patterns))
+	for i, pattern := range patterns {
+		allowed[i] = strings.ToLower(pattern)
+	}
+	return func(next client.HTTPClient) client.HTTPClient {
+		return client.HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+			host := strings.TrimSuffix(strings.ToLower(req.URL.Hostname()), ".")
+			if _, ok := httpx.MatchHost(allowed, host); !ok {
+				httpx.CloseBody(req)
+				return nil, &client.PolicyError{Host: host, Reason: "credentials are only sent to allowed hosts"}
+			}
+			return next.Do(req)
+		})
+	}
+}
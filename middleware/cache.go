@@ -0,0 +1,931 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/client"
+)
+
+// CacheStatusHeader is added to responses passing through a Cache. It holds
+// one of the CacheHit, CacheMiss, CacheRevalidated or CacheStale values.
+const CacheStatusHeader = "X-Cache"
+
+// Values of CacheStatusHeader.
+const (
+	CacheHit         = "HIT"
+	CacheMiss        = "MISS"
+	CacheRevalidated = "REVALIDATED"
+	// CacheStale marks stale responses served under the stale-while-revalidate
+	// or stale-if-error directives of RFC 5861. Their Age exceeds their
+	// freshness lifetime.
+	CacheStale = "STALE"
+)
+
+// Names of the cache metrics. The counters are labeled with the cache name.
+const (
+	MetricCacheHits          = "http_client_cache_hits_total"
+	MetricCacheMisses        = "http_client_cache_misses_total"
+	MetricCacheStale         = "http_client_cache_stale_total"
+	MetricCacheRevalidations = "http_client_cache_revalidations_total"
+	MetricCacheEntries       = "http_client_cache_entries"
+	MetricCacheBytes         = "http_client_cache_bytes"
+)
+
+// CacheMode selects how a Cache treats a single request, set with
+// ContextWithCacheMode. The Cache-Control request directives no-cache and
+// no-store give finer control through the headers.
+type CacheMode int
+
+// Cache modes.
+const (
+	// CacheDefault serves and stores responses as their headers allow.
+	CacheDefault CacheMode = iota
+	// CacheBypass sends the request as if there was no cache: nothing is
+	// served, stored or invalidated.
+	CacheBypass
+	// CacheReload ignores the stored response, without revalidating it,
+	// and stores the new one as usual.
+	CacheReload
+	// CachePurge removes the stored response, then sends the request
+	// without storing its response.
+	CachePurge
+)
+
+// cacheModeKey is the context key of the per-request CacheMode.
+type cacheModeKey struct{}
+
+// ContextWithCacheMode returns a context making the requests sent with it
+// use mode.
+func ContextWithCacheMode(ctx context.Context, mode CacheMode) context.Context {
+	return context.WithValue(ctx, cacheModeKey{}, mode)
+}
+
+// maxHeuristicFreshness caps the freshness guessed from Last-Modified.
+const maxHeuristicFreshness = 24 * time.Hour
+
+// DefaultCacheRetainStale is how long responses with validators are kept
+// after going stale by default.
+const DefaultCacheRetainStale = 24 * time.Hour
+
+// heuristicStatuses are cacheable without explicit freshness, as listed in
+// RFC 9110 section 15.1. Partial content is left out since ranges are not
+// combined.
+var heuristicStatuses = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusPermanentRedirect:    true,
+	http.StatusNotFound:             true,
+	http.StatusMethodNotAllowed:     true,
+	http.StatusGone:                 true,
+	http.StatusRequestURITooLong:    true,
+	http.StatusNotImplemented:       true,
+}
+
+// hopByHopHeaders are not stored, and notUpdatedHeaders are kept from the
+// stored response when a 304 response refreshes it.
+var (
+	hopByHopHeaders = []string{
+		"Connection", "Keep-Alive", "Proxy-Connection", "Transfer-Encoding",
+		"Upgrade", "Te", "Trailer", CacheStatusHeader,
+	}
+	notUpdatedHeaders = []string{
+		"Content-Length", "Content-Encoding", "Content-Range", "Content-Type",
+	}
+)
+
+// CacheConfig configures a Cache.
+type CacheConfig struct {
+	// Shared makes the cache follow the rules for caches shared between
+	// users: private responses and, unless explicitly allowed, responses
+	// to requests with Authorization are not stored. A client-side cache
+	// is private by default.
+	Shared bool
+	// Clock tells the time for freshness; nil uses client.SystemClock.
+	Clock client.Clock
+
+	// RetainStale is how long responses with an ETag or Last-Modified are
+	// kept after going stale, so a conditional request answered with 304
+	// Not Modified can refresh them instead of fetching the body again.
+	// Zero means DefaultCacheRetainStale and a negative value drops
+	// responses once stale.
+	RetainStale time.Duration
+
+	// NegativeTTL, if positive, is how long 404 Not Found and 410 Gone
+	// responses without explicit freshness are fresh, so lookups of missing
+	// resources do not reach the origin every time. Explicit Cache-Control
+	// and Expires headers still take precedence.
+	NegativeTTL time.Duration
+
+	// Key returns the key the response to a GET request is stored under;
+	// nil uses DefaultCacheKey. Requests with different keys never share
+	// responses. See CacheKeyFunc for keys including headers or the
+	// caller's identity.
+	Key func(*http.Request) string
+
+	// Metrics, if set, receives the counters of the cache, and the entry
+	// and byte gauges of the built-in stores, labeled cache=Name.
+	Metrics client.Metrics
+	// Name tells caches apart in metrics; empty means "default".
+	Name string
+
+	// Store holds the entries; nil keeps them in a bounded in-memory LRU.
+	Store CacheStore
+	// MaxEntries bounds the number of stored responses; zero means
+	// DefaultCacheMaxEntries and a negative value means no bound.
+	MaxEntries int
+	// MaxBytes bounds the total size of the stored responses; zero means
+	// DefaultCacheMaxBytes and a negative value means no bound. The least
+	// recently used entries are evicted first. The bounds apply to the
+	// built-in stores only, except that responses whose body is larger than
+	// MaxBytes are never stored: they are streamed to the caller after at
+	// most MaxBytes were buffered.
+	MaxBytes int64
+}
+
+// CacheStats are the counters of a Cache.
+type CacheStats struct {
+	Hits          int64
+	Misses        int64
+	Revalidations int64
+	Stale         int64
+
+	Entries     int
+	Bytes       int64
+	Evictions   int64
+	Expirations int64
+}
+
+// Cache is an HTTP cache following RFC 9111: it honors Cache-Control,
+// Expires, Vary and Age, guesses freshness from Last-Modified, revalidates
+// with ETag and Last-Modified validators, and invalidates entries on unsafe
+// requests. Only GET responses are stored. The stale-while-revalidate and
+// stale-if-error extensions of RFC 5861 are supported.
+type Cache struct {
+	cfg   CacheConfig
+	clock client.Clock
+	store CacheStore
+	// maxBody is the size of the largest body stored, or negative for no
+	// bound.
+	maxBody int64
+
+	hits          atomic.Int64
+	misses        atomic.Int64
+	revalidations atomic.Int64
+	stale         atomic.Int64
+
+	// refreshing holds the keys being revalidated in the background.
+	refreshing sync.Map
+}
+
+// CacheStore holds serialized cache entries until their TTL runs out. Its
+// methods are called concurrently. Stores that fail, such as a remote one
+// that is down, should behave as if empty, so the cache degrades to misses.
+type CacheStore interface {
+	// Get returns the value stored under key, if any.
+	Get(key string) (value []byte, ok bool)
+	// Set stores value under key for ttl, which is positive.
+	Set(key string, value []byte, ttl time.Duration)
+	// Delete removes the value under key, if any.
+	Delete(key string)
+}
+
+// statsStore is implemented by the built-in stores reporting their counters.
+type statsStore interface {
+	// stats fills in the store counters of s.
+	stats(s *CacheStats)
+}
+
+// cachedResponse is a stored response.
+type cachedResponse struct {
+	StatusCode   int         `json:"status_code"`
+	Header       http.Header `json:"header,omitempty"`
+	Body         []byte      `json:"body,omitempty"`
+	RequestTime  time.Time   `json:"request_time"`
+	ResponseTime time.Time   `json:"response_time"`
+	// Vary holds the request headers the response varies on, with the
+	// values they had in the request that fetched it.
+	Vary http.Header `json:"vary,omitempty"`
+}
+
+// NewCache creates a Cache keeping entries in cfg.Store, or in a bounded
+// in-memory LRU.
+func NewCache(cfg CacheConfig) *Cache {
+	clock := clockOrSystem(cfg.Clock)
+	maxEntries, maxBytes := cfg.bounds()
+	store := cfg.Store
+	if store == nil {
+		store = newLRUCacheStore(clock, maxEntries, maxBytes)
+	}
+	return &Cache{cfg: cfg, clock: clock, store: store, maxBody: maxBytes}
+}
+
+// bounds returns the store bounds with defaults applied.
+func (cfg CacheConfig) bounds() (maxEntries int, maxBytes int64) {
+	maxEntries, maxBytes = cfg.MaxEntries, cfg.MaxBytes
+	if maxEntries == 0 {
+		maxEntries = DefaultCacheMaxEntries
+	}
+	if maxBytes == 0 {
+		maxBytes = DefaultCacheMaxBytes
+	}
+	return maxEntries, maxBytes
+}
+
+// CacheMiddleware caches responses in a new Cache.
+func CacheMiddleware(cfg CacheConfig) client.Middleware {
+	return NewCache(cfg).Middleware()
+}
+
+// Middleware returns the middleware serving responses from the cache.
+func (c *Cache) Middleware() client.Middleware {
+	return func(next client.HTTPClient) client.HTTPClient {
+		return client.HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+			return c.do(next, req)
+		})
+	}
+}
+
+// Flush writes out the state its store keeps pending, such as the index of
+// a disk cache. Call it before the process exits; the cache stays usable.
+func (c *Cache) Flush() error {
+	if f, ok := c.store.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// Stats returns the counters of the cache.
+func (c *Cache) Stats() CacheStats {
+	s := CacheStats{
+		Hits:          c.hits.Load(),
+		Misses:        c.misses.Load(),
+		Revalidations: c.revalidations.Load(),
+		Stale:         c.stale.Load(),
+	}
+	if store, ok := c.store.(statsStore); ok {
+		store.stats(&s)
+	}
+	return s
+}
+
+// count increments counter and reports it with the store gauges.
+func (c *Cache) count(counter *atomic.Int64, metric string) {
+	counter.Add(1)
+	if c.cfg.Metrics == nil {
+		return
+	}
+	c.cfg.Metrics.AddCounter(metric, 1, "cache", c.name())
+	c.reportGauges()
+}
+
+// reportGauges reports the size of the store, if it tells it.
+func (c *Cache) reportGauges() {
+	store, ok := c.store.(statsStore)
+	if c.cfg.Metrics == nil || !ok {
+		return
+	}
+	var s CacheStats
+	store.stats(&s)
+	c.cfg.Metrics.SetGauge(MetricCacheEntries, float64(s.Entries), "cache", c.name())
+	c.cfg.Metrics.SetGauge(MetricCacheBytes, float64(s.Bytes), "cache", c.name())
+}
+
+// name returns the metrics label of the cache.
+func (c *Cache) name() string {
+	if c.cfg.Name == "" {
+		return "default"
+	}
+	return c.cfg.Name
+}
+
+// CacheStatus returns how a Cache answered resp: CacheHit, CacheMiss,
+// CacheRevalidated or CacheStale, or "" if no cache was involved.
+func CacheStatus(resp *http.Response) string {
+	return resp.Header.Get(CacheStatusHeader)
+}
+
+// FromCache reports whether resp was served from a cache, possibly after
+// revalidating it, rather than fetched in full.
+func FromCache(resp *http.Response) bool {
+	switch CacheStatus(resp) {
+	case CacheHit, CacheRevalidated, CacheStale:
+		return true
+	}
+	return false
+}
+
+// Invalidate removes the entry for a GET of rawURL without headers. With a
+// custom Key including headers, other variants expire on their own.
+func (c *Cache) Invalidate(rawURL string) {
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return
+	}
+	c.store.Delete(c.key(req))
+	c.reportGauges()
+}
+
+// invalidate removes the entry a GET of u with the headers of req would
+// use.
+func (c *Cache) invalidate(req *http.Request, u *url.URL) {
+	get := req.Clone(req.Context())
+	get.Method = http.MethodGet
+	get.URL = u
+	get.Host = ""
+	get.Body = nil
+	c.store.Delete(c.key(get))
+	c.reportGauges()
+}
+
+// key returns the key req is stored under.
+func (c *Cache) key(req *http.Request) string {
+	if c.cfg.Key != nil {
+		return c.cfg.Key(req)
+	}
+	return DefaultCacheKey(req)
+}
+
+// do answers req from the cache or from client.
+func (c *Cache) do(next client.HTTPClient, req *http.Request) (*http.Response, error) {
+	mode, _ := req.Context().Value(cacheModeKey{}).(CacheMode)
+	switch mode {
+	case CacheBypass:
+		return next.Do(req)
+	case CachePurge:
+		c.invalidate(req, req.URL)
+		return next.Do(req)
+	}
+	if req.Method != http.MethodGet {
+		return c.passThrough(next, req)
+	}
+	// Conditional and range requests expect answers the cache does not
+	// build, so they go to the origin untouched.
+	if isConditional(req) || req.Header.Get("Range") != "" {
+		return next.Do(req)
+	}
+
+	reqCC := parseCacheControl(req.Header)
+	if _, ok := reqCC["no-cache"]; !ok && len(req.Header.Values("Cache-Control")) == 0 &&
+		strings.EqualFold(req.Header.Get("Pragma"), "no-cache") {
+		reqCC["no-cache"] = ""
+	}
+	key := c.key(req)
+	var entry *cachedResponse
+	if mode != CacheReload {
+		entry = c.lookup(key, req)
+	}
+	now := c.clock.Now()
+
+	if entry != nil && c.usable(entry, reqCC, now) {
+		c.count(&c.hits, MetricCacheHits)
+		return entry.response(req, now, CacheHit), nil
+	}
+	if _, ok := reqCC["only-if-cached"]; ok {
+		return gatewayTimeout(req), nil
+	}
+	if entry != nil && c.staleWhileRevalidate(entry, reqCC, now) {
+		c.count(&c.stale, MetricCacheStale)
+		resp := entry.response(req, now, CacheStale)
+		c.refresh(next, key, req, entry)
+		return resp, nil
+	}
+
+	outgoing := conditionalRequest(req, entry)
+	requestTime := c.clock.Now()
+	resp, err := next.Do(outgoing)
+	if entry != nil && (err != nil || isServerError(resp.StatusCode)) && c.staleIfError(entry, reqCC, c.clock.Now()) {
+		if err == nil {
+			resp.Body.Close()
+		}
+		c.count(&c.stale, MetricCacheStale)
+		return entry.response(req, c.clock.Now(), CacheStale), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c.handleResponse(key, req, reqCC, entry, outgoing != req, resp, requestTime, c.clock.Now())
+}
+
+// handleResponse refreshes entry with a 304 answer to a conditional
+// request, or stores resp.
+func (c *Cache) handleResponse(key string, req *http.Request, reqCC map[string]string, entry *cachedResponse, conditional bool, resp *http.Response, requestTime, responseTime time.Time) (*http.Response, error) {
+	if resp.StatusCode == http.StatusNotModified && conditional {
+		resp.Body.Close()
+		c.count(&c.revalidations, MetricCacheRevalidations)
+		entry.update(resp.Header, requestTime, responseTime)
+		c.save(key, entry, reqCC)
+		return entry.response(req, responseTime, CacheRevalidated), nil
+	}
+	return c.storeResponse(key, req, reqCC, resp, requestTime, responseTime)
+}
+
+// refresh revalidates entry in the background, unless that is already
+// under way. The request keeps the values but not the cancellation of the
+// context of req, since req is answered before the refresh completes.
+func (c *Cache) refresh(next client.HTTPClient, key string, req *http.Request, entry *cachedResponse) {
+	if _, busy := c.refreshing.LoadOrStore(key, struct{}{}); busy {
+		return
+	}
+	bg := req.Clone(context.WithoutCancel(req.Context()))
+	go func() {
+		defer c.refreshing.Delete(key)
+		outgoing := conditionalRequest(bg, entry)
+		requestTime := c.clock.Now()
+		resp, err := next.Do(outgoing)
+		if err != nil {
+			return
+		}
+		resp, err = c.handleResponse(key, bg, map[string]string{}, entry, outgoing != bg, resp, requestTime, c.clock.Now())
+		if err == nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+	}()
+}
+
+// conditionalRequest returns req with the validators of entry, or req
+// itself when there are none.
+func conditionalRequest(req *http.Request, entry *cachedResponse) *http.Request {
+	if entry == nil {
+		return req
+	}
+	if etag := entry.Header.Get("Etag"); etag != "" {
+		outgoing := req.Clone(req.Context())
+		outgoing.Header.Set("If-None-Match", etag)
+		return outgoing
+	}
+	if modified := entry.Header.Get("Last-Modified"); modified != "" {
+		outgoing := req.Clone(req.Context())
+		outgoing.Header.Set("If-Modified-Since", modified)
+		return outgoing
+	}
+	return req
+}
+
+// passThrough sends requests the cache does not store, invalidating the
+// entries an unsafe request changed.
+func (c *Cache) passThrough(next client.HTTPClient, req *http.Request) (*http.Response, error) {
+	resp, err := next.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if isSafeMethod(req.Method) || resp.StatusCode >= 400 {
+		return resp, nil
+	}
+
+	// RFC 9111 section 4.4: the target URI and the same-origin URIs in
+	// Location and Content-Location are invalidated.
+	c.invalidate(req, req.URL)
+	for _, name := range []string{"Location", "Content-Location"} {
+		if loc := resp.Header.Get(name); loc != "" {
+			if u, err := req.URL.Parse(loc); err == nil && u.Host == req.URL.Host && u.Scheme == req.URL.Scheme {
+				c.invalidate(req, u)
+			}
+		}
+	}
+	return resp, nil
+}
+
+// lookup returns the entry stored under key if it matches the Vary headers
+// of req.
+func (c *Cache) lookup(key string, req *http.Request) *cachedResponse {
+	data, ok := c.store.Get(key)
+	if !ok {
+		return nil
+	}
+	var entry cachedResponse
+	if err := json.Unmarshal(data, &entry); err != nil {
+		c.store.Delete(key)
+		return nil
+	}
+	for name, values := range entry.Vary {
+		if normalizeVary(req.Header.Values(name)) != normalizeVary(values) {
+			return nil
+		}
+	}
+	return &entry
+}
+
+// usable reports whether entry can answer a request with the Cache-Control
+// directives reqCC without revalidation.
+func (c *Cache) usable(entry *cachedResponse, reqCC map[string]string, now time.Time) bool {
+	respCC := parseCacheControl(entry.Header)
+	if _, ok := reqCC["no-cache"]; ok {
+		return false
+	}
+	if _, ok := respCC["no-cache"]; ok {
+		return false
+	}
+
+	lifetime := c.freshness(entry.StatusCode, entry.Header, respCC)
+	age := entry.age(now)
+	if maxAge, ok := directiveSeconds(reqCC, "max-age"); ok && age > maxAge {
+		return false
+	}
+	if minFresh, ok := directiveSeconds(reqCC, "min-fresh"); ok {
+		lifetime -= minFresh
+	}
+	if lifetime > age {
+		return true
+	}
+
+	// Stale entries are only served when the request accepts them and the
+	// response does not forbid it.
+	if c.mustRevalidate(respCC) {
+		return false
+	}
+	if value, ok := reqCC["max-stale"]; ok {
+		if value == "" {
+			return true
+		}
+		maxStale, _ := directiveSeconds(reqCC, "max-stale")
+		return age-lifetime <= maxStale
+	}
+	return false
+}
+
+// staleWhileRevalidate reports whether the stale entry may be served while
+// it is revalidated in the background. Requests stating their own freshness
+// requirements are answered by the origin instead.
+func (c *Cache) staleWhileRevalidate(entry *cachedResponse, reqCC map[string]string, now time.Time) bool {
+	for _, name := range []string{"no-cache", "max-age", "min-fresh"} {
+		if _, ok := reqCC[name]; ok {
+			return false
+		}
+	}
+	respCC := parseCacheControl(entry.Header)
+	if _, ok := respCC["no-cache"]; ok || c.mustRevalidate(respCC) {
+		return false
+	}
+	window, ok := directiveSeconds(respCC, "stale-while-revalidate")
+	if !ok {
+		return false
+	}
+	staleness := entry.age(now) - c.freshness(entry.StatusCode, entry.Header, respCC)
+	return staleness > 0 && staleness <= window
+}
+
+// staleIfError reports whether the entry may be served when the origin
+// fails, under a stale-if-error directive of the response or the request.
+func (c *Cache) staleIfError(entry *cachedResponse, reqCC map[string]string, now time.Time) bool {
+	respCC := parseCacheControl(entry.Header)
+	if c.mustRevalidate(respCC) {
+		return false
+	}
+	respWindow, respOK := directiveSeconds(respCC, "stale-if-error")
+	reqWindow, reqOK := directiveSeconds(reqCC, "stale-if-error")
+	if !respOK && !reqOK {
+		return false
+	}
+	staleness := entry.age(now) - c.freshness(entry.StatusCode, entry.Header, respCC)
+	return staleness <= max(respWindow, reqWindow)
+}
+
+// mustRevalidate reports whether the response directives forbid serving
+// the response stale.
+func (c *Cache) mustRevalidate(respCC map[string]string) bool {
+	if _, ok := respCC["must-revalidate"]; ok {
+		return true
+	}
+	_, ok := respCC["proxy-revalidate"]
+	return ok && c.cfg.Shared
+}
+
+// storeResponse stores resp if it is cacheable and returns it.
+func (c *Cache) storeResponse(key string, req *http.Request, reqCC map[string]string, resp *http.Response, requestTime, responseTime time.Time) (*http.Response, error) {
+	c.count(&c.misses, MetricCacheMisses)
+	resp.Header.Set(CacheStatusHeader, CacheMiss)
+	if !c.cacheable(req, reqCC, resp) {
+		return resp, nil
+	}
+
+	var limited io.Reader = resp.Body
+	if c.maxBody >= 0 {
+		limited = io.LimitReader(resp.Body, c.maxBody+1)
+	}
+	body, err := io.ReadAll(limited)
+	if err != nil {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if c.maxBody >= 0 && int64(len(body)) > c.maxBody {
+		// Too large to store: hand back what was read followed by the rest.
+		resp.Body = &prefixedBody{Reader: io.MultiReader(bytes.NewReader(body), resp.Body), Closer: resp.Body}
+		return resp, nil
+	}
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	entry := &cachedResponse{
+		StatusCode:   resp.StatusCode,
+		Header:       resp.Header.Clone(),
+		Body:         body,
+		RequestTime:  requestTime,
+		ResponseTime: responseTime,
+	}
+	for _, name := range hopByHopHeaders {
+		entry.Header.Del(name)
+	}
+	for _, name := range varyNames(resp.Header) {
+		if entry.Vary == nil {
+			entry.Vary = make(http.Header)
+		}
+		entry.Vary[name] = req.Header.Values(name)
+	}
+	c.save(key, entry, reqCC)
+	return resp, nil
+}
+
+// prefixedBody is a response body whose start was already read into memory.
+type prefixedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// save stores entry until it goes stale, or past that for the longest
+// window in which it may be served stale or, when it has validators,
+// revalidated.
+func (c *Cache) save(key string, entry *cachedResponse, reqCC map[string]string) {
+	if _, ok := reqCC["no-store"]; ok {
+		return
+	}
+	respCC := parseCacheControl(entry.Header)
+	var extra time.Duration
+	if !c.mustRevalidate(respCC) {
+		swr, _ := directiveSeconds(respCC, "stale-while-revalidate")
+		sie, _ := directiveSeconds(respCC, "stale-if-error")
+		extra = max(swr, sie)
+	}
+	if entry.Header.Get("Etag") != "" || entry.Header.Get("Last-Modified") != "" {
+		retain := c.cfg.RetainStale
+		if retain == 0 {
+			retain = DefaultCacheRetainStale
+		}
+		extra = max(extra, retain)
+	}
+	ttl := c.freshness(entry.StatusCode, entry.Header, respCC) - entry.age(c.clock.Now()) + extra
+	if ttl <= 0 {
+		c.store.Delete(key)
+		return
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	c.store.Set(key, data, ttl)
+	c.reportGauges()
+}
+
+// cacheable reports whether the response to req may be stored.
+func (c *Cache) cacheable(req *http.Request, reqCC map[string]string, resp *http.Response) bool {
+	if _, ok := reqCC["no-store"]; ok {
+		return false
+	}
+	if resp.StatusCode == http.StatusNotModified || resp.StatusCode == http.StatusPartialContent {
+		return false
+	}
+	respCC := parseCacheControl(resp.Header)
+	if _, ok := respCC["no-store"]; ok {
+		return false
+	}
+	for _, name := range varyNames(resp.Header) {
+		if name == "*" {
+			return false
+		}
+	}
+
+	_, public := respCC["public"]
+	_, sMaxAge := respCC["s-maxage"]
+	_, mustRevalidate := respCC["must-revalidate"]
+	if c.cfg.Shared {
+		if _, ok := respCC["private"]; ok {
+			return false
+		}
+		if req.Header.Get("Authorization") != "" && !public && !sMaxAge && !mustRevalidate {
+			return false
+		}
+	}
+
+	_, maxAge := respCC["max-age"]
+	explicit := maxAge || (sMaxAge && c.cfg.Shared) || resp.Header.Get("Expires") != ""
+	return explicit || public || heuristicStatuses[resp.StatusCode]
+}
+
+// freshness returns the freshness lifetime of a response, per RFC 9111
+// section 4.2.1.
+func (c *Cache) freshness(status int, header http.Header, respCC map[string]string) time.Duration {
+	if c.cfg.Shared {
+		if d, ok := directiveSeconds(respCC, "s-maxage"); ok {
+			return d
+		}
+	}
+	if d, ok := directiveSeconds(respCC, "max-age"); ok {
+		return d
+	}
+
+	date := responseDate(header)
+	if expires := header.Get("Expires"); expires != "" {
+		t, err := http.ParseTime(expires)
+		if err != nil {
+			// Invalid dates, like "0", mean already expired.
+			return 0
+		}
+		return t.Sub(date)
+	}
+
+	if c.cfg.NegativeTTL > 0 && (status == http.StatusNotFound || status == http.StatusGone) {
+		return c.cfg.NegativeTTL
+	}
+	_, public := respCC["public"]
+	if !heuristicStatuses[status] && !public {
+		return 0
+	}
+	if modified, err := http.ParseTime(header.Get("Last-Modified")); err == nil && modified.Before(date) {
+		return min(date.Sub(modified)/10, maxHeuristicFreshness)
+	}
+	return 0
+}
+
+// age returns the current age of the entry, per RFC 9111 section 4.2.3.
+func (e *cachedResponse) age(now time.Time) time.Duration {
+	ageValue, _ := strconv.Atoi(e.Header.Get("Age"))
+	date := responseDate(e.Header)
+	if date.IsZero() {
+		date = e.ResponseTime
+	}
+
+	apparent := max(e.ResponseTime.Sub(date), 0)
+	corrected := time.Duration(ageValue)*time.Second + e.ResponseTime.Sub(e.RequestTime)
+	return max(apparent, corrected) + now.Sub(e.ResponseTime)
+}
+
+// update refreshes the entry with the headers of a 304 response.
+func (e *cachedResponse) update(header http.Header, requestTime, responseTime time.Time) {
+	for name, values := range header {
+		if contains(hopByHopHeaders, name) || contains(notUpdatedHeaders, name) {
+			continue
+		}
+		e.Header[name] = values
+	}
+	e.RequestTime = requestTime
+	e.ResponseTime = responseTime
+}
+
+// response builds the response answering req from the entry.
+func (e *cachedResponse) response(req *http.Request, now time.Time, status string) *http.Response {
+	header := e.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	header.Set("Age", strconv.Itoa(int(e.age(now)/time.Second)))
+	header.Set(CacheStatusHeader, status)
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode)),
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+// gatewayTimeout is the answer to only-if-cached requests the cache cannot
+// satisfy.
+func gatewayTimeout(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:     "504 " + http.StatusText(http.StatusGatewayTimeout),
+		StatusCode: http.StatusGatewayTimeout,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{CacheStatusHeader: {CacheMiss}},
+		Body:       http.NoBody,
+		Request:    req,
+	}
+}
+
+// DefaultCacheKey returns the key a GET of req is stored under by default:
+// the method and the URL without fragment.
+func DefaultCacheKey(req *http.Request) string {
+	u := *req.URL
+	u.Fragment = ""
+	return http.MethodGet + " " + u.String()
+}
+
+// parseCacheControl parses the Cache-Control directives in h, with
+// lowercase names and unquoted values.
+func parseCacheControl(h http.Header) map[string]string {
+	directives := make(map[string]string)
+	for _, line := range h.Values("Cache-Control") {
+		for _, part := range strings.Split(line, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+			if name == "" {
+				continue
+			}
+			directives[strings.ToLower(name)] = strings.Trim(value, `"`)
+		}
+	}
+	return directives
+}
+
+// directiveSeconds returns the delta-seconds value of a directive.
+func directiveSeconds(cc map[string]string, name string) (time.Duration, bool) {
+	value, ok := cc[name]
+	if !ok {
+		return 0, false
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	// RFC 9111 section 1.2.2 caps delta-seconds to 2^31.
+	return time.Duration(min(seconds, math.MaxInt32)) * time.Second, true
+}
+
+// responseDate returns the Date of a response, or the zero time.
+func responseDate(h http.Header) time.Time {
+	date, _ := http.ParseTime(h.Get("Date"))
+	return date
+}
+
+// varyNames returns the canonical header names in the Vary of a response.
+func varyNames(h http.Header) []string {
+	var names []string
+	for _, line := range h.Values("Vary") {
+		for _, name := range strings.Split(line, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	return names
+}
+
+// normalizeVary joins header values for comparison, ignoring whitespace
+// differences.
+func normalizeVary(values []string) string {
+	var parts []string
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			parts = append(parts, strings.TrimSpace(part))
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// isConditional reports whether req carries validators.
+func isConditional(req *http.Request) bool {
+	for _, name := range []string{"If-None-Match", "If-Modified-Since", "If-Match", "If-Unmodified-Since", "If-Range"} {
+		if req.Header.Get(name) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// isServerError reports whether status is one of the errors stale-if-error
+// applies to.
+func isServerError(status int) bool {
+	switch status {
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// isSafeMethod reports whether method is read-only, per RFC 9110.
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// contains reports whether names holds name, ignoring case.
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
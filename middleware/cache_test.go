@@ -0,0 +1,425 @@
+package middleware_test
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/client"
+	"github.com/Vkanhan/go-auth-middleware-http-client/middleware"
+)
+
+// countingReader counts the bytes read from it.
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+// Read reads from r.
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+func TestCacheBodyLimit(t *testing.T) {
+	const size = 1000
+	tests := []struct {
+		name     string
+		maxBytes int64
+		calls    int
+	}{
+		{"stored", 2 * size, 1},
+		{"too large", size / 10, 2},
+		{"unbounded", -1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var bodies []*countingReader
+			next := client.HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+				body := &countingReader{r: strings.NewReader(strings.Repeat("x", size))}
+				bodies = append(bodies, body)
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Header:     http.Header{"Cache-Control": {"max-age=60"}},
+					Body:       io.NopCloser(body),
+					Request:    req,
+				}, nil
+			})
+			c := middleware.CacheMiddleware(middleware.CacheConfig{MaxBytes: tt.maxBytes, Clock: newStepClock()})(next)
+
+			for range 2 {
+				resp, err := c.Do(newRequest(t, http.MethodGet, "http://example.com/large", nil))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if tt.maxBytes >= 0 && tt.maxBytes < size {
+					if read := bodies[len(bodies)-1].n; int64(read) > tt.maxBytes+1 {
+						t.Errorf("read %d bytes before returning the response, want at most %d", read, tt.maxBytes+1)
+					}
+				}
+				body, err := io.ReadAll(resp.Body)
+				resp.Body.Close()
+				if err != nil || len(body) != size {
+					t.Fatalf("read %d bytes, %v; want %d", len(body), err, size)
+				}
+			}
+			if len(bodies) != tt.calls {
+				t.Errorf("calls = %d, want %d", len(bodies), tt.calls)
+			}
+		})
+	}
+}
+
+// cacheStep is a request of a TestCache case and what it should get.
+type cacheStep struct {
+	advance time.Duration
+	method  string
+	header  http.Header
+	mode    middleware.CacheMode
+
+	status  string      // X-Cache of the response.
+	code    int         // Status code, if not 200.
+	body    string      // Response body.
+	headers http.Header // Response headers to check.
+	sent    http.Header // Request headers the origin should have seen.
+	wait    int         // Origin calls to wait for, after a background refresh.
+}
+
+func TestCache(t *testing.T) {
+	fresh := func(cc, body string) reply {
+		return reply{status: 200, header: http.Header{"Cache-Control": {cc}}, body: body}
+	}
+	// Responses with a validator are kept once stale, so requests can
+	// accept them.
+	tagged := func(cc, body string) reply {
+		return reply{status: 200, header: http.Header{"Cache-Control": {cc}, "Etag": {`"v1"`}}, body: body}
+	}
+	tests := []struct {
+		name    string
+		cfg     middleware.CacheConfig
+		replies []reply
+		steps   []cacheStep
+		calls   int
+	}{
+		{
+			name:    "fresh",
+			replies: []reply{fresh("max-age=60", "a"), fresh("max-age=60", "b")},
+			steps: []cacheStep{
+				{status: middleware.CacheMiss, body: "a"},
+				{advance: 59 * time.Second, status: middleware.CacheHit, body: "a", headers: http.Header{"Age": {"59"}}},
+				{advance: time.Second, status: middleware.CacheMiss, body: "b"},
+			},
+			calls: 2,
+		},
+		{
+			name:    "expires",
+			replies: []reply{{status: 200, header: http.Header{"Date": {epoch.Format(http.TimeFormat)}, "Expires": {epoch.Add(time.Minute).Format(http.TimeFormat)}}, body: "a"}},
+			steps: []cacheStep{
+				{status: middleware.CacheMiss, body: "a"},
+				{advance: 30 * time.Second, status: middleware.CacheHit, body: "a"},
+				{advance: 30 * time.Second, status: middleware.CacheMiss, body: "a"},
+			},
+			calls: 2,
+		},
+		{
+			name:    "no-store",
+			replies: []reply{fresh("no-store", "a"), fresh("no-store", "b")},
+			steps: []cacheStep{
+				{status: middleware.CacheMiss, body: "a"},
+				{status: middleware.CacheMiss, body: "b"},
+			},
+			calls: 2,
+		},
+		{
+			name: "revalidated with etag",
+			replies: []reply{
+				{status: 200, header: http.Header{"Cache-Control": {"max-age=60"}, "Etag": {`"v1"`}, "Content-Type": {"text/plain"}, "X-Version": {"1"}}, body: "a"},
+				{status: 304, header: http.Header{"Cache-Control": {"max-age=120"}, "Etag": {`"v1"`}, "Content-Type": {"text/html"}, "X-Version": {"2"}}},
+			},
+			steps: []cacheStep{
+				{status: middleware.CacheMiss, body: "a"},
+				{
+					advance: 61 * time.Second, status: middleware.CacheRevalidated, body: "a",
+					headers: http.Header{"X-Version": {"2"}, "Content-Type": {"text/plain"}},
+					sent:    http.Header{"If-None-Match": {`"v1"`}},
+				},
+				{advance: 119 * time.Second, status: middleware.CacheHit, body: "a", headers: http.Header{"X-Version": {"2"}}},
+			},
+			calls: 2,
+		},
+		{
+			name: "revalidated with last-modified",
+			replies: []reply{
+				{status: 200, header: http.Header{"Cache-Control": {"max-age=60"}, "Last-Modified": {"Mon, 01 Jan 2024 00:00:00 GMT"}}, body: "a"},
+				{status: 304},
+			},
+			steps: []cacheStep{
+				{status: middleware.CacheMiss, body: "a"},
+				{advance: time.Hour, status: middleware.CacheRevalidated, body: "a", sent: http.Header{"If-Modified-Since": {"Mon, 01 Jan 2024 00:00:00 GMT"}}},
+			},
+			calls: 2,
+		},
+		{
+			name: "changed on revalidation",
+			replies: []reply{
+				{status: 200, header: http.Header{"Cache-Control": {"max-age=60"}, "Etag": {`"v1"`}}, body: "a"},
+				{status: 200, header: http.Header{"Cache-Control": {"max-age=60"}, "Etag": {`"v2"`}}, body: "b"},
+			},
+			steps: []cacheStep{
+				{status: middleware.CacheMiss, body: "a"},
+				{advance: 61 * time.Second, status: middleware.CacheMiss, body: "b"},
+				{status: middleware.CacheHit, body: "b"},
+			},
+			calls: 2,
+		},
+		{
+			name: "heuristic freshness",
+			replies: []reply{{status: 200, header: http.Header{
+				"Date":          {epoch.Format(http.TimeFormat)},
+				"Last-Modified": {epoch.Add(-100 * time.Minute).Format(http.TimeFormat)},
+			}, body: "a"}, {status: 304}},
+			steps: []cacheStep{
+				{status: middleware.CacheMiss, body: "a"},
+				{advance: 9 * time.Minute, status: middleware.CacheHit, body: "a"},
+				{advance: 2 * time.Minute, status: middleware.CacheRevalidated, body: "a"},
+			},
+			calls: 2,
+		},
+		{
+			name: "vary",
+			replies: []reply{
+				{status: 200, header: http.Header{"Cache-Control": {"max-age=60"}, "Vary": {"Accept-Language"}}, body: "en"},
+				{status: 200, header: http.Header{"Cache-Control": {"max-age=60"}, "Vary": {"Accept-Language"}}, body: "fr"},
+			},
+			steps: []cacheStep{
+				{header: http.Header{"Accept-Language": {"en"}}, status: middleware.CacheMiss, body: "en"},
+				{header: http.Header{"Accept-Language": {"en"}}, status: middleware.CacheHit, body: "en"},
+				{header: http.Header{"Accept-Language": {"fr"}}, status: middleware.CacheMiss, body: "fr"},
+				{header: http.Header{"Accept-Language": {"fr"}}, status: middleware.CacheHit, body: "fr"},
+			},
+			calls: 2,
+		},
+		{
+			name:    "vary star",
+			replies: []reply{{status: 200, header: http.Header{"Cache-Control": {"max-age=60"}, "Vary": {"*"}}, body: "a"}},
+			steps: []cacheStep{
+				{status: middleware.CacheMiss, body: "a"},
+				{status: middleware.CacheMiss, body: "a"},
+			},
+			calls: 2,
+		},
+		{
+			name:    "stale while revalidate",
+			replies: []reply{fresh("max-age=10, stale-while-revalidate=60", "a"), fresh("max-age=10, stale-while-revalidate=60", "b")},
+			steps: []cacheStep{
+				{status: middleware.CacheMiss, body: "a"},
+				{advance: 20 * time.Second, status: middleware.CacheStale, body: "a", wait: 2},
+				{status: middleware.CacheHit, body: "b"},
+			},
+			calls: 2,
+		},
+		{
+			name:    "stale while revalidate expired",
+			replies: []reply{fresh("max-age=10, stale-while-revalidate=60", "a"), fresh("max-age=10", "b")},
+			steps: []cacheStep{
+				{status: middleware.CacheMiss, body: "a"},
+				{advance: 71 * time.Second, status: middleware.CacheMiss, body: "b"},
+			},
+			calls: 2,
+		},
+		{
+			name:    "stale if error",
+			replies: []reply{fresh("max-age=10, stale-if-error=60", "a"), {status: 503, body: "down"}},
+			steps: []cacheStep{
+				{status: middleware.CacheMiss, body: "a"},
+				{advance: 20 * time.Second, status: middleware.CacheStale, body: "a"},
+				{advance: 60 * time.Second, status: middleware.CacheMiss, code: 503, body: "down"},
+			},
+			calls: 3,
+		},
+		{
+			name:    "stale if transport error",
+			replies: []reply{fresh("max-age=10, stale-if-error=60", "a"), {err: errors.New("connection refused")}},
+			steps: []cacheStep{
+				{status: middleware.CacheMiss, body: "a"},
+				{advance: 20 * time.Second, status: middleware.CacheStale, body: "a"},
+			},
+			calls: 2,
+		},
+		{
+			name:    "stale if error requested",
+			replies: []reply{tagged("max-age=10", "a"), {status: 500, body: "down"}},
+			steps: []cacheStep{
+				{status: middleware.CacheMiss, body: "a"},
+				{advance: 20 * time.Second, header: http.Header{"Cache-Control": {"stale-if-error=30"}}, status: middleware.CacheStale, body: "a"},
+			},
+			calls: 2,
+		},
+		{
+			name:    "must revalidate",
+			replies: []reply{fresh("max-age=10, stale-if-error=60, must-revalidate", "a"), {status: 500, body: "down"}},
+			steps: []cacheStep{
+				{status: middleware.CacheMiss, body: "a"},
+				{advance: 20 * time.Second, status: middleware.CacheMiss, code: 500, body: "down"},
+			},
+			calls: 2,
+		},
+		{
+			name:    "negative caching",
+			cfg:     middleware.CacheConfig{NegativeTTL: 30 * time.Second},
+			replies: []reply{{status: 404, body: "missing"}},
+			steps: []cacheStep{
+				{status: middleware.CacheMiss, code: 404, body: "missing"},
+				{advance: 29 * time.Second, status: middleware.CacheHit, code: 404, body: "missing"},
+				{advance: time.Second, status: middleware.CacheMiss, code: 404, body: "missing"},
+			},
+			calls: 2,
+		},
+		{
+			name:    "negative caching off",
+			replies: []reply{{status: 404, body: "missing"}},
+			steps: []cacheStep{
+				{status: middleware.CacheMiss, code: 404, body: "missing"},
+				{status: middleware.CacheMiss, code: 404, body: "missing"},
+			},
+			calls: 2,
+		},
+		{
+			name:    "negative caching explicit",
+			cfg:     middleware.CacheConfig{NegativeTTL: time.Hour},
+			replies: []reply{{status: 404, header: http.Header{"Cache-Control": {"max-age=5"}}, body: "missing"}},
+			steps: []cacheStep{
+				{status: middleware.CacheMiss, code: 404, body: "missing"},
+				{advance: 5 * time.Second, status: middleware.CacheMiss, code: 404, body: "missing"},
+			},
+			calls: 2,
+		},
+		{
+			name:    "bypass",
+			replies: []reply{fresh("max-age=60", "a"), fresh("max-age=60", "b")},
+			steps: []cacheStep{
+				{status: middleware.CacheMiss, body: "a"},
+				{mode: middleware.CacheBypass, body: "b"},
+				{status: middleware.CacheHit, body: "a"},
+			},
+			calls: 2,
+		},
+		{
+			name:    "reload",
+			replies: []reply{fresh("max-age=60", "a"), fresh("max-age=60", "b")},
+			steps: []cacheStep{
+				{status: middleware.CacheMiss, body: "a"},
+				{mode: middleware.CacheReload, status: middleware.CacheMiss, body: "b"},
+				{status: middleware.CacheHit, body: "b"},
+			},
+			calls: 2,
+		},
+		{
+			name:    "purge",
+			replies: []reply{fresh("max-age=60", "a"), fresh("max-age=60", "b"), fresh("max-age=60", "c")},
+			steps: []cacheStep{
+				{status: middleware.CacheMiss, body: "a"},
+				{mode: middleware.CachePurge, body: "b"},
+				{status: middleware.CacheMiss, body: "c"},
+			},
+			calls: 3,
+		},
+		{
+			name:    "unsafe method invalidates",
+			replies: []reply{fresh("max-age=60", "a"), {status: 204}, fresh("max-age=60", "c")},
+			steps: []cacheStep{
+				{status: middleware.CacheMiss, body: "a"},
+				{method: http.MethodPost, code: 204},
+				{status: middleware.CacheMiss, body: "c"},
+			},
+			calls: 3,
+		},
+		{
+			name:    "no-cache request",
+			replies: []reply{fresh("max-age=60", "a"), fresh("max-age=60", "b")},
+			steps: []cacheStep{
+				{status: middleware.CacheMiss, body: "a"},
+				{header: http.Header{"Cache-Control": {"no-cache"}}, status: middleware.CacheMiss, body: "b"},
+			},
+			calls: 2,
+		},
+		{
+			name:    "max-stale",
+			replies: []reply{tagged("max-age=10", "a")},
+			steps: []cacheStep{
+				{status: middleware.CacheMiss, body: "a"},
+				{advance: 30 * time.Second, header: http.Header{"Cache-Control": {"max-stale=30"}}, status: middleware.CacheHit, body: "a"},
+			},
+			calls: 1,
+		},
+		{
+			name:    "only-if-cached",
+			replies: []reply{fresh("max-age=60", "a")},
+			steps: []cacheStep{
+				{header: http.Header{"Cache-Control": {"only-if-cached"}}, status: middleware.CacheMiss, code: 504},
+			},
+			calls: 0,
+		},
+		{
+			name:    "shared private",
+			cfg:     middleware.CacheConfig{Shared: true},
+			replies: []reply{fresh("max-age=60, private", "a"), fresh("max-age=60, private", "b")},
+			steps: []cacheStep{
+				{status: middleware.CacheMiss, body: "a"},
+				{status: middleware.CacheMiss, body: "b"},
+			},
+			calls: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := client.NewFakeClock(epoch)
+			cfg := tt.cfg
+			cfg.Clock = clock
+			next := newStub(tt.replies...)
+			m := middleware.CacheMiddleware(cfg)
+
+			for i, step := range tt.steps {
+				clock.Advance(step.advance)
+				req := newRequest(t, cmp.Or(step.method, http.MethodGet), "http://example.com/doc", nil)
+				for name, values := range step.header {
+					req.Header[name] = values
+				}
+				if step.mode != middleware.CacheDefault {
+					req = req.WithContext(middleware.ContextWithCacheMode(context.Background(), step.mode))
+				}
+				resp, body := send(t, m, next, req)
+
+				if got := middleware.CacheStatus(resp); got != step.status {
+					t.Errorf("step %d: X-Cache = %q, want %q", i, got, step.status)
+				}
+				if want := cmp.Or(step.code, http.StatusOK); resp.StatusCode != want {
+					t.Errorf("step %d: status = %d, want %d", i, resp.StatusCode, want)
+				}
+				if body != step.body {
+					t.Errorf("step %d: body = %q, want %q", i, body, step.body)
+				}
+				for name := range step.headers {
+					if got, want := resp.Header.Get(name), step.headers.Get(name); got != want {
+						t.Errorf("step %d: %s = %q, want %q", i, name, got, want)
+					}
+				}
+				for name := range step.sent {
+					if got, want := next.last().Header.Get(name), step.sent.Get(name); got != want {
+						t.Errorf("step %d: sent %s = %q, want %q", i, name, got, want)
+					}
+				}
+				waitForCalls(t, next, step.wait)
+			}
+			if next.calls() != tt.calls {
+				t.Errorf("calls = %d, want %d", next.calls(), tt.calls)
+			}
+		})
+	}
+}
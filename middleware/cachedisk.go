@@ -0,0 +1,377 @@
+package middleware
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/client"
+)
+
+// diskIndexFile is the name of the index in a disk cache directory, and
+// diskObjectsDir the directory holding the stored values.
+const (
+	diskIndexFile  = "index.json"
+	diskObjectsDir = "objects"
+)
+
+// diskIndexDelay is how long index changes are batched before the index is
+// written.
+const diskIndexDelay = time.Second
+
+// diskCacheStore is a CacheStore persisting values under a directory, so
+// entries survive across process runs. Values are stored once per content
+// hash in objects/, and index.json maps keys to hashes. Objects are written
+// at once, the index once changes settled for diskIndexDelay; whatever a
+// crash leaves out of step is swept on the next open. The store is meant
+// for one process at a time.
+type diskCacheStore struct {
+	dir        string
+	clock      client.Clock
+	maxEntries int
+	maxBytes   int64
+
+	mu          sync.Mutex
+	index       map[string]*diskEntry
+	order       *list.List       // of *diskEntry, most recently used first
+	dirty       bool             // the index changed since it was written
+	flush       *time.Timer      // pending index write
+	refs        map[string]int   // entries per hash
+	sizes       map[string]int64 // object sizes per hash
+	bytes       int64
+	evictions   int64
+	expirations int64
+}
+
+// diskEntry is an index entry of a diskCacheStore.
+type diskEntry struct {
+	Hash    string    `json:"hash"`
+	Expires time.Time `json:"expires"`
+	// Used is the last time the entry was stored or read; it is only
+	// persisted when the index is next written.
+	Used time.Time `json:"used"`
+
+	key  string
+	elem *list.Element
+}
+
+// NewDiskCache creates a Cache that keeps entries in files under dir,
+// creating it if needed. MaxBytes bounds the size of the stored files. A
+// corrupt index starts the cache empty, and corrupt files are dropped when
+// read, so a damaged directory costs cache misses rather than errors. The
+// index is written a second after changes settle; call Cache.Flush before
+// exiting to keep the latest entries.
+func NewDiskCache(dir string, cfg CacheConfig) (*Cache, error) {
+	clock := clockOrSystem(cfg.Clock)
+	maxEntries, maxBytes := cfg.bounds()
+	store, err := openDiskCacheStore(dir, clock, maxEntries, maxBytes)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Store = store
+	return NewCache(cfg), nil
+}
+
+// openDiskCacheStore loads the store under dir, dropping index entries
+// whose files are gone and files no entry refers to.
+func openDiskCacheStore(dir string, clock client.Clock, maxEntries int, maxBytes int64) (*diskCacheStore, error) {
+	if err := os.MkdirAll(filepath.Join(dir, diskObjectsDir), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	s := &diskCacheStore{
+		dir:        dir,
+		clock:      clock,
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		index:      make(map[string]*diskEntry),
+		order:      list.New(),
+		refs:       make(map[string]int),
+		sizes:      make(map[string]int64),
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, diskIndexFile))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read cache index: %w", err)
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &s.index); err != nil {
+			// The index can only be torn by a bug or by hand; the
+			// objects it described are swept below.
+			s.index = make(map[string]*diskEntry)
+		}
+	}
+
+	now := clock.Now()
+	for key, entry := range s.index {
+		if entry == nil || !validHash(entry.Hash) || !now.Before(entry.Expires) {
+			delete(s.index, key)
+			continue
+		}
+		info, err := os.Stat(s.objectPath(entry.Hash))
+		if err != nil {
+			delete(s.index, key)
+			continue
+		}
+		entry.key = key
+		s.refs[entry.Hash]++
+		if _, ok := s.sizes[entry.Hash]; !ok {
+			s.sizes[entry.Hash] = info.Size()
+			s.bytes += info.Size()
+		}
+	}
+	entries := make([]*diskEntry, 0, len(s.index))
+	for _, entry := range s.index {
+		entries = append(entries, entry)
+	}
+	slices.SortFunc(entries, func(a, b *diskEntry) int { return b.Used.Compare(a.Used) })
+	for _, entry := range entries {
+		entry.elem = s.order.PushBack(entry)
+	}
+
+	if err := s.sweep(); err != nil {
+		return nil, err
+	}
+	s.evict()
+	s.save()
+	return s, nil
+}
+
+// sweep removes object files no entry refers to, including temporary files
+// left by an interrupted write.
+func (s *diskCacheStore) sweep() error {
+	root := filepath.Join(s.dir, diskObjectsDir)
+	return filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("failed to scan cache directory: %w", err)
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if s.refs[d.Name()] == 0 {
+			os.Remove(path)
+		}
+		return nil
+	})
+}
+
+// Get returns the unexpired value under key, dropping it when its file is
+// missing or does not match its hash.
+func (s *diskCacheStore) Get(key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.index[key]
+	if !ok {
+		return nil, false
+	}
+	now := s.clock.Now()
+	if !now.Before(entry.Expires) {
+		s.remove(key)
+		s.expirations++
+		s.changed()
+		return nil, false
+	}
+
+	value, err := os.ReadFile(s.objectPath(entry.Hash))
+	if err != nil || contentHash(value) != entry.Hash {
+		s.drop(entry.Hash)
+		s.changed()
+		return nil, false
+	}
+	entry.Used = now
+	s.order.MoveToFront(entry.elem)
+	return value, true
+}
+
+// Set stores value under key for ttl, evicting the least recently used
+// entries to stay in bounds. Values larger than the byte bound and values
+// that cannot be written are not stored.
+func (s *diskCacheStore) Set(key string, value []byte, ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.changed()
+	if _, ok := s.index[key]; ok {
+		s.remove(key)
+	}
+	if s.maxBytes >= 0 && int64(len(value)) > s.maxBytes {
+		return
+	}
+
+	hash := contentHash(value)
+	if s.refs[hash] == 0 {
+		if err := s.writeObject(hash, value); err != nil {
+			return
+		}
+		s.sizes[hash] = int64(len(value))
+		s.bytes += int64(len(value))
+	}
+	now := s.clock.Now()
+	entry := &diskEntry{Hash: hash, Expires: now.Add(ttl), Used: now, key: key}
+	entry.elem = s.order.PushFront(entry)
+	s.index[key] = entry
+	s.refs[hash]++
+	s.evict()
+}
+
+// Delete removes the value under key.
+func (s *diskCacheStore) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.index[key]; ok {
+		s.remove(key)
+		s.changed()
+	}
+}
+
+// Flush writes the index if it changed, instead of waiting for the pending
+// write.
+func (s *diskCacheStore) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.flush != nil {
+		s.flush.Stop()
+		s.flush = nil
+	}
+	if !s.dirty {
+		return nil
+	}
+	return s.save()
+}
+
+// changed schedules an index write, batching the changes until then.
+// Callers must hold s.mu.
+func (s *diskCacheStore) changed() {
+	s.dirty = true
+	if s.flush == nil {
+		s.flush = time.AfterFunc(diskIndexDelay, func() { s.Flush() })
+	}
+}
+
+// stats fills in the store counters.
+func (s *diskCacheStore) stats(stats *CacheStats) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats.Entries = len(s.index)
+	stats.Bytes = s.bytes
+	stats.Evictions = s.evictions
+	stats.Expirations = s.expirations
+}
+
+// evict removes the least recently used entries until the store is in
+// bounds. Callers must hold s.mu.
+func (s *diskCacheStore) evict() {
+	for (s.maxEntries >= 0 && len(s.index) > s.maxEntries) || (s.maxBytes >= 0 && s.bytes > s.maxBytes) {
+		oldest := s.order.Back()
+		if oldest == nil {
+			return
+		}
+		s.remove(oldest.Value.(*diskEntry).key)
+		s.evictions++
+	}
+}
+
+// remove drops the entry under key, deleting its file once no other entry
+// shares it. Callers must hold s.mu.
+func (s *diskCacheStore) remove(key string) {
+	entry := s.index[key]
+	hash := entry.Hash
+	s.order.Remove(entry.elem)
+	delete(s.index, key)
+	s.refs[hash]--
+	if s.refs[hash] > 0 {
+		return
+	}
+	delete(s.refs, hash)
+	s.bytes -= s.sizes[hash]
+	delete(s.sizes, hash)
+	os.Remove(s.objectPath(hash))
+}
+
+// drop removes every entry sharing a corrupt file. Callers must hold s.mu.
+func (s *diskCacheStore) drop(hash string) {
+	for key, entry := range s.index {
+		if entry.Hash == hash {
+			s.remove(key)
+		}
+	}
+}
+
+// writeObject writes value to the file for hash through a temporary file,
+// so a crash never leaves a torn object.
+func (s *diskCacheStore) writeObject(hash string, value []byte) error {
+	path := s.objectPath(hash)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".object-*")
+	if err != nil {
+		return fmt.Errorf("failed to write cache object: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(value); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write cache object: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write cache object: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write cache object: %w", err)
+	}
+	return nil
+}
+
+// save writes the index through a temporary file. Callers must hold s.mu.
+// The store keeps working from memory when the index cannot be written.
+func (s *diskCacheStore) save() error {
+	data, err := json.Marshal(s.index)
+	if err != nil {
+		return fmt.Errorf("failed to encode cache index: %w", err)
+	}
+	tmp, err := os.CreateTemp(s.dir, ".index-*")
+	if err != nil {
+		return fmt.Errorf("failed to write cache index: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write cache index: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write cache index: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(s.dir, diskIndexFile)); err != nil {
+		return fmt.Errorf("failed to write cache index: %w", err)
+	}
+	s.dirty = false
+	return nil
+}
+
+// objectPath returns the file holding the value with the given hash,
+// fanned out over subdirectories by its first two characters.
+func (s *diskCacheStore) objectPath(hash string) string {
+	return filepath.Join(s.dir, diskObjectsDir, hash[:2], hash)
+}
+
+// validHash reports whether hash is a hex SHA-256, as index entries must be
+// before they are used in paths.
+func validHash(hash string) bool {
+	if len(hash) != 2*sha256.Size {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
+
+// contentHash returns the hex SHA-256 of value.
+func contentHash(value []byte) string {
+	sum := sha256.Sum256(value)
+	return hex.EncodeToString(sum[:])
+}
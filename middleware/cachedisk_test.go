@@ -0,0 +1,115 @@
+package middleware_test
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/middleware"
+)
+
+// cacheable answers every request with the same fresh response.
+func cacheable() *stub {
+	return newStub(reply{status: 200, header: http.Header{"Cache-Control": {"max-age=3600"}}, body: "cached"})
+}
+
+func TestDiskCachePersists(t *testing.T) {
+	dir := t.TempDir()
+	clock := newStepClock()
+	next := cacheable()
+
+	c, err := middleware.NewDiskCache(dir, middleware.CacheConfig{Clock: clock})
+	if err != nil {
+		t.Fatal(err)
+	}
+	send(t, c.Middleware(), next, newRequest(t, http.MethodGet, "http://example.com/a", nil))
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := middleware.NewDiskCache(dir, middleware.CacheConfig{Clock: clock})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, _ := send(t, reopened.Middleware(), next, newRequest(t, http.MethodGet, "http://example.com/a", nil))
+	if !middleware.FromCache(resp) || next.calls() != 1 {
+		t.Errorf("reopened cache missed: calls = %d, status %q", next.calls(), middleware.CacheStatus(resp))
+	}
+}
+
+func TestDiskCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	clock := newStepClock()
+	next := cacheable()
+	c, err := middleware.NewDiskCache(t.TempDir(), middleware.CacheConfig{Clock: clock, MaxEntries: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := func(path string) bool {
+		clock.Advance(1)
+		resp, _ := send(t, c.Middleware(), next, newRequest(t, http.MethodGet, "http://example.com"+path, nil))
+		return middleware.FromCache(resp)
+	}
+
+	get("/a")
+	get("/b")
+	get("/a") // /b is now the least recently used.
+	get("/c")
+	if !get("/a") {
+		t.Error("/a was evicted")
+	}
+	if get("/b") {
+		t.Error("/b was kept")
+	}
+	if stats := c.Stats(); stats.Entries != 2 || stats.Evictions != 2 {
+		t.Errorf("entries = %d, evictions = %d; want 2 and 2", stats.Entries, stats.Evictions)
+	}
+}
+
+func TestDiskCacheIgnoresBadIndex(t *testing.T) {
+	dir := t.TempDir()
+	outside := filepath.Join(dir, "outside")
+	if err := os.WriteFile(outside, []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// A hash of the right length resolving to the file above, as
+	// objects/<hash[:2]>/<hash> with hash[:2] == "..".
+	hash := "../" + filepath.Base(dir) + "/"
+	pad := 64 - len(hash) - len("outside")
+	hash += strings.Repeat("./", pad/2) + strings.Repeat("/", pad%2) + "outside"
+	if len(hash) != 64 || filepath.Join(dir, "objects", hash[:2], hash) != outside {
+		t.Fatalf("hash %q does not resolve to %s", hash, outside)
+	}
+	index := `{"k":{"hash":"` + hash + `","expires":"2999-01-01T00:00:00Z"}}`
+	if err := os.WriteFile(filepath.Join(dir, "index.json"), []byte(index), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := middleware.NewDiskCache(dir, middleware.CacheConfig{Clock: newStepClock()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats := c.Stats(); stats.Entries != 0 {
+		t.Errorf("entries = %d, want the bad entry dropped", stats.Entries)
+	}
+	if _, err := os.Stat(outside); err != nil {
+		t.Errorf("file outside the cache was touched: %v", err)
+	}
+}
+
+// BenchmarkDiskCacheFill stores b.N responses in a disk cache bounded to
+// 1000 entries, so most stores evict.
+func BenchmarkDiskCacheFill(b *testing.B) {
+	c, err := middleware.NewDiskCache(b.TempDir(), middleware.CacheConfig{Clock: newStepClock(), MaxEntries: 1000})
+	if err != nil {
+		b.Fatal(err)
+	}
+	next := cacheable()
+	m := c.Middleware()
+	b.ResetTimer()
+	for i := range b.N {
+		send(b, m, next, newRequest(b, http.MethodGet, fmt.Sprintf("http://example.com/%d", i), nil))
+	}
+}
@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// CacheKeyOptions configures the keys built by CacheKeyFunc.
+type CacheKeyOptions struct {
+	// Headers lists request headers whose values are part of the key, such
+	// as Accept-Language for content-negotiated responses.
+	Headers []string
+	// IgnoreQuery lists query parameters left out of the key, such as
+	// cache busters or tracking parameters.
+	IgnoreQuery []string
+	// Principal returns the identity of the caller, so responses are never
+	// shared between users; AuthorizationPrincipal suits most clients.
+	Principal func(*http.Request) string
+}
+
+// CacheKeyFunc returns a Key for CacheConfig extending DefaultCacheKey as
+// opts describe.
+func CacheKeyFunc(opts CacheKeyOptions) func(*http.Request) string {
+	return func(req *http.Request) string {
+		u := *req.URL
+		if len(opts.IgnoreQuery) > 0 {
+			query := u.Query()
+			for _, name := range opts.IgnoreQuery {
+				query.Del(name)
+			}
+			u.RawQuery = query.Encode()
+		}
+
+		var b strings.Builder
+		b.WriteString(DefaultCacheKey(&http.Request{URL: &u}))
+		for _, name := range opts.Headers {
+			b.WriteString("\n")
+			b.WriteString(http.CanonicalHeaderKey(name))
+			b.WriteString(": ")
+			b.WriteString(normalizeVary(req.Header.Values(name)))
+		}
+		if opts.Principal != nil {
+			b.WriteString("\nPrincipal: ")
+			b.WriteString(opts.Principal(req))
+		}
+		return b.String()
+	}
+}
+
+// AuthorizationPrincipal identifies callers by a hash of their
+// Authorization header, so credentials never end up in cache keys.
+// Requests without one share the empty principal.
+func AuthorizationPrincipal(req *http.Request) string {
+	auth := req.Header.Get("Authorization")
+	if auth == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(auth))
+	return hex.EncodeToString(sum[:])
+}
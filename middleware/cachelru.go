@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/client"
+)
+
+// Default bounds of the in-memory cache.
+const (
+	DefaultCacheMaxEntries = 10000
+	DefaultCacheMaxBytes   = 64 << 20
+)
+
+// lruCacheStore is an in-memory CacheStore bounded in entries and bytes,
+// evicting the least recently used entries first.
+type lruCacheStore struct {
+	clock      client.Clock
+	maxEntries int
+	maxBytes   int64
+
+	mu          sync.Mutex
+	order       *list.List // of *lruEntry, most recently used first
+	entries     map[string]*list.Element
+	bytes       int64
+	evictions   int64
+	expirations int64
+}
+
+// lruEntry is a value in an lruCacheStore.
+type lruEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// newLRUCacheStore creates an empty store. Negative bounds disable them.
+func newLRUCacheStore(clock client.Clock, maxEntries int, maxBytes int64) *lruCacheStore {
+	return &lruCacheStore{
+		clock:      clock,
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+// Get returns the unexpired value under key and marks it recently used.
+func (s *lruCacheStore) Get(key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	elem, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*lruEntry)
+	if !s.clock.Now().Before(entry.expires) {
+		s.remove(elem)
+		s.expirations++
+		return nil, false
+	}
+	s.order.MoveToFront(elem)
+	return entry.value, true
+}
+
+// Set stores value under key for ttl, evicting entries to stay in bounds.
+// Values larger than the byte bound are not stored.
+func (s *lruCacheStore) Set(key string, value []byte, ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if elem, ok := s.entries[key]; ok {
+		s.remove(elem)
+	}
+	if s.maxBytes >= 0 && int64(len(value)) > s.maxBytes {
+		return
+	}
+
+	entry := &lruEntry{key: key, value: value, expires: s.clock.Now().Add(ttl)}
+	s.entries[key] = s.order.PushFront(entry)
+	s.bytes += int64(len(value))
+
+	for (s.maxEntries >= 0 && s.order.Len() > s.maxEntries) || (s.maxBytes >= 0 && s.bytes > s.maxBytes) {
+		s.remove(s.order.Back())
+		s.evictions++
+	}
+}
+
+// Delete removes the value under key.
+func (s *lruCacheStore) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if elem, ok := s.entries[key]; ok {
+		s.remove(elem)
+	}
+}
+
+// stats fills in the store counters.
+func (s *lruCacheStore) stats(stats *CacheStats) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats.Entries = s.order.Len()
+	stats.Bytes = s.bytes
+	stats.Evictions = s.evictions
+	stats.Expirations = s.expirations
+}
+
+// remove drops elem from the store. Callers must hold s.mu.
+func (s *lruCacheStore) remove(elem *list.Element) {
+	entry := s.order.Remove(elem).(*lruEntry)
+	delete(s.entries, entry.key)
+	s.bytes -= int64(len(entry.value))
+}
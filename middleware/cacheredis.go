@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// defaultRedisTimeout bounds the commands of a RedisCacheStore by default.
+const defaultRedisTimeout = time.Second
+
+// RedisClient is the subset of a Redis client RedisCacheStore needs. The
+// middleware/cacheredis/goredis package implements it with go-redis; other
+// client libraries need a similar adapter of a few lines.
+type RedisClient interface {
+	// Get returns the value stored under key, or nil if there is none.
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Set stores value under key, expiring it after ttl.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Del removes the value under key, if any.
+	Del(ctx context.Context, key string) error
+}
+
+// RedisCacheStore is a CacheStore in Redis, letting the instances of a
+// service share one cache. Failing commands are reported to OnError and
+// behave as cache misses.
+type RedisCacheStore struct {
+	// Client sends the commands.
+	Client RedisClient
+	// Prefix is prepended to the keys, to share a database with others.
+	Prefix string
+	// Timeout bounds each command; zero means one second.
+	Timeout time.Duration
+	// OnError, if set, is called with the errors of failing commands.
+	OnError func(error)
+}
+
+// NewRedisCacheStore creates a store sending its commands through client.
+func NewRedisCacheStore(client RedisClient) *RedisCacheStore {
+	return &RedisCacheStore{Client: client}
+}
+
+// Get returns the value stored under key.
+func (s *RedisCacheStore) Get(key string) ([]byte, bool) {
+	ctx, cancel := s.context()
+	defer cancel()
+	value, err := s.Client.Get(ctx, s.Prefix+key)
+	if err != nil {
+		s.report(fmt.Errorf("failed to get redis cache entry: %w", err))
+		return nil, false
+	}
+	return value, value != nil
+}
+
+// Set stores value under key for ttl.
+func (s *RedisCacheStore) Set(key string, value []byte, ttl time.Duration) {
+	ctx, cancel := s.context()
+	defer cancel()
+	if err := s.Client.Set(ctx, s.Prefix+key, value, ttl); err != nil {
+		s.report(fmt.Errorf("failed to set redis cache entry: %w", err))
+	}
+}
+
+// Delete removes the value under key.
+func (s *RedisCacheStore) Delete(key string) {
+	ctx, cancel := s.context()
+	defer cancel()
+	if err := s.Client.Del(ctx, s.Prefix+key); err != nil {
+		s.report(fmt.Errorf("failed to delete redis cache entry: %w", err))
+	}
+}
+
+// context returns the context of a command, bounded by Timeout.
+func (s *RedisCacheStore) context() (context.Context, context.CancelFunc) {
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = defaultRedisTimeout
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+// report passes err to OnError.
+func (s *RedisCacheStore) report(err error) {
+	if s.OnError != nil {
+		s.OnError(err)
+	}
+}
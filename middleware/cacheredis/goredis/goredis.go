@@ -0,0 +1,47 @@
+// Package goredis backs middleware.RedisCacheStore with go-redis.
+package goredis
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/middleware"
+)
+
+// Client is a middleware.RedisClient sending its commands through go-redis.
+type Client struct {
+	rdb redis.Cmdable
+}
+
+// New creates a client sending its commands through rdb, such as a
+// *redis.Client or a *redis.ClusterClient.
+func New(rdb redis.Cmdable) *Client {
+	return &Client{rdb: rdb}
+}
+
+// NewCacheStore creates a cache store in the Redis rdb talks to.
+func NewCacheStore(rdb redis.Cmdable) *middleware.RedisCacheStore {
+	return middleware.NewRedisCacheStore(New(rdb))
+}
+
+// Get implements middleware.RedisClient.
+func (c *Client) Get(ctx context.Context, key string) ([]byte, error) {
+	value, err := c.rdb.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	return value, err
+}
+
+// Set implements middleware.RedisClient.
+func (c *Client) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return c.rdb.Set(ctx, key, value, ttl).Err()
+}
+
+// Del implements middleware.RedisClient.
+func (c *Client) Del(ctx context.Context, key string) error {
+	return c.rdb.Del(ctx, key).Err()
+}
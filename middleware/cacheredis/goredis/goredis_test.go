@@ -0,0 +1,82 @@
+package goredis_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/middleware/cacheredis/goredis"
+)
+
+// newRedis starts a miniredis server and returns it with a client of it
+// that does not retry failed commands.
+func newRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { rdb.Close() })
+	return mr, rdb
+}
+
+func TestCacheStore(t *testing.T) {
+	mr, rdb := newRedis(t)
+	store := goredis.NewCacheStore(rdb)
+	store.Prefix = "http:"
+
+	if _, ok := store.Get("k"); ok {
+		t.Fatal("Get found a value in an empty store")
+	}
+	store.Set("k", []byte("value"), time.Minute)
+	if got, err := mr.Get("http:k"); err != nil || got != "value" {
+		t.Errorf("stored %q, %v; want %q under the prefix", got, err, "value")
+	}
+	if ttl := mr.TTL("http:k"); ttl != time.Minute {
+		t.Errorf("ttl = %v, want %v", ttl, time.Minute)
+	}
+	if got, ok := store.Get("k"); !ok || string(got) != "value" {
+		t.Errorf("Get = %q, %v", got, ok)
+	}
+
+	mr.FastForward(time.Minute)
+	if _, ok := store.Get("k"); ok {
+		t.Error("Get found an expired value")
+	}
+
+	store.Set("k", []byte("value"), time.Minute)
+	store.Delete("k")
+	if _, ok := store.Get("k"); ok {
+		t.Error("Get found a deleted value")
+	}
+}
+
+func TestCacheStoreErrors(t *testing.T) {
+	mr, rdb := newRedis(t)
+	store := goredis.NewCacheStore(rdb)
+	var errs []error
+	store.OnError = func(err error) { errs = append(errs, err) }
+
+	mr.SetError("READONLY")
+	store.Set("k", []byte("value"), time.Minute)
+	if _, ok := store.Get("k"); ok {
+		t.Error("Get found a value despite the error")
+	}
+	store.Delete("k")
+	if len(errs) != 3 {
+		t.Fatalf("errors = %v, want one per command", errs)
+	}
+	var redisErr redis.Error
+	if !errors.As(errs[0], &redisErr) {
+		t.Errorf("err = %v, want the redis error wrapped", errs[0])
+	}
+}
+
+func TestClientGetMissing(t *testing.T) {
+	_, rdb := newRedis(t)
+	value, err := goredis.New(rdb).Get(t.Context(), "missing")
+	if value != nil || err != nil {
+		t.Errorf("Get = %q, %v; want nil, nil", value, err)
+	}
+}
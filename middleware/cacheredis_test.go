@@ -0,0 +1,98 @@
+package middleware_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/middleware"
+)
+
+// fakeRedis is an in-memory RedisClient that ignores TTLs.
+type fakeRedis struct {
+	mu     sync.Mutex
+	values map[string][]byte
+	ttls   map[string]time.Duration
+	err    error
+}
+
+// newFakeRedis creates an empty fakeRedis.
+func newFakeRedis() *fakeRedis {
+	return &fakeRedis{values: make(map[string][]byte), ttls: make(map[string]time.Duration)}
+}
+
+// Get returns the value under key.
+func (r *fakeRedis) Get(ctx context.Context, key string) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.values[key], r.err
+}
+
+// Set stores value under key, recording ttl.
+func (r *fakeRedis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return r.err
+	}
+	r.values[key], r.ttls[key] = value, ttl
+	return nil
+}
+
+// Del removes the value under key.
+func (r *fakeRedis) Del(ctx context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.values, key)
+	return r.err
+}
+
+func TestRedisCacheStoreSharesEntries(t *testing.T) {
+	redis := newFakeRedis()
+	store := &middleware.RedisCacheStore{Client: redis, Prefix: "http:"}
+	next := newStub(reply{status: 200, header: http.Header{"Cache-Control": {"max-age=60"}}, body: "shared"})
+	clock := newStepClock()
+
+	// Two caches, as in two instances of a service, share the store.
+	for range 2 {
+		c := middleware.CacheMiddleware(middleware.CacheConfig{Store: store, Clock: clock})
+		_, body := send(t, c, next, newRequest(t, http.MethodGet, "http://example.com/a", nil))
+		if body != "shared" {
+			t.Errorf("body = %q, want %q", body, "shared")
+		}
+	}
+	if next.calls() != 1 {
+		t.Errorf("calls = %d, want 1", next.calls())
+	}
+	for key, ttl := range redis.ttls {
+		if !strings.HasPrefix(key, "http:") {
+			t.Errorf("key %q lacks the prefix", key)
+		}
+		if ttl <= 0 {
+			t.Errorf("key %q stored with ttl %v", key, ttl)
+		}
+	}
+}
+
+func TestRedisCacheStoreErrors(t *testing.T) {
+	redis := newFakeRedis()
+	redis.err = errors.New("connection refused")
+	var reported []error
+	store := &middleware.RedisCacheStore{Client: redis, OnError: func(err error) { reported = append(reported, err) }}
+	next := newStub(reply{status: 200, header: http.Header{"Cache-Control": {"max-age=60"}}})
+	c := middleware.CacheMiddleware(middleware.CacheConfig{Store: store, Clock: newStepClock()})
+
+	for range 2 {
+		send(t, c, next, newRequest(t, http.MethodGet, "http://example.com/a", nil))
+	}
+	if next.calls() != 2 {
+		t.Errorf("calls = %d, want 2 as the store is down", next.calls())
+	}
+	if len(reported) == 0 || !errors.Is(reported[0], redis.err) {
+		t.Errorf("reported %v, want the store errors", reported)
+	}
+}
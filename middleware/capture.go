@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/client"
+)
+
+// CapturedRequest is a request recorded by CaptureMiddleware.
+type CapturedRequest struct {
+	// Request is a clone of the request as sent; its Body can be read and
+	// holds a copy of Body.
+	Request *http.Request
+	// Body is the request body, nil if it had none.
+	Body []byte
+	// StatusCode is the status of the response, zero if the request failed
+	// or is still in flight.
+	StatusCode int
+	// Err is the error the request failed with.
+	Err error
+}
+
+// RequestLog is a concurrency-safe log of captured requests, in the order
+// they were sent.
+type RequestLog struct {
+	mu      sync.Mutex
+	entries []*CapturedRequest
+}
+
+// NewRequestLog creates an empty request log.
+func NewRequestLog() *RequestLog {
+	return &RequestLog{}
+}
+
+// CaptureMiddleware records every request into log. Middleware passed first
+// to client.NewCustomClient is the closest to the base client, so pass it
+// first to capture requests after every other middleware changed them.
+func CaptureMiddleware(log *RequestLog) client.Middleware {
+	return func(next client.HTTPClient) client.HTTPClient {
+		return client.HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+			entry := &CapturedRequest{Request: req.Clone(req.Context())}
+			if req.Body != nil && req.Body != http.NoBody {
+				body, err := io.ReadAll(req.Body)
+				req.Body.Close()
+				if err != nil {
+					return nil, fmt.Errorf("failed to capture request body: %w", err)
+				}
+				entry.Body = body
+				entry.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+				// Send a copy of the request, since its body was consumed.
+				req = req.Clone(req.Context())
+				req.Body = io.NopCloser(bytes.NewReader(body))
+				req.GetBody = func() (io.ReadCloser, error) {
+					return io.NopCloser(bytes.NewReader(body)), nil
+				}
+			}
+			log.add(entry)
+
+			resp, err := next.Do(req)
+			log.mu.Lock()
+			if err != nil {
+				entry.Err = err
+			} else {
+				entry.StatusCode = resp.StatusCode
+			}
+			log.mu.Unlock()
+			return resp, err
+		})
+	}
+}
+
+// add appends entry to the log.
+func (l *RequestLog) add(entry *CapturedRequest) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, entry)
+}
+
+// Requests returns the captured requests in the order they were sent.
+func (l *RequestLog) Requests() []CapturedRequest {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	requests := make([]CapturedRequest, len(l.entries))
+	for i, entry := range l.entries {
+		requests[i] = *entry
+	}
+	return requests
+}
+
+// Len returns the number of captured requests.
+func (l *RequestLog) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.entries)
+}
+
+// Last returns the last captured request, if any.
+func (l *RequestLog) Last() (CapturedRequest, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.entries) == 0 {
+		return CapturedRequest{}, false
+	}
+	return *l.entries[len(l.entries)-1], true
+}
+
+// Reset empties the log.
+func (l *RequestLog) Reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = nil
+}
@@ -0,0 +1,77 @@
+package middleware_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/client"
+	"github.com/Vkanhan/go-auth-middleware-http-client/middleware"
+)
+
+func TestCaptureMiddleware(t *testing.T) {
+	errReset := errors.New("connection reset")
+	next := newStub(reply{status: 201}, reply{err: errReset}, reply{status: 200})
+	log := middleware.NewRequestLog()
+	// The capture is passed first, so it sees the key added after it.
+	c := client.NewCustomClient(next, middleware.CaptureMiddleware(log), middleware.APIKeyAuthMiddleware("key"))
+
+	for _, body := range []string{`{"name":"gopher"}`, "retry me", ""} {
+		var r io.Reader
+		if body != "" {
+			r = strings.NewReader(body)
+		}
+		resp, err := c.Do(newRequest(t, http.MethodPost, "http://api.example.com/users", r))
+		if err == nil {
+			resp.Body.Close()
+		}
+	}
+
+	requests := log.Requests()
+	if log.Len() != 3 || len(requests) != 3 {
+		t.Fatalf("captured %d requests, want 3", log.Len())
+	}
+	want := []struct {
+		body   string
+		status int
+		err    error
+	}{
+		{`{"name":"gopher"}`, 201, nil},
+		{"retry me", 0, errReset},
+		{"", 200, nil},
+	}
+	for i, w := range want {
+		got := requests[i]
+		if string(got.Body) != w.body || got.StatusCode != w.status || !errors.Is(got.Err, w.err) {
+			t.Errorf("request %d: body %q, status %d, err %v; want %q, %d, %v", i, got.Body, got.StatusCode, got.Err, w.body, w.status, w.err)
+		}
+		if auth := got.Request.Header.Get("Authorization"); auth != "Bearer key" {
+			t.Errorf("request %d: Authorization = %q, want the key added after the capture", i, auth)
+		}
+	}
+
+	// The captured body and the one sent on are both whole.
+	if body, _ := io.ReadAll(requests[0].Request.Body); string(body) != `{"name":"gopher"}` {
+		t.Errorf("captured request body = %q", body)
+	}
+	replay, err := next.requests[0].GetBody()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := io.ReadAll(replay); string(body) != `{"name":"gopher"}` {
+		t.Errorf("GetBody of the sent request = %q", body)
+	}
+	if requests[2].Body != nil {
+		t.Errorf("body of a request without one = %q, want nil", requests[2].Body)
+	}
+
+	if last, ok := log.Last(); !ok || last.StatusCode != 200 {
+		t.Errorf("Last = %v, %v; want the third request", last, ok)
+	}
+	log.Reset()
+	if _, ok := log.Last(); ok || log.Len() != 0 {
+		t.Errorf("log not empty after Reset")
+	}
+}
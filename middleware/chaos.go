@@ -0,0 +1,156 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrUnknownProfile is returned for network profile names that were never
+// registered.
+var ErrUnknownProfile = errors.New("unknown network profile")
+
+// LatencyDistribution is the shape of injected latency around its base.
+type LatencyDistribution int
+
+const (
+	// DistributionUniform spreads latency evenly within Latency ± Jitter.
+	DistributionUniform LatencyDistribution = iota
+	// DistributionNormal draws latency from a normal distribution with mean
+	// Latency and standard deviation Jitter.
+	DistributionNormal
+	// DistributionExponential adds to Latency an exponentially distributed
+	// delay with mean Jitter, giving a long tail of slow requests.
+	DistributionExponential
+)
+
+// sample draws a latency, never negative, using roll for randomness.
+func (d LatencyDistribution) sample(latency, jitter time.Duration, roll func() float64) time.Duration {
+	if jitter <= 0 {
+		return latency
+	}
+	var offset float64
+	switch d {
+	case DistributionNormal:
+		// Box-Muller transform; 1-roll() keeps the logarithm finite.
+		offset = math.Sqrt(-2*math.Log(1-roll())) * math.Cos(2*math.Pi*roll())
+	case DistributionExponential:
+		offset = -math.Log(1 - roll())
+	default:
+		offset = 2*roll() - 1
+	}
+	return max(latency+time.Duration(offset*float64(jitter)), 0)
+}
+
+// NetworkProfile describes the conditions of a network, such as a mobile
+// link or a flaky datacenter, for soak testing the resilience middleware.
+// Every request gets the profile latency; the rates are the fractions of
+// requests that fail in each way.
+type NetworkProfile struct {
+	// Match selects the requests the profile applies to; nil matches all.
+	Match func(*http.Request) bool
+
+	Latency      time.Duration
+	Jitter       time.Duration
+	Distribution LatencyDistribution
+
+	// ErrorRate is the fraction of requests failing with ErrInjectedFault,
+	// as if the connection broke.
+	ErrorRate float64
+	// ServerErrorRate is the fraction of requests answered with 503
+	// Service Unavailable.
+	ServerErrorRate float64
+	// TruncateRate is the fraction of responses whose body is cut short.
+	TruncateRate float64
+}
+
+// networkProfiles holds the registered profiles by name.
+var networkProfiles = struct {
+	sync.RWMutex
+	m map[string]NetworkProfile
+}{m: map[string]NetworkProfile{
+	// A mobile link: slow, jittery and occasionally dropped.
+	"3g": {
+		Latency:      300 * time.Millisecond,
+		Jitter:       100 * time.Millisecond,
+		Distribution: DistributionNormal,
+		ErrorRate:    0.02,
+	},
+	// A datacenter with a sick dependency: fast, with a long tail, some
+	// resets, overload responses and broken streams.
+	"flaky-dc": {
+		Latency:         2 * time.Millisecond,
+		Jitter:          20 * time.Millisecond,
+		Distribution:    DistributionExponential,
+		ErrorRate:       0.02,
+		ServerErrorRate: 0.05,
+		TruncateRate:    0.01,
+	},
+	// A network partition: requests hang until their deadline, then fail.
+	"partition": {
+		Latency:   time.Minute,
+		ErrorRate: 1,
+	},
+}}
+
+// RegisterNetworkProfile registers p under name, replacing any profile of
+// that name, including the built-in "3g", "flaky-dc" and "partition".
+func RegisterNetworkProfile(name string, p NetworkProfile) {
+	networkProfiles.Lock()
+	defer networkProfiles.Unlock()
+	networkProfiles.m[name] = p
+}
+
+// NetworkProfileFaults returns the faults of the profile registered under
+// name, to use in FaultConfig.Faults.
+func NetworkProfileFaults(name string) ([]Fault, error) {
+	networkProfiles.RLock()
+	p, ok := networkProfiles.m[name]
+	networkProfiles.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownProfile, name)
+	}
+	return p.Faults(), nil
+}
+
+// Faults returns faults reproducing the profile. Faults are tried in order,
+// so the probability of each is conditioned on the previous ones missing.
+func (p NetworkProfile) Faults() []Fault {
+	base := Fault{
+		Match:        p.Match,
+		Latency:      p.Latency,
+		Jitter:       p.Jitter,
+		Distribution: p.Distribution,
+	}
+
+	var faults []Fault
+	remaining := 1.0
+	add := func(rate float64, fault Fault) {
+		if rate <= 0 || remaining <= 0 {
+			return
+		}
+		fault.Probability = min(rate/remaining, 1)
+		remaining -= rate
+		faults = append(faults, fault)
+	}
+
+	errFault := base
+	errFault.Err = ErrInjectedFault
+	add(p.ErrorRate, errFault)
+
+	statusFault := base
+	statusFault.StatusCode = http.StatusServiceUnavailable
+	add(p.ServerErrorRate, statusFault)
+
+	truncateFault := base
+	truncateFault.TruncateAfter = 1
+	add(p.TruncateRate, truncateFault)
+
+	if p.Latency > 0 || p.Jitter > 0 {
+		add(remaining, base)
+	}
+	return faults
+}
@@ -0,0 +1,142 @@
+package middleware_test
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/middleware"
+)
+
+// describeFaults summarizes faults as their kind and probability.
+func describeFaults(faults []middleware.Fault) string {
+	var parts []string
+	for _, f := range faults {
+		kind := "latency"
+		switch {
+		case f.Err != nil:
+			kind = "error"
+		case f.StatusCode != 0:
+			kind = fmt.Sprint(f.StatusCode)
+		case f.TruncateAfter > 0:
+			kind = "truncate"
+		}
+		parts = append(parts, fmt.Sprintf("%s:%.4f", kind, f.Probability))
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestNetworkProfileFaults(t *testing.T) {
+	middleware.RegisterNetworkProfile("test-overload", middleware.NetworkProfile{ServerErrorRate: 0.5})
+	tests := []struct {
+		name   string
+		faults string
+	}{
+		{"3g", "error:0.0200 latency:1.0000"},
+		{"flaky-dc", "error:0.0200 503:0.0510 truncate:0.0108 latency:1.0000"},
+		{"partition", "error:1.0000"},
+		{"test-overload", "503:0.5000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			faults, err := middleware.NetworkProfileFaults(tt.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := describeFaults(faults); got != tt.faults {
+				t.Errorf("faults = %s, want %s", got, tt.faults)
+			}
+		})
+	}
+
+	if _, err := middleware.NetworkProfileFaults("dial-up"); !errors.Is(err, middleware.ErrUnknownProfile) {
+		t.Errorf("err = %v, want %v", err, middleware.ErrUnknownProfile)
+	}
+}
+
+func TestNetworkProfileRates(t *testing.T) {
+	faults, err := middleware.NetworkProfileFaults("flaky-dc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := middleware.FaultInjectionMiddleware(middleware.FaultConfig{
+		Faults: faults,
+		Rand:   rand.New(rand.NewPCG(1, 2)).Float64,
+		Clock:  newStepClock(),
+	})
+	next := newStub(reply{status: 200, body: "response"})
+
+	const requests = 20000
+	counts := map[string]int{}
+	for range requests {
+		counts[outcome(m(next).Do(newRequest(t, http.MethodGet, "http://api.example.com/", nil)))]++
+	}
+	rates := map[string]float64{
+		"error: injected fault":   0.02,
+		"503 Service Unavailable": 0.05,
+		"200 r: unexpected EOF":   0.01,
+		"200 response":            0.92,
+	}
+	for outcome, want := range rates {
+		if got := float64(counts[outcome]) / requests; math.Abs(got-want) > 0.01 {
+			t.Errorf("rate of %q = %.3f, want %.2f", outcome, got, want)
+		}
+	}
+}
+
+func TestNetworkProfileMatch(t *testing.T) {
+	faults := middleware.NetworkProfile{
+		Match:     func(req *http.Request) bool { return req.URL.Host == "slow.example.com" },
+		Latency:   time.Second,
+		ErrorRate: 1,
+	}.Faults()
+	m := middleware.FaultInjectionMiddleware(middleware.FaultConfig{Faults: faults, Clock: newStepClock()})
+	next := newStub(reply{status: 200})
+	for host, want := range map[string]string{"slow.example.com": "error: injected fault", "api.example.com": "200 "} {
+		if got := outcome(m(next).Do(newRequest(t, http.MethodGet, "http://"+host+"/", nil))); got != want {
+			t.Errorf("%s: outcome = %q, want %q", host, got, want)
+		}
+	}
+}
+
+func TestLatencyDistribution(t *testing.T) {
+	tests := []struct {
+		name         string
+		distribution middleware.LatencyDistribution
+		latency      time.Duration
+		rolls        []float64 // After the roll of the fault probability.
+		want         time.Duration
+	}{
+		{"uniform low", middleware.DistributionUniform, 100 * time.Millisecond, []float64{0}, 60 * time.Millisecond},
+		{"uniform high", middleware.DistributionUniform, 100 * time.Millisecond, []float64{0.75}, 120 * time.Millisecond},
+		{"never negative", middleware.DistributionUniform, 10 * time.Millisecond, []float64{0}, 0},
+		{"normal mean", middleware.DistributionNormal, 100 * time.Millisecond, []float64{0, 0}, 100 * time.Millisecond},
+		{"normal two deviations", middleware.DistributionNormal, 100 * time.Millisecond, []float64{1 - math.Exp(-2), 0}, 180 * time.Millisecond},
+		{"exponential", middleware.DistributionExponential, 100 * time.Millisecond, []float64{1 - math.Exp(-1)}, 140 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rolls := append([]float64{0}, tt.rolls...)
+			clock := newStepClock()
+			m := middleware.FaultInjectionMiddleware(middleware.FaultConfig{
+				Faults: []middleware.Fault{{Probability: 1, Latency: tt.latency, Jitter: 40 * time.Millisecond, Distribution: tt.distribution}},
+				Rand: func() float64 {
+					roll := rolls[0]
+					rolls = rolls[1:]
+					return roll
+				},
+				Clock: clock,
+			})
+			send(t, m, newStub(reply{status: 200}), newRequest(t, http.MethodGet, "http://api.example.com/", nil))
+			slept := clock.Slept()
+			if len(slept) != 1 || (slept[0]-tt.want).Abs() > time.Microsecond {
+				t.Errorf("slept = %v, want [%v]", slept, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,333 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/client"
+	"github.com/Vkanhan/go-auth-middleware-http-client/internal/httpx"
+)
+
+// Defaults of CircuitBreakerConfig.
+const (
+	DefaultCircuitConsecutiveFailures = 5
+	DefaultCircuitMinRequests         = 20
+	DefaultCircuitWindow              = time.Minute
+	DefaultCircuitCooldown            = 30 * time.Second
+)
+
+// circuitBuckets is the number of slices the failure rate window is kept
+// in, so it rolls forward a slice at a time.
+const circuitBuckets = 10
+
+// maxCircuitHosts bounds the per-host breakers kept. Once it is reached,
+// idle breakers are dropped, or the least recently used one if none is.
+const maxCircuitHosts = 1024
+
+// ErrCircuitOpen is returned for requests the circuit breaker rejects
+// without sending them.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitState is the state of a circuit breaker.
+type CircuitState int
+
+// The states of a circuit breaker. Closed lets requests through, open
+// rejects them, and half-open lets a few probes through to decide which of
+// the two comes next.
+const (
+	CircuitClosed CircuitState = iota
+	CircuitOpen
+	CircuitHalfOpen
+)
+
+// String returns the name of the state.
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("CircuitState(%d)", int(s))
+}
+
+// CircuitBreakerConfig configures CircuitBreakerMiddleware.
+type CircuitBreakerConfig struct {
+	// ConsecutiveFailures opens the circuit after that many failures in a
+	// row; zero means DefaultCircuitConsecutiveFailures and a negative
+	// value turns the check off.
+	ConsecutiveFailures int
+	// FailureRate opens the circuit once the fraction of requests failing
+	// within Window reaches it, counting only windows of at least
+	// MinRequests requests; zero turns the check off.
+	FailureRate float64
+	// MinRequests defaults to DefaultCircuitMinRequests.
+	MinRequests int
+	// Window defaults to DefaultCircuitWindow.
+	Window time.Duration
+	// Cooldown is how long the circuit stays open before probing; zero
+	// means DefaultCircuitCooldown.
+	Cooldown time.Duration
+	// HalfOpenProbes is how many requests are let through while half-open,
+	// all of which must succeed to close the circuit; zero means one.
+	HalfOpenProbes int
+	// PerHost gives every host its own breaker instead of sharing one.
+	PerHost bool
+	// IsFailure classifies outcomes; nil counts errors and 429 and 5xx
+	// responses. Requests whose context was cancelled are never counted.
+	IsFailure func(resp *http.Response, err error) bool
+	// OnStateChange, if set, is called on every transition with the host of
+	// the breaker, or "" when shared. It is called with the breaker locked,
+	// so calls come in the order of the transitions, and it must not send
+	// requests through the breaker.
+	OnStateChange func(host string, from, to CircuitState)
+	// Clock times the cooldown and window; nil uses client.SystemClock.
+	Clock client.Clock
+}
+
+// CircuitBreakerMiddleware stops sending requests to an upstream that keeps
+// failing. Once the failures pass a threshold the circuit opens and
+// requests fail fast with an error wrapping ErrCircuitOpen; after the
+// cooldown a few probes are let through, closing the circuit when they
+// succeed and opening it again when one fails.
+func CircuitBreakerMiddleware(cfg CircuitBreakerConfig) client.Middleware {
+	if cfg.ConsecutiveFailures == 0 {
+		cfg.ConsecutiveFailures = DefaultCircuitConsecutiveFailures
+	}
+	if cfg.MinRequests <= 0 {
+		cfg.MinRequests = DefaultCircuitMinRequests
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = DefaultCircuitWindow
+	}
+	if cfg.Cooldown <= 0 {
+		cfg.Cooldown = DefaultCircuitCooldown
+	}
+	if cfg.HalfOpenProbes <= 0 {
+		cfg.HalfOpenProbes = 1
+	}
+	if cfg.IsFailure == nil {
+		cfg.IsFailure = defaultCircuitFailure
+	}
+	clock := clockOrSystem(cfg.Clock)
+	shared := &circuitBreaker{cfg: &cfg, clock: clock}
+
+	var mu sync.Mutex
+	var uses uint64
+	hosts := make(map[string]*circuitBreaker)
+	breakerFor := func(host string) *circuitBreaker {
+		mu.Lock()
+		defer mu.Unlock()
+		b, ok := hosts[host]
+		if !ok {
+			if len(hosts) >= maxCircuitHosts {
+				var oldest string
+				for h, other := range hosts {
+					if other.idle() {
+						delete(hosts, h)
+					} else if oldest == "" || other.used < hosts[oldest].used {
+						oldest = h
+					}
+				}
+				if len(hosts) >= maxCircuitHosts {
+					delete(hosts, oldest)
+				}
+			}
+			b = &circuitBreaker{cfg: &cfg, clock: clock, host: host}
+			hosts[host] = b
+		}
+		uses++
+		b.used = uses
+		return b
+	}
+
+	return func(next client.HTTPClient) client.HTTPClient {
+		return client.HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+			b := shared
+			if cfg.PerHost {
+				b = breakerFor(req.URL.Host)
+			}
+			generation, ok := b.allow()
+			if !ok {
+				httpx.CloseBody(req)
+				return nil, fmt.Errorf("request to %s failed: %w", req.URL.Host, ErrCircuitOpen)
+			}
+
+			resp, err := next.Do(req)
+			switch {
+			case errors.Is(err, context.Canceled):
+				b.release(generation)
+			case cfg.IsFailure(resp, err):
+				b.record(generation, true)
+			default:
+				b.record(generation, false)
+			}
+			return resp, err
+		})
+	}
+}
+
+// defaultCircuitFailure counts errors and 429 and 5xx responses as
+// failures.
+func defaultCircuitFailure(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+// circuitBreaker is the state machine of one circuit.
+type circuitBreaker struct {
+	cfg   *CircuitBreakerConfig
+	clock client.Clock
+	host  string
+	// used orders the per-host breakers by last use, under the lock of
+	// their map.
+	used uint64
+
+	mu       sync.Mutex
+	state    CircuitState
+	openedAt time.Time
+	// generation changes on every transition, so outcomes of requests let
+	// through in an earlier state are ignored.
+	generation  uint64
+	consecutive int
+	buckets     [circuitBuckets]circuitBucket
+	probes      int
+	successes   int
+}
+
+// circuitBucket counts the outcomes within one slice of the window.
+type circuitBucket struct {
+	start    time.Time
+	total    int
+	failures int
+}
+
+// allow reports whether a request may be sent, and the generation its
+// outcome must be recorded against.
+func (b *circuitBreaker) allow() (uint64, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == CircuitOpen && b.clock.Now().Sub(b.openedAt) >= b.cfg.Cooldown {
+		b.transition(CircuitHalfOpen)
+	}
+	allowed := true
+	switch b.state {
+	case CircuitOpen:
+		allowed = false
+	case CircuitHalfOpen:
+		if b.probes >= b.cfg.HalfOpenProbes {
+			allowed = false
+		} else {
+			b.probes++
+		}
+	}
+	return b.generation, allowed
+}
+
+// record counts the outcome of a request let through in generation.
+func (b *circuitBreaker) record(generation uint64, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if generation != b.generation {
+		return
+	}
+	switch b.state {
+	case CircuitClosed:
+		bucket := b.bucket()
+		bucket.total++
+		if failed {
+			bucket.failures++
+			b.consecutive++
+		} else {
+			b.consecutive = 0
+		}
+		if failed && b.tripped() {
+			b.transition(CircuitOpen)
+		}
+	case CircuitHalfOpen:
+		if failed {
+			b.transition(CircuitOpen)
+		} else if b.successes++; b.successes >= b.cfg.HalfOpenProbes {
+			b.transition(CircuitClosed)
+		}
+	}
+}
+
+// release gives back the probe slot of a request whose outcome does not
+// count.
+func (b *circuitBreaker) release(generation uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if generation == b.generation && b.state == CircuitHalfOpen {
+		b.probes--
+	}
+}
+
+// tripped reports whether the failures pass a threshold. The caller holds
+// mu.
+func (b *circuitBreaker) tripped() bool {
+	if b.cfg.ConsecutiveFailures > 0 && b.consecutive >= b.cfg.ConsecutiveFailures {
+		return true
+	}
+	if b.cfg.FailureRate <= 0 {
+		return false
+	}
+	var total, failures int
+	since := b.clock.Now().Add(-b.cfg.Window)
+	for _, bucket := range b.buckets {
+		if bucket.start.After(since) {
+			total += bucket.total
+			failures += bucket.failures
+		}
+	}
+	return total >= b.cfg.MinRequests && float64(failures)/float64(total) >= b.cfg.FailureRate
+}
+
+// bucket returns the bucket of the current slice of the window, clearing
+// it if it last held an older slice. The caller holds mu.
+func (b *circuitBreaker) bucket() *circuitBucket {
+	width := max(b.cfg.Window/circuitBuckets, time.Nanosecond)
+	start := b.clock.Now().Truncate(width)
+	// The modulo is kept non-negative for clocks set before 1970.
+	i := start.UnixNano() / int64(width) % circuitBuckets
+	bucket := &b.buckets[(i+circuitBuckets)%circuitBuckets]
+	if !bucket.start.Equal(start) {
+		*bucket = circuitBucket{start: start}
+	}
+	return bucket
+}
+
+// transition moves the breaker to state, resets the counts of the old one
+// and reports the change. The caller holds mu.
+func (b *circuitBreaker) transition(state CircuitState) {
+	from := b.state
+	b.state = state
+	b.generation++
+	b.probes, b.successes = 0, 0
+	switch state {
+	case CircuitOpen:
+		b.openedAt = b.clock.Now()
+	case CircuitClosed:
+		b.consecutive = 0
+		b.buckets = [circuitBuckets]circuitBucket{}
+	}
+	if b.cfg.OnStateChange != nil {
+		b.cfg.OnStateChange(b.host, from, state)
+	}
+}
+
+// idle reports whether the breaker is closed and its last request
+// succeeded, so dropping it loses little.
+func (b *circuitBreaker) idle() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state == CircuitClosed && b.consecutive == 0
+}
@@ -0,0 +1,379 @@
+package middleware_test
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/client"
+	"github.com/Vkanhan/go-auth-middleware-http-client/middleware"
+)
+
+// circuitStep is a request of a TestCircuitBreakerMiddleware case.
+type circuitStep struct {
+	advance  time.Duration
+	host     string
+	status   int  // Answer of the upstream; zero fails with an error.
+	rejected bool // Whether the breaker should reject the request.
+}
+
+// Outcomes of circuit steps.
+var (
+	okStep   = circuitStep{status: 200}
+	failStep = circuitStep{status: 500}
+)
+
+// after returns s sent once the clock moved by d.
+func (s circuitStep) after(d time.Duration) circuitStep {
+	s.advance = d
+	return s
+}
+
+// to returns s sent to host.
+func (s circuitStep) to(host string) circuitStep {
+	s.host = host
+	return s
+}
+
+// reject returns s expected to be rejected.
+func (s circuitStep) reject() circuitStep {
+	s.rejected = true
+	return s
+}
+
+func TestCircuitBreakerMiddleware(t *testing.T) {
+	rate := middleware.CircuitBreakerConfig{ConsecutiveFailures: -1, FailureRate: 0.5, MinRequests: 4, Window: 10 * time.Second}
+	tests := []struct {
+		name        string
+		cfg         middleware.CircuitBreakerConfig
+		start       time.Time
+		steps       []circuitStep
+		transitions string
+	}{
+		{
+			name:        "consecutive failures",
+			cfg:         middleware.CircuitBreakerConfig{ConsecutiveFailures: 3},
+			steps:       []circuitStep{failStep, failStep, okStep, failStep, failStep, failStep, okStep.reject()},
+			transitions: "[:closed>open]",
+		},
+		{
+			name:        "errors and 429 fail",
+			cfg:         middleware.CircuitBreakerConfig{ConsecutiveFailures: 2},
+			steps:       []circuitStep{{status: 0}, {status: 429}, okStep.reject()},
+			transitions: "[:closed>open]",
+		},
+		{
+			name:        "client errors succeed",
+			cfg:         middleware.CircuitBreakerConfig{ConsecutiveFailures: 1},
+			steps:       []circuitStep{{status: 404}, {status: 400}, okStep},
+			transitions: "[]",
+		},
+		{
+			name: "custom failures",
+			cfg: middleware.CircuitBreakerConfig{ConsecutiveFailures: 1, IsFailure: func(resp *http.Response, err error) bool {
+				return err == nil && resp.StatusCode == 404
+			}},
+			steps:       []circuitStep{{status: 0}, failStep, {status: 404}, okStep.reject()},
+			transitions: "[:closed>open]",
+		},
+		{
+			name:        "probe closes",
+			cfg:         middleware.CircuitBreakerConfig{ConsecutiveFailures: 1, Cooldown: 30 * time.Second},
+			steps:       []circuitStep{failStep, okStep.after(29 * time.Second).reject(), okStep.after(time.Second), failStep},
+			transitions: "[:closed>open :open>half-open :half-open>closed :closed>open]",
+		},
+		{
+			name:        "probe reopens",
+			cfg:         middleware.CircuitBreakerConfig{ConsecutiveFailures: 1, Cooldown: 30 * time.Second},
+			steps:       []circuitStep{failStep, failStep.after(30 * time.Second), okStep.after(29 * time.Second).reject(), okStep.after(time.Second)},
+			transitions: "[:closed>open :open>half-open :half-open>open :open>half-open :half-open>closed]",
+		},
+		{
+			name:        "all probes must succeed",
+			cfg:         middleware.CircuitBreakerConfig{ConsecutiveFailures: 1, Cooldown: time.Second, HalfOpenProbes: 2},
+			steps:       []circuitStep{failStep, okStep.after(time.Second), failStep, okStep.reject()},
+			transitions: "[:closed>open :open>half-open :half-open>open]",
+		},
+		{
+			name:        "closing resets the counts",
+			cfg:         middleware.CircuitBreakerConfig{ConsecutiveFailures: 2, Cooldown: time.Second},
+			steps:       []circuitStep{failStep, failStep, okStep.after(time.Second), failStep, okStep},
+			transitions: "[:closed>open :open>half-open :half-open>closed]",
+		},
+		{
+			name:        "failure rate",
+			cfg:         rate,
+			steps:       []circuitStep{okStep, okStep, failStep, failStep, okStep.reject()},
+			transitions: "[:closed>open]",
+		},
+		{
+			name:        "failure rate needs min requests",
+			cfg:         rate,
+			steps:       []circuitStep{failStep, failStep, failStep, okStep},
+			transitions: "[]",
+		},
+		{
+			name:        "failure rate window rolls",
+			cfg:         rate,
+			steps:       []circuitStep{failStep, failStep, failStep, okStep.after(10 * time.Second), failStep, okStep, failStep, okStep.reject()},
+			transitions: "[:closed>open]",
+		},
+		{
+			name:        "clock before 1970",
+			cfg:         rate,
+			start:       time.Date(1960, 1, 1, 0, 0, 0, 0, time.UTC),
+			steps:       []circuitStep{okStep, failStep, okStep.after(time.Second), failStep.after(time.Second), okStep.reject()},
+			transitions: "[:closed>open]",
+		},
+		{
+			name: "window shorter than the buckets",
+			cfg: middleware.CircuitBreakerConfig{
+				ConsecutiveFailures: -1, FailureRate: 0.5, MinRequests: 2, Window: 5 * time.Nanosecond,
+			},
+			steps:       []circuitStep{failStep, failStep, okStep.reject()},
+			transitions: "[:closed>open]",
+		},
+		{
+			name:        "shared",
+			cfg:         middleware.CircuitBreakerConfig{ConsecutiveFailures: 1},
+			steps:       []circuitStep{failStep.to("a.example.com"), okStep.to("b.example.com").reject()},
+			transitions: "[:closed>open]",
+		},
+		{
+			name:        "per host",
+			cfg:         middleware.CircuitBreakerConfig{ConsecutiveFailures: 1, PerHost: true},
+			steps:       []circuitStep{failStep.to("a.example.com"), okStep.to("b.example.com"), okStep.to("a.example.com").reject()},
+			transitions: "[a.example.com:closed>open]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := tt.start
+			if start.IsZero() {
+				start = epoch
+			}
+			clock := client.NewFakeClock(start)
+			cfg := tt.cfg
+			cfg.Clock = clock
+			var transitions []string
+			cfg.OnStateChange = func(host string, from, to middleware.CircuitState) {
+				transitions = append(transitions, fmt.Sprintf("%s:%s>%s", host, from, to))
+			}
+
+			var status int
+			calls := 0
+			next := client.HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+				calls++
+				if status == 0 {
+					return nil, errors.New("connection reset")
+				}
+				return &http.Response{StatusCode: status, Body: http.NoBody, Request: req}, nil
+			})
+			c := middleware.CircuitBreakerMiddleware(cfg)(next)
+
+			for i, step := range tt.steps {
+				clock.Advance(step.advance)
+				status = step.status
+				before := calls
+				resp, err := c.Do(newRequest(t, http.MethodGet, "http://"+cmp.Or(step.host, "example.com")+"/", nil))
+				if resp != nil {
+					resp.Body.Close()
+				}
+				if rejected := errors.Is(err, middleware.ErrCircuitOpen); rejected != step.rejected {
+					t.Fatalf("step %d: err = %v, want rejected %v", i, err, step.rejected)
+				}
+				if sent := calls > before; sent == step.rejected {
+					t.Errorf("step %d: sent = %v", i, sent)
+				}
+			}
+			if got := fmt.Sprint(transitions); got != tt.transitions {
+				t.Errorf("transitions = %s, want %s", got, tt.transitions)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerMiddlewareProbes(t *testing.T) {
+	clock := client.NewFakeClock(epoch)
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	status := 500
+	next := client.HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Header.Get("X-Block") != "" {
+			entered <- struct{}{}
+			<-release
+		}
+		return &http.Response{StatusCode: status, Body: http.NoBody, Request: req}, nil
+	})
+	c := middleware.CircuitBreakerMiddleware(middleware.CircuitBreakerConfig{
+		ConsecutiveFailures: 1,
+		Cooldown:            time.Second,
+		HalfOpenProbes:      2,
+		Clock:               clock,
+	})(next)
+	get := func(block bool) error {
+		req := newRequest(t, http.MethodGet, "http://example.com/", nil)
+		if block {
+			req.Header.Set("X-Block", "1")
+		}
+		resp, err := c.Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	get(false)
+	clock.Advance(time.Second)
+	status = 200
+
+	// Two probes are let through while half-open, and no more until they
+	// finish.
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := get(true); err != nil {
+				t.Errorf("probe: %v", err)
+			}
+		}()
+		<-entered
+	}
+	if err := get(false); !errors.Is(err, middleware.ErrCircuitOpen) {
+		t.Errorf("third request while half-open: err = %v, want it rejected", err)
+	}
+	close(release)
+	wg.Wait()
+	if err := get(false); err != nil {
+		t.Errorf("after the probes succeeded: %v", err)
+	}
+}
+
+func TestCircuitBreakerMiddlewareIgnoresCanceled(t *testing.T) {
+	next := client.HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, req.Context().Err()
+	})
+	c := middleware.CircuitBreakerMiddleware(middleware.CircuitBreakerConfig{
+		ConsecutiveFailures: 1,
+		Clock:               client.NewFakeClock(epoch),
+	})(next)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for range 3 {
+		_, err := c.Do(newRequest(t, http.MethodGet, "http://example.com/", nil).WithContext(ctx))
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("err = %v, want context.Canceled", err)
+		}
+	}
+}
+
+func TestCircuitBreakerMiddlewareClosesRejectedBody(t *testing.T) {
+	next := newStub(reply{status: 500})
+	m := middleware.CircuitBreakerMiddleware(middleware.CircuitBreakerConfig{ConsecutiveFailures: 1, Clock: client.NewFakeClock(epoch)})
+	send(t, m, next, newRequest(t, http.MethodGet, "http://example.com/", nil))
+
+	body := &closeRecorder{Reader: strings.NewReader("data")}
+	_, err := m(next).Do(newRequest(t, http.MethodPost, "http://example.com/", body))
+	if !errors.Is(err, middleware.ErrCircuitOpen) || !body.closed {
+		t.Errorf("err = %v, body closed = %v; want rejected with the body closed", err, body.closed)
+	}
+}
+
+// closeRecorder is a request body recording whether it was closed.
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+// Close records the call.
+func (r *closeRecorder) Close() error {
+	r.closed = true
+	return nil
+}
+
+func TestCircuitBreakerMiddlewareEvictsOldest(t *testing.T) {
+	next := newStub(reply{status: 500})
+	c := middleware.CircuitBreakerMiddleware(middleware.CircuitBreakerConfig{
+		ConsecutiveFailures: 1,
+		PerHost:             true,
+		Clock:               client.NewFakeClock(epoch),
+	})(next)
+	get := func(host string) error {
+		resp, err := c.Do(newRequest(t, http.MethodGet, "http://"+host+"/", nil))
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	// Every breaker is open, so none is idle, and a was used after b.
+	get("a.example.com")
+	get("b.example.com")
+	get("a.example.com")
+	for i := range 1022 {
+		get(fmt.Sprintf("h%d.example.com", i))
+	}
+	get("c.example.com")
+
+	if err := get("a.example.com"); !errors.Is(err, middleware.ErrCircuitOpen) {
+		t.Errorf("a.example.com: err = %v, want its open breaker kept", err)
+	}
+	if err := get("b.example.com"); errors.Is(err, middleware.ErrCircuitOpen) {
+		t.Errorf("b.example.com: err = %v, want its breaker evicted", err)
+	}
+}
+
+func TestCircuitBreakerMiddlewareTransitionOrder(t *testing.T) {
+	// transitions is not locked: the breaker must make its calls one at a
+	// time, which the race detector checks.
+	var transitions []middleware.CircuitState
+	c := middleware.CircuitBreakerMiddleware(middleware.CircuitBreakerConfig{
+		ConsecutiveFailures: 1,
+		Cooldown:            time.Nanosecond,
+		OnStateChange: func(host string, from, to middleware.CircuitState) {
+			if last := middleware.CircuitClosed; len(transitions) > 0 {
+				last = transitions[len(transitions)-1]
+				if from != last {
+					t.Errorf("transition %d from %s, want from %s", len(transitions), from, last)
+				}
+			}
+			transitions = append(transitions, to)
+		},
+	})(client.HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+		status := 200
+		if req.URL.Query().Get("fail") != "" {
+			status = 500
+		}
+		return &http.Response{StatusCode: status, Body: http.NoBody, Request: req}, nil
+	}))
+
+	var wg sync.WaitGroup
+	for g := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 200 {
+				url := "http://example.com/"
+				if (g+i)%2 == 0 {
+					url += "?fail=1"
+				}
+				if resp, err := c.Do(newRequest(t, http.MethodGet, url, nil)); err == nil {
+					resp.Body.Close()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if len(transitions) == 0 {
+		t.Error("breaker never changed state")
+	}
+}
@@ -0,0 +1,11 @@
+package middleware
+
+import "github.com/Vkanhan/go-auth-middleware-http-client/client"
+
+// clockOrSystem returns c, or client.SystemClock if c is nil.
+func clockOrSystem(c client.Clock) client.Clock {
+	if c == nil {
+		return client.SystemClock
+	}
+	return c
+}
@@ -0,0 +1,605 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/client"
+)
+
+// ErrContractViolation is matched by the errors reporting requests or
+// responses that do not follow the contract.
+var ErrContractViolation = errors.New("contract violation")
+
+// ContractViolation describes how a request or its response broke the
+// contract.
+type ContractViolation struct {
+	Method string
+	URL    string
+	Reason string
+}
+
+// Error implements the error interface.
+func (v *ContractViolation) Error() string {
+	return fmt.Sprintf("contract violation: %s %s: %s", v.Method, v.URL, v.Reason)
+}
+
+// Is makes the violation match ErrContractViolation.
+func (v *ContractViolation) Is(target error) bool {
+	return target == ErrContractViolation
+}
+
+// Contract is a parsed OpenAPI 3 document in JSON form. It checks paths,
+// operations, parameters, request bodies, status codes and JSON bodies
+// against their schemas, resolving local $ref pointers. Schema formats and
+// non-JSON bodies are not checked.
+type Contract struct {
+	doc      map[string]any
+	basePath string
+	routes   []contractRoute
+}
+
+// contractRoute is a path of the document.
+type contractRoute struct {
+	template string
+	segments []string
+	item     map[string]any
+}
+
+// LoadContract reads an OpenAPI 3 JSON document from path. YAML documents
+// are not supported.
+func LoadContract(path string) (*Contract, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read contract: %w", err)
+	}
+	return ParseContract(data)
+}
+
+// ParseContract parses an OpenAPI 3 JSON document. YAML documents are not
+// supported and fail to decode.
+func ParseContract(data []byte) (*Contract, error) {
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to decode contract: %w", err)
+	}
+	if version, _ := doc["openapi"].(string); !strings.HasPrefix(version, "3.") {
+		return nil, fmt.Errorf("unsupported contract version %q", version)
+	}
+
+	c := &Contract{doc: doc}
+	if servers, _ := doc["servers"].([]any); len(servers) > 0 {
+		if server, ok := c.resolve(servers[0]).(map[string]any); ok {
+			if rawURL, ok := server["url"].(string); ok {
+				if u, err := url.Parse(rawURL); err == nil {
+					c.basePath = strings.TrimSuffix(u.Path, "/")
+				}
+			}
+		}
+	}
+	paths, _ := doc["paths"].(map[string]any)
+	for template, item := range paths {
+		item, ok := c.resolve(item).(map[string]any)
+		if !ok {
+			continue
+		}
+		c.routes = append(c.routes, contractRoute{
+			template: template,
+			segments: strings.Split(strings.Trim(template, "/"), "/"),
+			item:     item,
+		})
+	}
+	return c, nil
+}
+
+// ContractMiddleware checks every request and response against contract,
+// for tests that must catch drift between the client and the provider.
+// Violations are passed to report, typically a test's Error method; with a
+// nil report they are returned as errors instead.
+func ContractMiddleware(contract *Contract, report func(error)) client.Middleware {
+	return func(next client.HTTPClient) client.HTTPClient {
+		return client.HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+			fail := func(reason string) error {
+				v := &ContractViolation{Method: req.Method, URL: req.URL.String(), Reason: reason}
+				if report == nil {
+					return v
+				}
+				report(v)
+				return nil
+			}
+
+			op, params, reason := contract.operation(req)
+			if reason != "" {
+				if err := fail(reason); err != nil {
+					return nil, err
+				}
+				return next.Do(req)
+			}
+
+			if reason, err := contract.checkRequest(req, op, params); err != nil {
+				return nil, err
+			} else if reason != "" {
+				if err := fail(reason); err != nil {
+					return nil, err
+				}
+			}
+
+			resp, err := next.Do(req)
+			if err != nil {
+				return nil, err
+			}
+			if reason, err := contract.checkResponse(resp, op); err != nil {
+				resp.Body.Close()
+				return nil, err
+			} else if reason != "" {
+				if err := fail(reason); err != nil {
+					resp.Body.Close()
+					return nil, err
+				}
+			}
+			return resp, nil
+		})
+	}
+}
+
+// operation finds the operation of req, along with its path parameters, or
+// explains why there is none.
+func (c *Contract) operation(req *http.Request) (map[string]any, map[string]string, string) {
+	path, ok := strings.CutPrefix(req.URL.Path, c.basePath)
+	if !ok {
+		return nil, nil, fmt.Sprintf("path is outside of base path %s", c.basePath)
+	}
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+
+	// Prefer the template with the most literal segments, so /users/me wins
+	// over /users/{id}.
+	var best *contractRoute
+	var bestParams map[string]string
+	bestLiterals := -1
+	for i := range c.routes {
+		route := &c.routes[i]
+		params, literals, ok := route.match(segments)
+		if ok && literals > bestLiterals {
+			best, bestParams, bestLiterals = route, params, literals
+		}
+	}
+	if best == nil {
+		return nil, nil, "path is not in the contract"
+	}
+
+	op, ok := c.resolve(best.item[strings.ToLower(req.Method)]).(map[string]any)
+	if !ok {
+		return nil, nil, fmt.Sprintf("method is not allowed on %s", best.template)
+	}
+	// Merge the path-level parameters, which operations may override.
+	shared, _ := best.item["parameters"].([]any)
+	own, _ := op["parameters"].([]any)
+	merged := make(map[string]any, len(op))
+	for k, v := range op {
+		merged[k] = v
+	}
+	merged["parameters"] = append(append([]any(nil), shared...), own...)
+	return merged, bestParams, ""
+}
+
+// match matches the route against path segments, returning the path
+// parameters and the number of literal segments.
+func (r *contractRoute) match(segments []string) (map[string]string, int, bool) {
+	if len(segments) != len(r.segments) {
+		return nil, 0, false
+	}
+	params := make(map[string]string)
+	literals := 0
+	for i, segment := range r.segments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			if segments[i] == "" {
+				return nil, 0, false
+			}
+			params[segment[1:len(segment)-1]] = segments[i]
+			continue
+		}
+		if segment != segments[i] {
+			return nil, 0, false
+		}
+		literals++
+	}
+	return params, literals, true
+}
+
+// checkRequest checks the parameters and body of req against op.
+func (c *Contract) checkRequest(req *http.Request, op map[string]any, pathParams map[string]string) (string, error) {
+	seen := make(map[string]bool)
+	params, _ := op["parameters"].([]any)
+	// Operation parameters come last and override path-level ones.
+	for i := len(params) - 1; i >= 0; i-- {
+		param, ok := c.resolve(params[i]).(map[string]any)
+		if !ok {
+			continue
+		}
+		name, _ := param["name"].(string)
+		in, _ := param["in"].(string)
+		if seen[in+":"+name] {
+			continue
+		}
+		seen[in+":"+name] = true
+
+		var values []string
+		switch in {
+		case "path":
+			if v, ok := pathParams[name]; ok {
+				values = []string{v}
+			}
+		case "query":
+			values = req.URL.Query()[name]
+		case "header":
+			values = req.Header.Values(name)
+		case "cookie":
+			if cookie, err := req.Cookie(name); err == nil {
+				values = []string{cookie.Value}
+			}
+		}
+
+		if len(values) == 0 {
+			if required, _ := param["required"].(bool); required || in == "path" {
+				return fmt.Sprintf("missing required %s parameter %q", in, name), nil
+			}
+			continue
+		}
+		if reason := c.checkParam(c.resolve(param["schema"]), values); reason != "" {
+			return fmt.Sprintf("%s parameter %q: %s", in, name, reason), nil
+		}
+	}
+
+	body, _ := c.resolve(op["requestBody"]).(map[string]any)
+	hasBody := req.Body != nil && req.Body != http.NoBody
+	if body == nil {
+		return "", nil
+	}
+	if !hasBody {
+		if required, _ := body["required"].(bool); required {
+			return "missing required request body", nil
+		}
+		return "", nil
+	}
+
+	data, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return "", fmt.Errorf("failed to read request body: %w", err)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	if reason := c.checkContent(body, req.Header.Get("Content-Type"), data); reason != "" {
+		return "request body: " + reason, nil
+	}
+	return "", nil
+}
+
+// checkResponse checks the status and body of resp against op.
+func (c *Contract) checkResponse(resp *http.Response, op map[string]any) (string, error) {
+	responses, _ := op["responses"].(map[string]any)
+	code := strconv.Itoa(resp.StatusCode)
+	spec, ok := responses[code]
+	if !ok {
+		spec, ok = responses[code[:1]+"XX"]
+	}
+	if !ok {
+		spec, ok = responses["default"]
+	}
+	if !ok {
+		return fmt.Sprintf("status %d is not in the contract", resp.StatusCode), nil
+	}
+	response, _ := c.resolve(spec).(map[string]any)
+	if _, ok := response["content"]; !ok {
+		return "", nil
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return "", fmt.Errorf("failed to read response body: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	if len(data) == 0 && resp.Request != nil && resp.Request.Method == http.MethodHead {
+		return "", nil
+	}
+	if reason := c.checkContent(response, resp.Header.Get("Content-Type"), data); reason != "" {
+		return fmt.Sprintf("response %d: %s", resp.StatusCode, reason), nil
+	}
+	return "", nil
+}
+
+// checkContent checks a body with contentType against the content map of a
+// request body or response.
+func (c *Contract) checkContent(spec map[string]any, contentType string, data []byte) string {
+	content, _ := spec["content"].(map[string]any)
+	if len(content) == 0 {
+		return ""
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Sprintf("invalid content type %q", contentType)
+	}
+
+	media, ok := content[mediaType]
+	if !ok {
+		major, _, _ := strings.Cut(mediaType, "/")
+		if media, ok = content[major+"/*"]; !ok {
+			media, ok = content["*/*"]
+		}
+	}
+	if !ok {
+		return fmt.Sprintf("content type %s is not in the contract", mediaType)
+	}
+	if mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json") {
+		return ""
+	}
+
+	m, _ := c.resolve(media).(map[string]any)
+	schema, ok := m["schema"]
+	if !ok {
+		return ""
+	}
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Sprintf("invalid JSON: %v", err)
+	}
+	return c.checkSchema(schema, value, "$")
+}
+
+// checkParam checks the string values of a parameter against its schema.
+func (c *Contract) checkParam(schema any, values []string) string {
+	s, _ := schema.(map[string]any)
+	if schemaTypes(s)["array"] {
+		var items []any
+		for _, v := range values {
+			for _, part := range strings.Split(v, ",") {
+				items = append(items, c.coerce(s["items"], part))
+			}
+		}
+		return c.checkSchema(s, items, "$")
+	}
+	if len(values) > 1 {
+		return "repeated parameter is not an array"
+	}
+	return c.checkSchema(s, c.coerce(s, values[0]), "$")
+}
+
+// coerce converts a parameter string to the type its schema expects, or
+// leaves it as a string when it does not convert.
+func (c *Contract) coerce(schema any, v string) any {
+	types := schemaTypes(c.resolve(schema))
+	switch {
+	case types["integer"], types["number"]:
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+	case types["boolean"]:
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+	return v
+}
+
+// checkSchema checks a decoded JSON value against schema, returning why it
+// does not conform, or "" if it does. at is the JSON path of the value.
+func (c *Contract) checkSchema(schema any, value any, at string) string {
+	s, ok := c.resolve(schema).(map[string]any)
+	if !ok {
+		return ""
+	}
+
+	if value == nil {
+		if nullable, _ := s["nullable"].(bool); nullable || schemaTypes(s)["null"] || len(schemaTypes(s)) == 0 {
+			return ""
+		}
+		return at + ": must not be null"
+	}
+	if types := schemaTypes(s); len(types) > 0 && !types[jsonType(value)] &&
+		(jsonType(value) != "integer" || !types["number"]) {
+		return fmt.Sprintf("%s: expected %s, got %s", at, strings.Join(typeNames(s), " or "), jsonType(value))
+	}
+
+	if enum, ok := s["enum"].([]any); ok {
+		found := false
+		for _, e := range enum {
+			if equalJSON(e, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Sprintf("%s: %v is not one of the allowed values", at, value)
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		if n, ok := s["minLength"].(float64); ok && float64(len([]rune(v))) < n {
+			return fmt.Sprintf("%s: shorter than %v characters", at, n)
+		}
+		if n, ok := s["maxLength"].(float64); ok && float64(len([]rune(v))) > n {
+			return fmt.Sprintf("%s: longer than %v characters", at, n)
+		}
+		if pattern, ok := s["pattern"].(string); ok {
+			if re, err := regexp.Compile(pattern); err == nil && !re.MatchString(v) {
+				return fmt.Sprintf("%s: %q does not match %s", at, v, pattern)
+			}
+		}
+	case float64:
+		if n, ok := s["minimum"].(float64); ok && v < n {
+			return fmt.Sprintf("%s: %v is below the minimum %v", at, v, n)
+		}
+		if n, ok := s["maximum"].(float64); ok && v > n {
+			return fmt.Sprintf("%s: %v is above the maximum %v", at, v, n)
+		}
+	case []any:
+		if n, ok := s["minItems"].(float64); ok && float64(len(v)) < n {
+			return fmt.Sprintf("%s: fewer than %v items", at, n)
+		}
+		if n, ok := s["maxItems"].(float64); ok && float64(len(v)) > n {
+			return fmt.Sprintf("%s: more than %v items", at, n)
+		}
+		for i, item := range v {
+			if reason := c.checkSchema(s["items"], item, fmt.Sprintf("%s[%d]", at, i)); reason != "" {
+				return reason
+			}
+		}
+	case map[string]any:
+		required, _ := s["required"].([]any)
+		for _, name := range required {
+			if name, ok := name.(string); ok {
+				if _, ok := v[name]; !ok {
+					return fmt.Sprintf("%s: missing required property %q", at, name)
+				}
+			}
+		}
+		properties, _ := s["properties"].(map[string]any)
+		for name, prop := range v {
+			if propSchema, ok := properties[name]; ok {
+				if reason := c.checkSchema(propSchema, prop, at+"."+name); reason != "" {
+					return reason
+				}
+				continue
+			}
+			switch extra := s["additionalProperties"].(type) {
+			case bool:
+				if !extra {
+					return fmt.Sprintf("%s: unexpected property %q", at, name)
+				}
+			case map[string]any:
+				if reason := c.checkSchema(extra, prop, at+"."+name); reason != "" {
+					return reason
+				}
+			}
+		}
+	}
+
+	if all, ok := s["allOf"].([]any); ok {
+		for _, sub := range all {
+			if reason := c.checkSchema(sub, value, at); reason != "" {
+				return reason
+			}
+		}
+	}
+	if anyOf, ok := s["anyOf"].([]any); ok && c.countMatches(anyOf, value, at) == 0 {
+		return at + ": matches none of anyOf"
+	}
+	if oneOf, ok := s["oneOf"].([]any); ok {
+		if n := c.countMatches(oneOf, value, at); n != 1 {
+			return fmt.Sprintf("%s: matches %d of oneOf instead of exactly one", at, n)
+		}
+	}
+	return ""
+}
+
+// countMatches returns how many of schemas value conforms to.
+func (c *Contract) countMatches(schemas []any, value any, at string) int {
+	n := 0
+	for _, sub := range schemas {
+		if c.checkSchema(sub, value, at) == "" {
+			n++
+		}
+	}
+	return n
+}
+
+// resolve follows local $ref pointers, such as
+// "#/components/schemas/User", until it reaches a value without one.
+func (c *Contract) resolve(v any) any {
+	for range 32 {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return v
+		}
+		ref, ok := m["$ref"].(string)
+		if !ok {
+			return v
+		}
+		pointer, ok := strings.CutPrefix(ref, "#/")
+		if !ok {
+			return nil
+		}
+		var target any = c.doc
+		for _, token := range strings.Split(pointer, "/") {
+			token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+			obj, ok := target.(map[string]any)
+			if !ok {
+				return nil
+			}
+			target = obj[token]
+		}
+		v = target
+	}
+	// Give up on reference cycles.
+	return nil
+}
+
+// schemaTypes returns the types a schema allows, from a type string or, in
+// OpenAPI 3.1, a type array.
+func schemaTypes(schema any) map[string]bool {
+	s, _ := schema.(map[string]any)
+	types := make(map[string]bool)
+	switch t := s["type"].(type) {
+	case string:
+		types[t] = true
+	case []any:
+		for _, name := range t {
+			if name, ok := name.(string); ok {
+				types[name] = true
+			}
+		}
+	}
+	return types
+}
+
+// typeNames returns the types of a schema for messages.
+func typeNames(schema map[string]any) []string {
+	var names []string
+	for name := range schemaTypes(schema) {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// jsonType returns the JSON schema type of a decoded JSON value.
+func jsonType(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) && !math.IsInf(v, 0) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return "unknown"
+}
+
+// equalJSON reports whether two decoded JSON values are equal.
+func equalJSON(a, b any) bool {
+	x, errA := json.Marshal(a)
+	y, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(x, y)
+}
@@ -0,0 +1,212 @@
+package middleware_test
+
+import (
+	"cmp"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/middleware"
+)
+
+// testContract is the contract of a small user and pet API.
+const testContract = `{
+	"openapi": "3.0.3",
+	"servers": [{"url": "https://api.example.com/v1"}],
+	"paths": {
+		"/users/{id}": {
+			"parameters": [{"name": "id", "in": "path", "required": true, "schema": {"type": "integer"}}],
+			"get": {
+				"parameters": [
+					{"name": "fields", "in": "query", "schema": {"type": "array", "items": {"type": "string", "enum": ["name", "email"]}}},
+					{"name": "verbose", "in": "query", "schema": {"type": "boolean"}}
+				],
+				"responses": {
+					"200": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/User"}}}},
+					"4XX": {"$ref": "#/components/responses/Error"}
+				}
+			}
+		},
+		"/users/me": {
+			"get": {"responses": {"200": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/User"}}}}}}
+		},
+		"/users": {
+			"post": {
+				"parameters": [{"name": "X-Request-Id", "in": "header", "required": true, "schema": {"type": "string"}}],
+				"requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/NewUser"}}}},
+				"responses": {
+					"201": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/User"}}}},
+					"default": {"$ref": "#/components/responses/Error"}
+				}
+			}
+		},
+		"/pets/{name}": {
+			"get": {
+				"parameters": [{"name": "name", "in": "path", "required": true, "schema": {"type": "string"}}],
+				"responses": {"200": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/Pet"}}}}}
+			}
+		}
+	},
+	"components": {
+		"schemas": {
+			"User": {
+				"type": "object",
+				"required": ["id", "name"],
+				"properties": {
+					"id": {"type": "integer"},
+					"name": {"type": "string", "minLength": 1},
+					"tag": {"anyOf": [{"type": "string", "maxLength": 3}, {"type": "integer"}]}
+				},
+				"additionalProperties": false
+			},
+			"NewUser": {"type": "object", "required": ["name"], "properties": {"name": {"type": "string"}}},
+			"Pet": {"oneOf": [{"$ref": "#/components/schemas/Cat"}, {"$ref": "#/components/schemas/Dog"}]},
+			"Cat": {"type": "object", "required": ["meows"]},
+			"Dog": {"type": "object", "required": ["barks"]},
+			"Error": {"type": "object", "required": ["message"], "properties": {"message": {"type": "string"}}}
+		},
+		"responses": {
+			"Error": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}}
+		}
+	}
+}`
+
+func TestContractMiddleware(t *testing.T) {
+	contract, err := middleware.ParseContract([]byte(testContract))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const user = `{"id": 1, "name": "gopher"}`
+	jsonHeader := http.Header{"Content-Type": {"application/json"}}
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		header http.Header
+		body   string
+		reply  reply
+		reason string // Reported violation, or "" for none.
+	}{
+		// Paths and methods.
+		{name: "path parameter", path: "/v1/users/1", reply: reply{status: 200, header: jsonHeader, body: user}},
+		{name: "literal path wins", path: "/v1/users/me", reply: reply{status: 200, header: jsonHeader, body: user}},
+		{name: "trailing slash", path: "/v1/users/1/", reply: reply{status: 200, header: jsonHeader, body: user}},
+		{name: "unknown path", path: "/v1/orders", reply: reply{status: 200}, reason: "path is not in the contract"},
+		{name: "too many segments", path: "/v1/users/1/posts", reply: reply{status: 200}, reason: "path is not in the contract"},
+		{name: "outside the base path", path: "/v2/users/1", reply: reply{status: 200}, reason: "path is outside of base path /v1"},
+		{name: "method not allowed", method: http.MethodDelete, path: "/v1/users/1", reply: reply{status: 204}, reason: "method is not allowed on /users/{id}"},
+
+		// Parameters.
+		{name: "path parameter type", path: "/v1/users/gopher", reply: reply{status: 200, header: jsonHeader, body: user}, reason: `path parameter "id": $: expected integer, got string`},
+		{name: "query parameter", path: "/v1/users/1?verbose=true", reply: reply{status: 200, header: jsonHeader, body: user}},
+		{name: "query parameter type", path: "/v1/users/1?verbose=yes", reply: reply{status: 200, header: jsonHeader, body: user}, reason: `query parameter "verbose": $: expected boolean, got string`},
+		{name: "repeated parameter", path: "/v1/users/1?verbose=true&verbose=false", reply: reply{status: 200, header: jsonHeader, body: user}, reason: `query parameter "verbose": repeated parameter is not an array`},
+		{name: "array parameter", path: "/v1/users/1?fields=name,email&fields=name", reply: reply{status: 200, header: jsonHeader, body: user}},
+		{name: "array parameter item", path: "/v1/users/1?fields=name,age", reply: reply{status: 200, header: jsonHeader, body: user}, reason: `query parameter "fields": $[1]: age is not one of the allowed values`},
+		{name: "missing header", method: http.MethodPost, path: "/v1/users", header: jsonHeader, body: `{"name": "gopher"}`, reply: reply{status: 201, header: jsonHeader, body: user}, reason: `missing required header parameter "X-Request-Id"`},
+
+		// Request bodies.
+		{name: "request body", method: http.MethodPost, path: "/v1/users", header: http.Header{"Content-Type": {"application/json"}, "X-Request-Id": {"1"}}, body: `{"name": "gopher"}`, reply: reply{status: 201, header: jsonHeader, body: user}},
+		{name: "missing request body", method: http.MethodPost, path: "/v1/users", header: http.Header{"X-Request-Id": {"1"}}, reply: reply{status: 201, header: jsonHeader, body: user}, reason: "missing required request body"},
+		{name: "invalid request body", method: http.MethodPost, path: "/v1/users", header: http.Header{"Content-Type": {"application/json"}, "X-Request-Id": {"1"}}, body: `{}`, reply: reply{status: 201, header: jsonHeader, body: user}, reason: `request body: $: missing required property "name"`},
+		{name: "request content type", method: http.MethodPost, path: "/v1/users", header: http.Header{"Content-Type": {"text/plain"}, "X-Request-Id": {"1"}}, body: "gopher", reply: reply{status: 201, header: jsonHeader, body: user}, reason: "request body: content type text/plain is not in the contract"},
+
+		// $ref and response schemas.
+		{name: "referenced schema", path: "/v1/users/1", reply: reply{status: 200, header: jsonHeader, body: `{"id": 1}`}, reason: `response 200: $: missing required property "name"`},
+		{name: "nested property", path: "/v1/users/1", reply: reply{status: 200, header: jsonHeader, body: `{"id": 1, "name": ""}`}, reason: "response 200: $.name: shorter than 1 characters"},
+		{name: "additional property", path: "/v1/users/1", reply: reply{status: 200, header: jsonHeader, body: `{"id": 1, "name": "gopher", "age": 3}`}, reason: `response 200: $: unexpected property "age"`},
+		{name: "invalid JSON", path: "/v1/users/1", reply: reply{status: 200, header: jsonHeader, body: `{"id": 1,`}, reason: "response 200: invalid JSON: unexpected end of JSON input"},
+
+		// anyOf and oneOf.
+		{name: "anyOf first", path: "/v1/users/1", reply: reply{status: 200, header: jsonHeader, body: `{"id": 1, "name": "gopher", "tag": "new"}`}},
+		{name: "anyOf second", path: "/v1/users/1", reply: reply{status: 200, header: jsonHeader, body: `{"id": 1, "name": "gopher", "tag": 7}`}},
+		{name: "anyOf none", path: "/v1/users/1", reply: reply{status: 200, header: jsonHeader, body: `{"id": 1, "name": "gopher", "tag": "brand new"}`}, reason: "response 200: $.tag: matches none of anyOf"},
+		{name: "oneOf", path: "/v1/pets/tom", reply: reply{status: 200, header: jsonHeader, body: `{"meows": true}`}},
+		{name: "oneOf none", path: "/v1/pets/tom", reply: reply{status: 200, header: jsonHeader, body: `{}`}, reason: "response 200: $: matches 0 of oneOf instead of exactly one"},
+		{name: "oneOf both", path: "/v1/pets/tom", reply: reply{status: 200, header: jsonHeader, body: `{"meows": true, "barks": true}`}, reason: "response 200: $: matches 2 of oneOf instead of exactly one"},
+
+		// Status fallback.
+		{name: "status range", path: "/v1/users/1", reply: reply{status: 404, header: jsonHeader, body: `{"message": "not found"}`}},
+		{name: "status range schema", path: "/v1/users/1", reply: reply{status: 404, header: jsonHeader, body: `{}`}, reason: `response 404: $: missing required property "message"`},
+		{name: "status not in the contract", path: "/v1/users/1", reply: reply{status: 500}, reason: "status 500 is not in the contract"},
+		{name: "default status", method: http.MethodPost, path: "/v1/users", header: http.Header{"Content-Type": {"application/json"}, "X-Request-Id": {"1"}}, body: `{"name": "gopher"}`, reply: reply{status: 503, header: jsonHeader, body: `{"message": "down"}`}},
+		{name: "default status schema", method: http.MethodPost, path: "/v1/users", header: http.Header{"Content-Type": {"application/json"}, "X-Request-Id": {"1"}}, body: `{"name": "gopher"}`, reply: reply{status: 503, header: jsonHeader, body: `"down"`}, reason: "response 503: $: expected object, got string"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var reasons []string
+			m := middleware.ContractMiddleware(contract, func(err error) {
+				var v *middleware.ContractViolation
+				if !errors.As(err, &v) {
+					t.Fatalf("reported %v, want a *ContractViolation", err)
+				}
+				reasons = append(reasons, v.Reason)
+			})
+			req := newRequest(t, cmp.Or(tt.method, http.MethodGet), "https://api.example.com"+tt.path, strings.NewReader(tt.body))
+			if tt.body == "" {
+				req.Body = http.NoBody
+			}
+			for name, values := range tt.header {
+				req.Header[name] = values
+			}
+			_, body := send(t, m, newStub(tt.reply), req)
+			if body != tt.reply.body {
+				t.Errorf("body = %q, want %q", body, tt.reply.body)
+			}
+			want := []string{}
+			if tt.reason != "" {
+				want = []string{tt.reason}
+			}
+			if strings.Join(reasons, "\n") != strings.Join(want, "\n") {
+				t.Errorf("violations = %q, want %q", reasons, want)
+			}
+		})
+	}
+}
+
+func TestContractMiddlewareErrors(t *testing.T) {
+	contract, err := middleware.ParseContract([]byte(testContract))
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := newStub(reply{status: 200})
+	_, err = middleware.ContractMiddleware(contract, nil)(next).Do(newRequest(t, http.MethodGet, "https://api.example.com/v1/orders", nil))
+	var v *middleware.ContractViolation
+	if !errors.As(err, &v) || !errors.Is(err, middleware.ErrContractViolation) {
+		t.Fatalf("err = %v, want a *ContractViolation", err)
+	}
+	if v.Method != http.MethodGet || v.URL != "https://api.example.com/v1/orders" {
+		t.Errorf("violation of %s %s, want GET https://api.example.com/v1/orders", v.Method, v.URL)
+	}
+	if next.calls() != 0 {
+		t.Errorf("calls = %d, want 0", next.calls())
+	}
+}
+
+func TestParseContract(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		err  string
+	}{
+		{"json", `{"openapi": "3.1.0", "paths": {}}`, ""},
+		{"yaml", "openapi: 3.1.0\npaths: {}\n", "failed to decode contract"},
+		{"swagger", `{"swagger": "2.0", "paths": {}}`, `unsupported contract version ""`},
+		{"old version", `{"openapi": "2.0"}`, `unsupported contract version "2.0"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := middleware.ParseContract([]byte(tt.doc))
+			if tt.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("err = %v, want %s", err, tt.err)
+			}
+		})
+	}
+}
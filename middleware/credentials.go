@@ -0,0 +1,292 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/client"
+)
+
+// errNoCredentials is returned when a provider supplied empty credentials.
+var errNoCredentials = errors.New("provider returned no credentials")
+
+// DefaultFileCheckInterval is how often file providers check their files
+// for changes by default.
+const DefaultFileCheckInterval = time.Second
+
+// TokenSource supplies the token requests are authenticated with, such as
+// an API key or an access token. Token is called for every request, so
+// sources that are slow to query should be wrapped in a CachedTokenSource.
+// An *OAuth2TokenSource is a TokenSource.
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// TokenSourceFunc adapts a function to a TokenSource, to fetch tokens from
+// a secret store such as Vault.
+type TokenSourceFunc func(ctx context.Context) (string, error)
+
+// Token calls fn.
+func (fn TokenSourceFunc) Token(ctx context.Context) (string, error) {
+	return fn(ctx)
+}
+
+// Credentials are the username and password of Basic authentication.
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// CredentialProvider supplies the credentials requests are authenticated
+// with. Credentials is called for every request, so providers that are slow
+// to query should be wrapped in a CachedCredentialProvider.
+type CredentialProvider interface {
+	Credentials(ctx context.Context) (Credentials, error)
+}
+
+// CredentialProviderFunc adapts a function to a CredentialProvider.
+type CredentialProviderFunc func(ctx context.Context) (Credentials, error)
+
+// Credentials calls fn.
+func (fn CredentialProviderFunc) Credentials(ctx context.Context) (Credentials, error) {
+	return fn(ctx)
+}
+
+// StaticToken returns a TokenSource always supplying token.
+func StaticToken(token string) TokenSource {
+	return TokenSourceFunc(func(context.Context) (string, error) {
+		return token, nil
+	})
+}
+
+// StaticCredentials returns a CredentialProvider always supplying username
+// and password.
+func StaticCredentials(username, password string) CredentialProvider {
+	creds := Credentials{Username: username, Password: password}
+	return CredentialProviderFunc(func(context.Context) (Credentials, error) {
+		return creds, nil
+	})
+}
+
+// EnvToken returns a TokenSource reading the environment variable name on
+// every call, failing while it is unset or empty.
+func EnvToken(name string) TokenSource {
+	return TokenSourceFunc(func(context.Context) (string, error) {
+		return getenv(name)
+	})
+}
+
+// EnvCredentials returns a CredentialProvider reading the username and
+// password from the environment variables userVar and passVar on every
+// call, failing while either is unset or empty.
+func EnvCredentials(userVar, passVar string) CredentialProvider {
+	return CredentialProviderFunc(func(context.Context) (Credentials, error) {
+		username, err := getenv(userVar)
+		if err != nil {
+			return Credentials{}, err
+		}
+		password, err := getenv(passVar)
+		if err != nil {
+			return Credentials{}, err
+		}
+		return Credentials{Username: username, Password: password}, nil
+	})
+}
+
+// getenv returns the value of the environment variable name.
+func getenv(name string) (string, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return value, nil
+}
+
+// FileConfig configures the file providers.
+type FileConfig struct {
+	// CheckInterval is how often the file is checked for changes; zero
+	// means DefaultFileCheckInterval.
+	CheckInterval time.Duration
+	// Clock times the checks; nil uses client.SystemClock.
+	Clock client.Clock
+}
+
+// FileToken returns a TokenSource supplying the contents of the file at
+// path, with surrounding whitespace trimmed. The file is read again when
+// its size or modification time changes, so rotated tokens are picked up
+// without a restart, including files swapped through a symlink as
+// Kubernetes does with mounted secrets.
+func FileToken(path string, cfg FileConfig) TokenSource {
+	file := newWatchedFile(path, cfg)
+	return TokenSourceFunc(func(context.Context) (string, error) {
+		return file.read()
+	})
+}
+
+// FileCredentials returns a CredentialProvider supplying the contents of
+// the files at userPath and passPath, watched like FileToken does.
+func FileCredentials(userPath, passPath string, cfg FileConfig) CredentialProvider {
+	userFile := newWatchedFile(userPath, cfg)
+	passFile := newWatchedFile(passPath, cfg)
+	return CredentialProviderFunc(func(context.Context) (Credentials, error) {
+		username, err := userFile.read()
+		if err != nil {
+			return Credentials{}, err
+		}
+		password, err := passFile.read()
+		if err != nil {
+			return Credentials{}, err
+		}
+		return Credentials{Username: username, Password: password}, nil
+	})
+}
+
+// watchedFile caches the trimmed contents of a file until it changes.
+type watchedFile struct {
+	path     string
+	interval time.Duration
+	clock    client.Clock
+
+	mu      sync.Mutex
+	value   string
+	size    int64
+	modTime time.Time
+	checked time.Time
+}
+
+// newWatchedFile creates a watchedFile for path.
+func newWatchedFile(path string, cfg FileConfig) *watchedFile {
+	interval := cfg.CheckInterval
+	if interval <= 0 {
+		interval = DefaultFileCheckInterval
+	}
+	return &watchedFile{path: path, interval: interval, clock: clockOrSystem(cfg.Clock)}
+}
+
+// read returns the contents of the file, reading it again if it changed
+// since the last check.
+func (f *watchedFile) read() (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := f.clock.Now()
+	if !f.checked.IsZero() && now.Sub(f.checked) < f.interval {
+		return f.value, nil
+	}
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read credentials file: %w", err)
+	}
+	if !f.checked.IsZero() && info.Size() == f.size && info.ModTime().Equal(f.modTime) {
+		f.checked = now
+		return f.value, nil
+	}
+
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read credentials file: %w", err)
+	}
+	value := strings.TrimSpace(string(data))
+	if value == "" {
+		return "", fmt.Errorf("credentials file %s is empty", f.path)
+	}
+	f.value, f.size, f.modTime, f.checked = value, info.Size(), info.ModTime(), now
+	return value, nil
+}
+
+// CachedTokenSource caches the tokens of Source for TTL, so slow sources
+// are not queried for every request. Errors are not cached.
+type CachedTokenSource struct {
+	Source TokenSource
+	TTL    time.Duration
+	// Clock times the TTL; nil uses client.SystemClock.
+	Clock client.Clock
+
+	cache ttlCache[string]
+}
+
+// Token returns the cached token, fetching a new one once it expired.
+func (s *CachedTokenSource) Token(ctx context.Context) (string, error) {
+	return s.cache.get(ctx, clockOrSystem(s.Clock), s.TTL, s.Source.Token)
+}
+
+// CachedCredentialProvider caches the credentials of Provider for TTL, like
+// CachedTokenSource.
+type CachedCredentialProvider struct {
+	Provider CredentialProvider
+	TTL      time.Duration
+	// Clock times the TTL; nil uses client.SystemClock.
+	Clock client.Clock
+
+	cache ttlCache[Credentials]
+}
+
+// Credentials returns the cached credentials, fetching new ones once they
+// expired.
+func (p *CachedCredentialProvider) Credentials(ctx context.Context) (Credentials, error) {
+	return p.cache.get(ctx, clockOrSystem(p.Clock), p.TTL, p.Provider.Credentials)
+}
+
+// ttlCache holds one value until it expires. Concurrent callers share a
+// single fetch, each waiting only as long as its own context allows.
+type ttlCache[T any] struct {
+	mu       sync.Mutex
+	value    T
+	expires  time.Time
+	inflight *ttlFetch[T]
+}
+
+// ttlFetch is a fetch in progress that concurrent callers wait on.
+type ttlFetch[T any] struct {
+	done  chan struct{}
+	value T
+	err   error
+}
+
+// get returns the cached value, fetching it if it expired.
+func (c *ttlCache[T]) get(ctx context.Context, clock client.Clock, ttl time.Duration, fetch func(context.Context) (T, error)) (T, error) {
+	c.mu.Lock()
+	if clock.Now().Before(c.expires) {
+		value := c.value
+		c.mu.Unlock()
+		return value, nil
+	}
+	f := c.inflight
+	if f == nil {
+		f = &ttlFetch[T]{done: make(chan struct{})}
+		c.inflight = f
+		go c.fetch(context.WithoutCancel(ctx), clock, ttl, fetch, f)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.value, f.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// fetch runs a fetch on behalf of every caller waiting for f. It does not
+// inherit caller cancellation, so one caller giving up does not fail the
+// others.
+func (c *ttlCache[T]) fetch(ctx context.Context, clock client.Clock, ttl time.Duration, fetch func(context.Context) (T, error), f *ttlFetch[T]) {
+	f.value, f.err = fetch(ctx)
+
+	c.mu.Lock()
+	c.inflight = nil
+	if f.err == nil {
+		c.value, c.expires = f.value, clock.Now().Add(ttl)
+	} else {
+		var zero T
+		f.value = zero
+	}
+	c.mu.Unlock()
+	close(f.done)
+}
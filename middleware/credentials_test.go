@@ -0,0 +1,149 @@
+package middleware_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/client"
+	"github.com/Vkanhan/go-auth-middleware-http-client/middleware"
+)
+
+// countingSource is a TokenSource returning t1, t2, ... in turn, or err.
+type countingSource struct {
+	calls atomic.Int32
+	err   error
+}
+
+// Token returns the next token.
+func (s *countingSource) Token(ctx context.Context) (string, error) {
+	n := s.calls.Add(1)
+	if s.err != nil {
+		return "", s.err
+	}
+	return fmt.Sprintf("t%d", n), nil
+}
+
+func TestCachedTokenSource(t *testing.T) {
+	clock := client.NewFakeClock(epoch)
+	source := &countingSource{}
+	cached := &middleware.CachedTokenSource{Source: source, TTL: time.Minute, Clock: clock}
+
+	steps := []struct {
+		advance time.Duration
+		token   string
+	}{
+		{0, "t1"},
+		{59 * time.Second, "t1"},
+		{time.Second, "t2"},
+		{30 * time.Second, "t2"},
+	}
+	for i, step := range steps {
+		clock.Advance(step.advance)
+		token, err := cached.Token(context.Background())
+		if err != nil || token != step.token {
+			t.Errorf("step %d: Token() = %q, %v; want %q", i, token, err, step.token)
+		}
+	}
+}
+
+func TestCachedTokenSourceErrors(t *testing.T) {
+	source := &countingSource{err: errors.New("vault is sealed")}
+	cached := &middleware.CachedTokenSource{Source: source, TTL: time.Minute, Clock: client.NewFakeClock(epoch)}
+	for range 2 {
+		if _, err := cached.Token(context.Background()); !errors.Is(err, source.err) {
+			t.Fatalf("err = %v, want %v", err, source.err)
+		}
+	}
+	if source.calls.Load() != 2 {
+		t.Errorf("calls = %d, want the error not cached", source.calls.Load())
+	}
+}
+
+func TestCachedCredentialProviderSharesFetch(t *testing.T) {
+	release := make(chan struct{})
+	var calls atomic.Int32
+	cached := &middleware.CachedCredentialProvider{
+		Provider: middleware.CredentialProviderFunc(func(ctx context.Context) (middleware.Credentials, error) {
+			calls.Add(1)
+			<-release
+			return middleware.Credentials{Username: "user", Password: "pass"}, nil
+		}),
+		TTL:   time.Minute,
+		Clock: client.NewFakeClock(epoch),
+	}
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if creds, err := cached.Credentials(context.Background()); err != nil || creds.Username != "user" {
+				t.Errorf("Credentials() = %v, %v", creds, err)
+			}
+		}()
+	}
+	close(release)
+	wg.Wait()
+	if calls.Load() != 1 {
+		t.Errorf("calls = %d, want 1", calls.Load())
+	}
+}
+
+func TestCachedTokenSourceBlockedFetch(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	cached := &middleware.CachedTokenSource{
+		Source: middleware.TokenSourceFunc(func(ctx context.Context) (string, error) {
+			close(started)
+			<-release
+			return "t1", nil
+		}),
+		TTL:   time.Minute,
+		Clock: client.NewFakeClock(epoch),
+	}
+
+	// The first caller gives up on the hanging fetch.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := tokenWithin(t, cached, ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want context.DeadlineExceeded", err)
+	}
+	<-started
+
+	// A caller that is already cancelled returns at once, without waiting
+	// for the fetch.
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := tokenWithin(t, cached, cancelled); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+
+	// The fetch completes for the callers still waiting.
+	close(release)
+	if token, err := cached.Token(context.Background()); err != nil || token != "t1" {
+		t.Errorf("Token() = %q, %v; want t1", token, err)
+	}
+}
+
+// tokenWithin calls Token with ctx, failing t if it does not return within
+// a second.
+func tokenWithin(t *testing.T, source middleware.TokenSource, ctx context.Context) error {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() {
+		_, err := source.Token(ctx)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(time.Second):
+		t.Fatal("Token blocked on the fetch")
+		return nil
+	}
+}
@@ -0,0 +1,173 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/client"
+	"github.com/Vkanhan/go-auth-middleware-http-client/internal/httpx"
+)
+
+// ErrInjectedFault is the error returned by faults that set neither Err nor
+// StatusCode nor TruncateAfter.
+var ErrInjectedFault = errors.New("injected fault")
+
+// faultKey is the context key toggling fault injection per request.
+type faultKey struct{}
+
+// ContextWithFaultInjection returns a context that turns fault injection on
+// or off for requests sent with it, overriding FaultConfig.RequireContext.
+func ContextWithFaultInjection(ctx context.Context, enabled bool) context.Context {
+	return context.WithValue(ctx, faultKey{}, enabled)
+}
+
+// Fault describes a failure to inject. Latency is applied first; then the
+// request fails with Err, is answered with StatusCode, or has its response
+// body cut after TruncateAfter bytes, whichever is set first.
+type Fault struct {
+	// Match selects the requests the fault applies to; nil matches all.
+	Match func(*http.Request) bool
+	// Probability is the chance, from 0 to 1, that a matching request is hit.
+	// Zero hits every matching request when Match is set, and none when it
+	// is not, so a fault aimed at some requests needs no probability.
+	Probability float64
+
+	// Latency delays the request before it is sent.
+	Latency time.Duration
+	// Jitter varies Latency from one request to the next, with a spread
+	// that depends on Distribution.
+	Jitter time.Duration
+	// Distribution is the shape of the latency around Latency.
+	Distribution LatencyDistribution
+	// Err is returned instead of sending the request.
+	Err error
+	// StatusCode is returned in a synthetic response instead of sending the
+	// request.
+	StatusCode int
+	// TruncateAfter, if positive, cuts the real response body after that
+	// many bytes with io.ErrUnexpectedEOF.
+	TruncateAfter int
+}
+
+// FaultConfig configures FaultInjectionMiddleware.
+type FaultConfig struct {
+	// Faults are tried in order; the first one that matches and triggers is
+	// applied.
+	Faults []Fault
+	// RequireContext limits injection to requests whose context enabled it
+	// with ContextWithFaultInjection.
+	RequireContext bool
+	// Rand returns numbers in [0, 1) for the probability rolls; nil uses
+	// math/rand/v2. Set it to make runs reproducible.
+	Rand func() float64
+	// Clock sleeps the injected latency; nil uses client.SystemClock.
+	Clock client.Clock
+}
+
+// FaultInjectionMiddleware injects errors, error statuses, truncated bodies
+// and latency into requests, to exercise retries, circuit breakers and
+// timeouts in tests and staging.
+func FaultInjectionMiddleware(cfg FaultConfig) client.Middleware {
+	roll := cfg.Rand
+	if roll == nil {
+		roll = rand.Float64
+	}
+	clock := clockOrSystem(cfg.Clock)
+
+	return func(next client.HTTPClient) client.HTTPClient {
+		return client.HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+			enabled, ok := req.Context().Value(faultKey{}).(bool)
+			if !ok {
+				enabled = !cfg.RequireContext
+			}
+			if !enabled {
+				return next.Do(req)
+			}
+
+			for _, fault := range cfg.Faults {
+				if fault.Match != nil && !fault.Match(req) {
+					continue
+				}
+				if !fault.triggers(roll) {
+					continue
+				}
+				return fault.inject(next, req, clock, roll)
+			}
+			return next.Do(req)
+		})
+	}
+}
+
+// triggers rolls for whether the fault hits a matching request.
+func (f Fault) triggers(roll func() float64) bool {
+	if f.Probability == 0 && f.Match != nil {
+		return true
+	}
+	return roll() < f.Probability
+}
+
+// inject applies the fault to the request.
+func (f Fault) inject(next client.HTTPClient, req *http.Request, clock client.Clock, roll func() float64) (*http.Response, error) {
+	if err := clock.Sleep(req.Context(), f.Distribution.sample(f.Latency, f.Jitter, roll)); err != nil {
+		httpx.CloseBody(req)
+		return nil, err
+	}
+
+	switch {
+	case f.Err != nil:
+		httpx.CloseBody(req)
+		return nil, f.Err
+	case f.StatusCode != 0:
+		httpx.CloseBody(req)
+		body := http.StatusText(f.StatusCode)
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", f.StatusCode, body),
+			StatusCode:    f.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{"Content-Type": {"text/plain; charset=utf-8"}},
+			Body:          io.NopCloser(strings.NewReader(body)),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}, nil
+	case f.TruncateAfter > 0:
+		resp, err := next.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = &truncatedBody{ReadCloser: resp.Body, remaining: f.TruncateAfter}
+		resp.ContentLength = -1
+		return resp, nil
+	case f.Latency > 0 || f.Jitter > 0:
+		return next.Do(req)
+	default:
+		httpx.CloseBody(req)
+		return nil, ErrInjectedFault
+	}
+}
+
+// truncatedBody fails with io.ErrUnexpectedEOF after a number of bytes.
+type truncatedBody struct {
+	io.ReadCloser
+	remaining int
+}
+
+// Read reads until the truncation point.
+func (b *truncatedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if len(p) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= n
+	return n, err
+}
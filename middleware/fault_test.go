@@ -0,0 +1,124 @@
+package middleware_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/middleware"
+)
+
+// outcome describes the result of a request as "error: <err>" or
+// "<status> <body>", followed by the error reading the body, if any.
+func outcome(resp *http.Response, err error) string {
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Sprintf("%d %s: %v", resp.StatusCode, body, err)
+	}
+	return fmt.Sprintf("%d %s", resp.StatusCode, body)
+}
+
+func TestFaultInjectionMiddleware(t *testing.T) {
+	errBoom := errors.New("boom")
+	flaky := func(req *http.Request) bool { return req.URL.Path == "/flaky" }
+	tests := []struct {
+		name    string
+		faults  []middleware.Fault
+		path    string
+		roll    float64
+		outcome string
+		calls   int
+		slept   string
+	}{
+		{"status", []middleware.Fault{{Probability: 1, StatusCode: 503}}, "/", 0, "503 Service Unavailable", 0, "[0s]"},
+		{"error", []middleware.Fault{{Probability: 1, Err: errBoom}}, "/", 0, "error: boom", 0, "[0s]"},
+		{"default error", []middleware.Fault{{Probability: 1}}, "/", 0, "error: injected fault", 0, "[0s]"},
+		{"latency only", []middleware.Fault{{Probability: 1, Latency: 2 * time.Second}}, "/", 0, "200 response", 1, "[2s]"},
+		{"latency before status", []middleware.Fault{{Probability: 1, Latency: time.Second, StatusCode: 500}}, "/", 0, "500 Internal Server Error", 0, "[1s]"},
+		{"truncated", []middleware.Fault{{Probability: 1, TruncateAfter: 3}}, "/", 0, "200 res: unexpected EOF", 1, "[0s]"},
+		{"roll hits", []middleware.Fault{{Probability: 0.5, StatusCode: 503}}, "/", 0.49, "503 Service Unavailable", 0, "[0s]"},
+		{"roll misses", []middleware.Fault{{Probability: 0.5, StatusCode: 503}}, "/", 0.5, "200 response", 1, "[]"},
+		{"match without probability", []middleware.Fault{{Match: flaky, StatusCode: 503}}, "/flaky", 0.99, "503 Service Unavailable", 0, "[0s]"},
+		{"no match", []middleware.Fault{{Match: flaky, StatusCode: 503}}, "/", 0, "200 response", 1, "[]"},
+		{"no match nor probability", []middleware.Fault{{StatusCode: 503}}, "/", 0, "200 response", 1, "[]"},
+		{"first triggering fault", []middleware.Fault{{Probability: 0.5, StatusCode: 500}, {Probability: 1, StatusCode: 503}}, "/", 0.7, "503 Service Unavailable", 0, "[0s]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newStepClock()
+			next := newStub(reply{status: 200, body: "response"})
+			m := middleware.FaultInjectionMiddleware(middleware.FaultConfig{
+				Faults: tt.faults,
+				Rand:   func() float64 { return tt.roll },
+				Clock:  clock,
+			})
+			got := outcome(m(next).Do(newRequest(t, http.MethodGet, "http://api.example.com"+tt.path, nil)))
+			if got != tt.outcome {
+				t.Errorf("outcome = %q, want %q", got, tt.outcome)
+			}
+			if next.calls() != tt.calls {
+				t.Errorf("calls = %d, want %d", next.calls(), tt.calls)
+			}
+			if got := fmt.Sprint(clock.Slept()); got != tt.slept {
+				t.Errorf("slept = %s, want %s", got, tt.slept)
+			}
+		})
+	}
+}
+
+func TestFaultInjectionMiddlewareContext(t *testing.T) {
+	tests := []struct {
+		name           string
+		requireContext bool
+		ctx            func(context.Context) context.Context
+		injected       bool
+	}{
+		{"on by default", false, nil, true},
+		{"turned off", false, func(ctx context.Context) context.Context { return middleware.ContextWithFaultInjection(ctx, false) }, false},
+		{"context required", true, nil, false},
+		{"turned on", true, func(ctx context.Context) context.Context { return middleware.ContextWithFaultInjection(ctx, true) }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := newStub(reply{status: 200})
+			m := middleware.FaultInjectionMiddleware(middleware.FaultConfig{
+				Faults:         []middleware.Fault{{Probability: 1, StatusCode: 503}},
+				RequireContext: tt.requireContext,
+				Clock:          newStepClock(),
+			})
+			req := newRequest(t, http.MethodGet, "http://api.example.com/", nil)
+			if tt.ctx != nil {
+				req = req.WithContext(tt.ctx(req.Context()))
+			}
+			resp, _ := send(t, m, next, req)
+			if injected := resp.StatusCode == 503; injected != tt.injected {
+				t.Errorf("status = %d, want injected %v", resp.StatusCode, tt.injected)
+			}
+		})
+	}
+}
+
+func TestFaultInjectionMiddlewareLatencyCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	next := newStub(reply{status: 200})
+	m := middleware.FaultInjectionMiddleware(middleware.FaultConfig{
+		Faults: []middleware.Fault{{Probability: 1, Latency: time.Second}},
+		Clock:  newStepClock(),
+	})
+	req := newRequest(t, http.MethodGet, "http://api.example.com/", nil).WithContext(ctx)
+	if _, err := m(next).Do(req); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want %v", err, context.Canceled)
+	}
+	if next.calls() != 0 {
+		t.Errorf("calls = %d, want 0", next.calls())
+	}
+}
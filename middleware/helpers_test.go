@@ -0,0 +1,165 @@
+package middleware_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/client"
+)
+
+// epoch is the start time of the test clocks.
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// stepClock is a Clock whose sleeps return at once, moving the time
+// forward by the duration slept.
+type stepClock struct {
+	mu    sync.Mutex
+	now   time.Time
+	slept []time.Duration
+}
+
+// newStepClock creates a stepClock set to epoch.
+func newStepClock() *stepClock {
+	return &stepClock{now: epoch}
+}
+
+// Now returns the current time.
+func (c *stepClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Sleep records d and advances the time by it.
+func (c *stepClock) Sleep(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.slept = append(c.slept, d)
+	c.now = c.now.Add(d)
+	return nil
+}
+
+// Advance moves the time forward by d.
+func (c *stepClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Slept returns the durations slept so far.
+func (c *stepClock) Slept() []time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]time.Duration(nil), c.slept...)
+}
+
+// reply is a canned response of a stub.
+type reply struct {
+	status int
+	header http.Header
+	body   string
+	err    error
+}
+
+// stub is an HTTPClient answering with its replies in turn, repeating the
+// last one, and counting the requests it received.
+type stub struct {
+	mu       sync.Mutex
+	replies  []reply
+	requests []*http.Request
+}
+
+// newStub creates a stub answering with replies.
+func newStub(replies ...reply) *stub {
+	return &stub{replies: replies}
+}
+
+// Do answers req with the next reply.
+func (s *stub) Do(req *http.Request) (*http.Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if req.Body != nil {
+		io.Copy(io.Discard, req.Body)
+		req.Body.Close()
+	}
+	s.requests = append(s.requests, req)
+	r := s.replies[min(len(s.requests), len(s.replies))-1]
+	if r.err != nil {
+		return nil, r.err
+	}
+	header := r.header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		StatusCode: r.status,
+		Header:     header,
+		Body:       io.NopCloser(strings.NewReader(r.body)),
+		Request:    req,
+	}, nil
+}
+
+// calls returns the number of requests received.
+func (s *stub) calls() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.requests)
+}
+
+// last returns the last request received.
+func (s *stub) last() *http.Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[len(s.requests)-1]
+}
+
+// newRequest creates a request, failing t on error.
+func newRequest(t testing.TB, method, url string, body io.Reader) *http.Request {
+	t.Helper()
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+// send sends a request through m in front of next and returns the response
+// body, failing t on error.
+func send(t testing.TB, m client.Middleware, next client.HTTPClient, req *http.Request) (*http.Response, string) {
+	t.Helper()
+	resp, err := m(next).Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", req.Method, req.URL, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read response body: %v", err)
+	}
+	return resp, string(body)
+}
+
+// waitForCalls waits until next received n requests and, since the
+// request is sent before its response is handled, a little longer.
+func waitForCalls(t *testing.T, next *stub, n int) {
+	t.Helper()
+	if n == 0 {
+		return
+	}
+	deadline := time.Now().Add(time.Second)
+	for next.calls() < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("calls = %d after a second, want %d", next.calls(), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+}
@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/client"
+)
+
+// redactedValue replaces the values of redacted headers in logs.
+const redactedValue = "[REDACTED]"
+
+// DefaultRedactedHeaders are the headers LoggingMiddleware redacts by
+// default.
+var DefaultRedactedHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+	"X-API-Key",
+	"X-Amz-Security-Token",
+}
+
+// LoggingConfig configures LoggingMiddleware.
+type LoggingConfig struct {
+	// Logger receives the records; nil uses slog.Default.
+	Logger *slog.Logger
+	// Level is the level of requests that got a response; zero is
+	// slog.LevelInfo. Requests that failed are logged at slog.LevelError.
+	Level slog.Level
+	// Headers adds the request and response headers to the records.
+	Headers bool
+	// Redact lists the headers whose values are replaced in the records;
+	// nil means DefaultRedactedHeaders.
+	Redact []string
+	// Clock times the requests; nil uses client.SystemClock.
+	Clock client.Clock
+}
+
+// LoggingMiddleware logs a record for every request with its method, URL,
+// status and duration, or the error it failed with. Passwords in URLs are
+// always redacted, as are the values of the Redact headers. Requests
+// carrying a span, such as those passed on by TracingMiddleware, are logged
+// with its trace and span IDs. The duration runs until the response headers
+// arrive.
+func LoggingMiddleware(cfg LoggingConfig) client.Middleware {
+	clock := clockOrSystem(cfg.Clock)
+	redact := cfg.Redact
+	if redact == nil {
+		redact = DefaultRedactedHeaders
+	}
+
+	return func(next client.HTTPClient) client.HTTPClient {
+		return client.HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+			logger := cfg.Logger
+			if logger == nil {
+				logger = slog.Default()
+			}
+			ctx := req.Context()
+			// Enabled is checked at the error level too, so failures are
+			// logged when the success level is filtered out.
+			if !logger.Enabled(ctx, cfg.Level) && !logger.Enabled(ctx, slog.LevelError) {
+				return next.Do(req)
+			}
+
+			attrs := []slog.Attr{
+				slog.String("method", req.Method),
+				slog.String("url", req.URL.Redacted()),
+			}
+			if sc, ok := SpanContextFromContext(ctx); ok {
+				attrs = append(attrs,
+					slog.String("trace_id", hex.EncodeToString(sc.TraceID[:])),
+					slog.String("span_id", hex.EncodeToString(sc.SpanID[:])))
+			}
+			if cfg.Headers {
+				attrs = append(attrs, headerAttr("request_headers", req.Header, redact))
+			}
+
+			start := clock.Now()
+			resp, err := next.Do(req)
+			duration := clock.Now().Sub(start)
+
+			if err != nil {
+				attrs = append(attrs, slog.Duration("duration", duration), slog.String("error", err.Error()))
+				logger.LogAttrs(ctx, slog.LevelError, "http request failed", attrs...)
+				return nil, err
+			}
+			attrs = append(attrs, slog.Int("status", resp.StatusCode), slog.Duration("duration", duration))
+			if cfg.Headers {
+				attrs = append(attrs, headerAttr("response_headers", resp.Header, redact))
+			}
+			logger.LogAttrs(ctx, cfg.Level, "http request", attrs...)
+			return resp, nil
+		})
+	}
+}
+
+// headerAttr returns header as a group, with the values of the redacted
+// headers replaced.
+func headerAttr(key string, header http.Header, redact []string) slog.Attr {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	attrs := make([]any, 0, len(names))
+	for _, name := range names {
+		value := strings.Join(header[name], ", ")
+		if slices.ContainsFunc(redact, func(r string) bool { return strings.EqualFold(r, name) }) {
+			value = redactedValue
+		}
+		attrs = append(attrs, slog.String(name, value))
+	}
+	return slog.Group(key, attrs...)
+}
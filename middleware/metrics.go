@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/client"
+)
+
+// Names of the request metrics. They are labeled with the method, the host
+// and, except for errors, the status code, which is "error" for requests
+// that got no response.
+const (
+	MetricRequests        = "http_client_requests_total"
+	MetricRequestErrors   = "http_client_request_errors_total"
+	MetricRequestDuration = "http_client_request_duration_seconds"
+)
+
+// MetricsConfig configures MetricsMiddleware.
+type MetricsConfig struct {
+	// Metrics receives the measurements, for example a PrometheusMetrics.
+	Metrics client.Metrics
+	// Clock times the requests; nil uses client.SystemClock.
+	Clock client.Clock
+}
+
+// MetricsMiddleware counts requests and the errors they fail with, and
+// records their latency until the response headers arrive.
+func MetricsMiddleware(cfg MetricsConfig) client.Middleware {
+	clock := clockOrSystem(cfg.Clock)
+	return func(next client.HTTPClient) client.HTTPClient {
+		if cfg.Metrics == nil {
+			return next
+		}
+		return client.HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+			method, host := req.Method, req.URL.Host
+			if method == "" {
+				method = http.MethodGet
+			}
+
+			start := clock.Now()
+			resp, err := next.Do(req)
+			duration := clock.Now().Sub(start).Seconds()
+
+			status := "error"
+			if err != nil {
+				cfg.Metrics.AddCounter(MetricRequestErrors, 1, "method", method, "host", host)
+			} else {
+				status = strconv.Itoa(resp.StatusCode)
+			}
+			cfg.Metrics.AddCounter(MetricRequests, 1, "method", method, "host", host, "status", status)
+			cfg.Metrics.Observe(MetricRequestDuration, duration, "method", method, "host", host, "status", status)
+			return resp, err
+		})
+	}
+}
@@ -0,0 +1,267 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/client"
+	"github.com/Vkanhan/go-auth-middleware-http-client/internal/httpx"
+)
+
+// Timings of OAuth2 token handling.
+const (
+	// DefaultOAuth2RefreshBefore is how long before expiry a token is
+	// refreshed by default.
+	DefaultOAuth2RefreshBefore = time.Minute
+	// oauth2FetchTimeout bounds a token request, which outlives the
+	// request that triggered it.
+	oauth2FetchTimeout = 30 * time.Second
+	// oauth2MaxBody caps the size of token responses.
+	oauth2MaxBody = 1 << 20
+)
+
+// OAuth2Config configures an OAuth2TokenSource using the client credentials
+// grant of RFC 6749 section 4.4.
+type OAuth2Config struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+
+	// Client sends the token requests; nil uses http.DefaultClient.
+	Client client.HTTPClient
+	// RefreshBefore is how long before expiry the token is refreshed in
+	// the background; zero means DefaultOAuth2RefreshBefore. Tokens living
+	// shorter than twice as long refresh at half their lifetime.
+	RefreshBefore time.Duration
+	// Clock tells the time for expiry; nil uses client.SystemClock.
+	Clock client.Clock
+}
+
+// OAuth2Error is an error response of a token endpoint.
+type OAuth2Error struct {
+	StatusCode  int
+	Code        string
+	Description string
+}
+
+// Error implements the error interface.
+func (e *OAuth2Error) Error() string {
+	msg := fmt.Sprintf("token endpoint returned %d", e.StatusCode)
+	if e.Code != "" {
+		msg += ": " + e.Code
+	}
+	if e.Description != "" {
+		msg += ": " + e.Description
+	}
+	return msg
+}
+
+// OAuth2TokenSource fetches and caches access tokens. It is safe for
+// concurrent use: callers share one token request at a time.
+type OAuth2TokenSource struct {
+	cfg   OAuth2Config
+	clock client.Clock
+
+	mu        sync.Mutex
+	token     string
+	expiry    time.Time // zero for tokens without expires_in
+	refreshAt time.Time
+	fetch     *tokenFetch
+}
+
+// tokenFetch is a token request in flight.
+type tokenFetch struct {
+	done   chan struct{}
+	token  string
+	expiry time.Time
+	err    error
+}
+
+// NewOAuth2TokenSource creates a token source for cfg.
+func NewOAuth2TokenSource(cfg OAuth2Config) *OAuth2TokenSource {
+	return &OAuth2TokenSource{cfg: cfg, clock: clockOrSystem(cfg.Clock)}
+}
+
+// OAuth2Middleware authenticates requests with access tokens obtained with
+// the client credentials grant. Tokens are cached and refreshed before they
+// expire, and a request answered with 401 Unauthorized is retried once with
+// a new token.
+func OAuth2Middleware(tokenURL, clientID, clientSecret string, scopes ...string) client.Middleware {
+	return NewOAuth2TokenSource(OAuth2Config{
+		TokenURL:     tokenURL,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Scopes:       scopes,
+	}).Middleware()
+}
+
+// Middleware returns the middleware adding tokens from the source.
+func (s *OAuth2TokenSource) Middleware() client.Middleware {
+	return func(next client.HTTPClient) client.HTTPClient {
+		return client.HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+			token, err := s.Token(req.Context())
+			if err != nil {
+				httpx.CloseBody(req)
+				return nil, fmt.Errorf("failed to get access token: %w", err)
+			}
+			req.Header.Set("Authorization", "Bearer "+token)
+			resp, err := next.Do(req)
+			if err != nil || resp.StatusCode != http.StatusUnauthorized {
+				return resp, err
+			}
+			// Only requests whose body can be sent again are retried.
+			if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+				return resp, nil
+			}
+
+			s.Invalidate(token)
+			token, err = s.Token(req.Context())
+			if err != nil {
+				// Keep the 401 rather than hide it behind the token error.
+				return resp, nil
+			}
+			retry, err := httpx.RewindBody(req)
+			if err != nil {
+				return resp, nil
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			if retry == req {
+				retry = req.Clone(req.Context())
+			}
+			retry.Header.Set("Authorization", "Bearer "+token)
+			return next.Do(retry)
+		})
+	}
+}
+
+// Token returns a valid access token, fetching one if none is cached or the
+// cached one expired. A token due for refresh is still returned while a new
+// one is fetched in the background.
+func (s *OAuth2TokenSource) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	now := s.clock.Now()
+	if s.token != "" && (s.expiry.IsZero() || now.Before(s.expiry)) {
+		token := s.token
+		if !s.refreshAt.IsZero() && !now.Before(s.refreshAt) {
+			s.startFetch()
+		}
+		s.mu.Unlock()
+		return token, nil
+	}
+	f := s.startFetch()
+	s.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.token, f.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// Invalidate drops token from the cache, if it is still the cached one, so
+// the next call to Token fetches a new one.
+func (s *OAuth2TokenSource) Invalidate(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token == token {
+		s.token = ""
+	}
+}
+
+// startFetch starts a token request unless one is in flight, and returns
+// it. Callers must hold s.mu.
+func (s *OAuth2TokenSource) startFetch() *tokenFetch {
+	if s.fetch != nil {
+		return s.fetch
+	}
+	f := &tokenFetch{done: make(chan struct{})}
+	s.fetch = f
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), oauth2FetchTimeout)
+		defer cancel()
+		f.token, f.expiry, f.err = s.request(ctx)
+
+		s.mu.Lock()
+		s.fetch = nil
+		if f.err == nil {
+			s.token, s.expiry = f.token, f.expiry
+			s.refreshAt = time.Time{}
+			if !f.expiry.IsZero() {
+				lifetime := f.expiry.Sub(s.clock.Now())
+				before := s.cfg.RefreshBefore
+				if before <= 0 {
+					before = DefaultOAuth2RefreshBefore
+				}
+				s.refreshAt = f.expiry.Add(-min(before, lifetime/2))
+			}
+		}
+		s.mu.Unlock()
+		close(f.done)
+	}()
+	return f
+}
+
+// request sends a client credentials token request.
+func (s *OAuth2TokenSource) request(ctx context.Context) (string, time.Time, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(s.cfg.Scopes) > 0 {
+		form.Set("scope", strings.Join(s.cfg.Scopes, " "))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	// RFC 6749 section 2.3.1 encodes the credentials before Basic auth.
+	req.SetBasicAuth(url.QueryEscape(s.cfg.ClientID), url.QueryEscape(s.cfg.ClientSecret))
+
+	httpClient := s.cfg.Client
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	requested := s.clock.Now()
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		AccessToken      string `json:"access_token"`
+		TokenType        string `json:"token_type"`
+		ExpiresIn        int64  `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	decodeErr := httpx.DecodeJSON(resp.Body, &body, oauth2MaxBody)
+	if resp.StatusCode != http.StatusOK {
+		return "", time.Time{}, &OAuth2Error{StatusCode: resp.StatusCode, Code: body.Error, Description: body.ErrorDescription}
+	}
+	if decodeErr != nil {
+		return "", time.Time{}, decodeErr
+	}
+	if body.AccessToken == "" {
+		return "", time.Time{}, errors.New("token response has no access_token")
+	}
+	if body.TokenType != "" && !strings.EqualFold(body.TokenType, "Bearer") {
+		return "", time.Time{}, fmt.Errorf("unsupported token type %q", body.TokenType)
+	}
+
+	var expiry time.Time
+	if body.ExpiresIn > 0 {
+		// Count the lifetime from the request, to err on the early side.
+		expiry = requested.Add(time.Duration(body.ExpiresIn) * time.Second)
+	}
+	return body.AccessToken, expiry, nil
+}
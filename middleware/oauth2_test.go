@@ -0,0 +1,246 @@
+package middleware_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/client"
+	"github.com/Vkanhan/go-auth-middleware-http-client/middleware"
+)
+
+// tokenReply is a token endpoint response granting token for expiresIn
+// seconds.
+func tokenReply(token string, expiresIn int) reply {
+	return reply{status: 200, body: fmt.Sprintf(`{"access_token":%q,"token_type":"bearer","expires_in":%d}`, token, expiresIn)}
+}
+
+// oauth2Step is a call to Token in a TestOAuth2TokenSource case.
+type oauth2Step struct {
+	advance time.Duration
+	token   string // Token returned.
+	fetches int    // Token requests made once the step settled.
+}
+
+func TestOAuth2TokenSource(t *testing.T) {
+	tests := []struct {
+		name          string
+		refreshBefore time.Duration
+		replies       []reply
+		steps         []oauth2Step
+	}{
+		{
+			name:    "cached",
+			replies: []reply{tokenReply("t1", 3600), tokenReply("t2", 3600)},
+			steps: []oauth2Step{
+				{token: "t1", fetches: 1},
+				{advance: 30 * time.Minute, token: "t1", fetches: 1},
+			},
+		},
+		{
+			name:    "refreshed in the background",
+			replies: []reply{tokenReply("t1", 3600), tokenReply("t2", 3600)},
+			steps: []oauth2Step{
+				{token: "t1", fetches: 1},
+				{advance: 59 * time.Minute, token: "t1", fetches: 2},
+				{token: "t2", fetches: 2},
+			},
+		},
+		{
+			name:          "refresh before",
+			refreshBefore: 10 * time.Minute,
+			replies:       []reply{tokenReply("t1", 3600), tokenReply("t2", 3600)},
+			steps: []oauth2Step{
+				{token: "t1", fetches: 1},
+				{advance: 49 * time.Minute, token: "t1", fetches: 1},
+				{advance: time.Minute, token: "t1", fetches: 2},
+				{token: "t2", fetches: 2},
+			},
+		},
+		{
+			name:    "short lifetime refreshes at half",
+			replies: []reply{tokenReply("t1", 60), tokenReply("t2", 60)},
+			steps: []oauth2Step{
+				{token: "t1", fetches: 1},
+				{advance: 29 * time.Second, token: "t1", fetches: 1},
+				{advance: time.Second, token: "t1", fetches: 2},
+				{token: "t2", fetches: 2},
+			},
+		},
+		{
+			name:    "expired",
+			replies: []reply{tokenReply("t1", 3600), tokenReply("t2", 3600)},
+			steps: []oauth2Step{
+				{token: "t1", fetches: 1},
+				{advance: time.Hour, token: "t2", fetches: 2},
+			},
+		},
+		{
+			name:    "no expiry",
+			replies: []reply{tokenReply("t1", 0), tokenReply("t2", 0)},
+			steps: []oauth2Step{
+				{token: "t1", fetches: 1},
+				{advance: 1000 * time.Hour, token: "t1", fetches: 1},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := client.NewFakeClock(epoch)
+			endpoint := newStub(tt.replies...)
+			source := middleware.NewOAuth2TokenSource(middleware.OAuth2Config{
+				TokenURL:      "https://auth.example.com/token",
+				Client:        endpoint,
+				RefreshBefore: tt.refreshBefore,
+				Clock:         clock,
+			})
+
+			for i, step := range tt.steps {
+				clock.Advance(step.advance)
+				token, err := source.Token(context.Background())
+				if err != nil {
+					t.Fatalf("step %d: %v", i, err)
+				}
+				if token != step.token {
+					t.Errorf("step %d: token = %q, want %q", i, token, step.token)
+				}
+				waitForCalls(t, endpoint, step.fetches)
+				if endpoint.calls() != step.fetches {
+					t.Errorf("step %d: fetches = %d, want %d", i, endpoint.calls(), step.fetches)
+				}
+			}
+		})
+	}
+}
+
+func TestOAuth2TokenSourceRequest(t *testing.T) {
+	var form url.Values
+	var user, password string
+	endpoint := client.HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+		body, _ := io.ReadAll(req.Body)
+		form, _ = url.ParseQuery(string(body))
+		user, password, _ = req.BasicAuth()
+		return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(`{"access_token":"t1"}`))}, nil
+	})
+	source := middleware.NewOAuth2TokenSource(middleware.OAuth2Config{
+		TokenURL:     "https://auth.example.com/token",
+		ClientID:     "id:1",
+		ClientSecret: "s&cret",
+		Scopes:       []string{"read", "write"},
+		Client:       endpoint,
+		Clock:        client.NewFakeClock(epoch),
+	})
+	if _, err := source.Token(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if form.Get("grant_type") != "client_credentials" || form.Get("scope") != "read write" {
+		t.Errorf("form = %v", form)
+	}
+	if user != "id%3A1" || password != "s%26cret" {
+		t.Errorf("basic auth = %q, %q; want the credentials form-encoded", user, password)
+	}
+}
+
+func TestOAuth2TokenSourceErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply reply
+		want  string
+	}{
+		{"error response", reply{status: 400, body: `{"error":"invalid_client","error_description":"unknown client"}`}, "token endpoint returned 400: invalid_client: unknown client"},
+		{"no token", reply{status: 200, body: `{"token_type":"bearer"}`}, "token response has no access_token"},
+		{"token type", reply{status: 200, body: `{"access_token":"t1","token_type":"mac"}`}, `unsupported token type "mac"`},
+		{"transport", reply{err: errors.New("connection refused")}, "token request failed: connection refused"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := middleware.NewOAuth2TokenSource(middleware.OAuth2Config{
+				TokenURL: "https://auth.example.com/token",
+				Client:   newStub(tt.reply),
+				Clock:    client.NewFakeClock(epoch),
+			})
+			_, err := source.Token(context.Background())
+			if err == nil || err.Error() != tt.want {
+				t.Fatalf("err = %v, want %q", err, tt.want)
+			}
+			var oauthErr *middleware.OAuth2Error
+			if errors.As(err, &oauthErr) != (tt.reply.status == 400) {
+				t.Errorf("err is %T", err)
+			}
+		})
+	}
+}
+
+func TestOAuth2TokenSourceSharesFetch(t *testing.T) {
+	release := make(chan struct{})
+	endpoint := newStub(tokenReply("t1", 3600))
+	source := middleware.NewOAuth2TokenSource(middleware.OAuth2Config{
+		TokenURL: "https://auth.example.com/token",
+		Client: client.HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+			<-release
+			return endpoint.Do(req)
+		}),
+		Clock: client.NewFakeClock(epoch),
+	})
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if token, err := source.Token(context.Background()); err != nil || token != "t1" {
+				t.Errorf("Token() = %q, %v", token, err)
+			}
+		}()
+	}
+	close(release)
+	wg.Wait()
+	if endpoint.calls() != 1 {
+		t.Errorf("fetches = %d, want 1", endpoint.calls())
+	}
+}
+
+func TestOAuth2Middleware(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    io.Reader
+		replies []reply
+		status  int
+		auth    []string // Authorization of each request sent.
+	}{
+		{"authorized", nil, []reply{{status: 200}}, 200, []string{"Bearer t1"}},
+		{"retried with a new token", nil, []reply{{status: 401}, {status: 200}}, 200, []string{"Bearer t1", "Bearer t2"}},
+		{"retried once", nil, []reply{{status: 401}}, 401, []string{"Bearer t1", "Bearer t2"}},
+		{"replayable body", strings.NewReader("data"), []reply{{status: 401}, {status: 200}}, 200, []string{"Bearer t1", "Bearer t2"}},
+		{"one-shot body", io.NopCloser(strings.NewReader("data")), []reply{{status: 401}, {status: 200}}, 401, []string{"Bearer t1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := middleware.NewOAuth2TokenSource(middleware.OAuth2Config{
+				TokenURL: "https://auth.example.com/token",
+				Client:   newStub(tokenReply("t1", 3600), tokenReply("t2", 3600)),
+				Clock:    client.NewFakeClock(epoch),
+			})
+			next := newStub(tt.replies...)
+			resp, _ := send(t, source.Middleware(), next, newRequest(t, http.MethodPost, "https://api.example.com/", tt.body))
+
+			if resp.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+			var auth []string
+			for _, req := range next.requests {
+				auth = append(auth, req.Header.Get("Authorization"))
+			}
+			if fmt.Sprint(auth) != fmt.Sprint(tt.auth) {
+				t.Errorf("Authorization = %q, want %q", auth, tt.auth)
+			}
+		})
+	}
+}
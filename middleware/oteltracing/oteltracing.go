@@ -0,0 +1,91 @@
+// Package oteltracing traces requests with OpenTelemetry, as the
+// OpenTelemetry counterpart of middleware.TracingMiddleware.
+package oteltracing
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/client"
+	"github.com/Vkanhan/go-auth-middleware-http-client/middleware"
+)
+
+// tracerName is the instrumentation scope of the spans.
+const tracerName = "github.com/Vkanhan/go-auth-middleware-http-client/middleware/oteltracing"
+
+// Config configures Middleware.
+type Config struct {
+	// TracerProvider starts the spans; nil uses otel.GetTracerProvider.
+	TracerProvider trace.TracerProvider
+	// Propagator injects the span into the request headers; nil uses the
+	// W3C trace context and baggage.
+	Propagator propagation.TextMapPropagator
+}
+
+// Middleware starts a client span for every request through the tracer
+// provider, as a child of the OpenTelemetry span of the request context,
+// and injects it into the request headers. Like TracingMiddleware, it ends
+// the span when the response headers arrive, and the middlewares it wraps
+// find the span both through trace.SpanContextFromContext and
+// middleware.SpanContextFromContext.
+func Middleware(cfg Config) client.Middleware {
+	provider := cfg.TracerProvider
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	propagator := cfg.Propagator
+	if propagator == nil {
+		propagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+	}
+	tracer := provider.Tracer(tracerName)
+
+	return func(next client.HTTPClient) client.HTTPClient {
+		return client.HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+			method := req.Method
+			if method == "" {
+				method = http.MethodGet
+			}
+			ctx, span := tracer.Start(req.Context(), "HTTP "+method,
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(
+					attribute.String("http.request.method", method),
+					attribute.String("url.full", req.URL.Redacted()),
+					attribute.String("server.address", req.URL.Hostname()),
+				),
+			)
+			defer span.End()
+
+			ctx = middleware.ContextWithSpanContext(ctx, spanContext(span.SpanContext()))
+			req = req.Clone(ctx)
+			propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+			resp, err := next.Do(req)
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+				return resp, err
+			}
+			span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+			if resp.StatusCode >= 500 {
+				span.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
+			}
+			return resp, nil
+		})
+	}
+}
+
+// spanContext converts an OpenTelemetry span context to the one of the
+// middleware package.
+func spanContext(sc trace.SpanContext) middleware.SpanContext {
+	return middleware.SpanContext{
+		TraceID:    sc.TraceID(),
+		SpanID:     sc.SpanID(),
+		Sampled:    sc.IsSampled(),
+		TraceState: sc.TraceState().String(),
+	}
+}
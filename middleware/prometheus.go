@@ -0,0 +1,200 @@
+package middleware
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultHistogramBuckets are the upper bounds of the histogram buckets of
+// PrometheusMetrics, suited to latencies in seconds.
+var DefaultHistogramBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// PrometheusMetrics is a client.Metrics that keeps the measurements in
+// memory and serves them in the Prometheus text exposition format, for a
+// scraper to collect. The zero value is ready to use.
+type PrometheusMetrics struct {
+	// Buckets are the histogram upper bounds, in increasing order; nil means
+	// DefaultHistogramBuckets. They must not change once observations start.
+	Buckets []float64
+
+	mu       sync.Mutex
+	families map[string]*metricFamily
+}
+
+// metricFamily holds the series of one metric name.
+type metricFamily struct {
+	kind   string
+	series map[string]*metricSeries
+}
+
+// metricSeries holds the value of one label set.
+type metricSeries struct {
+	labels []string
+	value  float64
+	// counts are the per-bucket counts of a histogram, not cumulative.
+	counts []uint64
+	count  uint64
+}
+
+// AddCounter implements client.Metrics.
+func (m *PrometheusMetrics) AddCounter(name string, delta float64, labels ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s := m.series("counter", name, labels); s != nil {
+		s.value += delta
+	}
+}
+
+// SetGauge implements client.Metrics.
+func (m *PrometheusMetrics) SetGauge(name string, value float64, labels ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s := m.series("gauge", name, labels); s != nil {
+		s.value = value
+	}
+}
+
+// Observe implements client.Metrics.
+func (m *PrometheusMetrics) Observe(name string, value float64, labels ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.series("histogram", name, labels)
+	if s == nil {
+		return
+	}
+	buckets := m.buckets()
+	if s.counts == nil {
+		s.counts = make([]uint64, len(buckets)+1)
+	}
+	i, _ := slices.BinarySearch(buckets, value)
+	s.counts[i]++
+	s.count++
+	s.value += value
+}
+
+// buckets returns the histogram upper bounds.
+func (m *PrometheusMetrics) buckets() []float64 {
+	if m.Buckets == nil {
+		return DefaultHistogramBuckets
+	}
+	return m.Buckets
+}
+
+// series returns the series of name with labels, creating it, or nil when
+// name is already used by a metric of another kind. The caller holds mu.
+func (m *PrometheusMetrics) series(kind, name string, labels []string) *metricSeries {
+	if m.families == nil {
+		m.families = make(map[string]*metricFamily)
+	}
+	family, ok := m.families[name]
+	if !ok {
+		family = &metricFamily{kind: kind, series: make(map[string]*metricSeries)}
+		m.families[name] = family
+	}
+	if family.kind != kind {
+		return nil
+	}
+	labels = labels[:len(labels)&^1]
+	key := strings.Join(labels, "\xff")
+	s, ok := family.series[key]
+	if !ok {
+		s = &metricSeries{labels: slices.Clone(labels)}
+		family.series[key] = s
+	}
+	return s
+}
+
+// ServeHTTP serves the metrics in the text exposition format.
+func (m *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+// WriteTo writes the metrics in the text exposition format, sorted by name
+// and labels.
+func (m *PrometheusMetrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	names := make([]string, 0, len(m.families))
+	for name := range m.families {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		family := m.families[name]
+		fmt.Fprintf(bw, "# TYPE %s %s\n", name, family.kind)
+		keys := make([]string, 0, len(family.series))
+		for key := range family.series {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			s := family.series[key]
+			if family.kind != "histogram" {
+				fmt.Fprintf(bw, "%s%s %s\n", name, formatLabels(s.labels), formatFloat(s.value))
+				continue
+			}
+			var cumulative uint64
+			for i, bound := range m.buckets() {
+				cumulative += s.counts[i]
+				fmt.Fprintf(bw, "%s_bucket%s %d\n", name, formatLabels(s.labels, "le", formatFloat(bound)), cumulative)
+			}
+			fmt.Fprintf(bw, "%s_bucket%s %d\n", name, formatLabels(s.labels, "le", "+Inf"), s.count)
+			fmt.Fprintf(bw, "%s_sum%s %s\n", name, formatLabels(s.labels), formatFloat(s.value))
+			fmt.Fprintf(bw, "%s_count%s %d\n", name, formatLabels(s.labels), s.count)
+		}
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// formatLabels formats name, value pairs as a Prometheus label set.
+func formatLabels(labels []string, extra ...string) string {
+	labels = append(labels[:len(labels):len(labels)], extra...)
+	if len(labels) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(labels[i])
+		b.WriteString(`="`)
+		b.WriteString(labelEscaper.Replace(labels[i+1]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// labelEscaper escapes label values for the text exposition format.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatFloat formats v as the text exposition format expects.
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+// Write writes p to w.
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
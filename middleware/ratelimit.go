@@ -0,0 +1,167 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/client"
+	"github.com/Vkanhan/go-auth-middleware-http-client/internal/httpx"
+)
+
+// maxRateLimitHosts bounds the per-host buckets kept. Once it is reached,
+// full buckets are dropped, or the least recently used one if none is.
+const maxRateLimitHosts = 1024
+
+// RateLimit configures RateLimitMiddleware.
+type RateLimit struct {
+	// RequestsPerSecond is the sustained rate; zero means unlimited.
+	RequestsPerSecond float64
+	// Burst is how many requests may go out at once after a quiet spell;
+	// zero means one.
+	Burst int
+	// PerHost gives every host its own bucket instead of sharing one.
+	PerHost bool
+	// OnWait, if set, is called with how long each request waited for the
+	// limiter, zero included, before it is sent.
+	OnWait func(req *http.Request, wait time.Duration)
+	// Clock paces the requests; nil uses client.SystemClock.
+	Clock client.Clock
+}
+
+// RateLimitMiddleware holds requests back to the configured rate. Requests
+// block until the bucket lets them through rather than fail; they fail
+// with the context error if their context is done first, right away when
+// the wait would outlast the context deadline.
+func RateLimitMiddleware(limit RateLimit) client.Middleware {
+	if limit.RequestsPerSecond <= 0 {
+		return func(next client.HTTPClient) client.HTTPClient { return next }
+	}
+	clock := clockOrSystem(limit.Clock)
+	burst := max(limit.Burst, 1)
+	shared := newRequestLimiter(limit.RequestsPerSecond, burst, clock)
+
+	var mu sync.Mutex
+	var uses uint64
+	hosts := make(map[string]*requestLimiter)
+	limiterFor := func(host string) *requestLimiter {
+		mu.Lock()
+		defer mu.Unlock()
+		l, ok := hosts[host]
+		if !ok {
+			if len(hosts) >= maxRateLimitHosts {
+				var oldest string
+				for h, other := range hosts {
+					if other.full() {
+						delete(hosts, h)
+					} else if oldest == "" || other.used < hosts[oldest].used {
+						oldest = h
+					}
+				}
+				if len(hosts) >= maxRateLimitHosts {
+					delete(hosts, oldest)
+				}
+			}
+			l = newRequestLimiter(limit.RequestsPerSecond, burst, clock)
+			hosts[host] = l
+		}
+		uses++
+		l.used = uses
+		return l
+	}
+
+	return func(next client.HTTPClient) client.HTTPClient {
+		return client.HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+			l := shared
+			if limit.PerHost {
+				l = limiterFor(req.URL.Host)
+			}
+			wait, err := l.wait(req.Context())
+			if err != nil {
+				httpx.CloseBody(req)
+				return nil, fmt.Errorf("rate limit: %w", err)
+			}
+			if limit.OnWait != nil {
+				limit.OnWait(req, wait)
+			}
+			return next.Do(req)
+		})
+	}
+}
+
+// requestLimiter is a token bucket counting requests.
+type requestLimiter struct {
+	clock client.Clock
+	// used orders the per-host buckets by last use, under the lock of their
+	// map.
+	used   uint64
+	mu     sync.Mutex
+	rate   float64
+	burst  int
+	tokens float64
+	last   time.Time
+}
+
+// newRequestLimiter creates a full bucket of burst requests refilling at
+// rate per second.
+func newRequestLimiter(rate float64, burst int, clock client.Clock) *requestLimiter {
+	return &requestLimiter{
+		clock:  clock,
+		rate:   rate,
+		burst:  burst,
+		tokens: float64(burst),
+		last:   clock.Now(),
+	}
+}
+
+// refill adds the tokens earned since the last call. The caller holds mu.
+func (l *requestLimiter) refill() {
+	now := l.clock.Now()
+	l.tokens = min(l.tokens+now.Sub(l.last).Seconds()*l.rate, float64(l.burst))
+	l.last = now
+}
+
+// wait takes a token, blocking until it is available or ctx is done, and
+// returns how long it blocked. A request that gives up returns its token.
+func (l *requestLimiter) wait(ctx context.Context) (time.Duration, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	l.mu.Lock()
+	l.refill()
+	// Take the token right away and sleep off the debt, so that concurrent
+	// requests queue up behind each other.
+	l.tokens--
+	delay := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return 0, nil
+	}
+	var err error
+	if deadline, ok := ctx.Deadline(); ok && l.clock.Now().Add(delay).After(deadline) {
+		err = fmt.Errorf("wait of %v would pass the deadline: %w", delay, context.DeadlineExceeded)
+	} else {
+		err = l.clock.Sleep(ctx, delay)
+	}
+	if err != nil {
+		l.mu.Lock()
+		l.refill()
+		l.tokens = min(l.tokens+1, float64(l.burst))
+		l.mu.Unlock()
+		return 0, err
+	}
+	return delay, nil
+}
+
+// full reports whether the bucket refilled completely, so dropping it
+// changes nothing.
+func (l *requestLimiter) full() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill()
+	return l.tokens >= float64(l.burst)
+}
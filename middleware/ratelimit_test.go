@@ -0,0 +1,208 @@
+package middleware_test
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/client"
+	"github.com/Vkanhan/go-auth-middleware-http-client/middleware"
+)
+
+// rateStep is a request of a TestRateLimitMiddleware case.
+type rateStep struct {
+	advance time.Duration
+	host    string
+	wait    time.Duration // How long the limiter should hold it.
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit middleware.RateLimit
+		steps []rateStep
+	}{
+		{
+			name:  "burst then rate",
+			limit: middleware.RateLimit{RequestsPerSecond: 10, Burst: 2},
+			steps: []rateStep{
+				{}, {},
+				{wait: 100 * time.Millisecond},
+				{wait: 100 * time.Millisecond},
+			},
+		},
+		{
+			name:  "burst defaults to one",
+			limit: middleware.RateLimit{RequestsPerSecond: 2},
+			steps: []rateStep{
+				{},
+				{wait: 500 * time.Millisecond},
+			},
+		},
+		{
+			name:  "refills while idle",
+			limit: middleware.RateLimit{RequestsPerSecond: 10, Burst: 2},
+			steps: []rateStep{
+				{}, {},
+				{advance: 50 * time.Millisecond, wait: 50 * time.Millisecond},
+				{advance: time.Second}, {},
+				{wait: 100 * time.Millisecond},
+			},
+		},
+		{
+			name:  "refill capped at burst",
+			limit: middleware.RateLimit{RequestsPerSecond: 10, Burst: 1},
+			steps: []rateStep{
+				{advance: time.Hour}, {wait: 100 * time.Millisecond},
+			},
+		},
+		{
+			name:  "shared across hosts",
+			limit: middleware.RateLimit{RequestsPerSecond: 10},
+			steps: []rateStep{
+				{host: "a.example.com"},
+				{host: "b.example.com", wait: 100 * time.Millisecond},
+			},
+		},
+		{
+			name:  "per host",
+			limit: middleware.RateLimit{RequestsPerSecond: 10, PerHost: true},
+			steps: []rateStep{
+				{host: "a.example.com"},
+				{host: "b.example.com"},
+				{host: "a.example.com", wait: 100 * time.Millisecond},
+			},
+		},
+		{
+			name:  "unlimited",
+			limit: middleware.RateLimit{},
+			steps: []rateStep{{}, {}, {}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := client.NewFakeClock(epoch)
+			limit := tt.limit
+			limit.Clock = clock
+			var waits []time.Duration
+			limit.OnWait = func(req *http.Request, wait time.Duration) { waits = append(waits, wait) }
+			next := newStub(reply{status: 200})
+			m := middleware.RateLimitMiddleware(limit)
+
+			for i, step := range tt.steps {
+				clock.Advance(step.advance)
+				req := newRequest(t, http.MethodGet, "http://"+cmp.Or(step.host, "example.com")+"/", nil)
+				done := make(chan error, 1)
+				go func() {
+					_, err := m(next).Do(req)
+					done <- err
+				}()
+				if step.wait > 0 {
+					clock.WaitForSleepers(1)
+					if next.calls() != i {
+						t.Fatalf("step %d: sent before waiting", i)
+					}
+					clock.Advance(step.wait)
+				}
+				if err := <-done; err != nil {
+					t.Fatalf("step %d: %v", i, err)
+				}
+				if limit.RequestsPerSecond > 0 && waits[i] != step.wait {
+					t.Errorf("step %d: waited %v, want %v", i, waits[i], step.wait)
+				}
+			}
+			if next.calls() != len(tt.steps) {
+				t.Errorf("calls = %d, want %d", next.calls(), len(tt.steps))
+			}
+		})
+	}
+}
+
+func TestRateLimitMiddlewareDeadline(t *testing.T) {
+	// The deadline is in real time, so the clock starts there.
+	clock := client.NewFakeClock(time.Now())
+	next := newStub(reply{status: 200})
+	m := middleware.RateLimitMiddleware(middleware.RateLimit{RequestsPerSecond: 1, Clock: clock})
+	send(t, m, next, newRequest(t, http.MethodGet, "http://example.com/", nil))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := m(next).Do(newRequest(t, http.MethodGet, "http://example.com/", nil).WithContext(ctx))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want a deadline error", err)
+	}
+	if clock.Sleepers() != 0 || next.calls() != 1 {
+		t.Errorf("sleepers = %d, calls = %d; want the request refused at once", clock.Sleepers(), next.calls())
+	}
+
+	// The refused request gave its token back.
+	clock.Advance(time.Second)
+	sendNow(t, m, next)
+}
+
+// sendNow sends a request through m that must not wait for the limiter,
+// which refuses it at once rather than block on the fake clock.
+func sendNow(t *testing.T, m client.Middleware, next client.HTTPClient) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	send(t, m, next, newRequest(t, http.MethodGet, "http://example.com/", nil).WithContext(ctx))
+}
+
+func TestRateLimitMiddlewareCancel(t *testing.T) {
+	clock := client.NewFakeClock(time.Now())
+	next := newStub(reply{status: 200})
+	m := middleware.RateLimitMiddleware(middleware.RateLimit{RequestsPerSecond: 1, Clock: clock})
+	send(t, m, next, newRequest(t, http.MethodGet, "http://example.com/", nil))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := m(next).Do(newRequest(t, http.MethodGet, "http://example.com/", nil).WithContext(ctx))
+		done <- err
+	}()
+	clock.WaitForSleepers(1)
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+
+	// The cancelled request gave its token back.
+	clock.Advance(time.Second)
+	sendNow(t, m, next)
+}
+
+func TestRateLimitMiddlewareEvictsOldest(t *testing.T) {
+	clock := client.NewFakeClock(time.Now())
+	next := newStub(reply{status: 200})
+	m := middleware.RateLimitMiddleware(middleware.RateLimit{RequestsPerSecond: 1, Burst: 2, PerHost: true, Clock: clock})
+	get := func(host string) error {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		resp, err := m(next).Do(newRequest(t, http.MethodGet, "http://"+host+"/", nil).WithContext(ctx))
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	// No bucket is full, and a was used after b.
+	for _, host := range []string{"b.example.com", "b.example.com", "a.example.com", "a.example.com"} {
+		get(host)
+	}
+	for i := range 1022 {
+		get(fmt.Sprintf("h%d.example.com", i))
+	}
+	get("c.example.com")
+
+	if err := get("a.example.com"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("a.example.com: err = %v, want its empty bucket kept", err)
+	}
+	if err := get("b.example.com"); err != nil {
+		t.Errorf("b.example.com: err = %v, want its bucket evicted", err)
+	}
+}
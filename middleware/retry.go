@@ -0,0 +1,236 @@
+package middleware
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/client"
+	"github.com/Vkanhan/go-auth-middleware-http-client/internal/httpx"
+)
+
+// Defaults of RetryPolicy.
+const (
+	DefaultRetryMaxAttempts = 3
+	DefaultRetryBaseDelay   = 100 * time.Millisecond
+	DefaultRetryMaxDelay    = 10 * time.Second
+)
+
+// defaultRetryStatuses are the transient statuses retried by default.
+var defaultRetryStatuses = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// RetryPolicy configures RetryMiddleware.
+type RetryPolicy struct {
+	// MaxAttempts bounds the attempts, the first included; zero means
+	// DefaultRetryMaxAttempts.
+	MaxAttempts int
+	// BaseDelay is the backoff before the first retry, doubling on each
+	// one up to MaxDelay; zero means DefaultRetryBaseDelay and
+	// DefaultRetryMaxDelay. The backoff is drawn at random between zero
+	// and that bound, for full jitter.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Statuses lists the retried status codes; nil means 429, 502, 503
+	// and 504. Retry-After is honored on these responses, and retrying
+	// stops when it asks for a wait longer than MaxDelay.
+	Statuses []int
+	// Idempotent reports whether a request may be sent twice; nil allows
+	// the idempotent methods of RFC 9110 and requests carrying an
+	// Idempotency-Key header.
+	Idempotent func(*http.Request) bool
+	// Clock paces the backoff; nil uses client.SystemClock.
+	Clock client.Clock
+}
+
+// RetryError is returned when every attempt failed with an error. Attempts
+// ending with a retryable status return the response instead; see
+// RetryAttempts.
+type RetryError struct {
+	Attempts int
+	Err      error
+}
+
+// Error implements the error interface.
+func (e *RetryError) Error() string {
+	if e.Attempts == 1 {
+		return fmt.Sprintf("request failed after 1 attempt: %v", e.Err)
+	}
+	return fmt.Sprintf("request failed after %d attempts: %v", e.Attempts, e.Err)
+}
+
+// Unwrap returns the error of the last attempt.
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+// RetryMiddleware retries idempotent requests that fail with a network
+// error or a transient status, with exponential backoff and jitter. Bodies
+// are rewound with GetBody, so requests with a body but no GetBody are sent
+// once. Retrying stops early when the backoff would pass the deadline of
+// the request context. When retries run out on an error, a *RetryError
+// counting the attempts is returned. When they run out on a status, the
+// last response is returned with a nil error, as the status is the
+// caller's to handle; the attempt count is then only available through
+// RetryAttempts, not in an error.
+func RetryMiddleware(policy RetryPolicy) client.Middleware {
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = DefaultRetryMaxAttempts
+	}
+	if policy.BaseDelay <= 0 {
+		policy.BaseDelay = DefaultRetryBaseDelay
+	}
+	if policy.MaxDelay <= 0 {
+		policy.MaxDelay = DefaultRetryMaxDelay
+	}
+	if policy.Statuses == nil {
+		policy.Statuses = defaultRetryStatuses
+	}
+	if policy.Idempotent == nil {
+		policy.Idempotent = idempotentRequest
+	}
+	clock := clockOrSystem(policy.Clock)
+
+	return func(next client.HTTPClient) client.HTTPClient {
+		return client.HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+			replayable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+			if !replayable || !policy.Idempotent(req) {
+				resp, err := next.Do(req)
+				return withRetryAttempts(req, resp, 1), err
+			}
+
+			ctx := req.Context()
+			for attempt := 1; ; attempt++ {
+				resp, err := next.Do(req)
+				if attempt >= policy.MaxAttempts || !policy.retryable(resp, err) || ctx.Err() != nil {
+					return policy.give(req, resp, err, attempt)
+				}
+
+				wait := policy.backoff(attempt)
+				if resp != nil {
+					if after, ok := httpx.ParseRetryAfter(resp.Header, clock.Now()); ok {
+						if after > policy.MaxDelay {
+							return policy.give(req, resp, err, attempt)
+						}
+						wait = after
+					}
+				}
+				// The deadline is in real time, whatever the clock.
+				if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+					return policy.give(req, resp, err, attempt)
+				}
+
+				retryReq, rewindErr := httpx.RewindBody(req)
+				if rewindErr != nil {
+					return policy.give(req, resp, err, attempt)
+				}
+				if resp != nil {
+					io.Copy(io.Discard, resp.Body)
+					resp.Body.Close()
+				}
+				if err := clock.Sleep(ctx, wait); err != nil {
+					return nil, &RetryError{Attempts: attempt, Err: err}
+				}
+				req = retryReq
+			}
+		})
+	}
+}
+
+// give returns the outcome of the last attempt, with the error wrapped in a
+// *RetryError once the request was retried.
+func (p *RetryPolicy) give(req *http.Request, resp *http.Response, err error, attempts int) (*http.Response, error) {
+	if err != nil {
+		if attempts > 1 {
+			err = &RetryError{Attempts: attempts, Err: err}
+		}
+		return resp, err
+	}
+	return withRetryAttempts(req, resp, attempts), nil
+}
+
+// retryAttemptsKey is the context key of the attempt count of a response.
+type retryAttemptsKey struct{}
+
+// withRetryAttempts records the attempts in the context of the request of
+// resp, req if it has none, where RetryAttempts finds it.
+func withRetryAttempts(req *http.Request, resp *http.Response, attempts int) *http.Response {
+	if resp == nil {
+		return resp
+	}
+	if resp.Request == nil {
+		resp.Request = req
+	}
+	resp.Request = resp.Request.WithContext(context.WithValue(resp.Request.Context(), retryAttemptsKey{}, attempts))
+	return resp
+}
+
+// RetryAttempts returns the number of attempts RetryMiddleware made to get
+// resp, the first included, or zero if resp did not come through it.
+func RetryAttempts(resp *http.Response) int {
+	if resp == nil || resp.Request == nil {
+		return 0
+	}
+	attempts, _ := resp.Request.Context().Value(retryAttemptsKey{}).(int)
+	return attempts
+}
+
+// retryable reports whether the outcome of an attempt is worth retrying.
+func (p *RetryPolicy) retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return retryableError(err)
+	}
+	for _, status := range p.Statuses {
+		if resp.StatusCode == status {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns the jittered wait before the retry following attempt.
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	bound := p.BaseDelay
+	for i := 1; i < attempt && bound < p.MaxDelay; i++ {
+		bound *= 2
+	}
+	bound = min(bound, p.MaxDelay)
+	return time.Duration(rand.Int64N(int64(bound) + 1))
+}
+
+// retryableError reports whether err may be transient. Cancellation,
+// certificate failures and refusals by the client itself are final.
+func retryableError(err error) bool {
+	var (
+		certErr   *tls.CertificateVerificationError
+		unknownCA x509.UnknownAuthorityError
+		hostErr   x509.HostnameError
+		policyErr *client.PolicyError
+	)
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return false
+	case errors.As(err, &certErr), errors.As(err, &unknownCA), errors.As(err, &hostErr):
+		return false
+	case errors.As(err, &policyErr), errors.Is(err, client.ErrForbiddenAddress), errors.Is(err, ErrCircuitOpen):
+		return false
+	case errors.Is(err, client.ErrTooManyRedirects), errors.Is(err, client.ErrCrossHostRedirect), errors.Is(err, client.ErrRedirectDowngrade):
+		return false
+	}
+	return true
+}
+
+// idempotentRequest reports whether req may be sent more than once.
+func idempotentRequest(req *http.Request) bool {
+	return httpx.IsIdempotent(req.Method) || req.Header.Get("Idempotency-Key") != "" || req.Header.Get("X-Idempotency-Key") != ""
+}
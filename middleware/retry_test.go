@@ -0,0 +1,222 @@
+package middleware_test
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/client"
+	"github.com/Vkanhan/go-auth-middleware-http-client/middleware"
+)
+
+func TestRetryMiddleware(t *testing.T) {
+	errReset := errors.New("connection reset")
+	tests := []struct {
+		name     string
+		method   string
+		header   http.Header
+		replies  []reply
+		calls    int
+		status   int
+		attempts int
+	}{
+		{
+			name:     "success",
+			replies:  []reply{{status: 200}},
+			calls:    1,
+			status:   200,
+			attempts: 1,
+		},
+		{
+			name:     "transient status then success",
+			replies:  []reply{{status: 503}, {status: 502}, {status: 200}},
+			calls:    3,
+			status:   200,
+			attempts: 3,
+		},
+		{
+			name:     "error then success",
+			replies:  []reply{{err: errReset}, {status: 200}},
+			calls:    2,
+			status:   200,
+			attempts: 2,
+		},
+		{
+			name:     "retries run out on a status",
+			replies:  []reply{{status: 503}},
+			calls:    3,
+			status:   503,
+			attempts: 3,
+		},
+		{
+			name:     "permanent status",
+			replies:  []reply{{status: 500}},
+			calls:    1,
+			status:   500,
+			attempts: 1,
+		},
+		{
+			name:     "post is not retried",
+			method:   http.MethodPost,
+			replies:  []reply{{status: 503}},
+			calls:    1,
+			status:   503,
+			attempts: 1,
+		},
+		{
+			name:     "post with an idempotency key",
+			method:   http.MethodPost,
+			header:   http.Header{"Idempotency-Key": {"k"}},
+			replies:  []reply{{status: 503}, {status: 200}},
+			calls:    2,
+			status:   200,
+			attempts: 2,
+		},
+		{
+			name:     "retry-after beyond the max delay",
+			replies:  []reply{{status: 429, header: http.Header{"Retry-After": {"86400"}}}, {status: 200}},
+			calls:    1,
+			status:   429,
+			attempts: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := newStub(tt.replies...)
+			m := middleware.RetryMiddleware(middleware.RetryPolicy{Clock: newStepClock()})
+			req := newRequest(t, cmp.Or(tt.method, http.MethodGet), "http://example.com/", nil)
+			for k, v := range tt.header {
+				req.Header[k] = v
+			}
+			resp, _ := send(t, m, next, req)
+			if resp.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+			if next.calls() != tt.calls {
+				t.Errorf("calls = %d, want %d", next.calls(), tt.calls)
+			}
+			if got := middleware.RetryAttempts(resp); got != tt.attempts {
+				t.Errorf("RetryAttempts = %d, want %d", got, tt.attempts)
+			}
+		})
+	}
+}
+
+func TestRetryMiddlewareError(t *testing.T) {
+	errReset := errors.New("connection reset")
+	next := newStub(reply{err: errReset})
+	m := middleware.RetryMiddleware(middleware.RetryPolicy{MaxAttempts: 4, Clock: newStepClock()})
+	_, err := m(next).Do(newRequest(t, http.MethodGet, "http://example.com/", nil))
+
+	var retryErr *middleware.RetryError
+	if !errors.As(err, &retryErr) || retryErr.Attempts != 4 {
+		t.Fatalf("err = %v, want a *RetryError after 4 attempts", err)
+	}
+	if !errors.Is(err, errReset) {
+		t.Errorf("err = %v, want it to wrap %v", err, errReset)
+	}
+}
+
+func TestRetryMiddlewareFinalErrors(t *testing.T) {
+	for _, err := range []error{context.Canceled, middleware.ErrCircuitOpen, client.ErrTooManyRedirects} {
+		next := newStub(reply{err: err})
+		m := middleware.RetryMiddleware(middleware.RetryPolicy{Clock: newStepClock()})
+		m(next).Do(newRequest(t, http.MethodGet, "http://example.com/", nil))
+		if next.calls() != 1 {
+			t.Errorf("%v: calls = %d, want 1", err, next.calls())
+		}
+	}
+}
+
+func TestRetryMiddlewareBackoff(t *testing.T) {
+	clock := newStepClock()
+	next := newStub(reply{status: 503})
+	m := middleware.RetryMiddleware(middleware.RetryPolicy{
+		MaxAttempts: 6,
+		BaseDelay:   100 * time.Millisecond,
+		MaxDelay:    time.Second,
+		Clock:       clock,
+	})
+	send(t, m, next, newRequest(t, http.MethodGet, "http://example.com/", nil))
+
+	bound := 100 * time.Millisecond
+	for i, wait := range clock.Slept() {
+		if wait < 0 || wait > bound {
+			t.Errorf("wait %d = %v, want within [0, %v]", i, wait, bound)
+		}
+		bound = min(2*bound, time.Second)
+	}
+	if len(clock.Slept()) != 5 {
+		t.Errorf("slept %d times, want 5", len(clock.Slept()))
+	}
+}
+
+func TestRetryMiddlewareRetryAfter(t *testing.T) {
+	clock := newStepClock()
+	next := newStub(reply{status: 503, header: http.Header{"Retry-After": {"2"}}}, reply{status: 200})
+	m := middleware.RetryMiddleware(middleware.RetryPolicy{MaxDelay: 5 * time.Second, Clock: clock})
+	send(t, m, next, newRequest(t, http.MethodGet, "http://example.com/", nil))
+
+	if slept := clock.Slept(); len(slept) != 1 || slept[0] != 2*time.Second {
+		t.Errorf("slept %v, want [2s]", slept)
+	}
+}
+
+func TestRetryMiddlewareDeadline(t *testing.T) {
+	// The deadline is in real time, so it decides alone whatever the clock
+	// says.
+	tests := []struct {
+		name       string
+		clock      time.Time
+		retryAfter string
+		deadline   time.Duration
+		calls      int
+	}{
+		{"too close", time.Now(), "5", time.Second, 1},
+		{"too close with a clock in the past", epoch, "5", time.Second, 1},
+		{"far enough", time.Now(), "1", time.Minute, 2},
+		{"far enough with a clock in the future", time.Now().Add(24 * time.Hour), "1", time.Minute, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := newStub(reply{status: 503, header: http.Header{"Retry-After": {tt.retryAfter}}}, reply{status: 200})
+			m := middleware.RetryMiddleware(middleware.RetryPolicy{Clock: &stepClock{now: tt.clock}})
+			ctx, cancel := context.WithTimeout(context.Background(), tt.deadline)
+			defer cancel()
+			send(t, m, next, newRequest(t, http.MethodGet, "http://example.com/", nil).WithContext(ctx))
+
+			if next.calls() != tt.calls {
+				t.Errorf("calls = %d, want %d", next.calls(), tt.calls)
+			}
+		})
+	}
+}
+
+func TestRetryMiddlewareRewindsBody(t *testing.T) {
+	var bodies []string
+	next := client.HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+		body, _ := io.ReadAll(req.Body)
+		bodies = append(bodies, string(body))
+		status := 503
+		if len(bodies) == 3 {
+			status = 200
+		}
+		return &http.Response{StatusCode: status, Header: http.Header{}, Body: http.NoBody, Request: req}, nil
+	})
+	m := middleware.RetryMiddleware(middleware.RetryPolicy{Clock: newStepClock()})
+	send(t, m, next, newRequest(t, http.MethodPut, "http://example.com/", bytes.NewReader([]byte("payload"))))
+
+	if len(bodies) != 3 {
+		t.Fatalf("sent %d times, want 3", len(bodies))
+	}
+	for i, body := range bodies {
+		if body != "payload" {
+			t.Errorf("attempt %d sent %q, want %q", i+1, body, "payload")
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package middleware_test
+
+import (
+	"testing"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/authtest"
+	"github.com/Vkanhan/go-auth-middleware-http-client/middleware"
+)
+
+// addSigningSeeds adds the generator seeds along with inputs that pick
+// unicode paths, repeated headers and query keys, and empty bodies.
+func addSigningSeeds(f *testing.F) {
+	authtest.AddFuzzSeeds(f)
+	// GET /ü/雪/😀
+	f.Add([]byte{0, 3, 3, 4, 13, 0, 0, 0, 0})
+	// POST /users?a=1&a=a+b with an empty body and X-Custom set three times.
+	f.Add([]byte{1, 1, 2, 2, 0, 1, 0, 2, 1, 0, 4, 0, 1, 1, 2, 0, 7, 2, 1})
+	// PUT / with an empty body.
+	f.Add([]byte{2, 0, 0, 1, 0, 0})
+	// POST / with a binary body.
+	f.Add([]byte{1, 0, 0, 2, 3, 0})
+}
+
+func FuzzHMACSigning(f *testing.F) {
+	addSigningSeeds(f)
+	signer := &middleware.HMACSigner{Key: hmacKey}
+	f.Fuzz(authtest.SigningTarget(func(next authtest.Client) authtest.Client {
+		return middleware.SigningMiddleware(signer)(next)
+	}, authtest.TimestampedHMAC(hmacKey)))
+}
+
+func FuzzSigV4Signing(f *testing.F) {
+	addSigningSeeds(f)
+	f.Fuzz(authtest.SigningTarget(func(next authtest.Client) authtest.Client {
+		return middleware.SigningMiddleware(sigV4Signer)(next)
+	}, authtest.SigV4(sigV4Creds)))
+}
@@ -0,0 +1,114 @@
+package middleware_test
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/authtest"
+	"github.com/Vkanhan/go-auth-middleware-http-client/client"
+	"github.com/Vkanhan/go-auth-middleware-http-client/middleware"
+)
+
+var (
+	hmacKey     = []byte("secret")
+	sigV4Creds  = authtest.SigV4Credentials{AccessKeyID: "AKID", SecretAccessKey: "SECRET", Region: "eu-west-1", Service: "execute-api"}
+	sigV4Signer = &middleware.SigV4Signer{AccessKeyID: "AKID", SecretAccessKey: "SECRET", Region: "eu-west-1", Service: "execute-api", SessionToken: "TOKEN"}
+)
+
+func TestSigningMiddleware(t *testing.T) {
+	clock := client.NewFakeClock(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	signers := []struct {
+		name     string
+		signer   middleware.Signer
+		verifier authtest.Verifier
+	}{
+		{"hmac", &middleware.HMACSigner{Key: hmacKey, Clock: clock}, authtest.TimestampedHMAC(hmacKey)},
+		{"sigv4", &middleware.SigV4Signer{
+			AccessKeyID: "AKID", SecretAccessKey: "SECRET", Region: "eu-west-1", Service: "execute-api", Clock: clock,
+		}, authtest.SigV4(sigV4Creds)},
+	}
+	requests := []struct {
+		name, method, url string
+		body              io.Reader
+	}{
+		{"no body", http.MethodGet, "https://example.com/users?b=2&a=1&a=0", nil},
+		{"replayable body", http.MethodPost, "https://example.com/users", strings.NewReader(`{"name":"gopher"}`)},
+		{"streaming body", http.MethodPut, "https://example.com/files/ü", io.MultiReader(strings.NewReader("part"))},
+	}
+	for _, s := range signers {
+		for _, r := range requests {
+			t.Run(s.name+"/"+r.name, func(t *testing.T) {
+				rec := &authtest.Recorder{}
+				req := newRequest(t, r.method, r.url, r.body)
+				resp, err := middleware.SigningMiddleware(s.signer)(rec).Do(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp.Body.Close()
+
+				sent := rec.Last(t)
+				authtest.AssertSignedWith(t, sent, s.verifier)
+				if r.body != nil && sent.GetBody == nil {
+					t.Error("signed request has no GetBody")
+				}
+			})
+		}
+	}
+}
+
+func TestSigningMiddlewareDetectsTampering(t *testing.T) {
+	rec := &authtest.Recorder{}
+	signer := &middleware.HMACSigner{Key: hmacKey}
+	req := newRequest(t, http.MethodPost, "https://example.com/orders", strings.NewReader("amount=1"))
+	resp, err := middleware.SigningMiddleware(signer)(rec).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	sent := rec.Last(t)
+	sent.URL.RawQuery = "admin=1"
+	if err := authtest.TimestampedHMAC(hmacKey).Verify(sent); err == nil {
+		t.Error("tampered request verified")
+	}
+}
+
+func TestSigningMiddlewareBodyLifetime(t *testing.T) {
+	// Large enough to spill to a temporary file.
+	body := strings.Repeat("x", middleware.DefaultSpillThreshold+1)
+	checkSpoolLifetime(t, middleware.SigningMiddleware(&middleware.HMACSigner{Key: hmacKey}), body)
+}
+
+func TestSigningMiddlewareRefuses(t *testing.T) {
+	for _, signer := range []middleware.Signer{&middleware.HMACSigner{}, &middleware.SigV4Signer{AccessKeyID: "AKID"}} {
+		next := newStub(reply{status: 200})
+		_, err := middleware.SigningMiddleware(signer)(next).Do(newRequest(t, http.MethodGet, "https://example.com/", nil))
+		if err == nil {
+			t.Errorf("%T: no error signing without credentials", signer)
+		}
+		if next.calls() != 0 {
+			t.Errorf("%T: unsigned request was sent", signer)
+		}
+	}
+}
+
+func TestSigV4SignerSessionToken(t *testing.T) {
+	rec := &authtest.Recorder{}
+	resp, err := middleware.SigningMiddleware(sigV4Signer)(rec).Do(newRequest(t, http.MethodGet, "https://example.com/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	sent := rec.Last(t)
+	if got := sent.Header.Get("X-Amz-Security-Token"); got != "TOKEN" {
+		t.Errorf("X-Amz-Security-Token = %q, want %q", got, "TOKEN")
+	}
+	if !strings.Contains(sent.Header.Get("Authorization"), "x-amz-security-token") {
+		t.Errorf("session token is not signed: %s", sent.Header.Get("Authorization"))
+	}
+	authtest.AssertSignedWith(t, sent, authtest.SigV4(sigV4Creds))
+}
@@ -0,0 +1,113 @@
+package middleware_test
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/authtest"
+	"github.com/Vkanhan/go-auth-middleware-http-client/client"
+	"github.com/Vkanhan/go-auth-middleware-http-client/middleware"
+)
+
+// soakDuration keeps the soaks short enough for every test run.
+const soakDuration = 500 * time.Millisecond
+
+func TestSoakAuth(t *testing.T) {
+	if testing.Short() {
+		t.Skip("soak test")
+	}
+	var generation atomic.Int64
+	token := func() string { return "token-" + strconv.FormatInt(generation.Load(), 10) }
+	source := &middleware.CachedTokenSource{
+		Source: middleware.TokenSourceFunc(func(context.Context) (string, error) { return token(), nil }),
+		TTL:    5 * time.Millisecond,
+	}
+
+	result := authtest.Soak(t, authtest.SoakConfig{
+		Duration: soakDuration,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			// Tokens stay valid for one rotation, as the cache may lag.
+			auth := req.Header.Get("Authorization")
+			if auth != "Bearer "+token() && auth != "Bearer token-"+strconv.FormatInt(generation.Load()-1, 10) {
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+		}),
+		NewClient: func(base *http.Client) authtest.Client {
+			return middleware.APIKeyAuthSourceMiddleware(source)(base)
+		},
+		Chaos:      []func(){func() { generation.Add(1) }},
+		CancelRate: 0.1,
+	})
+	if result.Errors > 0 {
+		t.Errorf("%d of %d requests failed", result.Errors, result.Requests)
+	}
+}
+
+func TestSoakRetry(t *testing.T) {
+	if testing.Short() {
+		t.Skip("soak test")
+	}
+	result := authtest.Soak(t, authtest.SoakConfig{
+		Duration: soakDuration,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if rand.IntN(3) == 0 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+			w.Write([]byte("response body"))
+		}),
+		NewClient: func(base *http.Client) authtest.Client {
+			return middleware.RetryMiddleware(middleware.RetryPolicy{
+				MaxAttempts: 4,
+				BaseDelay:   time.Millisecond,
+				MaxDelay:    2 * time.Millisecond,
+			})(base)
+		},
+		CancelRate: 0.2,
+	})
+	if result.Errors > 0 {
+		t.Errorf("%d of %d requests failed", result.Errors, result.Requests)
+	}
+}
+
+func TestSoakCircuitBreaker(t *testing.T) {
+	if testing.Short() {
+		t.Skip("soak test")
+	}
+	var failing atomic.Bool
+	var opened atomic.Int64
+	result := authtest.Soak(t, authtest.SoakConfig{
+		Duration: soakDuration,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if failing.Load() {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		}),
+		NewClient: func(base *http.Client) authtest.Client {
+			chain := client.NewCustomClient(base,
+				middleware.CircuitBreakerMiddleware(middleware.CircuitBreakerConfig{
+					ConsecutiveFailures: 3,
+					Cooldown:            5 * time.Millisecond,
+					HalfOpenProbes:      2,
+					OnStateChange: func(host string, from, to middleware.CircuitState) {
+						if to == middleware.CircuitOpen {
+							opened.Add(1)
+						}
+					},
+				}),
+				middleware.RetryMiddleware(middleware.RetryPolicy{BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}),
+			)
+			return &chain
+		},
+		Chaos:         []func(){func() { failing.Store(true) }, func() { failing.Store(false) }},
+		ChaosInterval: 20 * time.Millisecond,
+		CancelRate:    0.1,
+	})
+	if opened.Load() == 0 {
+		t.Errorf("breaker never opened in %d requests", result.Requests)
+	}
+}
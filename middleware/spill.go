@@ -0,0 +1,199 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/client"
+)
+
+// DefaultSpillThreshold is the body size above which SpillMiddleware moves
+// bodies to temporary files by default.
+const DefaultSpillThreshold = 8 << 20
+
+// SpillConfig configures SpillMiddleware.
+type SpillConfig struct {
+	// Threshold is the largest body kept in memory; zero means
+	// DefaultSpillThreshold.
+	Threshold int64
+	// Dir is where temporary files are created; empty uses os.TempDir.
+	Dir string
+	// Requests also buffers request bodies, setting GetBody so middleware
+	// retrying uploads can resend them. A buffered body is freed once the
+	// request returned and the transport closed the body it sent.
+	Requests bool
+}
+
+// SpillMiddleware buffers response bodies, in memory up to the threshold and
+// in a temporary file beyond it, and replaces them with a *SpooledBody that
+// can be seeked and reread. Middleware that must buffer bodies, such as
+// signature verification or caching, then no longer holds large bodies in
+// memory. Pass it first to client.NewCustomClient so the other middlewares
+// see the spooled bodies.
+func SpillMiddleware(cfg SpillConfig) client.Middleware {
+	threshold := cfg.Threshold
+	if threshold <= 0 {
+		threshold = DefaultSpillThreshold
+	}
+	return func(next client.HTTPClient) client.HTTPClient {
+		return client.HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+			if cfg.Requests && req.Body != nil && req.Body != http.NoBody {
+				req = req.Clone(req.Context())
+				release, err := spoolRequestBody(req, threshold, cfg.Dir)
+				if err != nil {
+					return nil, err
+				}
+				defer release()
+			}
+
+			resp, err := next.Do(req)
+			if err != nil {
+				return nil, err
+			}
+			body, err := Spool(resp.Body, threshold, cfg.Dir)
+			resp.Body.Close()
+			if err != nil {
+				return nil, fmt.Errorf("failed to buffer response body: %w", err)
+			}
+			resp.Body = body
+			resp.ContentLength = body.Size()
+			return resp, nil
+		})
+	}
+}
+
+// errSpoolReleased is returned by the GetBody of a spooled request body
+// once the spool was freed.
+var errSpoolReleased = errors.New("spooled request body already released")
+
+// spoolRequestBody replaces the body of req, which the caller owns, with a
+// spooled copy of threshold and dir, and sets GetBody to reread it. The
+// transport may still be sending the body after the response came back, so
+// the spool is only freed once release was called and every reader handed
+// out is closed.
+func spoolRequestBody(req *http.Request, threshold int64, dir string) (release func(), err error) {
+	body, err := Spool(req.Body, threshold, dir)
+	req.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to buffer request body: %w", err)
+	}
+	spool := &sharedSpool{body: body, refs: 1}
+	req.ContentLength = body.Size()
+	req.Body, _ = spool.newReader()
+	req.GetBody = spool.newReader
+	return spool.release, nil
+}
+
+// sharedSpool frees a SpooledBody when the last of its references is
+// dropped: the one of its owner and one per reader.
+type sharedSpool struct {
+	body *SpooledBody
+
+	mu       sync.Mutex
+	refs     int
+	released bool
+}
+
+// newReader returns a reader of the whole body holding a reference until
+// it is closed.
+func (s *sharedSpool) newReader() (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.released {
+		return nil, errSpoolReleased
+	}
+	s.refs++
+	return &spoolReader{Reader: s.body.NewReader(), spool: s}, nil
+}
+
+// release drops a reference, freeing the body with the last one.
+func (s *sharedSpool) release() {
+	s.mu.Lock()
+	s.refs--
+	free := s.refs == 0
+	if free {
+		s.released = true
+	}
+	s.mu.Unlock()
+	if free {
+		s.body.Close()
+	}
+}
+
+// spoolReader is a reader of a sharedSpool.
+type spoolReader struct {
+	io.Reader
+	spool *sharedSpool
+	once  sync.Once
+}
+
+// Close drops the reference of the reader.
+func (r *spoolReader) Close() error {
+	r.once.Do(r.spool.release)
+	return nil
+}
+
+// SpooledBody is a body buffered in memory or in a temporary file. Reading
+// and seeking work on its own position; NewReader returns independent
+// readers. Closing it removes the file.
+type SpooledBody struct {
+	*io.SectionReader
+	file *os.File
+}
+
+// Spool reads r to the end into a SpooledBody, spilling it to a temporary
+// file in dir once it exceeds threshold bytes.
+func Spool(r io.Reader, threshold int64, dir string) (*SpooledBody, error) {
+	var buf bytes.Buffer
+	n, err := io.CopyN(&buf, r, threshold+1)
+	if err == io.EOF || (err == nil && n <= threshold) {
+		data := buf.Bytes()
+		return &SpooledBody{SectionReader: io.NewSectionReader(bytes.NewReader(data), 0, int64(len(data)))}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.CreateTemp(dir, "spill-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spill file: %w", err)
+	}
+	// Unlink the file right away where the platform allows it, so it is
+	// reclaimed even if the body is never closed.
+	os.Remove(file.Name())
+	size, err := io.Copy(file, io.MultiReader(&buf, r))
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, fmt.Errorf("failed to write spill file: %w", err)
+	}
+	return &SpooledBody{SectionReader: io.NewSectionReader(file, 0, size), file: file}, nil
+}
+
+// InMemory reports whether the body stayed in memory.
+func (b *SpooledBody) InMemory() bool {
+	return b.file == nil
+}
+
+// NewReader returns a reader of the whole body, independent of the others.
+// Closing it leaves the body open.
+func (b *SpooledBody) NewReader() io.ReadCloser {
+	return io.NopCloser(io.NewSectionReader(b.SectionReader, 0, b.Size()))
+}
+
+// Close releases the temporary file, if any.
+func (b *SpooledBody) Close() error {
+	if b.file == nil {
+		return nil
+	}
+	err := b.file.Close()
+	if rmErr := os.Remove(b.file.Name()); rmErr != nil && !errors.Is(rmErr, os.ErrNotExist) && err == nil {
+		err = rmErr
+	}
+	return err
+}
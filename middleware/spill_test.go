@@ -0,0 +1,77 @@
+package middleware_test
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/client"
+	"github.com/Vkanhan/go-auth-middleware-http-client/middleware"
+)
+
+// lateReader is an HTTPClient that answers at once and keeps the request
+// body, which it reads later, the way a transport can keep sending a body
+// after the server answered early.
+type lateReader struct {
+	req *http.Request
+}
+
+// Do keeps req and answers 200.
+func (l *lateReader) Do(req *http.Request) (*http.Response, error) {
+	l.req = req
+	return &http.Response{StatusCode: 200, Body: http.NoBody, Request: req}, nil
+}
+
+// checkSpoolLifetime sends a request with body through m in front of a
+// lateReader, and checks that the body can still be read after the request
+// returned and that GetBody fails once it was closed.
+func checkSpoolLifetime(t *testing.T, m client.Middleware, body string) {
+	t.Helper()
+	next := &lateReader{}
+	resp, err := m(next).Do(newRequest(t, http.MethodPut, "https://example.com/upload", io.MultiReader(strings.NewReader(body))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	got, err := io.ReadAll(next.req.Body)
+	if err != nil || string(got) != body {
+		t.Fatalf("body read after the response = %d bytes, %v; want %d bytes", len(got), err, len(body))
+	}
+	next.req.Body.Close()
+	if _, err := next.req.GetBody(); err == nil {
+		t.Error("GetBody succeeded after the spool was released")
+	}
+}
+
+func TestSpillMiddlewareRequestLifetime(t *testing.T) {
+	for _, size := range []int{10, 100} {
+		m := middleware.SpillMiddleware(middleware.SpillConfig{Threshold: 50, Dir: t.TempDir(), Requests: true})
+		checkSpoolLifetime(t, m, strings.Repeat("x", size))
+	}
+}
+
+func TestSpillMiddlewareRequestRetries(t *testing.T) {
+	// The spool outlives the readers closed while the request is pending, so
+	// middleware further down can resend it.
+	var bodies []string
+	next := client.HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+		for range 3 {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			data, _ := io.ReadAll(body)
+			body.Close()
+			bodies = append(bodies, string(data))
+		}
+		req.Body.Close()
+		return &http.Response{StatusCode: 200, Body: http.NoBody, Request: req}, nil
+	})
+	m := middleware.SpillMiddleware(middleware.SpillConfig{Threshold: 4, Dir: t.TempDir(), Requests: true})
+	send(t, m, next, newRequest(t, http.MethodPost, "https://example.com/", io.MultiReader(strings.NewReader("upload"))))
+	if strings.Join(bodies, ",") != "upload,upload,upload" {
+		t.Errorf("bodies = %q", bodies)
+	}
+}
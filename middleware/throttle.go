@@ -0,0 +1,167 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/client"
+)
+
+// bandwidthKey is the context key for per-request bandwidth limits.
+type bandwidthKey struct{}
+
+// bandwidthLimits are upload and download limits in bytes per second.
+type bandwidthLimits struct {
+	upload, download int
+}
+
+// ContextWithBandwidthLimit returns a context that limits the request sent
+// with it to upload and download bytes per second, on top of any client-wide
+// limits. Zero means unlimited. The limits are enforced by
+// BandwidthLimitMiddleware, which must be installed on the client.
+func ContextWithBandwidthLimit(ctx context.Context, upload, download int) context.Context {
+	return context.WithValue(ctx, bandwidthKey{}, bandwidthLimits{upload: upload, download: download})
+}
+
+// BandwidthLimit configures BandwidthLimitMiddleware.
+type BandwidthLimit struct {
+	// Upload and Download are in bytes per second; zero means unlimited.
+	Upload, Download int
+	// Clock paces the transfers; nil uses client.SystemClock.
+	Clock client.Clock
+}
+
+// BandwidthLimitMiddleware limits request and response bodies to the given
+// rates, shared by all requests of the client.
+func BandwidthLimitMiddleware(limit BandwidthLimit) client.Middleware {
+	clock := clockOrSystem(limit.Clock)
+	clientUpload := newBandwidthLimiter(limit.Upload, clock)
+	clientDownload := newBandwidthLimiter(limit.Download, clock)
+
+	return func(next client.HTTPClient) client.HTTPClient {
+		return client.HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+			ctx := req.Context()
+			uploads := limiters(clientUpload)
+			downloads := limiters(clientDownload)
+			if limits, ok := ctx.Value(bandwidthKey{}).(bandwidthLimits); ok {
+				uploads = append(uploads, limiters(newBandwidthLimiter(limits.upload, clock))...)
+				downloads = append(downloads, limiters(newBandwidthLimiter(limits.download, clock))...)
+			}
+
+			// Throttle the request body, including replays of it.
+			if len(uploads) > 0 && req.Body != nil && req.Body != http.NoBody {
+				req = req.Clone(ctx)
+				req.Body = &throttledReader{ctx: ctx, r: req.Body, limiters: uploads}
+				if getBody := req.GetBody; getBody != nil {
+					req.GetBody = func() (io.ReadCloser, error) {
+						body, err := getBody()
+						if err != nil {
+							return nil, err
+						}
+						return &throttledReader{ctx: ctx, r: body, limiters: uploads}, nil
+					}
+				}
+			}
+
+			resp, err := next.Do(req)
+			if err != nil {
+				return nil, err
+			}
+
+			// Throttle the response body.
+			if len(downloads) > 0 {
+				resp.Body = &throttledReader{ctx: ctx, r: resp.Body, limiters: downloads}
+			}
+			return resp, nil
+		})
+	}
+}
+
+// limiters returns l as a slice, or nil when l is unlimited.
+func limiters(l *bandwidthLimiter) []*bandwidthLimiter {
+	if l == nil {
+		return nil
+	}
+	return []*bandwidthLimiter{l}
+}
+
+// bandwidthLimiter is a token bucket measured in bytes.
+type bandwidthLimiter struct {
+	clock  client.Clock
+	mu     sync.Mutex
+	rate   float64
+	burst  int
+	tokens float64
+	last   time.Time
+}
+
+// newBandwidthLimiter creates a limiter for bytesPerSec, or returns nil when
+// bytesPerSec is not positive. The bucket holds one second worth of bytes.
+func newBandwidthLimiter(bytesPerSec int, clock client.Clock) *bandwidthLimiter {
+	if bytesPerSec <= 0 {
+		return nil
+	}
+	return &bandwidthLimiter{
+		clock:  clock,
+		rate:   float64(bytesPerSec),
+		burst:  bytesPerSec,
+		tokens: float64(bytesPerSec),
+		last:   clock.Now(),
+	}
+}
+
+// wait takes n bytes from the bucket, blocking until they are available or
+// ctx is done.
+func (l *bandwidthLimiter) wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	now := l.clock.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > float64(l.burst) {
+		l.tokens = float64(l.burst)
+	}
+	l.last = now
+
+	// Take the bytes right away and sleep off the debt, so that concurrent
+	// readers queue up behind each other.
+	l.tokens -= float64(n)
+	delay := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	return l.clock.Sleep(ctx, delay)
+}
+
+// throttledReader reads from r no faster than its limiters allow.
+type throttledReader struct {
+	ctx      context.Context
+	r        io.ReadCloser
+	limiters []*bandwidthLimiter
+}
+
+// Read reads at most one burst worth of bytes and waits for the limiters to
+// let them through.
+func (t *throttledReader) Read(p []byte) (int, error) {
+	for _, l := range t.limiters {
+		if len(p) > l.burst {
+			p = p[:l.burst]
+		}
+	}
+
+	n, err := t.r.Read(p)
+	for _, l := range t.limiters {
+		if waitErr := l.wait(t.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+// Close closes the underlying body.
+func (t *throttledReader) Close() error {
+	return t.r.Close()
+}
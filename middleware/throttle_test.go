@@ -0,0 +1,78 @@
+package middleware_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/middleware"
+)
+
+func TestBandwidthLimitMiddleware(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    middleware.BandwidthLimit
+		ctxLimit []int // Upload and download limits set on the context.
+		upload   int   // Size of the request body.
+		download int   // Size of each response body.
+		requests int
+		slept    string
+	}{
+		{name: "unlimited", upload: 300, download: 300, requests: 1, slept: "[]"},
+		{name: "download", limit: middleware.BandwidthLimit{Download: 100}, download: 350, requests: 1, slept: "[1s 1s 500ms]"},
+		{name: "within the burst", limit: middleware.BandwidthLimit{Download: 100}, download: 100, requests: 1, slept: "[]"},
+		{name: "upload", limit: middleware.BandwidthLimit{Upload: 100}, upload: 250, requests: 1, slept: "[1s 500ms]"},
+		{name: "shared by requests", limit: middleware.BandwidthLimit{Download: 100}, download: 100, requests: 3, slept: "[1s 1s]"},
+		{name: "context limit", ctxLimit: []int{0, 50}, download: 100, requests: 1, slept: "[1s]"},
+		{name: "context limit per request", ctxLimit: []int{0, 50}, download: 50, requests: 3, slept: "[]"},
+		{name: "tighter context limit", limit: middleware.BandwidthLimit{Download: 100}, ctxLimit: []int{0, 50}, download: 200, requests: 1, slept: "[1s 1s 1s]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newStepClock()
+			limit := tt.limit
+			limit.Clock = clock
+			m := middleware.BandwidthLimitMiddleware(limit)
+			next := newStub(reply{status: 200, body: strings.Repeat("d", tt.download)})
+			for range tt.requests {
+				var body io.Reader
+				if tt.upload > 0 {
+					body = strings.NewReader(strings.Repeat("u", tt.upload))
+				}
+				req := newRequest(t, http.MethodPost, "http://example.com/", body)
+				if tt.ctxLimit != nil {
+					req = req.WithContext(middleware.ContextWithBandwidthLimit(req.Context(), tt.ctxLimit[0], tt.ctxLimit[1]))
+				}
+				if _, got := send(t, m, next, req); len(got) != tt.download {
+					t.Errorf("read %d bytes, want %d", len(got), tt.download)
+				}
+			}
+			if got := fmt.Sprint(clock.Slept()); got != tt.slept {
+				t.Errorf("slept = %s, want %s", got, tt.slept)
+			}
+		})
+	}
+}
+
+func TestBandwidthLimitMiddlewareCancel(t *testing.T) {
+	m := middleware.BandwidthLimitMiddleware(middleware.BandwidthLimit{Download: 100, Clock: newStepClock()})
+	next := newStub(reply{status: 200, body: strings.Repeat("d", 200)})
+	ctx, cancel := context.WithCancel(context.Background())
+	resp, err := m(next).Do(newRequest(t, http.MethodGet, "http://example.com/", nil).WithContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	cancel()
+
+	// The first burst needs no wait; the second is returned along with the
+	// context error its wait failed with.
+	body, err := io.ReadAll(resp.Body)
+	if !errors.Is(err, context.Canceled) || len(body) != 200 {
+		t.Errorf("read %d bytes, err = %v; want 200 bytes and %v", len(body), err, context.Canceled)
+	}
+}
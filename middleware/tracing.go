@@ -0,0 +1,163 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/client"
+)
+
+// spanContextKey is the context key of the current SpanContext.
+type spanContextKey struct{}
+
+// SpanContext identifies a span in a W3C trace context.
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Sampled bool
+	// TraceState is the vendor-specific tracestate header, forwarded as it
+	// is.
+	TraceState string
+}
+
+// IsValid reports whether the trace and span IDs are set.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// TraceParent returns the traceparent header value of sc.
+func (sc SpanContext) TraceParent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + hex.EncodeToString(sc.TraceID[:]) + "-" + hex.EncodeToString(sc.SpanID[:]) + "-" + flags
+}
+
+// ParseTraceParent parses a traceparent header value. Versions above 00
+// are accepted as long as they start with the fields of version 00.
+func ParseTraceParent(value string) (SpanContext, error) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return sc, fmt.Errorf("malformed traceparent %q", value)
+	}
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, fmt.Errorf("malformed traceparent %q", value)
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, fmt.Errorf("malformed traceparent %q: %w", value, err)
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, fmt.Errorf("malformed traceparent %q: %w", value, err)
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return sc, fmt.Errorf("malformed traceparent %q: %w", value, err)
+	}
+	if !sc.IsValid() {
+		return sc, errors.New("traceparent has a zero trace or span ID")
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, nil
+}
+
+// ContextWithSpanContext returns a context carrying sc as the current span,
+// so TracingMiddleware starts the client spans of requests sent with it as
+// children of sc. Servers typically set it from the traceparent of the
+// request they are handling.
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+// SpanContextFromContext returns the current span of ctx, if any.
+func SpanContextFromContext(ctx context.Context) (SpanContext, bool) {
+	sc, ok := ctx.Value(spanContextKey{}).(SpanContext)
+	return sc, ok && sc.IsValid()
+}
+
+// Span is a finished client span.
+type Span struct {
+	SpanContext
+	// ParentSpanID is zero for spans that started a trace.
+	ParentSpanID [8]byte
+	Name         string
+	Method       string
+	URL          string
+	// StatusCode is zero when the request failed with Err.
+	StatusCode int
+	Err        error
+	Start, End time.Time
+}
+
+// TracingConfig configures TracingMiddleware.
+type TracingConfig struct {
+	// OnSpan, if set, receives every sampled span when it ends, to export
+	// it to a tracing system.
+	OnSpan func(Span)
+	// Sample decides whether the traces started for requests without a
+	// current span are sampled; nil samples them all.
+	Sample func(*http.Request) bool
+	// Clock times the spans; nil uses client.SystemClock.
+	Clock client.Clock
+}
+
+// TracingMiddleware starts a client span for every request, as a child of
+// the current span of the request context or as the root of a new trace,
+// and sends it in the traceparent and tracestate headers. The span becomes
+// the current span of the request context, so the middlewares it wraps can
+// read it. It ends when the response headers arrive. The current span is
+// the one of ContextWithSpanContext, not an OpenTelemetry span, which this
+// middleware does not see; services using OpenTelemetry should use the
+// middleware/oteltracing package instead.
+func TracingMiddleware(cfg TracingConfig) client.Middleware {
+	clock := clockOrSystem(cfg.Clock)
+	return func(next client.HTTPClient) client.HTTPClient {
+		return client.HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+			ctx := req.Context()
+			parent, hasParent := SpanContextFromContext(ctx)
+
+			span := Span{Method: req.Method, URL: req.URL.Redacted(), Start: clock.Now()}
+			if span.Method == "" {
+				span.Method = http.MethodGet
+			}
+			span.Name = "HTTP " + span.Method
+			if hasParent {
+				span.TraceID = parent.TraceID
+				span.ParentSpanID = parent.SpanID
+				span.Sampled = parent.Sampled
+				span.TraceState = parent.TraceState
+			} else {
+				rand.Read(span.TraceID[:])
+				span.Sampled = cfg.Sample == nil || cfg.Sample(req)
+			}
+			rand.Read(span.SpanID[:])
+
+			req = req.Clone(ContextWithSpanContext(ctx, span.SpanContext))
+			req.Header.Set("Traceparent", span.TraceParent())
+			if span.TraceState != "" {
+				req.Header.Set("Tracestate", span.TraceState)
+			} else {
+				req.Header.Del("Tracestate")
+			}
+
+			resp, err := next.Do(req)
+			span.End = clock.Now()
+			if err != nil {
+				span.Err = err
+			} else {
+				span.StatusCode = resp.StatusCode
+			}
+			if span.Sampled && cfg.OnSpan != nil {
+				cfg.OnSpan(span)
+			}
+			return resp, err
+		})
+	}
+}
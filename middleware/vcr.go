@@ -0,0 +1,436 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/client"
+)
+
+// scrubbedValue replaces secrets in recorded headers.
+const scrubbedValue = "[REDACTED]"
+
+// ErrNoInteraction is returned in replay mode when the cassette holds no
+// interaction matching the request.
+var ErrNoInteraction = errors.New("vcr: no recorded interaction matches the request")
+
+// defaultScrubHeaders are never written to a cassette in clear text.
+var defaultScrubHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+	"X-Api-Key",
+}
+
+// defaultScrubQueryParams are never written to a cassette in clear text.
+var defaultScrubQueryParams = []string{
+	"access_token",
+	"api_key",
+	"apikey",
+	"client_secret",
+}
+
+// defaultScrubJSONFields are redacted wherever they appear in recorded JSON
+// response bodies.
+var defaultScrubJSONFields = []string{
+	"access_token",
+	"refresh_token",
+	"id_token",
+	"client_secret",
+	"password",
+}
+
+// RecordMode decides when VCRMiddleware sends real requests.
+type RecordMode int
+
+const (
+	// RecordOnce records into a new cassette and only replays from an
+	// existing one.
+	RecordOnce RecordMode = iota
+	// RecordNewEpisodes replays the requests the cassette has and records
+	// the others into it.
+	RecordNewEpisodes
+	// RecordAll sends every request and records a fresh cassette,
+	// replacing the existing one.
+	RecordAll
+	// RecordNone only replays, and fails if the cassette does not exist.
+	RecordNone
+)
+
+// MatchRule selects the request attributes used to find a recorded
+// interaction. Rules combine with |.
+type MatchRule int
+
+const (
+	// MatchMethod compares the request method.
+	MatchMethod MatchRule = 1 << iota
+	// MatchURL compares the full request URL.
+	MatchURL
+	// MatchBody compares the SHA-256 hash of the request body.
+	MatchBody
+
+	// MatchDefault compares method, URL and body.
+	MatchDefault = MatchMethod | MatchURL | MatchBody
+)
+
+// VCRConfig configures VCRMiddleware.
+type VCRConfig struct {
+	// Path is the cassette file. When it exists, requests are replayed from
+	// it; otherwise real responses are recorded into it.
+	Path string
+	// Match selects how requests are matched on replay. Zero means
+	// MatchDefault.
+	Match MatchRule
+	// Mode decides when requests are recorded. Zero means RecordOnce.
+	Mode RecordMode
+	// ScrubHeaders lists headers to redact on top of Authorization,
+	// Proxy-Authorization, Cookie, Set-Cookie and X-Api-Key.
+	ScrubHeaders []string
+	// ScrubQueryParams lists query parameters to redact from recorded URLs
+	// on top of access_token, api_key, apikey and client_secret. Requests
+	// are matched against the redacted URLs.
+	ScrubQueryParams []string
+	// ScrubJSONFields lists fields to redact at any depth of recorded JSON
+	// response bodies, on top of access_token, refresh_token, id_token,
+	// client_secret and password.
+	ScrubJSONFields []string
+}
+
+// cassette is the on-disk form of a recording.
+type cassette struct {
+	Interactions []interaction `json:"interactions"`
+}
+
+// interaction is one recorded request and its response.
+type interaction struct {
+	Request  recordedRequest  `json:"request"`
+	Response recordedResponse `json:"response"`
+
+	// used marks interactions already replayed.
+	used bool
+}
+
+// recordedRequest is the recorded part of a request.
+type recordedRequest struct {
+	Method   string      `json:"method"`
+	URL      string      `json:"url"`
+	Header   http.Header `json:"header,omitempty"`
+	BodyHash string      `json:"body_sha256,omitempty"`
+}
+
+// recordedResponse is the recorded part of a response.
+type recordedResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+	BodyBase64 string      `json:"body_base64,omitempty"`
+}
+
+// vcr records and replays interactions for VCRMiddleware.
+type vcr struct {
+	cfg         VCRConfig
+	scrub       []string
+	scrubQuery  []string
+	scrubFields []string
+	mu          sync.Mutex
+	recording   bool
+	cassette    cassette
+}
+
+// VCRMiddleware records real responses into a cassette file and replays them
+// on later runs, so tests can run offline and deterministically. Secrets in
+// recorded headers, URLs and JSON bodies are redacted before being written,
+// so cassettes are safe to commit.
+func VCRMiddleware(cfg VCRConfig) (client.Middleware, error) {
+	v := &vcr{
+		cfg:         cfg,
+		scrub:       append(append([]string(nil), defaultScrubHeaders...), cfg.ScrubHeaders...),
+		scrubQuery:  append(append([]string(nil), defaultScrubQueryParams...), cfg.ScrubQueryParams...),
+		scrubFields: append(append([]string(nil), defaultScrubJSONFields...), cfg.ScrubJSONFields...),
+	}
+	if v.cfg.Match == 0 {
+		v.cfg.Match = MatchDefault
+	}
+	if err := v.load(); err != nil {
+		return nil, err
+	}
+
+	return func(next client.HTTPClient) client.HTTPClient {
+		return client.HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+			hash, err := hashBody(req)
+			if err != nil {
+				return nil, err
+			}
+			if v.recording {
+				return v.record(next, req, hash)
+			}
+			resp, err := v.replay(req, hash)
+			if v.cfg.Mode == RecordNewEpisodes && errors.Is(err, ErrNoInteraction) {
+				return v.record(next, req, hash)
+			}
+			return resp, err
+		})
+	}, nil
+}
+
+// load reads the cassette, switching to recording mode if the mode records
+// everything or the cassette does not exist.
+func (v *vcr) load() error {
+	if v.cfg.Mode == RecordAll {
+		v.recording = true
+		return nil
+	}
+	data, err := os.ReadFile(v.cfg.Path)
+	if errors.Is(err, os.ErrNotExist) && v.cfg.Mode != RecordNone {
+		v.recording = true
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read cassette: %w", err)
+	}
+	if err := json.Unmarshal(data, &v.cassette); err != nil {
+		return fmt.Errorf("failed to decode cassette: %w", err)
+	}
+	return nil
+}
+
+// record sends the request and appends the exchange to the cassette.
+func (v *vcr) record(next client.HTTPClient, req *http.Request, hash string) (*http.Response, error) {
+	resp, err := next.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	in := interaction{
+		Request: recordedRequest{
+			Method:   req.Method,
+			URL:      v.scrubURL(req.URL),
+			Header:   v.scrubHeader(req.Header),
+			BodyHash: hash,
+		},
+		Response: recordedResponse{
+			StatusCode: resp.StatusCode,
+			Header:     v.scrubHeader(resp.Header),
+		},
+	}
+	recorded := v.scrubBody(body)
+	if utf8.Valid(recorded) {
+		in.Response.Body = string(recorded)
+	} else {
+		in.Response.BodyBase64 = base64.StdEncoding.EncodeToString(recorded)
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.cassette.Interactions = append(v.cassette.Interactions, in)
+	if err := v.save(); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// replay answers the request from the cassette. Unused interactions are
+// preferred, so repeated requests replay in recorded order; once all matches
+// are used the last one is replayed again.
+func (v *vcr) replay(req *http.Request, hash string) (*http.Response, error) {
+	v.mu.Lock()
+	var found *interaction
+	for i := range v.cassette.Interactions {
+		in := &v.cassette.Interactions[i]
+		if !v.matches(in, req, hash) {
+			continue
+		}
+		found = in
+		if !in.used {
+			break
+		}
+	}
+	if found != nil {
+		found.used = true
+	}
+	v.mu.Unlock()
+
+	if found == nil {
+		return nil, fmt.Errorf("%w: %s %s", ErrNoInteraction, req.Method, req.URL.Redacted())
+	}
+	return found.Response.toResponse(req)
+}
+
+// matches reports whether the recorded interaction answers the request.
+func (v *vcr) matches(in *interaction, req *http.Request, hash string) bool {
+	rule := v.cfg.Match
+	if rule&MatchMethod != 0 && in.Request.Method != req.Method {
+		return false
+	}
+	if rule&MatchURL != 0 && in.Request.URL != v.scrubURL(req.URL) {
+		return false
+	}
+	if rule&MatchBody != 0 && in.Request.BodyHash != hash {
+		return false
+	}
+	return true
+}
+
+// save writes the cassette to disk. Callers must hold v.mu.
+func (v *vcr) save() error {
+	data, err := json.MarshalIndent(v.cassette, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode cassette: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(v.cfg.Path), 0o755); err != nil {
+		return fmt.Errorf("failed to create cassette directory: %w", err)
+	}
+	if err := os.WriteFile(v.cfg.Path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	return nil
+}
+
+// scrubHeader returns a copy of h with secret values redacted.
+func (v *vcr) scrubHeader(h http.Header) http.Header {
+	if len(h) == 0 {
+		return nil
+	}
+	scrubbed := h.Clone()
+	for name := range scrubbed {
+		for _, secret := range v.scrub {
+			if strings.EqualFold(name, secret) {
+				scrubbed[name] = []string{scrubbedValue}
+			}
+		}
+	}
+	return scrubbed
+}
+
+// scrubURL returns u as a string with secret query parameters redacted.
+func (v *vcr) scrubURL(u *url.URL) string {
+	if u.RawQuery == "" {
+		return u.String()
+	}
+	query := u.Query()
+	scrubbed := false
+	for name, values := range query {
+		for _, secret := range v.scrubQuery {
+			if strings.EqualFold(name, secret) {
+				for i := range values {
+					values[i] = scrubbedValue
+				}
+				scrubbed = true
+			}
+		}
+	}
+	if !scrubbed {
+		return u.String()
+	}
+	redacted := *u
+	redacted.RawQuery = query.Encode()
+	return redacted.String()
+}
+
+// scrubBody returns body with secret fields redacted if it is JSON, or body
+// unchanged otherwise.
+func (v *vcr) scrubBody(body []byte) []byte {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var value any
+	if err := dec.Decode(&value); err != nil || dec.More() {
+		return body
+	}
+	if !v.scrubJSON(value) {
+		return body
+	}
+	scrubbed, err := json.Marshal(value)
+	if err != nil {
+		return body
+	}
+	return scrubbed
+}
+
+// scrubJSON redacts secret fields in a decoded JSON value, reporting whether
+// it found any.
+func (v *vcr) scrubJSON(value any) bool {
+	scrubbed := false
+	switch value := value.(type) {
+	case map[string]any:
+		for name, field := range value {
+			if slices.ContainsFunc(v.scrubFields, func(secret string) bool { return strings.EqualFold(name, secret) }) {
+				value[name] = scrubbedValue
+				scrubbed = true
+				continue
+			}
+			scrubbed = v.scrubJSON(field) || scrubbed
+		}
+	case []any:
+		for _, item := range value {
+			scrubbed = v.scrubJSON(item) || scrubbed
+		}
+	}
+	return scrubbed
+}
+
+// toResponse rebuilds an *http.Response from the recording.
+func (r recordedResponse) toResponse(req *http.Request) (*http.Response, error) {
+	body := []byte(r.Body)
+	if r.BodyBase64 != "" {
+		var err error
+		if body, err = base64.StdEncoding.DecodeString(r.BodyBase64); err != nil {
+			return nil, fmt.Errorf("failed to decode recorded body: %w", err)
+		}
+	}
+
+	header := r.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", r.StatusCode, http.StatusText(r.StatusCode)),
+		StatusCode:    r.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// hashBody returns the hex SHA-256 of the request body, or "" if it has
+// none, and leaves the body readable.
+func hashBody(req *http.Request) (string, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return "", nil
+	}
+
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return "", fmt.Errorf("failed to read request body: %w", err)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:]), nil
+}
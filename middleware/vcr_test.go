@@ -0,0 +1,303 @@
+package middleware_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/client"
+	"github.com/Vkanhan/go-auth-middleware-http-client/middleware"
+)
+
+// newVCR creates a VCRMiddleware for cfg, failing t on error.
+func newVCR(t *testing.T, cfg middleware.VCRConfig) client.Middleware {
+	t.Helper()
+	m, err := middleware.VCRMiddleware(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// vcrDo sends a request with body, if not empty, through m in front of
+// next and describes the outcome.
+func vcrDo(t *testing.T, m client.Middleware, next client.HTTPClient, method, url, body string) string {
+	t.Helper()
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	return outcome(m(next).Do(newRequest(t, method, url, r)))
+}
+
+func TestVCRMiddlewareRecordReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassettes", "users.json")
+	next := newStub(
+		reply{status: 200, body: "first"},
+		reply{status: 200, body: "second"},
+		reply{status: 201, body: "created"},
+		reply{status: 200, body: "\xff\xfe binary"},
+	)
+	m := newVCR(t, middleware.VCRConfig{Path: path})
+	for _, step := range []struct{ method, url, body, outcome string }{
+		{http.MethodGet, "http://api.example.com/users", "", "200 first"},
+		{http.MethodGet, "http://api.example.com/users", "", "200 second"},
+		{http.MethodPost, "http://api.example.com/users", `{"name":"gopher"}`, "201 created"},
+		{http.MethodGet, "http://api.example.com/avatar", "", "200 \xff\xfe binary"},
+	} {
+		if got := vcrDo(t, m, next, step.method, step.url, step.body); got != step.outcome {
+			t.Errorf("recording %s %s: %q, want %q", step.method, step.url, got, step.outcome)
+		}
+	}
+
+	// A later run replays without sending anything.
+	offline := newStub(reply{err: errors.New("offline")})
+	m = newVCR(t, middleware.VCRConfig{Path: path})
+	tests := []struct {
+		name, method, url, body, outcome string
+	}{
+		{"recorded order", http.MethodGet, "http://api.example.com/users", "", "200 first"},
+		{"next recording", http.MethodGet, "http://api.example.com/users", "", "200 second"},
+		{"last recording again", http.MethodGet, "http://api.example.com/users", "", "200 second"},
+		{"body", http.MethodPost, "http://api.example.com/users", `{"name":"gopher"}`, "201 created"},
+		{"binary body", http.MethodGet, "http://api.example.com/avatar", "", "200 \xff\xfe binary"},
+		{"other body", http.MethodPost, "http://api.example.com/users", `{"name":"other"}`, "error: vcr: no recorded interaction matches the request: POST http://api.example.com/users"},
+		{"other method", http.MethodDelete, "http://api.example.com/users", "", "error: vcr: no recorded interaction matches the request: DELETE http://api.example.com/users"},
+		{"other URL", http.MethodGet, "http://api.example.com/users?page=2", "", "error: vcr: no recorded interaction matches the request: GET http://api.example.com/users?page=2"},
+	}
+	for _, tt := range tests {
+		if got := vcrDo(t, m, offline, tt.method, tt.url, tt.body); got != tt.outcome {
+			t.Errorf("%s: %q, want %q", tt.name, got, tt.outcome)
+		}
+	}
+	if offline.calls() != 0 {
+		t.Errorf("replay sent %d requests", offline.calls())
+	}
+
+	// Looser rules match requests the default one does not.
+	m = newVCR(t, middleware.VCRConfig{Path: path, Match: middleware.MatchMethod | middleware.MatchURL})
+	if got := vcrDo(t, m, offline, http.MethodPost, "http://api.example.com/users", `{"name":"other"}`); got != "201 created" {
+		t.Errorf("matching method and URL: %q, want 201 created", got)
+	}
+}
+
+// recordedInteraction mirrors the cassette form of an interaction.
+type recordedInteraction struct {
+	Request struct {
+		Method string      `json:"method"`
+		URL    string      `json:"url"`
+		Header http.Header `json:"header"`
+	} `json:"request"`
+	Response struct {
+		StatusCode int         `json:"status_code"`
+		Header     http.Header `json:"header"`
+		Body       string      `json:"body"`
+	} `json:"response"`
+}
+
+// readCassette decodes the interactions of the cassette at path.
+func readCassette(t *testing.T, path string) []recordedInteraction {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var c struct {
+		Interactions []recordedInteraction `json:"interactions"`
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		t.Fatal(err)
+	}
+	return c.Interactions
+}
+
+func TestVCRMiddlewareScrubbing(t *testing.T) {
+	cfg := middleware.VCRConfig{
+		ScrubHeaders:     []string{"X-Tenant-Token"},
+		ScrubQueryParams: []string{"sig"},
+		ScrubJSONFields:  []string{"api_secret"},
+	}
+	tests := []struct {
+		name       string
+		url        string
+		header     http.Header
+		reply      reply
+		wantURL    string
+		wantHeader http.Header
+		wantReply  http.Header
+		wantBody   string
+	}{
+		{
+			name:       "default headers",
+			url:        "http://api.example.com/users",
+			header:     http.Header{"Authorization": {"Bearer secret"}, "X-Api-Key": {"key"}, "Cookie": {"session=1"}, "Accept": {"application/json"}},
+			reply:      reply{status: 200, header: http.Header{"Set-Cookie": {"session=2"}, "Content-Type": {"text/plain"}}, body: "ok"},
+			wantURL:    "http://api.example.com/users",
+			wantHeader: http.Header{"Authorization": {"[REDACTED]"}, "X-Api-Key": {"[REDACTED]"}, "Cookie": {"[REDACTED]"}, "Accept": {"application/json"}},
+			wantReply:  http.Header{"Set-Cookie": {"[REDACTED]"}, "Content-Type": {"text/plain"}},
+			wantBody:   "ok",
+		},
+		{
+			name:       "extra headers",
+			url:        "http://api.example.com/users",
+			header:     http.Header{"X-Tenant-Token": {"one", "two"}, "X-Tenant": {"acme"}},
+			reply:      reply{status: 200, body: "ok"},
+			wantURL:    "http://api.example.com/users",
+			wantHeader: http.Header{"X-Tenant-Token": {"[REDACTED]"}, "X-Tenant": {"acme"}},
+			wantBody:   "ok",
+		},
+		{
+			name:     "query parameters",
+			url:      "http://api.example.com/users?page=2&ACCESS_TOKEN=secret&sig=abc&sig=def",
+			reply:    reply{status: 200, body: "ok"},
+			wantURL:  "http://api.example.com/users?ACCESS_TOKEN=%5BREDACTED%5D&page=2&sig=%5BREDACTED%5D&sig=%5BREDACTED%5D",
+			wantBody: "ok",
+		},
+		{
+			name:     "query without secrets",
+			url:      "http://api.example.com/users?z=1&a=2",
+			reply:    reply{status: 200, body: "ok"},
+			wantURL:  "http://api.example.com/users?z=1&a=2",
+			wantBody: "ok",
+		},
+		{
+			name:     "JSON fields",
+			url:      "http://api.example.com/token",
+			reply:    reply{status: 200, body: `{"access_token":"a","user":{"Password":"p","name":"gopher"},"items":[{"refresh_token":"r"},[{"api_secret":"s"}]],"expires_in":3600.0}`},
+			wantURL:  "http://api.example.com/token",
+			wantBody: `{"access_token":"[REDACTED]","expires_in":3600.0,"items":[{"refresh_token":"[REDACTED]"},[{"api_secret":"[REDACTED]"}]],"user":{"Password":"[REDACTED]","name":"gopher"}}`,
+		},
+		{
+			name:     "JSON secret object",
+			url:      "http://api.example.com/token",
+			reply:    reply{status: 200, body: `{"client_secret":{"value":"s"}}`},
+			wantURL:  "http://api.example.com/token",
+			wantBody: `{"client_secret":"[REDACTED]"}`,
+		},
+		{
+			name:     "JSON without secrets",
+			url:      "http://api.example.com/users",
+			reply:    reply{status: 200, body: `{ "name": "gopher",  "id": 1 }`},
+			wantURL:  "http://api.example.com/users",
+			wantBody: `{ "name": "gopher",  "id": 1 }`,
+		},
+		{
+			name:     "form body",
+			url:      "http://api.example.com/token",
+			reply:    reply{status: 200, body: "access_token=secret&token_type=bearer"},
+			wantURL:  "http://api.example.com/token",
+			wantBody: "access_token=secret&token_type=bearer",
+		},
+		{
+			name:     "JSON stream",
+			url:      "http://api.example.com/events",
+			reply:    reply{status: 200, body: `{"password":"a"} {"password":"b"}`},
+			wantURL:  "http://api.example.com/events",
+			wantBody: `{"password":"a"} {"password":"b"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "cassette.json")
+			cfg := cfg
+			cfg.Path = path
+			req := newRequest(t, http.MethodGet, tt.url, nil)
+			req.Header = tt.header.Clone()
+			resp, err := newVCR(t, cfg)(newStub(tt.reply)).Do(req)
+			if got := outcome(resp, err); got != "200 "+tt.reply.body {
+				t.Errorf("recording returned %q, want the real response", got)
+			}
+
+			recorded := readCassette(t, path)
+			if len(recorded) != 1 {
+				t.Fatalf("cassette has %d interactions, want 1", len(recorded))
+			}
+			in := recorded[0]
+			if in.Request.URL != tt.wantURL {
+				t.Errorf("recorded URL = %s, want %s", in.Request.URL, tt.wantURL)
+			}
+			if !reflect.DeepEqual(in.Request.Header, tt.wantHeader) {
+				t.Errorf("recorded request header = %v, want %v", in.Request.Header, tt.wantHeader)
+			}
+			if !reflect.DeepEqual(in.Response.Header, tt.wantReply) {
+				t.Errorf("recorded response header = %v, want %v", in.Response.Header, tt.wantReply)
+			}
+			if in.Response.Body != tt.wantBody {
+				t.Errorf("recorded body = %s, want %s", in.Response.Body, tt.wantBody)
+			}
+
+			// Replays answer from the redacted recording, whatever the
+			// secrets of the request.
+			offline := newStub(reply{err: errors.New("offline")})
+			got := vcrDo(t, newVCR(t, cfg), offline, http.MethodGet, strings.ReplaceAll(tt.url, "secret", "rotated"), "")
+			if want := "200 " + tt.wantBody; got != want {
+				t.Errorf("replay = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestVCRMiddlewareModes(t *testing.T) {
+	const recorded = `{"interactions": [{"request": {"method": "GET", "url": "http://api.example.com/a"}, "response": {"status_code": 200, "body": "old"}}]}`
+	noMatch := "error: vcr: no recorded interaction matches the request: GET http://api.example.com/b"
+	tests := []struct {
+		name     string
+		mode     middleware.RecordMode
+		existing bool
+		outcomes []string // of GET /a then GET /b
+		sent     int
+		cassette []string
+	}{
+		{"once replays", middleware.RecordOnce, true, []string{"200 old", noMatch}, 0, []string{"/a old"}},
+		{"once records", middleware.RecordOnce, false, []string{"200 new", "200 new"}, 2, []string{"/a new", "/b new"}},
+		{"new episodes", middleware.RecordNewEpisodes, true, []string{"200 old", "200 new"}, 1, []string{"/a old", "/b new"}},
+		{"new episodes without cassette", middleware.RecordNewEpisodes, false, []string{"200 new", "200 new"}, 2, []string{"/a new", "/b new"}},
+		{"all", middleware.RecordAll, true, []string{"200 new", "200 new"}, 2, []string{"/a new", "/b new"}},
+		{"none", middleware.RecordNone, true, []string{"200 old", noMatch}, 0, []string{"/a old"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "cassette.json")
+			if tt.existing {
+				if err := os.WriteFile(path, []byte(recorded), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			next := newStub(reply{status: 200, body: "new"})
+			m := newVCR(t, middleware.VCRConfig{Path: path, Mode: tt.mode})
+			for i, p := range []string{"/a", "/b"} {
+				if got := vcrDo(t, m, next, http.MethodGet, "http://api.example.com"+p, ""); got != tt.outcomes[i] {
+					t.Errorf("GET %s = %q, want %q", p, got, tt.outcomes[i])
+				}
+			}
+			if next.calls() != tt.sent {
+				t.Errorf("sent %d requests, want %d", next.calls(), tt.sent)
+			}
+
+			var cassette []string
+			for _, in := range readCassette(t, path) {
+				cassette = append(cassette, strings.TrimPrefix(in.Request.URL, "http://api.example.com")+" "+in.Response.Body)
+			}
+			if !slices.Equal(cassette, tt.cassette) {
+				t.Errorf("cassette = %q, want %q", cassette, tt.cassette)
+			}
+		})
+	}
+}
+
+func TestVCRMiddlewareRecordNoneWithoutCassette(t *testing.T) {
+	_, err := middleware.VCRMiddleware(middleware.VCRConfig{
+		Path: filepath.Join(t.TempDir(), "missing.json"),
+		Mode: middleware.RecordNone,
+	})
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("err = %v, want %v", err, os.ErrNotExist)
+	}
+}
@@ -0,0 +1,73 @@
+// Package mock forwards to package clienttest, where the mock client, its
+// matchers and the golden file fixtures now live along with the request
+// assertions and cassettes.
+//
+// Deprecated: Use package clienttest.
+package mock
+
+import (
+	"net/http"
+
+	"github.com/Vkanhan/go-auth-middleware-http-client/clienttest"
+)
+
+// ErrUnexpectedRequest is returned by Do for requests no expectation matches.
+var ErrUnexpectedRequest = clienttest.ErrUnexpectedRequest
+
+// MockClient is a clienttest.MockClient.
+type MockClient = clienttest.MockClient
+
+// Expectation is a clienttest.Expectation.
+type Expectation = clienttest.Expectation
+
+// Matcher is a clienttest.Matcher.
+type Matcher = clienttest.Matcher
+
+// Client is a clienttest.Client.
+type Client = clienttest.Client
+
+// Fixtures is a clienttest.Fixtures.
+type Fixtures = clienttest.Fixtures
+
+// NewMockClient creates a MockClient whose expectations may be met in any
+// order.
+func NewMockClient() *MockClient {
+	return clienttest.NewMockClient()
+}
+
+// Exactly matches the string s.
+func Exactly(s string) Matcher {
+	return clienttest.Exactly(s)
+}
+
+// Prefix matches strings starting with prefix.
+func Prefix(prefix string) Matcher {
+	return clienttest.Prefix(prefix)
+}
+
+// Contains matches strings containing substr.
+func Contains(substr string) Matcher {
+	return clienttest.Contains(substr)
+}
+
+// Regexp matches strings matching the regular expression expr. It panics if
+// expr does not compile.
+func Regexp(expr string) Matcher {
+	return clienttest.Regexp(expr)
+}
+
+// Any matches every string.
+func Any() Matcher {
+	return clienttest.Any()
+}
+
+// NewFixtures creates Fixtures reading from dir.
+func NewFixtures(dir string) *Fixtures {
+	return clienttest.NewFixtures(dir)
+}
+
+// FixtureName names the file of a request after its method, host, path and
+// query.
+func FixtureName(req *http.Request) string {
+	return clienttest.FixtureName(req)
+}